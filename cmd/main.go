@@ -1,14 +1,25 @@
 package main
 
 import (
+	"context"
 	"database/sql"
-	"fmt"
+	"flag"
+	"forum/internal/chat"
+	"forum/internal/config"
 	dbinit "forum/internal/db"
+	"forum/internal/digest"
 	"forum/internal/handlers"
+	"forum/internal/live"
+	"forum/internal/mail"
+	"forum/internal/media"
+	"forum/internal/reputation"
+	"forum/internal/spam"
 	"html/template"
 	"log"
 	"net/http"
+	"os"
 	"path/filepath"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 )
@@ -21,6 +32,15 @@ var (
 func main() {
 	var err error
 
+	cfg, err := config.Load(config.Path())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := handlers.ConfigureReactions(cfg.Reactions); err != nil {
+		log.Fatal("Ошибка настройки реакций: ", err)
+	}
+	reputationRules := handlers.ConfigureReputation(cfg.Reputation)
+
 	db, err = sql.Open("sqlite3", "./forum.db")
 	if err != nil {
 		log.Fatal(err)
@@ -30,25 +50,22 @@ func main() {
 	if err = dbinit.InitDatabase(db); err != nil {
 		log.Fatal("Ошибка при инициализации схемы:", err)
 	}
+	// После обновления форума репутацию один раз собираем по старым реакциям
+	if stale, err := reputation.Stale(db); err != nil {
+		log.Fatal("Ошибка проверки репутации: ", err)
+	} else if stale {
+		if _, err := reputation.Recalculate(db, reputationRules, time.Now()); err != nil {
+			log.Fatal("Ошибка расчёта репутации: ", err)
+		}
+	}
 
-	templates = template.New("").Funcs(template.FuncMap{
-		"inSlice": func(slice []string, val string) bool {
-			for _, s := range slice {
-				if s == val {
-					return true
-				}
-			}
-			return false
-		},
-		"contains": func(m map[string][]string, key string, val interface{}) bool {
-			for _, v := range m[key] {
-				if fmt.Sprint(v) == fmt.Sprint(val) {
-					return true
-				}
-			}
-			return false
-		},
-	})
+	// Служебные команды: forum set-role <email> <user|moderator|admin>
+	if len(os.Args) > 1 {
+		runCommand(os.Args[1:], reputationRules)
+		return
+	}
+
+	templates = template.New("").Funcs(handlers.TemplateFuncs())
 
 	templates, err = templates.ParseGlob(filepath.Join("templates", "*.html"))
 	if err != nil {
@@ -60,34 +77,166 @@ func main() {
 	}
 
 	errHandler := &handlers.ErrorHandler{Templates: templates}
+	notifier := &handlers.Notifier{DB: db}
+	// Последние 1024 события хранятся для повтора после переподключения
+	hub := live.NewHub(1024, 64)
+
+	spamFilter, err := spam.NewChain(db, cfg.Spam)
+	if err != nil {
+		log.Fatal("Ошибка настройки фильтров спама: ", err)
+	}
 
 	commentHandler := handlers.CommentHandler{
 		DB:        db,
 		Templates: templates,
 		Err:       errHandler,
+		Notify:    notifier,
+		Live:      hub,
+		Spam:      spamFilter,
 	}
 
 	likeHandler := handlers.LikeHandler{
+		DB:     db,
+		Err:    errHandler,
+		Notify: notifier,
+		Live:   hub,
+	}
+
+	reactionsHandler := handlers.ReactionsHandler{
+		DB:        db,
+		Templates: templates,
+		Err:       errHandler,
+	}
+
+	bookmarkHandler := handlers.BookmarkHandler{
+		DB:        db,
+		Templates: templates,
+		Err:       errHandler,
+	}
+
+	liveHandler := handlers.LiveHandler{
 		DB:  db,
+		Hub: hub,
 		Err: errHandler,
 	}
 
+	chatHub := chat.NewHub(db)
+	chatHub.MaxLength = cfg.Chat.MaxLength
+	chatHub.Scrollback = cfg.Chat.Scrollback
+	chatHandler := handlers.ChatHandler{
+		DB:        db,
+		Templates: templates,
+		Err:       errHandler,
+		Hub:       chatHub,
+		Limit:     cfg.Chat.Messages,
+	}
+
+	messageHandler := handlers.MessageHandler{
+		DB:         db,
+		Templates:  templates,
+		Err:        errHandler,
+		Live:       hub,
+		MaxLength:  cfg.Messages.MaxLength,
+		MaxMembers: cfg.Messages.MaxMembers,
+	}
+
+	notificationHandler := handlers.NotificationHandler{
+		DB:        db,
+		Templates: templates,
+		Err:       errHandler,
+		Secret:    []byte(cfg.Mail.Secret),
+	}
+
+	if cfg.Mail.Enabled {
+		startDigests(cfg.Mail)
+	}
+
 	filterHandler := handlers.FilterHandler{
 		DB:        db,
 		Templates: templates,
 		Err:       errHandler,
+		Live:      hub,
+	}
+
+	store, err := media.NewDiskStore(cfg.Uploads.Dir)
+	if err != nil {
+		log.Fatal(err)
 	}
 
 	postHandler := handlers.PostHandler{
 		DB:        db,
 		Templates: templates,
 		Err:       errHandler,
+		Store:     store,
+		Limits: media.Limits{
+			MaxBytes:  cfg.Uploads.MaxFileSize,
+			MaxWidth:  cfg.Uploads.MaxWidth,
+			MaxHeight: cfg.Uploads.MaxHeight,
+			MaxPixels: cfg.Uploads.MaxPixels,
+			ThumbSize: cfg.Uploads.ThumbSize,
+		},
+		MaxFiles: cfg.Uploads.MaxFiles,
+		Notify:   notifier,
+		Live:     hub,
+		Spam:     spamFilter,
 	}
 
+	// Запланированные посты выходят с точностью до минуты, как и поле формы
+	go postHandler.RunScheduler(context.Background(), 30*time.Second)
+
+	tagHandler := handlers.TagHandler{
+		DB:  db,
+		Err: errHandler,
+	}
+
+	userHandler := handlers.UserHandler{
+		DB:        db,
+		Templates: templates,
+		Err:       errHandler,
+	}
+
+	pollHandler := handlers.PollHandler{
+		DB:  db,
+		Err: errHandler,
+	}
+
+	mediaHandler := handlers.MediaHandler{
+		Store: store,
+		Err:   errHandler,
+	}
+
+	loginGuard := handlers.NewLoginGuard(db)
+
 	authHandler := handlers.AuthHandler{
 		DB:        db,
 		Templates: templates,
 		Err:       errHandler,
+		Guard:     loginGuard,
+	}
+
+	adminHandler := handlers.AdminHandler{
+		DB:        db,
+		Templates: templates,
+		Err:       errHandler,
+		Guard:     loginGuard,
+		Posts:     &postHandler,
+		Comments:  &commentHandler,
+	}
+
+	// Обсуждения без комментариев уходят в архив; 0 в настройках отключает
+	if days := cfg.Moderation.ArchiveAfterDays; days > 0 {
+		archiver := &handlers.Archiver{DB: db, After: time.Duration(days) * 24 * time.Hour}
+		go archiver.Run(context.Background(), time.Hour)
+	}
+
+	csrf := handlers.NewCSRF(nil, errHandler)
+	limiter := handlers.NewRateLimiter(db, cfg.RateLimits, errHandler)
+	security := handlers.NewSecurityHeaders(cfg.Security)
+	bodyLimiter := &handlers.BodyLimiter{
+		// Форма поста несёт вложения, остальным формам хватает мегабайта
+		Limits:  map[string]int64{"/create": int64(cfg.Uploads.MaxFiles)*cfg.Uploads.MaxFileSize + 1<<20},
+		Default: 1 << 20,
+		Err:     errHandler,
 	}
 
 	mux := http.NewServeMux()
@@ -100,9 +249,50 @@ func main() {
 	mux.HandleFunc("/login", authHandler.Login)
 	mux.HandleFunc("/logout", authHandler.Logout)
 	mux.HandleFunc("/create", postHandler.CreatePost)
+	mux.HandleFunc("/preview", postHandler.Preview)
+	mux.HandleFunc("/drafts", postHandler.Drafts)
+	mux.HandleFunc("/drafts/autosave", postHandler.Autosave)
+	mux.HandleFunc("/drafts/delete", postHandler.DeleteDraft)
 	mux.HandleFunc("/post/comment", commentHandler.AddComment)
+	mux.HandleFunc("/post/moderate", adminHandler.ModeratePost)
 	mux.HandleFunc("/like", likeHandler.Like)
+	mux.HandleFunc("/reactions", reactionsHandler.List)
+	mux.HandleFunc("/bookmark", bookmarkHandler.Bookmark)
+	mux.HandleFunc("/saved", filterHandler.SavedPage)
+	mux.HandleFunc("/saved/folder", bookmarkHandler.Folder)
 	mux.HandleFunc("/post/", postHandler.GetPost)
+	mux.HandleFunc("/media/", mediaHandler.Serve)
+	mux.HandleFunc("/poll/vote", pollHandler.Vote)
+	mux.HandleFunc("/poll/results", pollHandler.Results)
+	mux.HandleFunc("/admin/lockouts", adminHandler.Lockouts)
+	mux.HandleFunc("/admin/unlock", adminHandler.Unlock)
+	mux.HandleFunc("/admin/tags", adminHandler.Tags)
+	mux.HandleFunc("/admin/tags/merge", adminHandler.MergeTags)
+	mux.HandleFunc("/admin/tags/ban", adminHandler.BanTag)
+	mux.HandleFunc("/admin/log", adminHandler.ModerationLog)
+	mux.HandleFunc("/admin/spam", adminHandler.SpamQueue)
+	mux.HandleFunc("/tag/", filterHandler.TagPage)
+	mux.HandleFunc("/c/", filterHandler.CategoryPage)
+	mux.HandleFunc("/tags/suggest", tagHandler.Suggest)
+	mux.HandleFunc("/u/", filterHandler.UserPage)
+	mux.HandleFunc("/users/suggest", userHandler.Suggest)
+	mux.HandleFunc("/settings/blocks", userHandler.Blocks)
+	mux.HandleFunc("/notifications", notificationHandler.List)
+	mux.HandleFunc("/notifications/read", notificationHandler.MarkRead)
+	mux.HandleFunc("/notifications/digest", notificationHandler.SetDigest)
+	mux.HandleFunc("/unsubscribe", notificationHandler.Unsubscribe)
+	mux.HandleFunc("/follow", notificationHandler.Follow)
+	mux.HandleFunc("/events/feed", liveHandler.Feed)
+	mux.HandleFunc("/events/post/", liveHandler.Post)
+	mux.HandleFunc("/events/messages", liveHandler.Messages)
+	mux.HandleFunc("/messages", messageHandler.Inbox)
+	mux.HandleFunc("/messages/", messageHandler.Conversation)
+	mux.HandleFunc("/messages/new", messageHandler.New)
+	mux.HandleFunc("/messages/send", messageHandler.Send)
+	mux.HandleFunc("/messages/read", messageHandler.Read)
+	mux.HandleFunc("/messages/leave", messageHandler.Leave)
+	mux.HandleFunc("/chat/", chatHandler.Room)
+	mux.HandleFunc("/ws/chat/", chatHandler.Socket)
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.Path != "/" {
 			errHandler.NotFound(w, r)
@@ -111,9 +301,92 @@ func main() {
 		filterHandler.FilteredPosts(w, r)
 	})
 
-	wrappedMux := errHandler.RecoveryMiddleware(mux)
-	log.Println("Сервер запущен на http://localhost:8080")
-	if err := http.ListenAndServe(":8080", wrappedMux); err != nil {
+	wrappedMux := errHandler.RecoveryMiddleware(security.Middleware(bodyLimiter.Middleware(csrf.Middleware(limiter.Middleware(notifier.Middleware(mux))))))
+	if err := serve(cfg, wrappedMux); err != nil {
 		log.Fatal("Ошибка запуска сервера:", err)
 	}
 }
+
+// startDigests запускает фоновую рассылку дайджестов
+func startDigests(cfg config.Mail) {
+	if cfg.Secret == "" {
+		log.Fatal("Для рассылки дайджестов задайте mail.secret")
+	}
+
+	var transport mail.Transport
+	switch cfg.Transport {
+	case "file":
+		drop, err := mail.NewFileDrop(cfg.Dir, cfg.From)
+		if err != nil {
+			log.Fatal(err)
+		}
+		transport = drop
+	case "smtp":
+		transport = &mail.SMTP{
+			Addr:     cfg.SMTP.Addr,
+			Username: cfg.SMTP.Username,
+			Password: cfg.SMTP.Password,
+			From:     cfg.From,
+		}
+	default:
+		log.Fatal("Неизвестный почтовый транспорт: ", cfg.Transport)
+	}
+
+	html, text, err := digest.LoadTemplates(filepath.Join("templates", "email"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	scheduler := &digest.Scheduler{
+		DB:      db,
+		Mail:    transport,
+		HTML:    html,
+		Text:    text,
+		BaseURL: cfg.BaseURL,
+		Secret:  []byte(cfg.Secret),
+	}
+	go scheduler.Run(context.Background(), time.Duration(cfg.CheckIntervalMinutes)*time.Minute)
+	log.Printf("Рассылка дайджестов включена (%s)", cfg.Transport)
+}
+
+func runCommand(args []string, reputationRules reputation.Rules) {
+	switch args[0] {
+	case "set-role":
+		if len(args) != 3 {
+			log.Fatal("Использование: forum set-role <email> <user|moderator|admin>")
+		}
+		if err := dbinit.SetUserRole(db, args[1], args[2]); err != nil {
+			log.Fatal("Ошибка назначения роли: ", err)
+		}
+		log.Printf("Пользователю %s назначена роль %s", args[1], args[2])
+	case "add-category":
+		fs := flag.NewFlagSet("add-category", flag.ExitOnError)
+		slug := fs.String("slug", "", "адрес категории (/c/<slug>), по умолчанию из названия")
+		parent := fs.String("parent", "", "адрес родительской категории")
+		description := fs.String("description", "", "описание категории")
+		fs.Parse(args[1:])
+		if fs.NArg() != 1 {
+			log.Fatal("Использование: forum add-category [-slug адрес] [-parent адрес] [-description текст] <название>")
+		}
+		created, err := dbinit.AddCategory(db, fs.Arg(0), *slug, *parent, *description)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("Категория %s создана: /c/%s", fs.Arg(0), created)
+	case "recount":
+		// Счётчики реакций и комментариев собираются заново из исходных таблиц
+		result, err := dbinit.Recount(db)
+		if err != nil {
+			log.Fatal("Ошибка пересчёта: ", err)
+		}
+		log.Printf("Исправлены счётчики: постов — %d, комментариев — %d", result.Posts, result.Comments)
+	case "reputation":
+		// Нужен после смены очков или затухания в настройках
+		changed, err := reputation.Recalculate(db, reputationRules, time.Now())
+		if err != nil {
+			log.Fatal("Ошибка пересчёта репутации: ", err)
+		}
+		log.Printf("Репутация пересчитана, изменилась у %d пользователей", changed)
+	default:
+		log.Fatal("Неизвестная команда: ", args[0])
+	}
+}
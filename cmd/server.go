@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"forum/internal/certs"
+	"forum/internal/config"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// serve запускает HTTP-сервер, а при включённом TLS — HTTPS-сервер и
+// HTTP-слушатель для перенаправления и ACME-проверок.
+func serve(cfg config.Config, handler http.Handler) error {
+	if !cfg.TLS.Enabled {
+		log.Printf("Сервер запущен на http://localhost%s", cfg.Addr)
+		return http.ListenAndServe(cfg.Addr, handler)
+	}
+
+	ctx := context.Background()
+	httpHandler := handler
+	if cfg.TLS.RedirectHTTP {
+		httpHandler = certs.RedirectHandler(cfg.TLS.Addr)
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if cfg.TLS.ACME.Enabled {
+		solver := certs.NewHTTP01Solver()
+		manager, err := certs.NewACMEManager(cfg.TLS.ACME.DirectoryURL, cfg.TLS.ACME.Email,
+			cfg.TLS.ACME.Domains, cfg.TLS.ACME.CacheDir, solver)
+		if err != nil {
+			return err
+		}
+		tlsConfig.GetCertificate = manager.GetCertificate
+		httpHandler = solver.Handler(httpHandler)
+		go manager.Run(ctx, 12*time.Hour)
+	} else {
+		reloader, err := certs.NewReloader(cfg.TLS.CertFile, cfg.TLS.KeyFile)
+		if err != nil {
+			return err
+		}
+		tlsConfig.GetCertificate = reloader.GetCertificate
+
+		// kill -HUP <pid> перечитывает сертификат без перезапуска
+		sighup := make(chan os.Signal, 1)
+		signal.Notify(sighup, syscall.SIGHUP)
+		interval := time.Duration(cfg.TLS.ReloadIntervalSeconds) * time.Second
+		if interval <= 0 {
+			interval = time.Minute
+		}
+		go reloader.Watch(ctx, interval, sighup)
+	}
+
+	errs := make(chan error, 2)
+	go func() {
+		log.Printf("HTTP-слушатель на %s", cfg.Addr)
+		errs <- http.ListenAndServe(cfg.Addr, httpHandler)
+	}()
+	go func() {
+		server := &http.Server{Addr: cfg.TLS.Addr, Handler: handler, TLSConfig: tlsConfig}
+		log.Printf("Сервер запущен на https://localhost%s", cfg.TLS.Addr)
+		errs <- server.ListenAndServeTLS("", "")
+	}()
+
+	err := <-errs
+	if err == nil {
+		err = errors.New("сервер остановлен")
+	}
+	return err
+}
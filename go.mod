@@ -3,7 +3,16 @@ module forum
 go 1.23.2
 
 require (
-	github.com/google/uuid v1.6.0 
-	github.com/mattn/go-sqlite3 v1.14.28 
-	golang.org/x/crypto v0.38.0 
+	github.com/coder/websocket v1.8.15
+	github.com/google/uuid v1.6.0
+	github.com/mattn/go-sqlite3 v1.14.28
+	github.com/microcosm-cc/bluemonday v1.0.27
+	github.com/yuin/goldmark v1.7.13
+	golang.org/x/crypto v0.38.0
+	golang.org/x/net v0.26.0
+)
+
+require (
+	github.com/aymerick/douceur v0.2.0 // indirect
+	github.com/gorilla/css v1.0.1 // indirect
 )
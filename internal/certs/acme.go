@@ -0,0 +1,330 @@
+package certs
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/acme"
+)
+
+// ChallengeSolver выполняет проверку владения доменом одного типа
+// (http-01, dns-01 и т.п.). Present публикует ответ, CleanUp убирает его.
+type ChallengeSolver interface {
+	Type() string
+	Present(ctx context.Context, domain, token, keyAuth string) error
+	CleanUp(ctx context.Context, domain, token string) error
+}
+
+// HTTP01Solver отвечает на http-01 по пути /.well-known/acme-challenge/<token>.
+// Его нужно подключить к HTTP-слушателю на 80 порту.
+type HTTP01Solver struct {
+	mu     sync.RWMutex
+	tokens map[string]string
+}
+
+func NewHTTP01Solver() *HTTP01Solver {
+	return &HTTP01Solver{tokens: make(map[string]string)}
+}
+
+func (s *HTTP01Solver) Type() string { return "http-01" }
+
+func (s *HTTP01Solver) Present(_ context.Context, _, token, keyAuth string) error {
+	s.mu.Lock()
+	s.tokens[token] = keyAuth
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *HTTP01Solver) CleanUp(_ context.Context, _, token string) error {
+	s.mu.Lock()
+	delete(s.tokens, token)
+	s.mu.Unlock()
+	return nil
+}
+
+const challengePrefix = "/.well-known/acme-challenge/"
+
+// Handler отвечает на запросы проверки, остальные передаёт в next
+func (s *HTTP01Solver) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, challengePrefix) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		s.mu.RLock()
+		keyAuth, ok := s.tokens[strings.TrimPrefix(r.URL.Path, challengePrefix)]
+		s.mu.RUnlock()
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(keyAuth))
+	})
+}
+
+// ACMEManager получает и продлевает сертификат через ACME-совместимый
+// центр сертификации. Ключ аккаунта и сертификат хранятся в CacheDir.
+type ACMEManager struct {
+	Client      *acme.Client
+	Email       string
+	Domains     []string
+	Solver      ChallengeSolver
+	CacheDir    string
+	RenewBefore time.Duration
+	// RetryDelay — первая пауза перед повтором неудачной попытки; дальше
+	// она удваивается, но не превышает обычного интервала проверки
+	RetryDelay time.Duration
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+}
+
+func NewACMEManager(directoryURL, email string, domains []string, cacheDir string, solver ChallengeSolver) (*ACMEManager, error) {
+	if len(domains) == 0 {
+		return nil, errors.New("acme: не указаны домены")
+	}
+	if err := os.MkdirAll(cacheDir, 0700); err != nil {
+		return nil, err
+	}
+	key, err := loadOrCreateKey(filepath.Join(cacheDir, "account.key"))
+	if err != nil {
+		return nil, err
+	}
+
+	m := &ACMEManager{
+		Client:      &acme.Client{Key: key, DirectoryURL: directoryURL},
+		Email:       email,
+		Domains:     domains,
+		Solver:      solver,
+		CacheDir:    cacheDir,
+		RenewBefore: 30 * 24 * time.Hour,
+		RetryDelay:  2 * time.Minute,
+	}
+	if err := m.loadCached(); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Println("Сохранённый ACME-сертификат не загружен:", err)
+	}
+	return m, nil
+}
+
+func (m *ACMEManager) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.cert == nil {
+		return nil, errors.New("acme: сертификат ещё не получен")
+	}
+	return m.cert, nil
+}
+
+// NeedsRenewal сообщает, что сертификата нет или он скоро истечёт
+func (m *ACMEManager) NeedsRenewal(now time.Time) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.cert == nil || m.cert.Leaf == nil {
+		return true
+	}
+	return now.Add(m.RenewBefore).After(m.cert.Leaf.NotAfter)
+}
+
+// Obtain проходит полный цикл заказа сертификата и сохраняет результат
+func (m *ACMEManager) Obtain(ctx context.Context) error {
+	account := &acme.Account{}
+	if m.Email != "" {
+		account.Contact = []string{"mailto:" + m.Email}
+	}
+	if _, err := m.Client.Register(ctx, account, acme.AcceptTOS); err != nil && err != acme.ErrAccountAlreadyExists {
+		return fmt.Errorf("acme: регистрация аккаунта: %w", err)
+	}
+
+	order, err := m.Client.AuthorizeOrder(ctx, acme.DomainIDs(m.Domains...))
+	if err != nil {
+		return fmt.Errorf("acme: создание заказа: %w", err)
+	}
+
+	for _, authzURL := range order.AuthzURLs {
+		if err := m.authorize(ctx, authzURL); err != nil {
+			return err
+		}
+	}
+
+	order, err = m.Client.WaitOrder(ctx, order.URI)
+	if err != nil {
+		return fmt.Errorf("acme: ожидание заказа: %w", err)
+	}
+
+	certKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		DNSNames: m.Domains,
+	}, certKey)
+	if err != nil {
+		return err
+	}
+	chain, _, err := m.Client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		return fmt.Errorf("acme: выпуск сертификата: %w", err)
+	}
+
+	var certPEM []byte
+	for _, der := range chain {
+		certPEM = append(certPEM, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(certKey)
+	if err != nil {
+		return err
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+
+	if err := os.WriteFile(filepath.Join(m.CacheDir, "cert.pem"), certPEM, 0600); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(m.CacheDir, "key.pem"), keyPEM, 0600); err != nil {
+		return err
+	}
+	return m.loadCached()
+}
+
+func (m *ACMEManager) authorize(ctx context.Context, authzURL string) error {
+	authz, err := m.Client.GetAuthorization(ctx, authzURL)
+	if err != nil {
+		return fmt.Errorf("acme: получение авторизации: %w", err)
+	}
+	if authz.Status == acme.StatusValid {
+		return nil
+	}
+
+	var chal *acme.Challenge
+	for _, c := range authz.Challenges {
+		if c.Type == m.Solver.Type() {
+			chal = c
+			break
+		}
+	}
+	if chal == nil {
+		return fmt.Errorf("acme: сервер не предлагает проверку %s для %s", m.Solver.Type(), authz.Identifier.Value)
+	}
+
+	var keyAuth string
+	switch chal.Type {
+	case "http-01":
+		keyAuth, err = m.Client.HTTP01ChallengeResponse(chal.Token)
+	case "dns-01":
+		keyAuth, err = m.Client.DNS01ChallengeRecord(chal.Token)
+	default:
+		return fmt.Errorf("acme: тип проверки %s не поддерживается", chal.Type)
+	}
+	if err != nil {
+		return err
+	}
+
+	domain := authz.Identifier.Value
+	if err := m.Solver.Present(ctx, domain, chal.Token, keyAuth); err != nil {
+		return fmt.Errorf("acme: публикация ответа для %s: %w", domain, err)
+	}
+	defer m.Solver.CleanUp(ctx, domain, chal.Token)
+
+	if _, err := m.Client.Accept(ctx, chal); err != nil {
+		return fmt.Errorf("acme: запуск проверки %s: %w", domain, err)
+	}
+	if _, err := m.Client.WaitAuthorization(ctx, authz.URI); err != nil {
+		return fmt.Errorf("acme: проверка %s не пройдена: %w", domain, err)
+	}
+	return nil
+}
+
+func (m *ACMEManager) loadCached() error {
+	cert, err := tls.LoadX509KeyPair(filepath.Join(m.CacheDir, "cert.pem"), filepath.Join(m.CacheDir, "key.pem"))
+	if err != nil {
+		return err
+	}
+	if cert.Leaf == nil {
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			return err
+		}
+		cert.Leaf = leaf
+	}
+	m.mu.Lock()
+	m.cert = &cert
+	m.mu.Unlock()
+	return nil
+}
+
+// Run получает сертификат, если его нет, и продлевает его заранее.
+// Проверка выполняется раз в interval, пока не отменён ctx. После неудачи
+// попытка повторяется раньше, с паузой от RetryDelay, удваивающейся до
+// interval: без сертификата TLS-слушатель не может принять ни одного
+// соединения.
+func (m *ACMEManager) Run(ctx context.Context, interval time.Duration) {
+	retry := m.firstRetry(interval)
+	for {
+		wait := interval
+		if m.NeedsRenewal(time.Now()) {
+			if err := m.Obtain(ctx); err != nil {
+				log.Printf("Ошибка получения ACME-сертификата, повтор через %s: %v", retry, err)
+				wait = retry
+				retry = min(retry*2, interval)
+			} else {
+				log.Println("ACME-сертификат получен для", strings.Join(m.Domains, ", "))
+				retry = m.firstRetry(interval)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+func (m *ACMEManager) firstRetry(interval time.Duration) time.Duration {
+	if m.RetryDelay <= 0 || m.RetryDelay > interval {
+		return interval
+	}
+	return m.RetryDelay
+}
+
+func loadOrCreateKey(path string) (crypto.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("acme: повреждён ключ аккаунта %s", path)
+		}
+		return x509.ParseECPrivateKey(block.Bytes)
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
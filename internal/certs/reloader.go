@@ -0,0 +1,127 @@
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// Reloader отдаёт TLS-сертификат из файлов и перечитывает их при изменении
+// или по сигналу, не перезапуская сервер.
+type Reloader struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+func NewReloader(certFile, keyFile string) (*Reloader, error) {
+	r := &Reloader{certFile: certFile, keyFile: keyFile}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload перечитывает сертификат. При ошибке продолжает работать старый.
+func (r *Reloader) Reload() error {
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("ошибка загрузки сертификата: %w", err)
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.modTime = modTime
+	r.mu.Unlock()
+	return nil
+}
+
+// ReloadIfChanged перечитывает сертификат, только если файлы изменились
+func (r *Reloader) ReloadIfChanged() (bool, error) {
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return false, err
+	}
+	r.mu.RLock()
+	changed := modTime.After(r.modTime)
+	r.mu.RUnlock()
+	if !changed {
+		return false, nil
+	}
+	return true, r.Reload()
+}
+
+func (r *Reloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, name := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(name)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// Watch проверяет файлы раз в interval и перечитывает их по каждому сигналу
+// из signals (обычно SIGHUP), пока не отменён ctx.
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration, signals <-chan os.Signal) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			changed, err := r.ReloadIfChanged()
+			if err != nil {
+				log.Println("Ошибка проверки сертификата:", err)
+			} else if changed {
+				log.Println("Сертификат обновлён из", r.certFile)
+			}
+		case <-signals:
+			if err := r.Reload(); err != nil {
+				log.Println("Ошибка перезагрузки сертификата:", err)
+			} else {
+				log.Println("Сертификат перезагружен по сигналу")
+			}
+		}
+	}
+}
+
+// RedirectHandler перенаправляет HTTP-запросы на HTTPS-адрес tlsAddr
+func RedirectHandler(tlsAddr string) http.Handler {
+	_, port, _ := net.SplitHostPort(tlsAddr)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+}
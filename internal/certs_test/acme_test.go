@@ -0,0 +1,303 @@
+package certs_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"forum/internal/certs"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeACME — минимальный ACME-сервер (RFC 8555) для тестов.
+// Подписи JWS не проверяются; проверка http-01 выполняется через validate.
+type fakeACME struct {
+	t        *testing.T
+	server   *httptest.Server
+	validate func(token string) bool
+
+	mu         sync.Mutex
+	domains    []string
+	authzValid bool
+	issued     []byte
+	caKey      *ecdsa.PrivateKey
+	caCert     *x509.Certificate
+	// сколько ещё запросов каталога отклонить
+	unavailable int
+}
+
+const fakeToken = "test-token"
+
+func newFakeACME(t *testing.T) *fakeACME {
+	f := &fakeACME{t: t}
+	f.caKey, _ = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	f.caCert = &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Fake ACME CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/directory", f.directory)
+	mux.HandleFunc("/new-nonce", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("/new-account", f.newAccount)
+	mux.HandleFunc("/new-order", f.newOrder)
+	mux.HandleFunc("/order/1", f.order)
+	mux.HandleFunc("/authz/1", f.authz)
+	mux.HandleFunc("/chal/1", f.challenge)
+	mux.HandleFunc("/finalize/1", f.finalize)
+	mux.HandleFunc("/cert/1", f.cert)
+
+	f.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Replay-Nonce", base64.RawURLEncoding.EncodeToString(big.NewInt(time.Now().UnixNano()).Bytes()))
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+func (f *fakeACME) url(path string) string { return f.server.URL + path }
+
+func (f *fakeACME) payload(r *http.Request) []byte {
+	var jws struct{ Payload string }
+	body, _ := io.ReadAll(r.Body)
+	if err := json.Unmarshal(body, &jws); err != nil {
+		f.t.Errorf("invalid JWS: %v", err)
+	}
+	data, _ := base64.RawURLEncoding.DecodeString(jws.Payload)
+	return data
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func (f *fakeACME) directory(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	unavailable := f.unavailable > 0
+	if unavailable {
+		f.unavailable--
+	}
+	f.mu.Unlock()
+	if unavailable {
+		http.NotFound(w, r)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{
+		"newNonce":   f.url("/new-nonce"),
+		"newAccount": f.url("/new-account"),
+		"newOrder":   f.url("/new-order"),
+		"revokeCert": f.url("/revoke"),
+		"keyChange":  f.url("/key-change"),
+	})
+}
+
+func (f *fakeACME) newAccount(w http.ResponseWriter, r *http.Request) {
+	f.payload(r)
+	w.Header().Set("Location", f.url("/account/1"))
+	writeJSON(w, http.StatusCreated, map[string]string{"status": "valid"})
+}
+
+func (f *fakeACME) newOrder(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Identifiers []struct{ Value string }
+	}
+	json.Unmarshal(f.payload(r), &req)
+	f.mu.Lock()
+	for _, id := range req.Identifiers {
+		f.domains = append(f.domains, id.Value)
+	}
+	f.mu.Unlock()
+	w.Header().Set("Location", f.url("/order/1"))
+	writeJSON(w, http.StatusCreated, f.orderBody())
+}
+
+func (f *fakeACME) orderBody() map[string]interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	status := "pending"
+	if f.authzValid {
+		status = "ready"
+	}
+	body := map[string]interface{}{
+		"status":         status,
+		"authorizations": []string{f.url("/authz/1")},
+		"finalize":       f.url("/finalize/1"),
+	}
+	if f.issued != nil {
+		body["status"] = "valid"
+		body["certificate"] = f.url("/cert/1")
+	}
+	return body
+}
+
+func (f *fakeACME) order(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Location", f.url("/order/1"))
+	writeJSON(w, http.StatusOK, f.orderBody())
+}
+
+func (f *fakeACME) authz(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	status := "pending"
+	if f.authzValid {
+		status = "valid"
+	}
+	domain := f.domains[0]
+	f.mu.Unlock()
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status":     status,
+		"identifier": map[string]string{"type": "dns", "value": domain},
+		"challenges": []map[string]string{
+			{"type": "dns-01", "url": f.url("/chal/2"), "token": "other", "status": "pending"},
+			{"type": "http-01", "url": f.url("/chal/1"), "token": fakeToken, "status": status},
+		},
+	})
+}
+
+func (f *fakeACME) challenge(w http.ResponseWriter, r *http.Request) {
+	f.payload(r)
+	status := "invalid"
+	if f.validate(fakeToken) {
+		status = "valid"
+		f.mu.Lock()
+		f.authzValid = true
+		f.mu.Unlock()
+	}
+	writeJSON(w, http.StatusOK, map[string]string{
+		"type": "http-01", "url": f.url("/chal/1"), "token": fakeToken, "status": status,
+	})
+}
+
+func (f *fakeACME) finalize(w http.ResponseWriter, r *http.Request) {
+	var req struct{ CSR string }
+	json.Unmarshal(f.payload(r), &req)
+	der, _ := base64.RawURLEncoding.DecodeString(req.CSR)
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		f.t.Errorf("invalid CSR: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	leaf := &x509.Certificate{
+		SerialNumber: big.NewInt(42),
+		Subject:      pkix.Name{CommonName: csr.DNSNames[0]},
+		DNSNames:     csr.DNSNames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(90 * 24 * time.Hour),
+	}
+	leafDER, _ := x509.CreateCertificate(rand.Reader, leaf, f.caCert, csr.PublicKey, f.caKey)
+	caDER, _ := x509.CreateCertificate(rand.Reader, f.caCert, f.caCert, &f.caKey.PublicKey, f.caKey)
+
+	f.mu.Lock()
+	f.issued = append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leafDER}),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER})...)
+	f.mu.Unlock()
+
+	w.Header().Set("Location", f.url("/order/1"))
+	writeJSON(w, http.StatusOK, f.orderBody())
+}
+
+func (f *fakeACME) cert(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	w.Header().Set("Content-Type", "application/pem-certificate-chain")
+	w.Write(f.issued)
+}
+
+func TestACMEManager_ObtainsCertificate(t *testing.T) {
+	fake := newFakeACME(t)
+	solver := certs.NewHTTP01Solver()
+
+	manager, err := certs.NewACMEManager(fake.url("/directory"), "admin@forum.example",
+		[]string{"forum.example"}, t.TempDir(), solver)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Сервер проверяет ответ так же, как настоящий CA: запросом к HTTP-слушателю
+	fake.validate = func(token string) bool {
+		want, _ := manager.Client.HTTP01ChallengeResponse(token)
+		w := httptest.NewRecorder()
+		solver.Handler(http.NotFoundHandler()).ServeHTTP(w,
+			httptest.NewRequest(http.MethodGet, "/.well-known/acme-challenge/"+token, nil))
+		return w.Code == http.StatusOK && w.Body.String() == want
+	}
+
+	if !manager.NeedsRenewal(time.Now()) {
+		t.Fatal("manager without certificate must need renewal")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := manager.Obtain(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := manager.GetCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.Leaf.SerialNumber.Int64() != 42 || cert.Leaf.DNSNames[0] != "forum.example" {
+		t.Errorf("unexpected certificate: serial %v, names %v", cert.Leaf.SerialNumber, cert.Leaf.DNSNames)
+	}
+	if manager.NeedsRenewal(time.Now()) {
+		t.Error("fresh certificate must not need renewal")
+	}
+
+	// Ответ на проверку убран после выпуска
+	w := httptest.NewRecorder()
+	solver.Handler(http.NotFoundHandler()).ServeHTTP(w,
+		httptest.NewRequest(http.MethodGet, "/.well-known/acme-challenge/"+fakeToken, nil))
+	if w.Code != http.StatusNotFound {
+		t.Error("challenge response must be cleaned up")
+	}
+}
+
+func TestACMEManager_RetriesFailedObtain(t *testing.T) {
+	fake := newFakeACME(t)
+	solver := certs.NewHTTP01Solver()
+	manager, err := certs.NewACMEManager(fake.url("/directory"), "", []string{"forum.example"}, t.TempDir(), solver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake.validate = func(string) bool { return true }
+
+	// Первые две попытки не доходят до центра сертификации
+	fake.mu.Lock()
+	fake.unavailable = 2
+	fake.mu.Unlock()
+	manager.RetryDelay = 10 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go manager.Run(ctx, time.Hour)
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		if _, err := manager.GetCertificate(nil); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("failed obtain must be retried long before the renewal interval")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
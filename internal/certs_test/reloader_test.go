@@ -0,0 +1,121 @@
+package certs_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"forum/internal/certs"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// Самоподписанный сертификат с заданным серийным номером
+func writeCert(t *testing.T, dir string, serial int64) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	return certFile, keyFile
+}
+
+func serialOf(t *testing.T, r *certs.Reloader) int64 {
+	cert, _ := r.GetCertificate(nil)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leaf.SerialNumber.Int64()
+}
+
+func TestReloader_ReloadsChangedFiles(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCert(t, dir, 1)
+
+	reloader, err := certs.NewReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed, _ := reloader.ReloadIfChanged(); changed {
+		t.Error("unchanged files must not be reloaded")
+	}
+
+	writeCert(t, dir, 2)
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, future, future)
+
+	changed, err := reloader.ReloadIfChanged()
+	if err != nil || !changed {
+		t.Fatalf("expected reload, changed=%v err=%v", changed, err)
+	}
+	if got := serialOf(t, reloader); got != 2 {
+		t.Errorf("expected serial 2, got %d", got)
+	}
+}
+
+func TestReloader_ReloadsOnSignal(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCert(t, dir, 1)
+
+	reloader, err := certs.NewReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	signals := make(chan os.Signal)
+	go reloader.Watch(ctx, time.Hour, signals)
+
+	writeCert(t, dir, 3)
+	signals <- syscall.SIGHUP
+
+	deadline := time.Now().Add(2 * time.Second)
+	for serialOf(t, reloader) != 3 {
+		if time.Now().After(deadline) {
+			t.Fatal("certificate was not reloaded on SIGHUP")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRedirectHandler(t *testing.T) {
+	handler := certs.RedirectHandler(":8443")
+
+	req := httptest.NewRequest(http.MethodGet, "http://forum.example:8080/post/1?x=1", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusMovedPermanently {
+		t.Fatalf("expected 301, got %d", w.Code)
+	}
+	if got := w.Header().Get("Location"); got != "https://forum.example:8443/post/1?x=1" {
+		t.Errorf("unexpected redirect target %q", got)
+	}
+}
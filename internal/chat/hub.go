@@ -0,0 +1,454 @@
+// Package chat — комнаты живого чата по категориям: рассылка сообщений
+// подключённым участникам, история с подгрузкой старых сообщений, список
+// присутствующих и ограничения, которые накладывают модераторы.
+package chat
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+var (
+	ErrEmpty     = errors.New("пустое сообщение")
+	ErrTooLong   = errors.New("слишком длинное сообщение")
+	ErrMuted     = errors.New("вы лишены слова в этой комнате")
+	ErrKicked    = errors.New("вас удалили из этой комнаты")
+	ErrForbidden = errors.New("действие доступно только модераторам")
+	ErrTarget    = errors.New("этого участника нельзя ограничить")
+)
+
+// Виды ограничений в таблице chat_restrictions
+const (
+	restrictMute = "mute"
+	restrictKick = "kick"
+)
+
+// User — участник чата
+type User struct {
+	ID        int    `json:"id"`
+	Name      string `json:"name"`
+	Moderator bool   `json:"moderator,omitempty"`
+}
+
+// Message — сохранённое сообщение комнаты
+type Message struct {
+	ID        int64     `json:"id"`
+	UserID    int       `json:"user_id"`
+	Author    string    `json:"author"`
+	Text      string    `json:"text"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Event — то, что получает клиент
+type Event struct {
+	Type     string     `json:"type"` // message, history, presence, system, muted, kicked, error
+	Message  *Message   `json:"message,omitempty"`
+	Messages []Message  `json:"messages,omitempty"`
+	More     bool       `json:"more,omitempty"` // в истории есть сообщения старше
+	Users    []User     `json:"users,omitempty"`
+	Text     string     `json:"text,omitempty"`
+	Until    *time.Time `json:"until,omitempty"`
+}
+
+// Hub рассылает события участникам комнат. Комната — это категория.
+// Медленный участник не задерживает остальных: если его очередь
+// переполнена, подключение закрывается.
+type Hub struct {
+	DB  *sql.DB
+	Now func() time.Time
+	// Наибольшая длина сообщения в символах
+	MaxLength int
+	// Сколько сообщений отдавать за один раз при входе и подгрузке истории
+	Scrollback int
+	// Сколько событий может ждать отправки одному подключению
+	Buffer int
+
+	mu    sync.Mutex
+	rooms map[int]map[*Client]struct{}
+}
+
+func NewHub(db *sql.DB) *Hub {
+	return &Hub{
+		DB:         db,
+		Now:        time.Now,
+		MaxLength:  500,
+		Scrollback: 50,
+		Buffer:     64,
+		rooms:      map[int]map[*Client]struct{}{},
+	}
+}
+
+// Client — одно подключение участника к комнате. У пользователя может
+// быть несколько подключений (вкладок); в списке присутствующих он один.
+type Client struct {
+	User User
+	Room int
+	// Закодированные в JSON события. Канал закрывается, когда участник
+	// вышел, был удалён модератором или не успевал принимать события.
+	C <-chan []byte
+
+	c      chan []byte
+	hub    *Hub
+	closed bool // под hub.mu
+	kicked bool // под hub.mu
+	lagged bool // под hub.mu
+}
+
+// Join подключает участника к комнате и отправляет ему последние сообщения
+// и список присутствующих. Удалённому модератором возвращает ErrKicked,
+// пока не истёк срок.
+func (h *Hub) Join(room int, user User) (*Client, error) {
+	if until, err := h.restricted(room, user.ID, restrictKick); err != nil {
+		return nil, err
+	} else if until != nil {
+		return nil, ErrKicked
+	}
+	messages, more, err := h.History(room, 0)
+	if err != nil {
+		return nil, err
+	}
+	muted, _ := h.restricted(room, user.ID, restrictMute)
+
+	c := make(chan []byte, h.Buffer)
+	client := &Client{User: user, Room: room, C: c, c: c, hub: h}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	first := !h.present(room, user.ID)
+	if h.rooms[room] == nil {
+		h.rooms[room] = map[*Client]struct{}{}
+	}
+	h.rooms[room][client] = struct{}{}
+
+	h.send(client, Event{Type: "history", Messages: messages, More: more})
+	if muted != nil {
+		h.send(client, Event{Type: "muted", Until: muted})
+	}
+	if first {
+		h.broadcast(room, Event{Type: "presence", Users: h.presence(room)})
+	} else {
+		h.send(client, Event{Type: "presence", Users: h.presence(room)})
+	}
+	return client, nil
+}
+
+// Leave отключает участника. Повторный вызов безопасен.
+func (c *Client) Leave() {
+	h := c.hub
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if c.closed {
+		return
+	}
+	h.remove(c)
+	if !h.present(c.Room, c.User.ID) {
+		h.broadcast(c.Room, Event{Type: "presence", Users: h.presence(c.Room)})
+	}
+}
+
+// Kicked сообщает, что подключение закрыто модератором
+func (c *Client) Kicked() bool {
+	c.hub.mu.Lock()
+	defer c.hub.mu.Unlock()
+	return c.kicked
+}
+
+// Lagged сообщает, что подключение закрыто из-за переполненной очереди
+func (c *Client) Lagged() bool {
+	c.hub.mu.Lock()
+	defer c.hub.mu.Unlock()
+	return c.lagged
+}
+
+// Reply отправляет событие только этому подключению
+func (c *Client) Reply(ev Event) {
+	c.hub.mu.Lock()
+	defer c.hub.mu.Unlock()
+	c.hub.send(c, ev)
+}
+
+// Send сохраняет сообщение участника и рассылает его комнате
+func (h *Hub) Send(c *Client, text string) (*Message, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil, ErrEmpty
+	}
+	if utf8.RuneCountInString(text) > h.MaxLength {
+		return nil, ErrTooLong
+	}
+	if until, err := h.restricted(c.Room, c.User.ID, restrictMute); err != nil {
+		return nil, err
+	} else if until != nil {
+		return nil, ErrMuted
+	}
+
+	msg := Message{UserID: c.User.ID, Author: c.User.Name, Text: text, CreatedAt: h.Now()}
+	res, err := h.DB.Exec(`INSERT INTO chat_messages (category_id, user_id, content, created_at) VALUES (?, ?, ?, ?)`,
+		c.Room, msg.UserID, msg.Text, msg.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	msg.ID, _ = res.LastInsertId()
+
+	// Запись идёт без блокировки, поэтому одновременные сообщения могут
+	// прийти не по порядку id: клиент расставляет их по id сам
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.broadcast(c.Room, Event{Type: "message", Message: &msg})
+	return &msg, nil
+}
+
+// History возвращает до Scrollback сообщений комнаты старше before
+// (0 — самые новые) в хронологическом порядке
+func (h *Hub) History(room int, before int64) ([]Message, bool, error) {
+	query := `
+		SELECT m.id, m.user_id, u.username, m.content, m.created_at
+		FROM chat_messages m JOIN users u ON u.id = m.user_id
+		WHERE m.category_id = ?`
+	args := []interface{}{room}
+	if before > 0 {
+		query += ` AND m.id < ?`
+		args = append(args, before)
+	}
+	query += ` ORDER BY m.id DESC LIMIT ?`
+	args = append(args, h.Scrollback+1)
+
+	rows, err := h.DB.Query(query, args...)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+	var messages []Message
+	for rows.Next() {
+		var m Message
+		if err := rows.Scan(&m.ID, &m.UserID, &m.Author, &m.Text, &m.CreatedAt); err != nil {
+			return nil, false, err
+		}
+		messages = append(messages, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, err
+	}
+
+	more := len(messages) > h.Scrollback
+	if more {
+		messages = messages[:h.Scrollback]
+	}
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	return messages, more, nil
+}
+
+// Presence возвращает присутствующих в комнате
+func (h *Hub) Presence(room int) []User {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.presence(room)
+}
+
+// Mute лишает участника слова в комнате на d; d <= 0 снимает ограничение
+func (h *Hub) Mute(room int, moderator User, userID int, d time.Duration) error {
+	if err := h.checkTarget(moderator, userID); err != nil {
+		return err
+	}
+	if d <= 0 {
+		if _, err := h.DB.Exec(`DELETE FROM chat_restrictions WHERE category_id = ? AND user_id = ? AND kind = ?`,
+			room, userID, restrictMute); err != nil {
+			return err
+		}
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		h.sendUser(room, userID, Event{Type: "muted"})
+		return nil
+	}
+
+	until, err := h.restrict(room, moderator, userID, restrictMute, d)
+	if err != nil {
+		return err
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.sendUser(room, userID, Event{Type: "muted", Until: &until})
+	h.broadcast(room, Event{Type: "system", Text: "Участнику " + h.username(userID) + " запрещено писать до " + until.Format("15:04")})
+	return nil
+}
+
+// Kick отключает участника от комнаты и не пускает обратно в течение d
+func (h *Hub) Kick(room int, moderator User, userID int, d time.Duration) error {
+	if err := h.checkTarget(moderator, userID); err != nil {
+		return err
+	}
+	until, err := h.restrict(room, moderator, userID, restrictKick, d)
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for client := range h.rooms[room] {
+		if client.User.ID == userID {
+			h.send(client, Event{Type: "kicked", Until: &until})
+			client.kicked = true
+			h.remove(client)
+		}
+	}
+	h.broadcast(room, Event{Type: "system", Text: "Участник " + h.username(userID) + " удалён из комнаты"})
+	h.broadcast(room, Event{Type: "presence", Users: h.presence(room)})
+	return nil
+}
+
+// Restriction возвращает срок действующего ограничения kind ("mute" или
+// "kick") или nil, если его нет
+func (h *Hub) Restriction(room, userID int, kind string) (*time.Time, error) {
+	return h.restricted(room, userID, kind)
+}
+
+func (h *Hub) checkTarget(moderator User, userID int) error {
+	if !moderator.Moderator {
+		return ErrForbidden
+	}
+	var role string
+	err := h.DB.QueryRow(`SELECT role FROM users WHERE id = ?`, userID).Scan(&role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrTarget
+	}
+	if err != nil {
+		return err
+	}
+	// Модераторы друг друга не ограничивают
+	if userID == moderator.ID || role == "moderator" || role == "admin" {
+		return ErrTarget
+	}
+	return nil
+}
+
+func (h *Hub) restrict(room int, moderator User, userID int, kind string, d time.Duration) (time.Time, error) {
+	now := h.Now()
+	until := now.Add(d)
+	_, err := h.DB.Exec(`
+		INSERT INTO chat_restrictions (category_id, user_id, kind, until, moderator_id, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (category_id, user_id, kind)
+		DO UPDATE SET until = excluded.until, moderator_id = excluded.moderator_id, created_at = excluded.created_at`,
+		room, userID, kind, until, moderator.ID, now)
+	return until, err
+}
+
+func (h *Hub) restricted(room, userID int, kind string) (*time.Time, error) {
+	var until time.Time
+	err := h.DB.QueryRow(`SELECT until FROM chat_restrictions WHERE category_id = ? AND user_id = ? AND kind = ?`,
+		room, userID, kind).Scan(&until)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !until.After(h.Now()) {
+		return nil, nil
+	}
+	return &until, nil
+}
+
+func (h *Hub) username(userID int) string {
+	var name string
+	h.DB.QueryRow(`SELECT username FROM users WHERE id = ?`, userID).Scan(&name)
+	return name
+}
+
+// Методы ниже вызываются под h.mu
+
+func (h *Hub) present(room, userID int) bool {
+	for client := range h.rooms[room] {
+		if client.User.ID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *Hub) presence(room int) []User {
+	seen := map[int]bool{}
+	users := []User{}
+	for client := range h.rooms[room] {
+		if !seen[client.User.ID] {
+			seen[client.User.ID] = true
+			users = append(users, client.User)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return strings.ToLower(users[i].Name) < strings.ToLower(users[j].Name)
+	})
+	return users
+}
+
+func (h *Hub) broadcast(room int, ev Event) {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		log.Println("Ошибка кодирования события чата:", err)
+		return
+	}
+	var lagged bool
+	for client := range h.rooms[room] {
+		if !h.deliver(client, data) {
+			lagged = true
+		}
+	}
+	if lagged {
+		// Отключённые из-за очереди пропадают из списка присутствующих
+		h.broadcast(room, Event{Type: "presence", Users: h.presence(room)})
+	}
+}
+
+func (h *Hub) sendUser(room, userID int, ev Event) {
+	for client := range h.rooms[room] {
+		if client.User.ID == userID {
+			h.send(client, ev)
+		}
+	}
+}
+
+func (h *Hub) send(client *Client, ev Event) {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		log.Println("Ошибка кодирования события чата:", err)
+		return
+	}
+	h.deliver(client, data)
+}
+
+// deliver ставит событие в очередь подключения. Если очередь полна,
+// подключение закрывается, и deliver возвращает false.
+func (h *Hub) deliver(client *Client, data []byte) bool {
+	if client.closed {
+		return true
+	}
+	select {
+	case client.c <- data:
+		return true
+	default:
+		client.lagged = true
+		h.remove(client)
+		return false
+	}
+}
+
+func (h *Hub) remove(client *Client) {
+	if client.closed {
+		return
+	}
+	client.closed = true
+	delete(h.rooms[client.Room], client)
+	if len(h.rooms[client.Room]) == 0 {
+		delete(h.rooms, client.Room)
+	}
+	close(client.c)
+}
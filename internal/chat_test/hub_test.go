@@ -0,0 +1,332 @@
+package chat_test
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"forum/internal/chat"
+	"sync"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+var (
+	alice = chat.User{ID: 1, Name: "alice"}
+	bob   = chat.User{ID: 2, Name: "bob"}
+	mod   = chat.User{ID: 3, Name: "mod", Moderator: true}
+)
+
+type clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *clock) Add(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func setup(t *testing.T) (*sql.DB, *chat.Hub, *clock) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	db.SetMaxOpenConns(1)
+	_, err = db.Exec(`
+		CREATE TABLE users (id INTEGER PRIMARY KEY, username TEXT, role TEXT NOT NULL DEFAULT 'user');
+		CREATE TABLE chat_messages (id INTEGER PRIMARY KEY AUTOINCREMENT, category_id INTEGER, user_id INTEGER, content TEXT, created_at DATETIME);
+		CREATE TABLE chat_restrictions (category_id INTEGER, user_id INTEGER, kind TEXT, until DATETIME, moderator_id INTEGER, created_at DATETIME, PRIMARY KEY (category_id, user_id, kind));
+		INSERT INTO users (id, username, role) VALUES (1, 'alice', 'user'), (2, 'bob', 'user'), (3, 'mod', 'moderator');
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &clock{now: time.Date(2025, 5, 1, 20, 0, 0, 0, time.UTC)}
+	hub := chat.NewHub(db)
+	hub.Now = c.Now
+	return db, hub, c
+}
+
+// next ждёт следующее событие подключения
+func next(t *testing.T, c *chat.Client) chat.Event {
+	t.Helper()
+	select {
+	case data, ok := <-c.C:
+		if !ok {
+			t.Fatal("connection closed")
+		}
+		var ev chat.Event
+		if err := json.Unmarshal(data, &ev); err != nil {
+			t.Fatal(err)
+		}
+		return ev
+	case <-time.After(time.Second):
+		t.Fatal("no event")
+	}
+	return chat.Event{}
+}
+
+// expect пропускает события до первого события типа typ
+func expect(t *testing.T, c *chat.Client, typ string) chat.Event {
+	t.Helper()
+	for {
+		if ev := next(t, c); ev.Type == typ {
+			return ev
+		}
+	}
+}
+
+func join(t *testing.T, hub *chat.Hub, room int, user chat.User) *chat.Client {
+	t.Helper()
+	c, err := hub.Join(room, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(c.Leave)
+	return c
+}
+
+func names(users []chat.User) []string {
+	var list []string
+	for _, u := range users {
+		list = append(list, u.Name)
+	}
+	return list
+}
+
+func TestHub_MessagesArePersistedAndRoomsIsolated(t *testing.T) {
+	db, hub, _ := setup(t)
+	a := join(t, hub, 1, alice)
+	b := join(t, hub, 1, bob)
+	other := join(t, hub, 2, mod)
+
+	if _, err := hub.Send(a, "  Гол!  "); err != nil {
+		t.Fatal(err)
+	}
+	ev := expect(t, b, "message")
+	if ev.Message.Text != "Гол!" || ev.Message.Author != "alice" || ev.Message.ID == 0 {
+		t.Errorf("unexpected message %+v", ev.Message)
+	}
+	select {
+	case data := <-other.C:
+		var ev chat.Event
+		json.Unmarshal(data, &ev)
+		if ev.Type == "message" {
+			t.Error("message leaked into another room")
+		}
+	default:
+	}
+
+	var count int
+	db.QueryRow(`SELECT COUNT(*) FROM chat_messages WHERE category_id = 1`).Scan(&count)
+	if count != 1 {
+		t.Errorf("expected 1 stored message, got %d", count)
+	}
+
+	if _, err := hub.Send(a, "   "); !errors.Is(err, chat.ErrEmpty) {
+		t.Errorf("expected ErrEmpty, got %v", err)
+	}
+	hub.MaxLength = 5
+	if _, err := hub.Send(a, "шестьб"); !errors.Is(err, chat.ErrTooLong) {
+		t.Errorf("expected ErrTooLong, got %v", err)
+	}
+}
+
+func TestHub_Scrollback(t *testing.T) {
+	_, hub, _ := setup(t)
+	hub.Scrollback = 3
+	a := join(t, hub, 1, alice)
+	for i := 1; i <= 7; i++ {
+		hub.Send(a, fmt.Sprint(i))
+	}
+
+	b := join(t, hub, 1, bob)
+	ev := expect(t, b, "history")
+	if len(ev.Messages) != 3 || ev.Messages[0].Text != "5" || ev.Messages[2].Text != "7" || !ev.More {
+		t.Fatalf("unexpected first page %+v", ev)
+	}
+	older, more, err := hub.History(1, ev.Messages[0].ID)
+	if err != nil || len(older) != 3 || older[0].Text != "2" || !more {
+		t.Fatalf("unexpected second page %+v %v %v", older, more, err)
+	}
+	oldest, more, _ := hub.History(1, older[0].ID)
+	if len(oldest) != 1 || oldest[0].Text != "1" || more {
+		t.Errorf("unexpected last page %+v %v", oldest, more)
+	}
+}
+
+func TestHub_Presence(t *testing.T) {
+	_, hub, _ := setup(t)
+	a := join(t, hub, 1, alice)
+	if got := names(expect(t, a, "presence").Users); len(got) != 1 {
+		t.Fatalf("unexpected presence %v", got)
+	}
+
+	b1 := join(t, hub, 1, bob)
+	if got := names(expect(t, a, "presence").Users); fmt.Sprint(got) != "[alice bob]" {
+		t.Errorf("unexpected presence %v", got)
+	}
+	// Вторая вкладка того же пользователя не меняет список
+	b2, _ := hub.Join(1, bob)
+	b1.Leave()
+	if got := names(hub.Presence(1)); fmt.Sprint(got) != "[alice bob]" {
+		t.Errorf("bob still has a tab open: %v", got)
+	}
+	b2.Leave()
+	if got := names(expect(t, a, "presence").Users); fmt.Sprint(got) != "[alice]" {
+		t.Errorf("unexpected presence after leave %v", got)
+	}
+}
+
+func TestHub_Mute(t *testing.T) {
+	_, hub, clk := setup(t)
+	a := join(t, hub, 1, alice)
+	m := join(t, hub, 1, mod)
+
+	if err := hub.Mute(1, bob, alice.ID, time.Minute); !errors.Is(err, chat.ErrForbidden) {
+		t.Errorf("only moderators may mute, got %v", err)
+	}
+	if err := hub.Mute(1, mod, mod.ID, time.Minute); !errors.Is(err, chat.ErrTarget) {
+		t.Errorf("moderators can't be muted, got %v", err)
+	}
+	if err := hub.Mute(1, mod, alice.ID, 10*time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if ev := expect(t, a, "muted"); ev.Until == nil {
+		t.Error("muted event must carry the deadline")
+	}
+	expect(t, m, "system")
+
+	if _, err := hub.Send(a, "ну судья!"); !errors.Is(err, chat.ErrMuted) {
+		t.Errorf("expected ErrMuted, got %v", err)
+	}
+	// Ограничение действует только в своей комнате и переживает переподключение
+	other := join(t, hub, 2, alice)
+	if _, err := hub.Send(other, "привет"); err != nil {
+		t.Errorf("mute must not apply to other rooms: %v", err)
+	}
+	again := join(t, hub, 1, alice)
+	expect(t, again, "muted")
+
+	clk.Add(11 * time.Minute)
+	if _, err := hub.Send(a, "я снова здесь"); err != nil {
+		t.Errorf("mute must expire: %v", err)
+	}
+
+	hub.Mute(1, mod, alice.ID, time.Hour)
+	hub.Mute(1, mod, alice.ID, 0)
+	if _, err := hub.Send(a, "спасибо"); err != nil {
+		t.Errorf("mute must be lifted: %v", err)
+	}
+}
+
+func TestHub_Kick(t *testing.T) {
+	_, hub, clk := setup(t)
+	a := join(t, hub, 1, alice)
+	tab := join(t, hub, 1, alice)
+	b := join(t, hub, 1, bob)
+
+	if err := hub.Kick(1, mod, alice.ID, 10*time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []*chat.Client{a, tab} {
+		expect(t, c, "kicked")
+		for range c.C {
+		}
+		if !c.Kicked() {
+			t.Error("connection must be marked as kicked")
+		}
+	}
+	expect(t, b, "system")
+	if got := names(expect(t, b, "presence").Users); fmt.Sprint(got) != "[bob]" {
+		t.Errorf("kicked user must leave presence: %v", got)
+	}
+
+	if _, err := hub.Join(1, alice); !errors.Is(err, chat.ErrKicked) {
+		t.Errorf("expected ErrKicked, got %v", err)
+	}
+	clk.Add(11 * time.Minute)
+	join(t, hub, 1, alice)
+}
+
+func TestHub_SlowClientIsDropped(t *testing.T) {
+	_, hub, _ := setup(t)
+	hub.Buffer = 4
+	slow := join(t, hub, 1, bob)
+	a := join(t, hub, 1, alice)
+
+	for i := 0; i < 10; i++ {
+		if _, err := hub.Send(a, fmt.Sprint(i)); err != nil {
+			t.Fatal(err)
+		}
+		expect(t, a, "message")
+	}
+	for range slow.C {
+	}
+	if !slow.Lagged() {
+		t.Error("slow client must be dropped as lagged")
+	}
+	if got := names(hub.Presence(1)); fmt.Sprint(got) != "[alice]" {
+		t.Errorf("dropped client must leave presence: %v", got)
+	}
+}
+
+// Все участники получают все сообщения ровно по одному разу. Порядок
+// между одновременными сообщениями не гарантирован: клиент ставит их по id.
+func TestHub_ConcurrentClients(t *testing.T) {
+	db, hub, _ := setup(t)
+	const clients, perClient = 20, 10
+	hub.Buffer = clients*perClient + 2*clients + 10
+	for i := 10; i < 10+clients; i++ {
+		db.Exec(`INSERT INTO users (id, username) VALUES (?, ?)`, i, fmt.Sprintf("user%d", i))
+	}
+
+	conns := make([]*chat.Client, clients)
+	for i := range conns {
+		conns[i] = join(t, hub, 1, chat.User{ID: 10 + i, Name: fmt.Sprintf("user%d", 10+i)})
+	}
+
+	var wg sync.WaitGroup
+	for i, c := range conns {
+		wg.Add(1)
+		go func(i int, c *chat.Client) {
+			defer wg.Done()
+			for j := 0; j < perClient; j++ {
+				if _, err := hub.Send(c, fmt.Sprintf("%d-%d", i, j)); err != nil {
+					t.Error(err)
+				}
+			}
+		}(i, c)
+	}
+	wg.Wait()
+
+	var stored int
+	db.QueryRow(`SELECT COUNT(*) FROM chat_messages`).Scan(&stored)
+	if stored != clients*perClient {
+		t.Fatalf("stored %d messages, want %d", stored, clients*perClient)
+	}
+	for i, c := range conns {
+		seen := map[int64]bool{}
+		for len(seen) < clients*perClient {
+			ev := next(t, c)
+			if ev.Type != "message" {
+				continue
+			}
+			if seen[ev.Message.ID] {
+				t.Fatalf("client %d received message %d twice", i, ev.Message.ID)
+			}
+			seen[ev.Message.ID] = true
+		}
+	}
+}
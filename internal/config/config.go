@@ -0,0 +1,300 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+)
+
+// RateLimit — ограничение частоты запросов по алгоритму token bucket
+type RateLimit struct {
+	PerMinute float64 `json:"per_minute"` // скорость пополнения корзины
+	Burst     int     `json:"burst"`      // ёмкость корзины
+}
+
+// Security — заголовки безопасности и Content Security Policy
+type Security struct {
+	ScriptSources  []string `json:"script_sources"`
+	StyleSources   []string `json:"style_sources"`
+	ImgSources     []string `json:"img_sources"`
+	ConnectSources []string `json:"connect_sources"`
+	FrameAncestors []string `json:"frame_ancestors"`
+	ReferrerPolicy string   `json:"referrer_policy"`
+	// Только сообщать о нарушениях CSP, не блокируя (удобно при разработке)
+	ReportOnly bool `json:"report_only"`
+	// HSTS отправляется только по TLS; 0 отключает заголовок
+	HSTSMaxAge int `json:"hsts_max_age"`
+	// Доверять X-Forwarded-Proto от обратного прокси при определении TLS
+	TrustForwardedProto bool `json:"trust_forwarded_proto"`
+}
+
+// TLS — встроенный HTTPS. Сертификат берётся из файлов либо через ACME.
+type TLS struct {
+	Enabled  bool   `json:"enabled"`
+	Addr     string `json:"addr"`
+	CertFile string `json:"cert_file"`
+	KeyFile  string `json:"key_file"`
+	// HTTP-слушатель на основном адресе перенаправляет на HTTPS
+	RedirectHTTP bool `json:"redirect_http"`
+	// Как часто проверять, изменились ли файлы сертификата
+	ReloadIntervalSeconds int  `json:"reload_interval_seconds"`
+	ACME                  ACME `json:"acme"`
+}
+
+type ACME struct {
+	Enabled      bool     `json:"enabled"`
+	DirectoryURL string   `json:"directory_url"`
+	Email        string   `json:"email"`
+	Domains      []string `json:"domains"`
+	CacheDir     string   `json:"cache_dir"`
+}
+
+// Uploads — загрузка изображений к постам
+type Uploads struct {
+	// Каталог хранилища блобов
+	Dir         string `json:"dir"`
+	MaxFileSize int64  `json:"max_file_size"` // байт на один файл
+	MaxFiles    int    `json:"max_files"`     // файлов в одном посте
+	MaxWidth    int    `json:"max_width"`
+	MaxHeight   int    `json:"max_height"`
+	MaxPixels   int    `json:"max_pixels"` // ширина × высота: память на декодирование
+	ThumbSize   int    `json:"thumb_size"` // длинная сторона миниатюры
+}
+
+// Mail — отправка писем-дайджестов
+type Mail struct {
+	Enabled bool   `json:"enabled"`
+	From    string `json:"from"`
+	// Адрес форума для ссылок в письмах
+	BaseURL string `json:"base_url"`
+	// Ключ подписи ссылок отписки; обязателен, если рассылка включена
+	Secret string `json:"secret"`
+	// "file" складывает письма в Dir (для разработки), "smtp" — отправляет
+	Transport            string `json:"transport"`
+	Dir                  string `json:"dir"`
+	SMTP                 SMTP   `json:"smtp"`
+	CheckIntervalMinutes int    `json:"check_interval_minutes"`
+}
+
+type SMTP struct {
+	Addr     string `json:"addr"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// Chat — живой чат в комнатах категорий
+type Chat struct {
+	MaxLength  int `json:"max_length"` // символов в сообщении
+	Scrollback int `json:"scrollback"` // сообщений при входе и за одну подгрузку истории
+	// Частота сообщений для одного подключения
+	Messages RateLimit `json:"messages"`
+}
+
+// Reaction — вид реакции на пост или комментарий
+type Reaction struct {
+	// Имя вида в базе и в запросах: like, fire… Переименование вида
+	// отвязывает от него уже поставленные реакции.
+	Kind  string `json:"kind"`
+	Emoji string `json:"emoji"`
+	Title string `json:"title"` // подсказка на кнопке
+	// Вклад одной реакции в рейтинг поста при сортировке «Лучшие».
+	// За реакции с положительным весом автор получает уведомление.
+	Weight float64 `json:"weight"`
+}
+
+// Reputation — репутация пользователя по реакциям на его посты и комментарии
+type Reputation struct {
+	// Очки автору за одну реакцию каждого вида. Вид, которого нет в списке,
+	// приносит столько очков, сколько его вес в reactions.
+	Weights map[string]float64 `json:"weights"`
+	// За сколько дней вклад реакции уменьшается вдвое; 0 — без затухания
+	HalfLifeDays float64 `json:"half_life_days"`
+	// Сколько репутации нужно для действий; 0 — доступно всем
+	Privileges Privileges `json:"privileges"`
+}
+
+// Privileges — пороги репутации. Модераторов и администраторов не касаются.
+type Privileges struct {
+	CreatePoll float64 `json:"create_poll"`
+	// Реакции, за которые автор теряет очки (👎 и другие с отрицательным весом)
+	Downvote float64 `json:"downvote"`
+}
+
+// Moderation — закрытие, закрепление и архивирование обсуждений
+type Moderation struct {
+	// Через сколько дней без комментариев пост уходит в архив; 0 — никогда.
+	// Закреплённые посты в архив не уходят.
+	ArchiveAfterDays int `json:"archive_after_days"`
+}
+
+// Messages — личные переписки
+type Messages struct {
+	MaxLength int `json:"max_length"` // символов в сообщении
+	// Участников группы вместе с создателем
+	MaxMembers int `json:"max_members"`
+}
+
+// Spam — фильтры спама. Пост или комментарий, на котором сработал фильтр,
+// не публикуется, а ждёт решения модератора.
+type Spam struct {
+	// Запрещённые слова и фразы (без учёта регистра, целыми словами)
+	// и регулярные выражения в синтаксисе Go
+	BlockedWords    []string `json:"blocked_words"`
+	BlockedPatterns []string `json:"blocked_patterns"`
+	// Аккаунтам моложе new_account_days можно не больше new_account_links
+	// ссылок в тексте; 0 дней — без ограничения
+	NewAccountDays  float64 `json:"new_account_days"`
+	NewAccountLinks int     `json:"new_account_links"`
+	// Повтор текста, опубликованного за duplicate_window_hours; тексты короче
+	// duplicate_min_length символов не сравниваются. 0 часов — не искать.
+	DuplicateWindowHours float64 `json:"duplicate_window_hours"`
+	DuplicateMinLength   int     `json:"duplicate_min_length"`
+	// Классификатор задерживает тексты с вероятностью спама от threshold,
+	// когда модераторы отметили хотя бы min_training спамных и столько же
+	// обычных текстов; 0 — классификатор выключен
+	Threshold   float64 `json:"threshold"`
+	MinTraining int     `json:"min_training"`
+}
+
+type Config struct {
+	// Адрес HTTP-сервера
+	Addr string `json:"addr"`
+	// Лимиты для POST-запросов по точному пути маршрута
+	RateLimits map[string]RateLimit `json:"rate_limits"`
+	Security   Security             `json:"security"`
+	TLS        TLS                  `json:"tls"`
+	Uploads    Uploads              `json:"uploads"`
+	Mail       Mail                 `json:"mail"`
+	Chat       Chat                 `json:"chat"`
+	// Виды реакций в порядке показа
+	Reactions  []Reaction `json:"reactions"`
+	Reputation Reputation `json:"reputation"`
+	Moderation Moderation `json:"moderation"`
+	Messages   Messages   `json:"messages"`
+	Spam       Spam       `json:"spam"`
+}
+
+// Default возвращает настройки, с которыми форум работает без файла конфигурации
+func Default() Config {
+	return Config{
+		Addr: ":8080",
+		RateLimits: map[string]RateLimit{
+			"/create":          {PerMinute: 2, Burst: 5},
+			"/preview":         {PerMinute: 30, Burst: 10},
+			"/drafts/autosave": {PerMinute: 20, Burst: 10},
+			"/post/comment":    {PerMinute: 10, Burst: 20},
+			"/like":            {PerMinute: 60, Burst: 60},
+			"/bookmark":        {PerMinute: 60, Burst: 60},
+			"/poll/vote":       {PerMinute: 30, Burst: 10},
+			"/messages/new":    {PerMinute: 2, Burst: 5},
+			"/messages/send":   {PerMinute: 20, Burst: 10},
+		},
+		Security: Security{
+			ScriptSources:  []string{"'self'", "https://cdn.jsdelivr.net"},
+			StyleSources:   []string{"'self'", "https://cdn.jsdelivr.net", "'unsafe-inline'"},
+			ImgSources:     []string{"'self'", "data:"},
+			ConnectSources: []string{"'self'"},
+			FrameAncestors: []string{"'none'"},
+			ReferrerPolicy: "strict-origin-when-cross-origin",
+			HSTSMaxAge:     31536000,
+		},
+		TLS: TLS{
+			Addr:                  ":8443",
+			RedirectHTTP:          true,
+			ReloadIntervalSeconds: 60,
+			ACME: ACME{
+				DirectoryURL: "https://acme-v02.api.letsencrypt.org/directory",
+				CacheDir:     "certs",
+			},
+		},
+		Uploads: Uploads{
+			Dir:         "uploads",
+			MaxFileSize: 5 << 20,
+			MaxFiles:    4,
+			MaxWidth:    8000,
+			MaxHeight:   8000,
+			MaxPixels:   40_000_000,
+			ThumbSize:   320,
+		},
+		Mail: Mail{
+			From:                 "forum@localhost",
+			BaseURL:              "http://localhost:8080",
+			Transport:            "file",
+			Dir:                  "mail",
+			CheckIntervalMinutes: 15,
+		},
+		Chat: Chat{
+			MaxLength:  500,
+			Scrollback: 50,
+			Messages:   RateLimit{PerMinute: 20, Burst: 5},
+		},
+		Reactions: []Reaction{
+			{Kind: "like", Emoji: "👍", Title: "Нравится", Weight: 1},
+			{Kind: "dislike", Emoji: "👎", Title: "Не нравится", Weight: -1},
+			{Kind: "fire", Emoji: "🔥", Title: "Огонь", Weight: 2},
+			{Kind: "laugh", Emoji: "😂", Title: "Смешно", Weight: 1},
+			{Kind: "angry", Emoji: "😡", Title: "Возмутительно", Weight: 0.5},
+			{Kind: "clap", Emoji: "👏", Title: "Браво", Weight: 1.5},
+		},
+		Reputation: Reputation{
+			HalfLifeDays: 180,
+		},
+		Moderation: Moderation{
+			ArchiveAfterDays: 180,
+		},
+		Messages: Messages{
+			MaxLength:  2000,
+			MaxMembers: 10,
+		},
+		Spam: Spam{
+			NewAccountDays:       3,
+			NewAccountLinks:      1,
+			DuplicateWindowHours: 24,
+			DuplicateMinLength:   40,
+			Threshold:            0.9,
+			MinTraining:          10,
+		},
+	}
+}
+
+// Path возвращает путь к файлу настроек: FORUM_CONFIG, иначе config.<FORUM_ENV>.json,
+// иначе config.json. Так у каждого окружения может быть свой файл.
+func Path() string {
+	if path := os.Getenv("FORUM_CONFIG"); path != "" {
+		return path
+	}
+	if env := os.Getenv("FORUM_ENV"); env != "" {
+		return "config." + env + ".json"
+	}
+	return "config.json"
+}
+
+// Load читает JSON-файл поверх значений по умолчанию.
+// Отсутствующий файл не считается ошибкой.
+func Load(path string) (Config, error) {
+	cfg := Default()
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, fmt.Errorf("ошибка чтения конфигурации: %w", err)
+	}
+
+	// Список реакций из файла заменяет стандартный целиком: json дописывает
+	// элементы поверх старых, и пропущенные поля достались бы от стандартных
+	var lists struct {
+		Reactions json.RawMessage `json:"reactions"`
+	}
+	if json.Unmarshal(data, &lists) == nil && lists.Reactions != nil {
+		cfg.Reactions = nil
+	}
+
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("ошибка разбора конфигурации %s: %w", path, err)
+	}
+	return cfg, nil
+}
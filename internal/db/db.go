@@ -4,8 +4,48 @@ import (
 	"database/sql"
 	"fmt"
 	"os"
+	"strings"
+	"unicode"
 )
 
+// Колонки, появившиеся после первой версии схемы. CREATE TABLE IF NOT EXISTS
+// не меняет уже существующие таблицы, поэтому старые базы догоняем через ALTER TABLE.
+var columnMigrations = []struct {
+	table, column, definition string
+}{
+	{"users", "role", "TEXT NOT NULL DEFAULT 'user'"},
+	{"posts", "content_html", "TEXT NOT NULL DEFAULT ''"},
+	{"comments", "content_html", "TEXT NOT NULL DEFAULT ''"},
+	{"categories", "parent_id", "INTEGER REFERENCES categories(id)"},
+	{"categories", "slug", "TEXT NOT NULL DEFAULT ''"},
+	{"categories", "description", "TEXT NOT NULL DEFAULT ''"},
+	{"comments", "parent_id", "INTEGER REFERENCES comments(id)"},
+	{"users", "digest", "TEXT NOT NULL DEFAULT 'off'"},
+	{"users", "digest_sent_at", "DATETIME"},
+	{"posts", "reaction_counts", "TEXT NOT NULL DEFAULT '{}'"},
+	{"posts", "comment_count", "INTEGER NOT NULL DEFAULT 0"},
+	{"posts", "last_activity_at", "DATETIME"},
+	{"comments", "likes", "INTEGER NOT NULL DEFAULT 0"},
+	{"comments", "dislikes", "INTEGER NOT NULL DEFAULT 0"},
+	{"comments", "reaction_counts", "TEXT NOT NULL DEFAULT '{}'"},
+	{"users", "reputation", "REAL NOT NULL DEFAULT 0"},
+	{"users", "reputation_at", "DATETIME"},
+	{"posts", "locked", "BOOLEAN NOT NULL DEFAULT FALSE"},
+	{"posts", "pinned_at", "DATETIME"},
+	{"posts", "pinned_category_id", "INTEGER REFERENCES categories(id)"},
+	{"posts", "archived_at", "DATETIME"},
+	{"posts", "unarchived_at", "DATETIME"},
+}
+
+// Индексы по колонкам из columnMigrations: в schema.sql их создавать нельзя,
+// там эти колонки в старой базе ещё не существуют.
+var indexMigrations = []string{
+	"CREATE UNIQUE INDEX IF NOT EXISTS idx_categories_slug ON categories(slug)",
+	"CREATE INDEX IF NOT EXISTS idx_categories_parent ON categories(parent_id)",
+	"CREATE INDEX IF NOT EXISTS idx_posts_activity ON posts(last_activity_at)",
+	"CREATE INDEX IF NOT EXISTS idx_posts_pinned ON posts(pinned_at) WHERE pinned_at IS NOT NULL",
+}
+
 func InitDatabase(db *sql.DB) error {
 	sqlBytes, err := os.ReadFile("internal/db/schema.sql")
 	if err != nil {
@@ -17,5 +57,262 @@ func InitDatabase(db *sql.DB) error {
 		return fmt.Errorf("ошибка выполнения SQL схемы: %w", err)
 	}
 
+	for _, m := range columnMigrations {
+		if err := ensureColumn(db, m.table, m.column, m.definition); err != nil {
+			return fmt.Errorf("ошибка миграции %s.%s: %w", m.table, m.column, err)
+		}
+	}
+
+	if err := migrateLikes(db); err != nil {
+		return fmt.Errorf("ошибка переноса лайков в reactions: %w", err)
+	}
+
+	// Счётчики только что добавленных колонок ещё пусты: у постов старой
+	// базы нет времени последней активности
+	var stale int
+	db.QueryRow("SELECT COUNT(*) FROM posts WHERE last_activity_at IS NULL").Scan(&stale)
+	if stale > 0 {
+		if _, err := Recount(db); err != nil {
+			return fmt.Errorf("ошибка пересчёта счётчиков: %w", err)
+		}
+	}
+
+	// Категориям из старой базы нужен адрес до создания уникального индекса
+	if err := backfillCategorySlugs(db); err != nil {
+		return fmt.Errorf("ошибка заполнения адресов категорий: %w", err)
+	}
+	for _, stmt := range indexMigrations {
+		if _, err := db.Exec(stmt); err != nil {
+			return fmt.Errorf("ошибка создания индекса: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func ensureColumn(db *sql.DB, table, column, definition string) error {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid        int
+			name, typ  string
+			notNull    bool
+			defaultVal sql.NullString
+			pk         int
+		)
+		if err := rows.Scan(&cid, &name, &typ, &notNull, &defaultVal, &pk); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
+
+// Таблицы лайков первой версии схемы: is_like превращается в вид реакции
+var likeTables = []struct {
+	table, column, targetType string
+}{
+	{"post_likes", "post_id", "post"},
+	{"comment_likes", "comment_id", "comment"},
+}
+
+// migrateLikes переносит лайки и дизлайки из старых таблиц в reactions и
+// удаляет старые таблицы. Каждая таблица переносится в своей транзакции,
+// так что прерванный запуск просто повторит перенос.
+func migrateLikes(db *sql.DB) error {
+	for _, m := range likeTables {
+		var name string
+		err := db.QueryRow("SELECT name FROM sqlite_master WHERE type = 'table' AND name = ?", m.table).Scan(&name)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(fmt.Sprintf(`
+			INSERT OR IGNORE INTO reactions (target_type, target_id, user_id, kind, created_at)
+			SELECT ?, %s, user_id, CASE WHEN is_like THEN 'like' ELSE 'dislike' END,
+				COALESCE(created_at, CURRENT_TIMESTAMP)
+			FROM %s`, m.column, m.table), m.targetType)
+		if err == nil {
+			_, err = tx.Exec("DROP TABLE " + m.table)
+		}
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("%s: %w", m.table, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetUserRole назначает роль пользователю (user, moderator, admin)
+func SetUserRole(db *sql.DB, email, role string) error {
+	switch role {
+	case "user", "moderator", "admin":
+	default:
+		return fmt.Errorf("неизвестная роль: %s", role)
+	}
+	res, err := db.Exec("UPDATE users SET role = ? WHERE email = ?", role, email)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("пользователь %s не найден", email)
+	}
+	return nil
+}
+
+var translit = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e", 'ж': "zh",
+	'з': "z", 'и': "i", 'й': "i", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o",
+	'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u", 'ф': "f", 'х': "kh", 'ц': "ts",
+	'ч': "ch", 'ш': "sh", 'щ': "shch", 'ы': "y", 'э': "e", 'ю': "iu",
+	'я': "ia",
+}
+
+// Slugify делает из названия адрес для URL: латиница, цифры и дефисы
+// ("Формула-1" → "formula-1"). Кириллица транслитерируется.
+func Slugify(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		var part string
+		switch {
+		case r >= 'a' && r <= 'z' || r >= '0' && r <= '9':
+			part = string(r)
+		case translit[r] != "":
+			part = translit[r]
+		case unicode.IsSpace(r) || unicode.IsPunct(r) || unicode.IsSymbol(r):
+			dash = true
+		}
+		if part == "" {
+			continue
+		}
+		if dash && b.Len() > 0 {
+			b.WriteByte('-')
+		}
+		dash = false
+		b.WriteString(part)
+	}
+	return b.String()
+}
+
+// ValidSlug проверяет адрес, заданный вручную
+func ValidSlug(slug string) bool {
+	return slug != "" && Slugify(slug) == slug
+}
+
+// seedSlugs — адреса категорий из seed.sql. Старая база создана тем же
+// seed.sql, только без колонки slug, и её категории должны получить те же
+// адреса, что и в новой базе.
+var seedSlugs = map[string]string{
+	"Футбол":           "football",
+	"Баскетбол":        "basketball",
+	"Бокс":             "boxing",
+	"Теннис":           "tennis",
+	"Формула-1":        "formula-1",
+	"Хоккей":           "hockey",
+	"Олимпийские игры": "olympics",
+	"Премьер-лига":     "premier-league",
+	"РПЛ":              "rpl",
+	"НБА":              "nba",
+	"КХЛ":              "khl",
+	"Арсенал":          "arsenal",
+}
+
+func backfillCategorySlugs(db *sql.DB) error {
+	rows, err := db.Query("SELECT id, name FROM categories WHERE slug = ''")
+	if err != nil {
+		return err
+	}
+	type category struct {
+		id   int
+		name string
+	}
+	var pending []category
+	for rows.Next() {
+		var c category
+		if err := rows.Scan(&c.id, &c.name); err != nil {
+			rows.Close()
+			return err
+		}
+		pending = append(pending, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, c := range pending {
+		slug, ok := seedSlugs[c.name]
+		if !ok {
+			slug = Slugify(c.name)
+		}
+		if slug == "" {
+			slug = fmt.Sprintf("category-%d", c.id)
+		}
+		var taken int
+		db.QueryRow("SELECT COUNT(*) FROM categories WHERE slug = ?", slug).Scan(&taken)
+		if taken > 0 {
+			slug = fmt.Sprintf("%s-%d", slug, c.id)
+		}
+		if _, err := db.Exec("UPDATE categories SET slug = ? WHERE id = ?", slug, c.id); err != nil {
+			return err
+		}
+	}
 	return nil
 }
+
+// AddCategory создаёт категорию. Пустой slug выводится из названия,
+// parentSlug указывает родителя (пустой — корневая категория).
+func AddCategory(db *sql.DB, name, slug, parentSlug, description string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", fmt.Errorf("не указано название категории")
+	}
+	if slug == "" {
+		slug = Slugify(name)
+	}
+	if !ValidSlug(slug) {
+		return "", fmt.Errorf("некорректный адрес категории: %q", slug)
+	}
+
+	var parentID sql.NullInt64
+	if parentSlug != "" {
+		err := db.QueryRow("SELECT id FROM categories WHERE slug = ?", parentSlug).Scan(&parentID)
+		if err == sql.ErrNoRows {
+			return "", fmt.Errorf("родительская категория %s не найдена", parentSlug)
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+
+	_, err := db.Exec("INSERT INTO categories (name, slug, parent_id, description) VALUES (?, ?, ?, ?)",
+		name, slug, parentID, strings.TrimSpace(description))
+	if err != nil {
+		return "", fmt.Errorf("ошибка создания категории (название и адрес должны быть уникальны): %w", err)
+	}
+	return slug, nil
+}
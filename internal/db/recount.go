@@ -0,0 +1,203 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// RecountResult — сколько постов и комментариев получили исправленные счётчики
+type RecountResult struct {
+	Posts    int
+	Comments int
+}
+
+type postActivity struct {
+	comments int
+	last     time.Time
+}
+
+type storedCounters struct {
+	id              int
+	likes, dislikes int
+	reactions       string
+	comments        int
+	created         time.Time
+	activity        sql.NullTime
+}
+
+// Recount пересчитывает счётчики реакций и комментариев по исходным таблицам
+// и исправляет расхождения. Всё выполняется в одной транзакции, так что
+// реакции, поставленные во время пересчёта, не потеряются.
+func Recount(db *sql.DB) (RecountResult, error) {
+	var result RecountResult
+	tx, err := db.Begin()
+	if err != nil {
+		return result, err
+	}
+	defer tx.Rollback()
+
+	reactions, err := countReactions(tx)
+	if err != nil {
+		return result, err
+	}
+	activity, err := countComments(tx)
+	if err != nil {
+		return result, err
+	}
+
+	if result.Posts, err = recountPosts(tx, reactions["post"], activity); err != nil {
+		return result, err
+	}
+	if result.Comments, err = recountComments(tx, reactions["comment"]); err != nil {
+		return result, err
+	}
+	return result, tx.Commit()
+}
+
+// countReactions: тип объекта → id → вид реакции → количество
+func countReactions(tx *sql.Tx) (map[string]map[int]map[string]int, error) {
+	rows, err := tx.Query("SELECT target_type, target_id, kind, COUNT(*) FROM reactions GROUP BY target_type, target_id, kind")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	counts := map[string]map[int]map[string]int{}
+	for rows.Next() {
+		var typ, kind string
+		var id, n int
+		if err := rows.Scan(&typ, &id, &kind, &n); err != nil {
+			return nil, err
+		}
+		if counts[typ] == nil {
+			counts[typ] = map[int]map[string]int{}
+		}
+		if counts[typ][id] == nil {
+			counts[typ][id] = map[string]int{}
+		}
+		counts[typ][id][kind] = n
+	}
+	return counts, rows.Err()
+}
+
+func countComments(tx *sql.Tx) (map[int]postActivity, error) {
+	rows, err := tx.Query("SELECT post_id, created_at FROM comments")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	activity := map[int]postActivity{}
+	for rows.Next() {
+		var postID int
+		var created time.Time
+		if err := rows.Scan(&postID, &created); err != nil {
+			return nil, err
+		}
+		a := activity[postID]
+		a.comments++
+		if created.After(a.last) {
+			a.last = created
+		}
+		activity[postID] = a
+	}
+	return activity, rows.Err()
+}
+
+func recountPosts(tx *sql.Tx, reactions map[int]map[string]int, activity map[int]postActivity) (int, error) {
+	stored, err := loadCounters(tx, `
+		SELECT id, COALESCE(likes, 0), COALESCE(dislikes, 0), reaction_counts, comment_count, created_at, last_activity_at
+		FROM posts`)
+	if err != nil {
+		return 0, err
+	}
+	fixed := 0
+	for _, s := range stored {
+		fresh := reactions[s.id]
+		a := activity[s.id]
+		last := s.created
+		if a.last.After(last) {
+			last = a.last
+		}
+		if sameCounters(s, fresh) && s.comments == a.comments && s.activity.Valid && s.activity.Time.Equal(last) {
+			continue
+		}
+		_, err := tx.Exec(`
+			UPDATE posts SET likes = ?, dislikes = ?, reaction_counts = ?, comment_count = ?, last_activity_at = ?
+			WHERE id = ?`, fresh["like"], fresh["dislike"], encodeCounts(fresh), a.comments, last, s.id)
+		if err != nil {
+			return fixed, err
+		}
+		fixed++
+	}
+	return fixed, nil
+}
+
+func recountComments(tx *sql.Tx, reactions map[int]map[string]int) (int, error) {
+	stored, err := loadCounters(tx, `SELECT id, likes, dislikes, reaction_counts, 0, created_at, NULL FROM comments`)
+	if err != nil {
+		return 0, err
+	}
+	fixed := 0
+	for _, s := range stored {
+		fresh := reactions[s.id]
+		if sameCounters(s, fresh) {
+			continue
+		}
+		_, err := tx.Exec(`UPDATE comments SET likes = ?, dislikes = ?, reaction_counts = ? WHERE id = ?`,
+			fresh["like"], fresh["dislike"], encodeCounts(fresh), s.id)
+		if err != nil {
+			return fixed, err
+		}
+		fixed++
+	}
+	return fixed, nil
+}
+
+// loadCounters читает сохранённые счётчики целиком до начала обновлений
+func loadCounters(tx *sql.Tx, query string) ([]storedCounters, error) {
+	rows, err := tx.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var stored []storedCounters
+	for rows.Next() {
+		var s storedCounters
+		if err := rows.Scan(&s.id, &s.likes, &s.dislikes, &s.reactions, &s.comments, &s.created, &s.activity); err != nil {
+			return nil, err
+		}
+		stored = append(stored, s)
+	}
+	return stored, rows.Err()
+}
+
+// sameCounters сравнивает сохранённые счётчики реакций с пересчитанными.
+// Нулевые значения в JSON равносильны отсутствующим.
+func sameCounters(s storedCounters, fresh map[string]int) bool {
+	if s.likes != fresh["like"] || s.dislikes != fresh["dislike"] {
+		return false
+	}
+	var counts map[string]int
+	if json.Unmarshal([]byte(s.reactions), &counts) != nil {
+		return false
+	}
+	for kind, n := range counts {
+		if n != fresh[kind] {
+			return false
+		}
+	}
+	for kind, n := range fresh {
+		if counts[kind] != n {
+			return false
+		}
+	}
+	return true
+}
+
+func encodeCounts(counts map[string]int) string {
+	if len(counts) == 0 {
+		return "{}"
+	}
+	data, _ := json.Marshal(counts)
+	return string(data)
+}
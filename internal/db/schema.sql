@@ -4,24 +4,44 @@ CREATE TABLE IF NOT EXISTS users (
     email TEXT NOT NULL UNIQUE,
     username TEXT NOT NULL UNIQUE,
     password TEXT NOT NULL,
+    role TEXT NOT NULL DEFAULT 'user', -- user, moderator, admin
+    digest TEXT NOT NULL DEFAULT 'off', -- email-дайджест: off, daily, weekly
+    digest_sent_at DATETIME,            -- конец периода последнего дайджеста
+    reputation REAL NOT NULL DEFAULT 0, -- очки за полученные реакции на момент reputation_at
+    reputation_at DATETIME,             -- к другому моменту очки приводятся затуханием
     created_at DATETIME DEFAULT CURRENT_TIMESTAMP
 );
 
 -- Таблица категорий
 CREATE TABLE IF NOT EXISTS categories (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
-    name TEXT NOT NULL UNIQUE
+    name TEXT NOT NULL UNIQUE,
+    -- Родительская категория (NULL — корневая): Футбол → Премьер-лига → Арсенал
+    parent_id INTEGER REFERENCES categories(id),
+    -- Адрес страницы категории: /c/<slug>
+    slug TEXT NOT NULL DEFAULT '',
+    description TEXT NOT NULL DEFAULT ''
 );
 
--- Таблица постов (добавлены поля likes и dislikes)
+-- Таблица постов. Счётчики реакций и комментариев обновляются в одной
+-- транзакции с самими реакциями и комментариями; `forum recount` пересчитывает их заново.
 CREATE TABLE IF NOT EXISTS posts (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
     user_id INTEGER NOT NULL,
     title TEXT NOT NULL,
     content TEXT NOT NULL,
+    content_html TEXT NOT NULL DEFAULT '', -- отрендеренный Markdown
     created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
     likes INTEGER DEFAULT 0,
     dislikes INTEGER DEFAULT 0,
+    reaction_counts TEXT NOT NULL DEFAULT '{}', -- JSON: вид реакции → количество
+    comment_count INTEGER NOT NULL DEFAULT 0,
+    last_activity_at DATETIME, -- последний комментарий или создание поста
+    locked BOOLEAN NOT NULL DEFAULT FALSE, -- новые комментарии запрещены
+    pinned_at DATETIME, -- закреплён модератором
+    pinned_category_id INTEGER REFERENCES categories(id), -- NULL — закреплён везде
+    archived_at DATETIME, -- в архиве: ни комментариев, ни реакций
+    unarchived_at DATETIME, -- возвращён из архива; отсюда заново отсчитывается неактивность
     FOREIGN KEY (user_id) REFERENCES users(id)
 );
 
@@ -40,39 +60,394 @@ CREATE TABLE IF NOT EXISTS comments (
     post_id INTEGER NOT NULL,
     user_id INTEGER NOT NULL,
     content TEXT NOT NULL,
+    content_html TEXT NOT NULL DEFAULT '', -- отрендеренный Markdown
+    parent_id INTEGER REFERENCES comments(id), -- комментарий, на который это ответ
     created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    likes INTEGER NOT NULL DEFAULT 0,
+    dislikes INTEGER NOT NULL DEFAULT 0,
+    reaction_counts TEXT NOT NULL DEFAULT '{}', -- JSON: вид реакции → количество
     FOREIGN KEY (post_id) REFERENCES posts(id),
     FOREIGN KEY (user_id) REFERENCES users(id)
 );
 
--- Таблица лайков/дизлайков для постов
-CREATE TABLE IF NOT EXISTS post_likes (
+-- Реакции на посты и комментарии. kind — вид реакции из настроек
+-- (like, dislike, fire…); у пользователя одна реакция на объект.
+-- Лайки из прежних таблиц post_likes и comment_likes переносятся сюда при запуске.
+CREATE TABLE IF NOT EXISTS reactions (
+    target_type TEXT NOT NULL CHECK (target_type IN ('post', 'comment')),
+    target_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    kind TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (target_type, target_id, user_id),
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_reactions_target ON reactions(target_type, target_id, kind);
+CREATE INDEX IF NOT EXISTS idx_reactions_user ON reactions(user_id, kind);
+
+-- Таблица сессий пользователей (для cookies)
+CREATE TABLE IF NOT EXISTS sessions (
+    id TEXT PRIMARY KEY, -- UUID
+    user_id INTEGER NOT NULL,
+    expires_at DATETIME NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+-- Счётчики неудачных входов по аккаунту и по IP (ключи "account:<email>", "ip:<адрес>")
+CREATE TABLE IF NOT EXISTS login_throttle (
+    key TEXT PRIMARY KEY,
+    failures INTEGER NOT NULL DEFAULT 0,
+    last_failure_at DATETIME NOT NULL,
+    locked_until DATETIME
+);
+
+-- Журнал неудачных попыток входа
+CREATE TABLE IF NOT EXISTS login_failures (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    email TEXT NOT NULL,
+    ip TEXT NOT NULL,
+    user_id INTEGER, -- NULL, если пользователь не найден
+    reason TEXT NOT NULL, -- unknown_user, bad_password, locked
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Изображения, прикреплённые к постам. Сами файлы лежат в хранилище
+-- блобов под ключом SHA-256 содержимого.
+CREATE TABLE IF NOT EXISTS attachments (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
     post_id INTEGER NOT NULL,
     user_id INTEGER NOT NULL,
-    is_like BOOLEAN NOT NULL, -- TRUE = like, FALSE = dislike
+    blob_key TEXT NOT NULL,
+    thumb_key TEXT NOT NULL, -- совпадает с blob_key, если миниатюра не нужна
+    mime TEXT NOT NULL,
+    width INTEGER NOT NULL,
+    height INTEGER NOT NULL,
+    size INTEGER NOT NULL,
     created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-    UNIQUE (post_id, user_id),
     FOREIGN KEY (post_id) REFERENCES posts(id),
     FOREIGN KEY (user_id) REFERENCES users(id)
 );
 
--- Таблица лайков/дизлайков для комментариев
-CREATE TABLE IF NOT EXISTS comment_likes (
+CREATE INDEX IF NOT EXISTS idx_attachments_post ON attachments(post_id);
+
+-- Опросы в постах (не больше одного на пост)
+CREATE TABLE IF NOT EXISTS polls (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    post_id INTEGER NOT NULL UNIQUE,
+    question TEXT NOT NULL,
+    multiple BOOLEAN NOT NULL DEFAULT FALSE, -- можно выбрать несколько вариантов
+    closes_at DATETIME, -- NULL — опрос бессрочный
+    results TEXT NOT NULL DEFAULT 'always', -- always, voted, closed: когда показывать итоги
+    FOREIGN KEY (post_id) REFERENCES posts(id)
+);
+
+CREATE TABLE IF NOT EXISTS poll_options (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
-    comment_id INTEGER NOT NULL,
+    poll_id INTEGER NOT NULL,
+    position INTEGER NOT NULL,
+    text TEXT NOT NULL,
+    FOREIGN KEY (poll_id) REFERENCES polls(id)
+);
+
+-- Бюллетень: один на пользователя в опросе, это и есть "один голос"
+CREATE TABLE IF NOT EXISTS poll_ballots (
+    poll_id INTEGER NOT NULL,
     user_id INTEGER NOT NULL,
-    is_like BOOLEAN NOT NULL, -- TRUE = like, FALSE = dislike
     created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-    UNIQUE (comment_id, user_id),
-    FOREIGN KEY (comment_id) REFERENCES comments(id),
+    PRIMARY KEY (poll_id, user_id),
+    FOREIGN KEY (poll_id) REFERENCES polls(id),
     FOREIGN KEY (user_id) REFERENCES users(id)
 );
 
--- Таблица сессий пользователей (для cookies)
-CREATE TABLE IF NOT EXISTS sessions (
-    id TEXT PRIMARY KEY, -- UUID
+-- Выбранные в бюллетене варианты
+CREATE TABLE IF NOT EXISTS poll_votes (
+    poll_id INTEGER NOT NULL,
     user_id INTEGER NOT NULL,
-    expires_at DATETIME NOT NULL,
+    option_id INTEGER NOT NULL,
+    PRIMARY KEY (poll_id, user_id, option_id),
+    FOREIGN KEY (poll_id, user_id) REFERENCES poll_ballots(poll_id, user_id),
+    FOREIGN KEY (option_id) REFERENCES poll_options(id)
+);
+
+-- Свободные теги постов. Имя хранится нормализованным: строчные буквы,
+-- цифры и дефисы ("лига-чемпионов").
+CREATE TABLE IF NOT EXISTS tags (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL UNIQUE,
+    banned BOOLEAN NOT NULL DEFAULT FALSE, -- запрещён модератором
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Синонимы: "лч" → "лига-чемпионов". Появляются при слиянии тегов.
+CREATE TABLE IF NOT EXISTS tag_aliases (
+    alias TEXT PRIMARY KEY,
+    tag_id INTEGER NOT NULL,
+    FOREIGN KEY (tag_id) REFERENCES tags(id)
+);
+
+CREATE TABLE IF NOT EXISTS post_tags (
+    post_id INTEGER NOT NULL,
+    tag_id INTEGER NOT NULL,
+    PRIMARY KEY (post_id, tag_id),
+    FOREIGN KEY (post_id) REFERENCES posts(id),
+    FOREIGN KEY (tag_id) REFERENCES tags(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_post_tags_tag ON post_tags(tag_id);
+
+-- Подписки пользователя на пост, категорию или другого пользователя
+CREATE TABLE IF NOT EXISTS follows (
+    user_id INTEGER NOT NULL,
+    target_type TEXT NOT NULL CHECK (target_type IN ('post', 'category', 'user')),
+    target_id INTEGER NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, target_type, target_id),
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_follows_target ON follows(target_type, target_id);
+
+-- Уведомления. Непрочитанные однотипные события об одном объекте копятся
+-- в одной строке («5 человек оценили ваш пост»), после прочтения начинается новая.
+CREATE TABLE IF NOT EXISTS notifications (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,     -- получатель
+    kind TEXT NOT NULL,           -- comment, reply, like, mention, post
+    target_type TEXT NOT NULL,    -- post, comment, category, user
+    target_id INTEGER NOT NULL,
+    post_id INTEGER NOT NULL,     -- пост, на который ведёт уведомление
+    actor_id INTEGER NOT NULL,    -- автор последнего события
+    events INTEGER NOT NULL DEFAULT 1,
+    read BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at DATETIME NOT NULL,
+    updated_at DATETIME NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    FOREIGN KEY (actor_id) REFERENCES users(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_notifications_user ON notifications(user_id, updated_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_notifications_unread
+    ON notifications(user_id, kind, target_type, target_id) WHERE NOT read;
+
+-- Разные люди, вызвавшие события одного уведомления
+CREATE TABLE IF NOT EXISTS notification_actors (
+    notification_id INTEGER NOT NULL,
+    actor_id INTEGER NOT NULL,
+    PRIMARY KEY (notification_id, actor_id),
+    FOREIGN KEY (notification_id) REFERENCES notifications(id)
+);
+
+-- Упоминания @имя в постах и комментариях
+CREATE TABLE IF NOT EXISTS mentions (
+    target_type TEXT NOT NULL CHECK (target_type IN ('post', 'comment')),
+    target_id INTEGER NOT NULL,
+    post_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,   -- кого упомянули
+    author_id INTEGER NOT NULL, -- кто упомянул
+    created_at DATETIME NOT NULL,
+    PRIMARY KEY (target_type, target_id, user_id),
+    FOREIGN KEY (post_id) REFERENCES posts(id),
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    FOREIGN KEY (author_id) REFERENCES users(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_mentions_user ON mentions(user_id, post_id);
+
+-- Сообщения живого чата. Комната чата — категория.
+CREATE TABLE IF NOT EXISTS chat_messages (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    category_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    content TEXT NOT NULL,
+    created_at DATETIME NOT NULL,
+    FOREIGN KEY (category_id) REFERENCES categories(id),
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_chat_messages_room ON chat_messages(category_id, id);
+
+-- Ограничения, наложенные модераторами чата: mute — нельзя писать,
+-- kick — нельзя войти в комнату до until
+CREATE TABLE IF NOT EXISTS chat_restrictions (
+    category_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    kind TEXT NOT NULL CHECK (kind IN ('mute', 'kick')),
+    until DATETIME NOT NULL,
+    moderator_id INTEGER NOT NULL,
+    created_at DATETIME NOT NULL,
+    PRIMARY KEY (category_id, user_id, kind),
+    FOREIGN KEY (category_id) REFERENCES categories(id),
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    FOREIGN KEY (moderator_id) REFERENCES users(id)
+);
+
+-- Папки закладок пользователя
+CREATE TABLE IF NOT EXISTS bookmark_folders (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    created_at DATETIME NOT NULL,
+    UNIQUE (user_id, name),
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+-- Закладки на посты и комментарии; видны только владельцу.
+-- post_id — пост самой закладки или комментария, для фильтров ленты.
+CREATE TABLE IF NOT EXISTS bookmarks (
+    user_id INTEGER NOT NULL,
+    target_type TEXT NOT NULL CHECK (target_type IN ('post', 'comment')),
+    target_id INTEGER NOT NULL,
+    post_id INTEGER NOT NULL,
+    folder_id INTEGER REFERENCES bookmark_folders(id), -- NULL — без папки
+    note TEXT NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL,
+    PRIMARY KEY (user_id, target_type, target_id),
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    FOREIGN KEY (post_id) REFERENCES posts(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_bookmarks_folder ON bookmarks(user_id, folder_id);
+
+-- Черновики постов. С publish_at черновик запланирован: планировщик
+-- опубликует его в это время. До публикации в posts его нет.
+CREATE TABLE IF NOT EXISTS drafts (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    title TEXT NOT NULL DEFAULT '',
+    content TEXT NOT NULL DEFAULT '',
+    categories TEXT NOT NULL DEFAULT '[]', -- JSON-массив id категорий
+    tags TEXT NOT NULL DEFAULT '', -- как в поле формы, через запятую
+    poll TEXT NOT NULL DEFAULT '{}', -- поля опроса из формы
+    publish_at DATETIME,
+    error TEXT NOT NULL DEFAULT '', -- почему не удалась публикация по расписанию
+    created_at DATETIME NOT NULL,
+    updated_at DATETIME NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_drafts_user ON drafts(user_id, updated_at);
+CREATE INDEX IF NOT EXISTS idx_drafts_publish ON drafts(publish_at) WHERE publish_at IS NOT NULL;
+
+-- Изображения черновика; при публикации переносятся в attachments
+CREATE TABLE IF NOT EXISTS draft_attachments (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    draft_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    blob_key TEXT NOT NULL,
+    thumb_key TEXT NOT NULL,
+    mime TEXT NOT NULL,
+    width INTEGER NOT NULL,
+    height INTEGER NOT NULL,
+    size INTEGER NOT NULL,
+    FOREIGN KEY (draft_id) REFERENCES drafts(id),
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_draft_attachments_draft ON draft_attachments(draft_id);
+
+-- Журнал действий модераторов
+CREATE TABLE IF NOT EXISTS moderation_log (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    moderator_id INTEGER NOT NULL,
+    action TEXT NOT NULL, -- lock, unlock, pin, unpin, archive, unarchive
+    target_type TEXT NOT NULL,
+    target_id INTEGER NOT NULL,
+    details TEXT NOT NULL DEFAULT '', -- например, где закреплён пост
+    reason TEXT NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL,
+    FOREIGN KEY (moderator_id) REFERENCES users(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_moderation_log_target ON moderation_log(target_type, target_id);
+
+-- Заглушённые (mute) и заблокированные (block) пользователи: их посты и
+-- комментарии скрыты от user_id; заблокированные к тому же не могут
+-- отвечать ему и упоминать его
+CREATE TABLE IF NOT EXISTS user_blocks (
+    user_id INTEGER NOT NULL,
+    target_id INTEGER NOT NULL,
+    kind TEXT NOT NULL CHECK (kind IN ('mute', 'block')),
+    created_at DATETIME NOT NULL,
+    PRIMARY KEY (user_id, target_id),
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    FOREIGN KEY (target_id) REFERENCES users(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_blocks_target ON user_blocks(target_id);
+
+-- Личные переписки: диалоги один на один и небольшие группы
+CREATE TABLE IF NOT EXISTS conversations (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    title TEXT NOT NULL DEFAULT '', -- название группы
+    is_group BOOLEAN NOT NULL DEFAULT FALSE,
+    created_by INTEGER NOT NULL,
+    created_at DATETIME NOT NULL,
+    last_message_at DATETIME NOT NULL,
+    FOREIGN KEY (created_by) REFERENCES users(id)
+);
+
+-- last_read_id — последнее прочитанное сообщение: по нему считаются
+-- непрочитанные и отметки о прочтении
+CREATE TABLE IF NOT EXISTS conversation_members (
+    conversation_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    last_read_id INTEGER NOT NULL DEFAULT 0,
+    joined_at DATETIME NOT NULL,
+    PRIMARY KEY (conversation_id, user_id),
+    FOREIGN KEY (conversation_id) REFERENCES conversations(id),
     FOREIGN KEY (user_id) REFERENCES users(id)
 );
+
+CREATE INDEX IF NOT EXISTS idx_conversation_members_user ON conversation_members(user_id);
+
+CREATE TABLE IF NOT EXISTS messages (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    conversation_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    content TEXT NOT NULL,
+    created_at DATETIME NOT NULL,
+    FOREIGN KEY (conversation_id) REFERENCES conversations(id),
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_messages_conversation ON messages(conversation_id, id);
+
+-- Очередь проверки: посты и комментарии, задержанные фильтрами спама.
+-- Задержанный пост ждёт в черновиках автора (draft_id), комментарий
+-- хранится здесь же. Решение модератора обучает классификатор.
+CREATE TABLE IF NOT EXISTS held_content (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    target_type TEXT NOT NULL CHECK (target_type IN ('post', 'comment')),
+    user_id INTEGER NOT NULL,
+    draft_id INTEGER,
+    post_id INTEGER,
+    parent_id INTEGER,
+    content TEXT NOT NULL DEFAULT '',
+    filter TEXT NOT NULL, -- сработавший фильтр
+    reason TEXT NOT NULL DEFAULT '',
+    score REAL NOT NULL DEFAULT 0, -- вероятность спама по классификатору
+    created_at DATETIME NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    FOREIGN KEY (draft_id) REFERENCES drafts(id),
+    FOREIGN KEY (post_id) REFERENCES posts(id)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_held_content_draft ON held_content(draft_id) WHERE draft_id IS NOT NULL;
+
+-- Байесовский классификатор: в скольких спамных и обычных текстах
+-- встречалось слово и сколько всего текстов каждого вида
+CREATE TABLE IF NOT EXISTS spam_tokens (
+    token TEXT PRIMARY KEY,
+    spam INTEGER NOT NULL DEFAULT 0,
+    ham INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS spam_corpus (
+    label TEXT PRIMARY KEY CHECK (label IN ('spam', 'ham')),
+    docs INTEGER NOT NULL DEFAULT 0
+);
+
+-- Поиск повторов просматривает недавние посты и комментарии
+CREATE INDEX IF NOT EXISTS idx_posts_created ON posts(created_at);
+CREATE INDEX IF NOT EXISTS idx_comments_created ON comments(created_at);
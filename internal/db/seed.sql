@@ -1,14 +1,26 @@
 -- Категории
 
-INSERT INTO categories (name) VALUES
+INSERT INTO categories (name, slug, description) VALUES
 
-('Футбол'),
-('Баскетбол'),
-('Бокс'),
-('Теннис'),
-('Формула-1'),
-('Хоккей'),
-('Олимпийские игры');
+('Футбол', 'football', 'Матчи, трансферы и турниры со всего мира'),
+('Баскетбол', 'basketball', 'НБА, Евролига и российский баскетбол'),
+('Бокс', 'boxing', 'Бои, поясы и рейтинги'),
+('Теннис', 'tennis', 'Турниры Большого шлема и ATP/WTA'),
+('Формула-1', 'formula-1', 'Гонки, команды и регламент'),
+('Хоккей', 'hockey', 'КХЛ, НХЛ и сборные'),
+('Олимпийские игры', 'olympics', 'Летние и зимние Олимпиады');
+
+-- Подкатегории
+INSERT INTO categories (name, slug, description, parent_id) VALUES
+
+('Премьер-лига', 'premier-league', 'Чемпионат Англии', 1),
+('РПЛ', 'rpl', 'Российская Премьер-лига', 1),
+('НБА', 'nba', 'Национальная баскетбольная ассоциация', 2),
+('КХЛ', 'khl', 'Континентальная хоккейная лига', 6);
+
+INSERT INTO categories (name, slug, description, parent_id) VALUES
+
+('Арсенал', 'arsenal', 'Всё о лондонском «Арсенале»', 8);
 
 
 -- Пользователи
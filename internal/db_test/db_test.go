@@ -0,0 +1,199 @@
+package db_test
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+
+	dbinit "forum/internal/db"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestSlugify(t *testing.T) {
+	tests := map[string]string{
+		"Футбол":             "futbol",
+		"Формула-1":          "formula-1",
+		"Олимпийские игры":   "olimpiiskie-igry",
+		"Премьер-лига":       "premer-liga",
+		"  NBA / Евролига  ": "nba-evroliga",
+		"Щёлково":            "shchelkovo",
+		"!!!":                "",
+	}
+	for in, want := range tests {
+		if got := dbinit.Slugify(in); got != want {
+			t.Errorf("Slugify(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestAddCategory(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	db.Exec(`CREATE TABLE categories (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT UNIQUE, parent_id INTEGER, slug TEXT UNIQUE, description TEXT NOT NULL DEFAULT '')`)
+
+	if slug, err := dbinit.AddCategory(db, "Футбол", "football", "", "Всё о футболе"); err != nil || slug != "football" {
+		t.Fatalf("AddCategory: %q %v", slug, err)
+	}
+	if slug, err := dbinit.AddCategory(db, "Премьер-лига", "", "football", ""); err != nil || slug != "premer-liga" {
+		t.Fatalf("slug must be derived from name: %q %v", slug, err)
+	}
+	var parentID int
+	db.QueryRow(`SELECT parent_id FROM categories WHERE slug = 'premer-liga'`).Scan(&parentID)
+	if parentID != 1 {
+		t.Errorf("parent_id = %d, want 1", parentID)
+	}
+
+	if _, err := dbinit.AddCategory(db, "Арсенал", "", "premier-league", ""); err == nil {
+		t.Error("unknown parent must be rejected")
+	}
+	if _, err := dbinit.AddCategory(db, "Арсенал", "Arsenal FC", "", ""); err == nil {
+		t.Error("invalid slug must be rejected")
+	}
+	if _, err := dbinit.AddCategory(db, "Соккер", "football", "", ""); err == nil {
+		t.Error("duplicate slug must be rejected")
+	}
+}
+
+// openMemoryDB открывает базу в памяти; InitDatabase читает схему по пути
+// от корня проекта, поэтому рабочий каталог на время теста меняется
+func openMemoryDB(t *testing.T) *sql.DB {
+	wd, _ := os.Getwd()
+	if err := os.Chdir("../.."); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	db.SetMaxOpenConns(1)
+	return db
+}
+
+func TestInitDatabase_MigratesLikes(t *testing.T) {
+	db := openMemoryDB(t)
+	db.Exec(`CREATE TABLE post_likes (id INTEGER PRIMARY KEY AUTOINCREMENT, post_id INTEGER NOT NULL, user_id INTEGER NOT NULL, is_like BOOLEAN NOT NULL, created_at DATETIME DEFAULT CURRENT_TIMESTAMP, UNIQUE (post_id, user_id))`)
+	db.Exec(`CREATE TABLE comment_likes (id INTEGER PRIMARY KEY AUTOINCREMENT, comment_id INTEGER NOT NULL, user_id INTEGER NOT NULL, is_like BOOLEAN NOT NULL, created_at DATETIME DEFAULT CURRENT_TIMESTAMP, UNIQUE (comment_id, user_id))`)
+	db.Exec(`INSERT INTO post_likes (post_id, user_id, is_like, created_at) VALUES (1, 1, TRUE, '2024-05-01 10:00:00'), (1, 2, FALSE, '2024-05-01 11:00:00')`)
+	db.Exec(`INSERT INTO comment_likes (comment_id, user_id, is_like) VALUES (7, 2, TRUE)`)
+
+	if err := dbinit.InitDatabase(db); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := db.Query(`SELECT target_type, target_id, user_id, kind FROM reactions ORDER BY target_type DESC, user_id`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for rows.Next() {
+		var typ, kind string
+		var target, user int
+		rows.Scan(&typ, &target, &user, &kind)
+		got = append(got, fmt.Sprintf("%s-%d:%d:%s", typ, target, user, kind))
+	}
+	rows.Close()
+	want := "[post-1:1:like post-1:2:dislike comment-7:2:like]"
+	if fmt.Sprint(got) != want {
+		t.Errorf("reactions = %v, want %s", got, want)
+	}
+	var created string
+	db.QueryRow(`SELECT created_at FROM reactions WHERE target_type = 'post' AND user_id = 1`).Scan(&created)
+	if created[:10] != "2024-05-01" {
+		t.Errorf("created_at must be kept, got %q", created)
+	}
+
+	var old int
+	db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE name IN ('post_likes', 'comment_likes')`).Scan(&old)
+	if old != 0 {
+		t.Error("old like tables must be dropped")
+	}
+	// Повторный запуск на уже перенесённой базе ничего не ломает
+	if err := dbinit.InitDatabase(db); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRecount(t *testing.T) {
+	db := openMemoryDB(t)
+	if err := dbinit.InitDatabase(db); err != nil {
+		t.Fatal(err)
+	}
+	db.Exec(`INSERT INTO users (id, email, username, password) VALUES (1, 'a@example.com', 'fan1', 'x'), (2, 'b@example.com', 'fan2', 'x')`)
+	// Счётчики разошлись с данными: реакции и комментарии добавлены в обход обработчиков
+	db.Exec(`INSERT INTO posts (id, user_id, title, content, created_at, likes, reaction_counts, comment_count, last_activity_at) VALUES
+		(1, 1, 'A', 'текст', '2024-05-01 10:00:00', 5, '{"like":5}', 0, '2024-05-01 10:00:00'),
+		(2, 1, 'B', 'текст', '2024-05-02 10:00:00', 0, '{"like":0}', 0, '2024-05-02 10:00:00')`)
+	db.Exec(`INSERT INTO comments (id, post_id, user_id, content, created_at) VALUES
+		(1, 1, 2, 'первый', '2024-05-03 10:00:00'),
+		(2, 1, 1, 'второй', '2024-05-04 10:00:00')`)
+	db.Exec(`INSERT INTO reactions (target_type, target_id, user_id, kind) VALUES
+		('post', 1, 2, 'fire'), ('post', 1, 1, 'dislike'), ('comment', 2, 2, 'like')`)
+
+	res, err := dbinit.Recount(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Пост B согласован: нулевой счётчик в JSON равен отсутствующему
+	if res.Posts != 1 || res.Comments != 1 {
+		t.Errorf("fixed %+v, want 1 post and 1 comment", res)
+	}
+
+	var likes, dislikes, comments int
+	var counts, activity string
+	db.QueryRow(`SELECT likes, dislikes, reaction_counts, comment_count, last_activity_at FROM posts WHERE id = 1`).
+		Scan(&likes, &dislikes, &counts, &comments, &activity)
+	if likes != 0 || dislikes != 1 || counts != `{"dislike":1,"fire":1}` || comments != 2 || activity[:10] != "2024-05-04" {
+		t.Errorf("post 1: %d %d %s %d %s", likes, dislikes, counts, comments, activity)
+	}
+	db.QueryRow(`SELECT likes, reaction_counts FROM comments WHERE id = 2`).Scan(&likes, &counts)
+	if likes != 1 || counts != `{"like":1}` {
+		t.Errorf("comment 2: %d %s", likes, counts)
+	}
+
+	if res, err := dbinit.Recount(db); err != nil || res.Posts != 0 || res.Comments != 0 {
+		t.Errorf("second run must find nothing: %+v %v", res, err)
+	}
+}
+
+func TestInitDatabase_BackfillsSeedSlugs(t *testing.T) {
+	db := openMemoryDB(t)
+	seed, err := os.ReadFile("internal/db/seed.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Категории старой базы: те же названия из seed.sql, но без колонки slug
+	db.Exec(`CREATE TABLE categories (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT UNIQUE NOT NULL)`)
+	categories, _, _ := strings.Cut(string(seed), "-- Пользователи")
+	want := map[string]string{}
+	for _, m := range regexp.MustCompile(`\('([^']+)', '([a-z0-9-]+)', '`).FindAllStringSubmatch(categories, -1) {
+		db.Exec(`INSERT INTO categories (name) VALUES (?)`, m[1])
+		want[m[1]] = m[2]
+	}
+	db.Exec(`INSERT INTO categories (name) VALUES ('Волейбол')`)
+	want["Волейбол"] = "voleibol"
+	if len(want) < 8 {
+		t.Fatalf("seed.sql categories not found: %v", want)
+	}
+
+	if err := dbinit.InitDatabase(db); err != nil {
+		t.Fatal(err)
+	}
+	for name, slug := range want {
+		var got string
+		db.QueryRow(`SELECT slug FROM categories WHERE name = ?`, name).Scan(&got)
+		if got != slug {
+			t.Errorf("slug of %q = %q, want %q", name, got, slug)
+		}
+	}
+}
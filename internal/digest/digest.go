@@ -0,0 +1,322 @@
+// Package digest собирает письма-дайджесты: новые посты в категориях,
+// на которые подписан пользователь, и ответы в его обсуждениях.
+package digest
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	htmltemplate "html/template"
+	"log"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+	"time"
+	"unicode/utf8"
+
+	"forum/internal/mail"
+)
+
+// Периодичность дайджеста, значение users.digest
+const (
+	Off    = "off"
+	Daily  = "daily"
+	Weekly = "weekly"
+)
+
+// Periods — длительность периода для каждого режима
+var Periods = map[string]time.Duration{
+	Daily:  24 * time.Hour,
+	Weekly: 7 * 24 * time.Hour,
+}
+
+const (
+	maxPosts    = 20
+	maxComments = 30
+	excerptLen  = 200
+)
+
+type Post struct {
+	ID     int
+	Title  string
+	Author string
+	URL    string
+}
+
+type Comment struct {
+	Author  string
+	Excerpt string
+}
+
+// Thread — новые комментарии в одном обсуждении
+type Thread struct {
+	PostID   int
+	Title    string
+	URL      string
+	Comments []Comment
+}
+
+// Digest — данные шаблонов письма
+type Digest struct {
+	Username       string
+	Period         string
+	Since, Until   time.Time
+	Posts          []Post
+	Threads        []Thread
+	BaseURL        string
+	SettingsURL    string
+	UnsubscribeURL string
+}
+
+func (d *Digest) Empty() bool {
+	return len(d.Posts) == 0 && len(d.Threads) == 0
+}
+
+// Scheduler периодически рассылает дайджесты тем, кому подошёл срок
+type Scheduler struct {
+	DB      *sql.DB
+	Mail    mail.Transport
+	HTML    *htmltemplate.Template
+	Text    *texttemplate.Template
+	BaseURL string
+	Secret  []byte
+	Now     func() time.Time
+}
+
+func (s *Scheduler) now() time.Time {
+	if s.Now != nil {
+		return s.Now()
+	}
+	return time.Now()
+}
+
+// LoadTemplates читает digest.html и digest.txt из каталога dir
+func LoadTemplates(dir string) (*htmltemplate.Template, *texttemplate.Template, error) {
+	html, err := htmltemplate.ParseFiles(filepath.Join(dir, "digest.html"))
+	if err != nil {
+		return nil, nil, fmt.Errorf("ошибка разбора HTML-шаблона дайджеста: %w", err)
+	}
+	text, err := texttemplate.ParseFiles(filepath.Join(dir, "digest.txt"))
+	if err != nil {
+		return nil, nil, fmt.Errorf("ошибка разбора текстового шаблона дайджеста: %w", err)
+	}
+	return html, text, nil
+}
+
+// Run проверяет очередь каждые interval, пока не отменён ctx
+func (s *Scheduler) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if sent, err := s.RunOnce(); err != nil {
+			log.Println("Ошибка рассылки дайджестов:", err)
+		} else if sent > 0 {
+			log.Printf("Отправлено дайджестов: %d", sent)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+type recipient struct {
+	id              int
+	email, username string
+	period          string
+	sentAt          sql.NullTime
+}
+
+// RunOnce отправляет дайджесты всем, у кого истёк период, и возвращает
+// число отправленных писем. Пустой дайджест не отправляется, но период
+// всё равно сдвигается.
+func (s *Scheduler) RunOnce() (int, error) {
+	now := s.now().UTC()
+	rows, err := s.DB.Query(`SELECT id, email, username, digest, digest_sent_at FROM users WHERE digest IN (?, ?)`, Daily, Weekly)
+	if err != nil {
+		return 0, err
+	}
+	var due []recipient
+	for rows.Next() {
+		var r recipient
+		if err := rows.Scan(&r.id, &r.email, &r.username, &r.period, &r.sentAt); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if !r.sentAt.Valid || !now.Before(r.sentAt.Time.Add(Periods[r.period])) {
+			due = append(due, r)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, r := range due {
+		since := now.Add(-Periods[r.period])
+		if r.sentAt.Valid {
+			since = r.sentAt.Time
+		}
+		ok, err := s.send(r, since, now)
+		if err != nil {
+			// Период не сдвигаем: попробуем снова на следующем проходе
+			log.Printf("Ошибка дайджеста для %s: %v", r.email, err)
+			continue
+		}
+		if ok {
+			sent++
+		}
+		if _, err := s.DB.Exec(`UPDATE users SET digest_sent_at = ? WHERE id = ?`, now, r.id); err != nil {
+			return sent, err
+		}
+	}
+	return sent, nil
+}
+
+func (s *Scheduler) send(r recipient, since, until time.Time) (bool, error) {
+	d, err := s.Build(r.id, since, until)
+	if err != nil {
+		return false, err
+	}
+	if d.Empty() {
+		return false, nil
+	}
+	d.Username = r.username
+	d.Period = r.period
+
+	var html, text strings.Builder
+	if err := s.HTML.Execute(&html, d); err != nil {
+		return false, err
+	}
+	if err := s.Text.Execute(&text, d); err != nil {
+		return false, err
+	}
+	subject := "Дайджест форума за день"
+	if r.period == Weekly {
+		subject = "Дайджест форума за неделю"
+	}
+	return true, s.Mail.Send(mail.Message{
+		To:      r.email,
+		Subject: subject,
+		Text:    text.String(),
+		HTML:    html.String(),
+		Headers: map[string]string{"List-Unsubscribe": "<" + d.UnsubscribeURL + ">"},
+	})
+}
+
+// Build собирает дайджест пользователя за период (since, until]
+func (s *Scheduler) Build(userID int, since, until time.Time) (*Digest, error) {
+	base := strings.TrimRight(s.BaseURL, "/")
+	d := &Digest{
+		Since:          since,
+		Until:          until,
+		BaseURL:        base,
+		SettingsURL:    base + "/notifications",
+		UnsubscribeURL: UnsubscribeURL(base, s.Secret, userID),
+	}
+
+	// Новые посты в категориях из подписок, включая подкатегории
+	rows, err := s.DB.Query(`
+		WITH RECURSIVE followed(id) AS (
+			SELECT target_id FROM follows WHERE user_id = ? AND target_type = 'category'
+			UNION
+			SELECT c.id FROM categories c JOIN followed f ON c.parent_id = f.id
+		)
+		SELECT DISTINCT p.id, p.title, u.username, p.created_at
+		FROM posts p
+		JOIN users u ON u.id = p.user_id
+		JOIN post_categories pc ON pc.post_id = p.id
+		WHERE pc.category_id IN (SELECT id FROM followed)
+			AND p.user_id != ? AND p.created_at > ? AND p.created_at <= ?
+		ORDER BY p.created_at DESC
+		LIMIT ?
+	`, userID, userID, since, until, maxPosts)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var p Post
+		var createdAt time.Time
+		if err := rows.Scan(&p.ID, &p.Title, &p.Author, &createdAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		p.URL = base + "/post/" + strconv.Itoa(p.ID)
+		d.Posts = append(d.Posts, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Ответы в обсуждениях: комментарии к своим постам и постам из подписок,
+	// ответы на свои комментарии
+	rows, err = s.DB.Query(`
+		SELECT c.post_id, p.title, u.username, c.content
+		FROM comments c
+		JOIN posts p ON p.id = c.post_id
+		JOIN users u ON u.id = c.user_id
+		WHERE c.user_id != ? AND c.created_at > ? AND c.created_at <= ? AND (
+			p.user_id = ?
+			OR c.post_id IN (SELECT target_id FROM follows WHERE user_id = ? AND target_type = 'post')
+			OR c.parent_id IN (SELECT id FROM comments WHERE user_id = ?)
+		)
+		ORDER BY c.created_at DESC
+		LIMIT ?
+	`, userID, since, until, userID, userID, userID, maxComments)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	threads := map[int]int{} // post_id → индекс в d.Threads
+	for rows.Next() {
+		var postID int
+		var title string
+		var c Comment
+		if err := rows.Scan(&postID, &title, &c.Author, &c.Excerpt); err != nil {
+			return nil, err
+		}
+		c.Excerpt = excerpt(c.Excerpt)
+		i, ok := threads[postID]
+		if !ok {
+			i = len(d.Threads)
+			threads[postID] = i
+			d.Threads = append(d.Threads, Thread{PostID: postID, Title: title, URL: base + "/post/" + strconv.Itoa(postID)})
+		}
+		d.Threads[i].Comments = append(d.Threads[i].Comments, c)
+	}
+	return d, rows.Err()
+}
+
+// excerpt сокращает текст комментария до excerptLen символов в одну строку
+func excerpt(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if utf8.RuneCountInString(s) <= excerptLen {
+		return s
+	}
+	return string([]rune(s)[:excerptLen]) + "…"
+}
+
+// UnsubscribeToken подписывает ссылку отписки пользователя userID
+func UnsubscribeToken(secret []byte, userID int) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("digest-unsubscribe|" + strconv.Itoa(userID)))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyUnsubscribe проверяет подпись ссылки отписки
+func VerifyUnsubscribe(secret []byte, userID int, token string) bool {
+	return len(secret) > 0 && hmac.Equal([]byte(token), []byte(UnsubscribeToken(secret, userID)))
+}
+
+func UnsubscribeURL(base string, secret []byte, userID int) string {
+	q := url.Values{"u": {strconv.Itoa(userID)}, "t": {UnsubscribeToken(secret, userID)}}
+	return strings.TrimRight(base, "/") + "/unsubscribe?" + q.Encode()
+}
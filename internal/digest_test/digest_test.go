@@ -0,0 +1,161 @@
+package digest_test
+
+import (
+	"database/sql"
+	"forum/internal/digest"
+	"forum/internal/mail"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// memoryTransport запоминает письма вместо отправки
+type memoryTransport struct {
+	sent []mail.Message
+}
+
+func (m *memoryTransport) Send(msg mail.Message) error {
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+var start = time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)
+
+func setup(t *testing.T) (*sql.DB, *digest.Scheduler, *memoryTransport, *time.Time) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	db.SetMaxOpenConns(1)
+	_, err = db.Exec(`
+		CREATE TABLE users (id INTEGER PRIMARY KEY, email TEXT, username TEXT, digest TEXT NOT NULL DEFAULT 'off', digest_sent_at DATETIME);
+		CREATE TABLE posts (id INTEGER PRIMARY KEY, user_id INTEGER, title TEXT, created_at DATETIME);
+		CREATE TABLE comments (id INTEGER PRIMARY KEY, post_id INTEGER, user_id INTEGER, content TEXT, parent_id INTEGER, created_at DATETIME);
+		CREATE TABLE categories (id INTEGER PRIMARY KEY, name TEXT, parent_id INTEGER);
+		CREATE TABLE post_categories (post_id INTEGER, category_id INTEGER);
+		CREATE TABLE follows (user_id INTEGER, target_type TEXT, target_id INTEGER);
+		INSERT INTO users (id, email, username, digest) VALUES
+			(1, 'reader@example.com', 'reader', 'daily'), (2, 'author@example.com', 'author', 'off'), (3, 'weekly@example.com', 'weekly', 'weekly');
+		INSERT INTO categories (id, name, parent_id) VALUES (1, 'Футбол', NULL), (2, 'Премьер-лига', 1), (3, 'Бокс', NULL);
+		INSERT INTO follows (user_id, target_type, target_id) VALUES (1, 'category', 1);
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	html, text, err := digest.LoadTemplates("../../templates/email")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := start
+	transport := &memoryTransport{}
+	return db, &digest.Scheduler{
+		DB:      db,
+		Mail:    transport,
+		HTML:    html,
+		Text:    text,
+		BaseURL: "https://forum.example.com/",
+		Secret:  []byte("secret"),
+		Now:     func() time.Time { return now },
+	}, transport, &now
+}
+
+func addPost(db *sql.DB, id, userID, category int, title string, at time.Time) {
+	db.Exec(`INSERT INTO posts (id, user_id, title, created_at) VALUES (?, ?, ?, ?)`, id, userID, title, at)
+	db.Exec(`INSERT INTO post_categories (post_id, category_id) VALUES (?, ?)`, id, category)
+}
+
+func TestRunOnce_SendsDigestOncePerPeriod(t *testing.T) {
+	db, s, transport, now := setup(t)
+
+	addPost(db, 1, 2, 2, "Дерби в подкатегории", start.Add(-time.Hour))
+	addPost(db, 2, 2, 3, "Бой без подписки", start.Add(-time.Hour))
+	addPost(db, 3, 1, 1, "Свой пост", start.Add(-time.Hour))
+	addPost(db, 4, 2, 1, "Старый пост", start.Add(-48*time.Hour))
+	db.Exec(`INSERT INTO comments (id, post_id, user_id, content, created_at) VALUES
+		(1, 3, 2, 'Комментарий к моему посту', ?),
+		(2, 2, 1, 'Мой комментарий', ?),
+		(3, 2, 2, 'Ответ мне', ?)`, start.Add(-2*time.Hour), start.Add(-2*time.Hour), start.Add(-time.Hour))
+	db.Exec(`UPDATE comments SET parent_id = 2 WHERE id = 3`)
+
+	sent, err := s.RunOnce()
+	if err != nil || sent != 1 {
+		t.Fatalf("RunOnce: sent %d, err %v", sent, err)
+	}
+	msg := transport.sent[0]
+	if msg.To != "reader@example.com" || msg.Subject != "Дайджест форума за день" {
+		t.Errorf("unexpected message %q %q", msg.To, msg.Subject)
+	}
+	for _, want := range []string{"Дерби в подкатегории", "Комментарий к моему посту", "Ответ мне", "https://forum.example.com/post/1"} {
+		if !strings.Contains(msg.Text, want) || !strings.Contains(msg.HTML, want) {
+			t.Errorf("digest must mention %q", want)
+		}
+	}
+	for _, unwanted := range []string{"Старый пост", "Мой комментарий"} {
+		if strings.Contains(msg.Text, unwanted) {
+			t.Errorf("digest must not mention %q", unwanted)
+		}
+	}
+	// Посты без подписки и свои в разделе новых постов не нужны,
+	// а обсуждения с ответами группируются по посту
+	d, err := s.Build(1, start.Add(-24*time.Hour), start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Posts) != 1 || d.Posts[0].ID != 1 {
+		t.Errorf("new posts: %+v", d.Posts)
+	}
+	if len(d.Threads) != 2 || d.Threads[0].Title != "Бой без подписки" || d.Threads[1].Title != "Свой пост" {
+		t.Errorf("threads: %+v", d.Threads)
+	}
+	if !strings.Contains(msg.Headers["List-Unsubscribe"], "https://forum.example.com/unsubscribe?t=") {
+		t.Errorf("List-Unsubscribe: %q", msg.Headers["List-Unsubscribe"])
+	}
+
+	// В течение периода повторно не отправляется
+	addPost(db, 5, 2, 1, "Новый пост", start.Add(time.Hour))
+	*now = start.Add(12 * time.Hour)
+	if sent, _ := s.RunOnce(); sent != 0 {
+		t.Errorf("digest must not be resent within a period, sent %d", sent)
+	}
+
+	// Следующий дайджест содержит только новое
+	*now = start.Add(24 * time.Hour)
+	if sent, _ := s.RunOnce(); sent != 1 {
+		t.Fatalf("expected the next digest after a day, sent %d", sent)
+	}
+	if text := transport.sent[1].Text; !strings.Contains(text, "Новый пост") || strings.Contains(text, "Дерби") {
+		t.Errorf("next digest must cover only the new period:\n%s", text)
+	}
+}
+
+func TestRunOnce_SkipsEmptyDigest(t *testing.T) {
+	db, s, transport, now := setup(t)
+
+	if sent, err := s.RunOnce(); err != nil || sent != 0 || len(transport.sent) != 0 {
+		t.Fatalf("empty digest must not be sent: %d %v", sent, err)
+	}
+	// Период всё равно сдвигается: событие до отметки в письмо не попадёт
+	addPost(db, 1, 2, 1, "Пост", start.Add(time.Hour))
+	*now = start.Add(2 * time.Hour)
+	if sent, _ := s.RunOnce(); sent != 0 {
+		t.Errorf("period must advance after an empty digest, sent %d", sent)
+	}
+}
+
+func TestUnsubscribeToken(t *testing.T) {
+	secret := []byte("secret")
+	token := digest.UnsubscribeToken(secret, 1)
+	if !digest.VerifyUnsubscribe(secret, 1, token) {
+		t.Error("valid token rejected")
+	}
+	if digest.VerifyUnsubscribe(secret, 2, token) || digest.VerifyUnsubscribe([]byte("other"), 1, token) {
+		t.Error("token must be bound to user and secret")
+	}
+	if digest.VerifyUnsubscribe(nil, 1, digest.UnsubscribeToken(nil, 1)) {
+		t.Error("empty secret must never verify")
+	}
+}
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"html/template"
+	"net/http"
+)
+
+type AdminHandler struct {
+	DB        *sql.DB
+	Templates *template.Template
+	Err       *ErrorHandler
+	Guard     *LoginGuard
+	// Публикуют одобренное из очереди проверки
+	Posts    *PostHandler
+	Comments *CommentHandler
+}
+
+// Проверка, что запрос пришёл от администратора
+func (h *AdminHandler) requireAdmin(w http.ResponseWriter, r *http.Request) (string, bool) {
+	userID, username, ok := GetUserFromSession(h.DB, r)
+	if !ok {
+		SetFlash(w, "flash", "Авторизуйтесь")
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return "", false
+	}
+	if GetUserRole(h.DB, userID) != "admin" {
+		h.Err.Render(w, r, http.StatusForbidden, "Доступ только для администраторов")
+		return "", false
+	}
+	return username, true
+}
+
+// Проверка, что запрос пришёл от модератора или администратора
+func (h *AdminHandler) requireModerator(w http.ResponseWriter, r *http.Request) (int, string, bool) {
+	userID, username, ok := GetUserFromSession(h.DB, r)
+	if !ok {
+		SetFlash(w, "flash", "Авторизуйтесь")
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return 0, "", false
+	}
+	if !isModerator(h.DB, userID) {
+		h.Err.Render(w, r, http.StatusForbidden, "Доступ только для модераторов")
+		return 0, "", false
+	}
+	return userID, username, true
+}
+
+// Список заблокированных аккаунтов и журнал неудачных входов
+func (h *AdminHandler) Lockouts(w http.ResponseWriter, r *http.Request) {
+	username, ok := h.requireAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	locked, err := h.Guard.Locked()
+	if err != nil {
+		h.Err.Render(w, r, http.StatusInternalServerError, "Ошибка базы данных")
+		return
+	}
+	failures, err := h.Guard.RecentFailures(100)
+	if err != nil {
+		h.Err.Render(w, r, http.StatusInternalServerError, "Ошибка базы данных")
+		return
+	}
+
+	h.Templates.ExecuteTemplate(w, "layout", pageData(r, map[string]interface{}{
+		"Page":     "lockouts",
+		"User":     username,
+		"Flash":    GetFlash(w, r, "flash"),
+		"Locked":   locked,
+		"Failures": failures,
+	}))
+}
+
+// Снятие блокировки вручную
+func (h *AdminHandler) Unlock(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/admin/lockouts", http.StatusSeeOther)
+		return
+	}
+	if _, ok := h.requireAdmin(w, r); !ok {
+		return
+	}
+
+	key := r.FormValue("key")
+	if key == "" {
+		h.Err.Render(w, r, http.StatusBadRequest, "Некорректные параметры")
+		return
+	}
+	if err := h.Guard.Unlock(key); err != nil {
+		h.Err.Render(w, r, http.StatusInternalServerError, "Ошибка базы данных")
+		return
+	}
+
+	SetFlash(w, "flash", "Блокировка снята")
+	http.Redirect(w, r, "/admin/lockouts", http.StatusSeeOther)
+}
+
+// Теги с числом постов, слияние и запрет
+func (h *AdminHandler) Tags(w http.ResponseWriter, r *http.Request) {
+	_, username, ok := h.requireModerator(w, r)
+	if !ok {
+		return
+	}
+
+	tags, err := ListTags(h.DB)
+	if err != nil {
+		h.Err.Render(w, r, http.StatusInternalServerError, "Ошибка базы данных")
+		return
+	}
+
+	h.Templates.ExecuteTemplate(w, "layout", pageData(r, map[string]interface{}{
+		"Page":    "admintags",
+		"User":    username,
+		"Flash":   GetFlash(w, r, "flash"),
+		"TagList": tags,
+	}))
+}
+
+// Слияние тега from с тегом into: from становится синонимом
+func (h *AdminHandler) MergeTags(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/admin/tags", http.StatusSeeOther)
+		return
+	}
+	if _, _, ok := h.requireModerator(w, r); !ok {
+		return
+	}
+
+	from, into := r.FormValue("from"), r.FormValue("into")
+	if err := MergeTags(h.DB, from, into); err != nil {
+		SetFlash(w, "flash", "Не удалось объединить теги: "+err.Error())
+	} else {
+		SetFlash(w, "flash", "Тег «"+NormalizeTag(from)+"» объединён с «"+NormalizeTag(into)+"»")
+	}
+	http.Redirect(w, r, "/admin/tags", http.StatusSeeOther)
+}
+
+// Запрет тега или снятие запрета
+func (h *AdminHandler) BanTag(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/admin/tags", http.StatusSeeOther)
+		return
+	}
+	if _, _, ok := h.requireModerator(w, r); !ok {
+		return
+	}
+
+	name := NormalizeTag(r.FormValue("name"))
+	if name == "" {
+		h.Err.Render(w, r, http.StatusBadRequest, "Некорректные параметры")
+		return
+	}
+	banned := r.FormValue("action") != "unban"
+	err := SetTagBanned(h.DB, name, banned)
+	var aliasErr *TagAliasError
+	if errors.As(err, &aliasErr) {
+		SetFlash(w, "flash", "Не удалось изменить запрет: "+aliasErr.Error())
+		http.Redirect(w, r, "/admin/tags", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		h.Err.Render(w, r, http.StatusInternalServerError, "Ошибка базы данных")
+		return
+	}
+
+	if banned {
+		SetFlash(w, "flash", "Тег «"+name+"» запрещён")
+	} else {
+		SetFlash(w, "flash", "Запрет тега «"+name+"» снят")
+	}
+	http.Redirect(w, r, "/admin/tags", http.StatusSeeOther)
+}
@@ -2,7 +2,11 @@ package handlers
 
 import (
 	"database/sql"
+	"fmt"
+	"math"
 	"net/http"
+	"net/url"
+	"strconv"
 	"time"
 
 	"log"
@@ -19,8 +23,12 @@ type AuthHandler struct {
 	DB        *sql.DB
 	Templates *template.Template
 	Err       *ErrorHandler
+	Guard     *LoginGuard
 }
 
+// Хеш для сравнения, когда пользователь не найден
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy-password"), bcrypt.DefaultCost)
+
 // Проверка формата email
 func isValidEmail(email string) bool {
 	re := regexp.MustCompile(`^[a-zA-Z0-9._%+\-]+@[a-zA-Z0-9.\-]+\.[a-zA-Z]{2,}$`)
@@ -43,18 +51,18 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodGet {
 		_, username, _ := GetUserFromSession(h.DB, r)
 		flash := GetFlash(w, r, "flash")
-		h.Templates.ExecuteTemplate(w, "layout", map[string]interface{}{
+		h.Templates.ExecuteTemplate(w, "layout", pageData(r, map[string]interface{}{
 			"Page":       "register",
 			"User":       username,
 			"Flash":      flash,
 			"FormErrors": map[string]string{},
 			"FormValues": map[string]string{},
-		})
+		}))
 		return
 	}
 
 	if err := r.ParseForm(); err != nil {
-		h.Err.Render(w, http.StatusBadRequest, "Ошибка формы")
+		h.Err.Render(w, r, http.StatusBadRequest, "Ошибка формы")
 		return
 	}
 
@@ -87,7 +95,7 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 	if email != "" {
 		err := h.DB.QueryRow("SELECT COUNT(*) FROM users WHERE email = ?", email).Scan(&exists)
 		if err != nil {
-			h.Err.Render(w, http.StatusInternalServerError, "Ошибка базы данных")
+			h.Err.Render(w, r, http.StatusInternalServerError, "Ошибка базы данных")
 			return
 		}
 		if exists > 0 {
@@ -99,7 +107,7 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 	if username != "" {
 		err := h.DB.QueryRow("SELECT COUNT(*) FROM users WHERE username = ?", username).Scan(&exists)
 		if err != nil {
-			h.Err.Render(w, http.StatusInternalServerError, "Ошибка базы данных")
+			h.Err.Render(w, r, http.StatusInternalServerError, "Ошибка базы данных")
 			return
 		}
 		if exists > 0 {
@@ -108,33 +116,33 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if len(formErrors) > 0 {
-		h.Templates.ExecuteTemplate(w, "layout", map[string]interface{}{
+		h.Templates.ExecuteTemplate(w, "layout", pageData(r, map[string]interface{}{
 			"Page":       "register",
 			"FormErrors": formErrors,
 			"FormValues": map[string]string{
 				"Email":    email,
 				"Username": username,
 			},
-		})
+		}))
 		return
 	}
 
 	// Хеширование пароля
 	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
-		h.Err.Render(w, http.StatusInternalServerError, "Ошибка шифрования пароля")
+		h.Err.Render(w, r, http.StatusInternalServerError, "Ошибка шифрования пароля")
 		return
 	}
 
 	res, err := h.DB.Exec("INSERT INTO users (email, username, password) VALUES (?, ?, ?)", email, username, string(hashed))
 	if err != nil {
-		h.Err.Render(w, http.StatusInternalServerError, "Ошибка создания пользователя")
+		h.Err.Render(w, r, http.StatusInternalServerError, "Ошибка создания пользователя")
 		return
 	}
 
 	userID, err := res.LastInsertId()
 	if err != nil {
-		h.Err.Render(w, http.StatusInternalServerError, "Ошибка создания пользователя")
+		h.Err.Render(w, r, http.StatusInternalServerError, "Ошибка создания пользователя")
 		return
 	}
 
@@ -143,7 +151,7 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 	expires := time.Now().Add(24 * time.Hour)
 	_, err = h.DB.Exec("INSERT INTO sessions (id, user_id, expires_at) VALUES (?, ?, ?)", sessionID, userID, expires)
 	if err != nil {
-		h.Err.Render(w, http.StatusInternalServerError, "Ошибка создания сессии")
+		h.Err.Render(w, r, http.StatusInternalServerError, "Ошибка создания сессии")
 		return
 	}
 
@@ -163,18 +171,18 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodGet {
 		_, username, _ := GetUserFromSession(h.DB, r)
 		flash := GetFlash(w, r, "flash")
-		h.Templates.ExecuteTemplate(w, "layout", map[string]interface{}{
+		h.Templates.ExecuteTemplate(w, "layout", pageData(r, map[string]interface{}{
 			"Page":       "login",
 			"User":       username,
 			"Flash":      flash,
 			"FormErrors": map[string]string{},
 			"FormValues": map[string]string{},
-		})
+		}))
 		return
 	}
 
 	if err := r.ParseForm(); err != nil {
-		h.Err.Render(w, http.StatusBadRequest, "Ошибка формы")
+		h.Err.Render(w, r, http.StatusBadRequest, "Ошибка формы")
 		return
 	}
 
@@ -194,48 +202,80 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if len(formErrors) > 0 {
-		h.Templates.ExecuteTemplate(w, "layout", map[string]interface{}{
+		h.Templates.ExecuteTemplate(w, "layout", pageData(r, map[string]interface{}{
 			"Page":       "login",
 			"FormErrors": formErrors,
 			"FormValues": map[string]string{
 				"Email": email,
 			},
-		})
+		}))
 		return
 	}
 
+	ip := clientIP(r)
+
+	// Во время блокировки пароль даже не проверяем
+	if h.Guard != nil {
+		remaining, err := h.Guard.Remaining(email, ip)
+		if err != nil {
+			h.Err.Render(w, r, http.StatusInternalServerError, "Ошибка базы данных")
+			return
+		}
+		if remaining > 0 {
+			logGuardError(h.Guard.Fail(email, ip, 0, "locked"))
+			minutes := int(math.Ceil(remaining.Minutes()))
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(remaining.Seconds()))))
+			w.WriteHeader(http.StatusTooManyRequests)
+			formErrors["Login"] = fmt.Sprintf("Слишком много неудачных попыток. Повторите через %d мин.", minutes)
+			h.Templates.ExecuteTemplate(w, "layout", pageData(r, map[string]interface{}{
+				"Page":       "login",
+				"FormErrors": formErrors,
+				"FormValues": map[string]string{"Email": email},
+			}))
+			return
+		}
+	}
+
 	// Поиск пользователя
 	var id int
 	var hashed string
 	err := h.DB.QueryRow("SELECT id, password FROM users WHERE email = ?", email).Scan(&id, &hashed)
-	if err == sql.ErrNoRows {
-		formErrors["Email"] = "Пользователь не найден"
-		h.Templates.ExecuteTemplate(w, "layout", map[string]interface{}{
-			"Page":       "login",
-			"FormErrors": formErrors,
-			"FormValues": map[string]string{"Email": email},
-		})
-		return
-	} else if err != nil {
-		h.Err.Render(w, http.StatusInternalServerError, "Ошибка базы данных")
+	if err != nil && err != sql.ErrNoRows {
+		h.Err.Render(w, r, http.StatusInternalServerError, "Ошибка базы данных")
 		return
 	}
 
-	// Проверка пароля
-	if bcrypt.CompareHashAndPassword([]byte(hashed), []byte(password)) != nil {
-		formErrors["Password"] = "Неверный пароль"
-		h.Templates.ExecuteTemplate(w, "layout", map[string]interface{}{
+	// Проверка пароля. Для несуществующего email сверяем с фиктивным хешем,
+	// чтобы по времени ответа нельзя было понять, есть ли такой пользователь.
+	reason := ""
+	if err == sql.ErrNoRows {
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		reason = "unknown_user"
+	} else if bcrypt.CompareHashAndPassword([]byte(hashed), []byte(password)) != nil {
+		reason = "bad_password"
+	}
+
+	if reason != "" {
+		if h.Guard != nil {
+			logGuardError(h.Guard.Fail(email, ip, id, reason))
+		}
+		formErrors["Login"] = "Неверный email или пароль"
+		h.Templates.ExecuteTemplate(w, "layout", pageData(r, map[string]interface{}{
 			"Page":       "login",
 			"FormErrors": formErrors,
 			"FormValues": map[string]string{"Email": email},
-		})
+		}))
 		return
 	}
 
+	if h.Guard != nil {
+		logGuardError(h.Guard.Succeed(email))
+	}
+
 	// Удаление старых сессий
 	_, err = h.DB.Exec("DELETE FROM sessions WHERE user_id = ?", id)
 	if err != nil {
-		h.Err.Render(w, http.StatusInternalServerError, "Ошибка удаления старых сессий")
+		h.Err.Render(w, r, http.StatusInternalServerError, "Ошибка удаления старых сессий")
 		return
 	}
 
@@ -244,7 +284,7 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	expires := time.Now().Add(24 * time.Hour)
 	_, err = h.DB.Exec("INSERT INTO sessions (id, user_id, expires_at) VALUES (?, ?, ?)", sessionID, id, expires)
 	if err != nil {
-		h.Err.Render(w, http.StatusInternalServerError, "Ошибка создания сессии")
+		h.Err.Render(w, r, http.StatusInternalServerError, "Ошибка создания сессии")
 		return
 	}
 
@@ -259,8 +299,13 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
 
-// Выход пользователя
+// Выход пользователя (только POST, чтобы выход нельзя было вызвать ссылкой)
 func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
 	cookie, err := r.Cookie("session_id")
 	if err == nil {
 		h.DB.Exec("DELETE FROM sessions WHERE id = ?", cookie.Value)
@@ -310,14 +355,26 @@ func GetUserFromSession(db *sql.DB, r *http.Request) (int, string, bool) {
 	return userID, username, true
 }
 
+// GetUserRole возвращает роль пользователя: user, moderator или admin
+func GetUserRole(db *sql.DB, userID int) string {
+	var role string
+	if err := db.QueryRow("SELECT role FROM users WHERE id = ?", userID).Scan(&role); err != nil {
+		return "user"
+	}
+	return role
+}
+
+// SetFlash кладёт сообщение в cookie до следующей страницы. Значение
+// экранируется: net/http выбрасывает из cookie байты кириллицы.
 func SetFlash(w http.ResponseWriter, name, value string) {
 	http.SetCookie(w, &http.Cookie{
 		Name:  name,
-		Value: value,
+		Value: url.QueryEscape(value),
 		Path:  "/",
 	})
 }
 
+// GetFlash читает и удаляет сообщение, сохранённое SetFlash
 func GetFlash(w http.ResponseWriter, r *http.Request, name string) string {
 	cookie, err := r.Cookie(name)
 	if err == nil {
@@ -327,7 +384,11 @@ func GetFlash(w http.ResponseWriter, r *http.Request, name string) string {
 			Path:   "/",
 			MaxAge: -1,
 		})
-		return cookie.Value
+		value, err := url.QueryUnescape(cookie.Value)
+		if err != nil {
+			return ""
+		}
+		return value
 	}
 	return ""
 }
@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"forum/internal/models"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Виды ограничений: заглушённый пропадает из ленты и обсуждений,
+// заблокированный к тому же не может отвечать и упоминать
+const (
+	BlockMute  = "mute"
+	BlockBlock = "block"
+)
+
+var errReplyBlocked = errors.New("Автор заблокировал вас: отвечать ему нельзя")
+
+// Условие «автор скрыт от зрителя» для выборок постов и комментариев
+const mutedAuthor = `EXISTS (SELECT 1 FROM user_blocks ub WHERE ub.user_id = ? AND ub.target_id = %s)`
+
+// SetBlock заглушает или блокирует targetID для userID; пустой kind снимает ограничение
+func SetBlock(db *sql.DB, userID, targetID int, kind string) error {
+	if kind == "" {
+		_, err := db.Exec(`DELETE FROM user_blocks WHERE user_id = ? AND target_id = ?`, userID, targetID)
+		return err
+	}
+	_, err := db.Exec(`
+		INSERT INTO user_blocks (user_id, target_id, kind, created_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT (user_id, target_id) DO UPDATE SET kind = excluded.kind, created_at = excluded.created_at`,
+		userID, targetID, kind, time.Now().UTC())
+	return err
+}
+
+// BlockKind — как userID ограничил targetID: BlockMute, BlockBlock или ""
+func BlockKind(db *sql.DB, userID, targetID int) string {
+	var kind string
+	db.QueryRow(`SELECT kind FROM user_blocks WHERE user_id = ? AND target_id = ?`, userID, targetID).Scan(&kind)
+	return kind
+}
+
+// hasBlocks сообщает, скрыт ли от пользователя хоть кто-нибудь
+func hasBlocks(db *sql.DB, userID int) bool {
+	var exists bool
+	db.QueryRow(`SELECT EXISTS (SELECT 1 FROM user_blocks WHERE user_id = ?)`, userID).Scan(&exists)
+	return exists
+}
+
+// mutedNames — имена скрытых от пользователя авторов в JSON для script.js:
+// их посты и комментарии, пришедшие по SSE, не вставляются на страницу
+func mutedNames(db *sql.DB, userID int) string {
+	names := []string{}
+	rows, err := db.Query(`
+		SELECT u.username FROM user_blocks b JOIN users u ON u.id = b.target_id
+		WHERE b.user_id = ?`, userID)
+	if err == nil {
+		defer rows.Close()
+		for rows.Next() {
+			var name string
+			if rows.Scan(&name) == nil {
+				names = append(names, name)
+			}
+		}
+	}
+	data, _ := json.Marshal(names)
+	return string(data)
+}
+
+// blockedBy сообщает, что ownerID заблокировал actorID
+func blockedBy(q dbtx, ownerID, actorID int) bool {
+	var blocked bool
+	q.QueryRow(`SELECT EXISTS (SELECT 1 FROM user_blocks WHERE user_id = ? AND target_id = ? AND kind = 'block')`,
+		ownerID, actorID).Scan(&blocked)
+	return blocked
+}
+
+// replyBlocked сообщает, что автор поста или комментария parentID
+// заблокировал userID и ответ от него не принимается
+func replyBlocked(q dbtx, postID int, parentID int64, userID int) bool {
+	var blocked bool
+	q.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM user_blocks
+			WHERE kind = 'block' AND target_id = ? AND user_id IN (
+				SELECT user_id FROM posts WHERE id = ?
+				UNION SELECT user_id FROM comments WHERE id = ?
+			)
+		)`, userID, postID, parentID).Scan(&blocked)
+	return blocked
+}
+
+// LoadBlocks возвращает ограничения пользователя, новые сверху
+func LoadBlocks(db *sql.DB, userID int) ([]models.Block, error) {
+	rows, err := db.Query(`
+		SELECT b.target_id, u.username, b.kind, b.created_at
+		FROM user_blocks b JOIN users u ON u.id = b.target_id
+		WHERE b.user_id = ?
+		ORDER BY b.created_at DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var blocks []models.Block
+	for rows.Next() {
+		var b models.Block
+		if err := rows.Scan(&b.UserID, &b.Username, &b.Kind, &b.CreatedAt); err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, b)
+	}
+	return blocks, rows.Err()
+}
+
+// Blocks — настройки /settings/blocks: список заглушённых и заблокированных.
+// POST с user (имя) или id и kind (mute, block или пусто) меняет ограничение.
+func (h *UserHandler) Blocks(w http.ResponseWriter, r *http.Request) {
+	userID, username, ok := GetUserFromSession(h.DB, r)
+	if !ok {
+		SetFlash(w, "flash", "Авторизуйтесь")
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		blocks, err := LoadBlocks(h.DB, userID)
+		if err != nil {
+			log.Println("Ошибка загрузки ограничений:", err)
+			h.Err.Render(w, r, http.StatusInternalServerError, "Ошибка базы данных")
+			return
+		}
+		h.Templates.ExecuteTemplate(w, "layout", pageData(r, map[string]interface{}{
+			"Page":   "blocks",
+			"User":   username,
+			"Blocks": blocks,
+		}))
+		return
+	}
+
+	kind := r.FormValue("kind")
+	if kind != BlockMute && kind != BlockBlock && kind != "" {
+		h.Err.Render(w, r, http.StatusBadRequest, "Некорректные параметры")
+		return
+	}
+	// Ограничить можно по имени из формы настроек или по id из профиля
+	var targetID int
+	var err error
+	if name := strings.TrimPrefix(strings.TrimSpace(r.FormValue("user")), "@"); name != "" {
+		err = h.DB.QueryRow(`SELECT id FROM users WHERE username = ? COLLATE NOCASE`, name).Scan(&targetID)
+	} else {
+		id, convErr := strconv.Atoi(r.FormValue("id"))
+		if convErr != nil {
+			h.Err.Render(w, r, http.StatusBadRequest, "Некорректные параметры")
+			return
+		}
+		err = h.DB.QueryRow(`SELECT id FROM users WHERE id = ?`, id).Scan(&targetID)
+	}
+	back, ok := sameOriginReferer(r)
+	if !ok {
+		back = "/settings/blocks"
+	}
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		SetFlash(w, "flash", "Пользователь не найден")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	case err != nil:
+		h.Err.Render(w, r, http.StatusInternalServerError, "Ошибка базы данных")
+		return
+	case targetID == userID:
+		SetFlash(w, "flash", "Нельзя ограничить самого себя")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+
+	if err := SetBlock(h.DB, userID, targetID, kind); err != nil {
+		log.Println("Ошибка сохранения ограничения:", err)
+		h.Err.Render(w, r, http.StatusInternalServerError, "Ошибка базы данных")
+		return
+	}
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
@@ -0,0 +1,506 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"forum/internal/models"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+const (
+	maxBookmarkNote   = 500 // символов в заметке
+	maxFolderName     = 50
+	maxBookmarkFolder = 50 // папок у одного пользователя
+)
+
+// bookmarkTargets — где искать пост закладки: у комментария это его обсуждение
+var bookmarkTargets = map[string]string{
+	"post":    "SELECT id FROM posts WHERE id = ?",
+	"comment": "SELECT post_id FROM comments WHERE id = ?",
+}
+
+var errFolderNotFound = errors.New("Папка не найдена")
+
+// BookmarkHandler — закладки и их папки. Закладки видны только владельцу.
+type BookmarkHandler struct {
+	DB        *sql.DB
+	Templates *template.Template
+	Err       *ErrorHandler
+}
+
+// bookmarkResponse — ответ Bookmark в режиме JSON
+type bookmarkResponse struct {
+	Type   string `json:"type"`
+	ID     int    `json:"id"`
+	Saved  bool   `json:"saved"`
+	Folder string `json:"folder"`
+	Note   string `json:"note"`
+}
+
+// Bookmark сохраняет пост или комментарий в закладки, меняет папку и
+// заметку или убирает закладку. action: save (по умолчанию), remove или
+// toggle — для кнопки на карточке.
+func (h *BookmarkHandler) Bookmark(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	userID, _, ok := GetUserFromSession(h.DB, r)
+	if !ok {
+		h.fail(w, r, http.StatusUnauthorized, "Только для авторизованных пользователей")
+		return
+	}
+
+	typ := r.FormValue("type")
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if _, known := bookmarkTargets[typ]; err != nil || !known {
+		h.fail(w, r, http.StatusBadRequest, "Некорректные параметры")
+		return
+	}
+
+	action := r.FormValue("action")
+	if action == "toggle" {
+		action = "save"
+		if b, err := GetBookmark(h.DB, userID, typ, id); err != nil {
+			h.fail(w, r, http.StatusInternalServerError, "Ошибка базы данных")
+			return
+		} else if b != nil {
+			action = "remove"
+		}
+	}
+
+	resp := bookmarkResponse{Type: typ, ID: id}
+	if action == "remove" {
+		if err := RemoveBookmark(h.DB, userID, typ, id); err != nil {
+			h.fail(w, r, http.StatusInternalServerError, "Ошибка базы данных")
+			return
+		}
+	} else {
+		note := strings.TrimSpace(r.FormValue("note"))
+		if utf8.RuneCountInString(note) > maxBookmarkNote {
+			h.fail(w, r, http.StatusBadRequest, "Заметка слишком длинная (до 500 символов)")
+			return
+		}
+		folderID, msg := h.folderFromForm(r, userID)
+		if msg != "" {
+			h.fail(w, r, http.StatusBadRequest, msg)
+			return
+		}
+		err := SaveBookmark(h.DB, userID, typ, id, folderID, note)
+		if errors.Is(err, sql.ErrNoRows) {
+			h.fail(w, r, http.StatusNotFound, "Не найдено")
+			return
+		}
+		if errors.Is(err, errFolderNotFound) {
+			h.fail(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err != nil {
+			log.Println("Ошибка сохранения закладки:", err)
+			h.fail(w, r, http.StatusInternalServerError, "Ошибка базы данных")
+			return
+		}
+		b, _ := GetBookmark(h.DB, userID, typ, id)
+		resp.Saved = b != nil
+		if b != nil {
+			resp.Folder, resp.Note = b.Folder, b.Note
+		}
+	}
+
+	if wantsJSON(r) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+		return
+	}
+	back, ok := sameOriginReferer(r)
+	if !ok {
+		back = "/saved"
+	}
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
+
+// folderFromForm — папка закладки: выбранная из списка или новая по имени
+func (h *BookmarkHandler) folderFromForm(r *http.Request, userID int) (int, string) {
+	if name := strings.TrimSpace(r.FormValue("new_folder")); name != "" {
+		id, err := CreateBookmarkFolder(h.DB, userID, name)
+		if err != nil {
+			return 0, err.Error()
+		}
+		return id, ""
+	}
+	raw := r.FormValue("folder")
+	if raw == "" {
+		return 0, ""
+	}
+	id, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, "Некорректная папка"
+	}
+	return id, ""
+}
+
+// Folder создаёт, переименовывает и удаляет папки. Закладки удалённой
+// папки остаются без папки.
+func (h *BookmarkHandler) Folder(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/saved", http.StatusSeeOther)
+		return
+	}
+	userID, _, ok := GetUserFromSession(h.DB, r)
+	if !ok {
+		h.Err.Render(w, r, http.StatusUnauthorized, "Только для авторизованных пользователей")
+		return
+	}
+
+	id, _ := strconv.Atoi(r.FormValue("id"))
+	name := strings.TrimSpace(r.FormValue("name"))
+	var err error
+	switch r.FormValue("action") {
+	case "create":
+		id, err = CreateBookmarkFolder(h.DB, userID, name)
+	case "rename":
+		err = RenameBookmarkFolder(h.DB, userID, id, name)
+	case "delete":
+		err = DeleteBookmarkFolder(h.DB, userID, id)
+		id = 0
+	default:
+		h.Err.Render(w, r, http.StatusBadRequest, "Неизвестное действие")
+		return
+	}
+	if errors.Is(err, errFolderNotFound) {
+		h.Err.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		SetFlash(w, "flash", err.Error())
+	}
+
+	target := "/saved"
+	if id != 0 {
+		target += "?folder=" + strconv.Itoa(id)
+	}
+	http.Redirect(w, r, target, http.StatusSeeOther)
+}
+
+// fail сообщает об ошибке в том виде, который ждёт клиент
+func (h *BookmarkHandler) fail(w http.ResponseWriter, r *http.Request, status int, msg string) {
+	if wantsJSON(r) {
+		writeJSONError(w, status, msg)
+		return
+	}
+	h.Err.Render(w, r, status, msg)
+}
+
+// SavedPage — закладки пользователя /saved: посты с теми же фильтрами и
+// поиском, что и в ленте, и сохранённые комментарии. ?folder=<id> — одна папка.
+func (h *FilterHandler) SavedPage(w http.ResponseWriter, r *http.Request) {
+	userID, _, ok := GetUserFromSession(h.DB, r)
+	if !ok {
+		SetFlash(w, "flash", "Авторизуйтесь, чтобы открыть закладки")
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	r.ParseForm()
+	folders, err := LoadBookmarkFolders(h.DB, userID)
+	if err != nil {
+		h.Err.Render(w, r, http.StatusInternalServerError, "Ошибка базы данных")
+		return
+	}
+	var current *models.BookmarkFolder
+	if raw := r.FormValue("folder"); raw != "" {
+		id, _ := strconv.Atoi(raw)
+		for i := range folders {
+			if folders[i].ID == id {
+				current = &folders[i]
+			}
+		}
+		if current == nil {
+			h.Err.NotFound(w, r)
+			return
+		}
+	}
+
+	filter := PostFilter{
+		Query:      r.FormValue("q"),
+		Categories: r.Form["category"],
+		Tags:       normalizeTags(r.Form["tag"]),
+		Saved:      true,
+	}
+	if current != nil {
+		filter.Folder = current.ID
+	}
+	comments, err := savedComments(h.DB, userID, filter.Folder, filter.Query)
+	if err != nil {
+		log.Println("Ошибка загрузки сохранённых комментариев:", err)
+	}
+	h.renderPosts(w, r, filter, LoadAllCategories(h.DB), map[string]interface{}{
+		"SavedView":     true,
+		"Folders":       folders,
+		"Folder":        current,
+		"SavedComments": comments,
+		"Flash":         GetFlash(w, r, "flash"),
+	})
+}
+
+// GetBookmark возвращает закладку пользователя или nil
+func GetBookmark(db *sql.DB, userID int, targetType string, targetID int) (*models.Bookmark, error) {
+	marks, err := loadBookmarks(db, userID, targetType, []int{targetID})
+	return marks[targetID], err
+}
+
+// SaveBookmark добавляет закладку или меняет папку и заметку существующей.
+// folderID 0 — без папки. sql.ErrNoRows — объекта нет.
+func SaveBookmark(db *sql.DB, userID int, targetType string, targetID, folderID int, note string) error {
+	query, ok := bookmarkTargets[targetType]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	var postID int
+	if err := db.QueryRow(query, targetID).Scan(&postID); err != nil {
+		return err
+	}
+	var folder interface{}
+	if folderID != 0 {
+		var owner int
+		err := db.QueryRow("SELECT user_id FROM bookmark_folders WHERE id = ?", folderID).Scan(&owner)
+		if err == sql.ErrNoRows || owner != userID {
+			return errFolderNotFound
+		}
+		if err != nil {
+			return err
+		}
+		folder = folderID
+	}
+	_, err := db.Exec(`
+		INSERT INTO bookmarks (user_id, target_type, target_id, post_id, folder_id, note, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (user_id, target_type, target_id) DO UPDATE SET folder_id = excluded.folder_id, note = excluded.note`,
+		userID, targetType, targetID, postID, folder, note, time.Now().UTC())
+	return err
+}
+
+// RemoveBookmark убирает закладку; отсутствие закладки не ошибка
+func RemoveBookmark(db *sql.DB, userID int, targetType string, targetID int) error {
+	_, err := db.Exec("DELETE FROM bookmarks WHERE user_id = ? AND target_type = ? AND target_id = ?",
+		userID, targetType, targetID)
+	return err
+}
+
+// loadBookmarks — закладки пользователя на объекты одного типа: id → закладка
+func loadBookmarks(db *sql.DB, userID int, targetType string, ids []int) (map[int]*models.Bookmark, error) {
+	marks := map[int]*models.Bookmark{}
+	if userID == 0 || len(ids) == 0 {
+		return marks, nil
+	}
+	args := []interface{}{userID, targetType}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	rows, err := db.Query(`
+		SELECT b.target_id, b.post_id, COALESCE(b.folder_id, 0), COALESCE(f.name, ''), b.note, b.created_at
+		FROM bookmarks b
+		LEFT JOIN bookmark_folders f ON f.id = b.folder_id
+		WHERE b.user_id = ? AND b.target_type = ? AND b.target_id IN (?`+strings.Repeat(",?", len(ids)-1)+`)`, args...)
+	if err != nil {
+		return marks, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		b := &models.Bookmark{TargetType: targetType}
+		if err := rows.Scan(&b.TargetID, &b.PostID, &b.FolderID, &b.Folder, &b.Note, &b.CreatedAt); err != nil {
+			return marks, err
+		}
+		marks[b.TargetID] = b
+	}
+	return marks, rows.Err()
+}
+
+// markBookmarkedPosts отмечает посты из закладок пользователя
+func markBookmarkedPosts(db *sql.DB, userID int, posts []models.Post) {
+	ids := make([]int, len(posts))
+	for i, p := range posts {
+		ids[i] = p.ID
+	}
+	marks, err := loadBookmarks(db, userID, "post", ids)
+	if err != nil {
+		log.Println("Ошибка загрузки закладок:", err)
+	}
+	for i := range posts {
+		posts[i].Bookmark = marks[posts[i].ID]
+	}
+}
+
+// markBookmarkedComments отмечает комментарии из закладок пользователя
+func markBookmarkedComments(db *sql.DB, userID int, comments []models.Comment) {
+	ids := make([]int, len(comments))
+	for i, c := range comments {
+		ids[i] = c.ID
+	}
+	marks, err := loadBookmarks(db, userID, "comment", ids)
+	if err != nil {
+		log.Println("Ошибка загрузки закладок:", err)
+	}
+	for i := range comments {
+		comments[i].Bookmark = marks[comments[i].ID]
+	}
+}
+
+// savedComments — сохранённые комментарии, новые закладки первыми
+func savedComments(db *sql.DB, userID, folderID int, query string) ([]models.SavedComment, error) {
+	sqlQuery := `
+		SELECT c.id, c.post_id, c.user_id, u.username, c.content, c.content_html, c.created_at, p.title,
+			COALESCE(b.folder_id, 0), COALESCE(f.name, ''), b.note, b.created_at
+		FROM bookmarks b
+		JOIN comments c ON b.target_type = 'comment' AND c.id = b.target_id
+		JOIN posts p ON p.id = c.post_id
+		JOIN users u ON u.id = c.user_id
+		LEFT JOIN bookmark_folders f ON f.id = b.folder_id
+		WHERE b.user_id = ?`
+	args := []interface{}{userID}
+	if folderID != 0 {
+		sqlQuery += " AND b.folder_id = ?"
+		args = append(args, folderID)
+	}
+	if query != "" {
+		sqlQuery += " AND (c.content LIKE ? OR b.note LIKE ?)"
+		pattern := "%" + query + "%"
+		args = append(args, pattern, pattern)
+	}
+	rows, err := db.Query(sqlQuery+" ORDER BY b.created_at DESC", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var saved []models.SavedComment
+	for rows.Next() {
+		var s models.SavedComment
+		var cached string
+		if err := rows.Scan(&s.ID, &s.PostID, &s.UserID, &s.Author, &s.Content, &cached, &s.CreatedAt, &s.PostTitle,
+			&s.Bookmark.FolderID, &s.Bookmark.Folder, &s.Bookmark.Note, &s.Bookmark.CreatedAt); err != nil {
+			return saved, err
+		}
+		s.ContentHTML = template.HTML(cached)
+		s.Bookmark.TargetType, s.Bookmark.TargetID, s.Bookmark.PostID = "comment", s.ID, s.PostID
+		saved = append(saved, s)
+	}
+	return saved, rows.Err()
+}
+
+// LoadBookmarkFolders — папки пользователя по алфавиту с числом закладок
+func LoadBookmarkFolders(db *sql.DB, userID int) ([]models.BookmarkFolder, error) {
+	rows, err := db.Query(`
+		SELECT f.id, f.name, (SELECT COUNT(*) FROM bookmarks b WHERE b.folder_id = f.id)
+		FROM bookmark_folders f
+		WHERE f.user_id = ?
+		ORDER BY f.name COLLATE NOCASE`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var folders []models.BookmarkFolder
+	for rows.Next() {
+		var f models.BookmarkFolder
+		if err := rows.Scan(&f.ID, &f.Name, &f.Count); err != nil {
+			return folders, err
+		}
+		folders = append(folders, f)
+	}
+	return folders, rows.Err()
+}
+
+func validFolderName(name string) error {
+	if name == "" || utf8.RuneCountInString(name) > maxFolderName {
+		return errors.New("Название папки обязательно (до 50 символов)")
+	}
+	return nil
+}
+
+// CreateBookmarkFolder создаёт папку; папка с тем же названием уже может быть —
+// тогда возвращается она
+func CreateBookmarkFolder(db *sql.DB, userID int, name string) (int, error) {
+	if err := validFolderName(name); err != nil {
+		return 0, err
+	}
+	var id int
+	err := db.QueryRow("SELECT id FROM bookmark_folders WHERE user_id = ? AND name = ?", userID, name).Scan(&id)
+	if err == nil {
+		return id, nil
+	}
+	if err != sql.ErrNoRows {
+		return 0, err
+	}
+	var count int
+	db.QueryRow("SELECT COUNT(*) FROM bookmark_folders WHERE user_id = ?", userID).Scan(&count)
+	if count >= maxBookmarkFolder {
+		return 0, errors.New("Слишком много папок (не больше 50)")
+	}
+	res, err := db.Exec("INSERT INTO bookmark_folders (user_id, name, created_at) VALUES (?, ?, ?)",
+		userID, name, time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+	newID, _ := res.LastInsertId()
+	return int(newID), nil
+}
+
+func RenameBookmarkFolder(db *sql.DB, userID, folderID int, name string) error {
+	if err := validFolderName(name); err != nil {
+		return err
+	}
+	res, err := db.Exec("UPDATE bookmark_folders SET name = ? WHERE id = ? AND user_id = ?", name, folderID, userID)
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.Code == sqlite3.ErrConstraint {
+		return errors.New("Папка с таким названием уже есть")
+	}
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errFolderNotFound
+	}
+	return nil
+}
+
+// DeleteBookmarkFolder удаляет папку; её закладки остаются без папки
+func DeleteBookmarkFolder(db *sql.DB, userID, folderID int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec("DELETE FROM bookmark_folders WHERE id = ? AND user_id = ?", folderID, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errFolderNotFound
+	}
+	if _, err := tx.Exec("UPDATE bookmarks SET folder_id = NULL WHERE user_id = ? AND folder_id = ?", userID, folderID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// bookmarkButton — данные шаблона "bookmarkbutton"
+type bookmarkButton struct {
+	Type      string
+	ID        int
+	Bookmark  *models.Bookmark
+	Folders   []models.BookmarkFolder
+	CSRFToken string
+}
+
+func newBookmarkButton(typ string, id int, b *models.Bookmark, folders []models.BookmarkFolder, token string) bookmarkButton {
+	return bookmarkButton{Type: typ, ID: id, Bookmark: b, Folders: folders, CSRFToken: token}
+}
@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"forum/internal/models"
+)
+
+// LoadAllCategories возвращает категории в порядке обхода дерева: за каждой
+// категорией идут её подкатегории. Depth задаёт отступ, Posts — число постов
+// вместе с подкатегориями (пост в нескольких из них считается один раз).
+func LoadAllCategories(db *sql.DB) []models.Category {
+	rows, err := db.Query(`
+		WITH RECURSIVE subtree(root, id) AS (
+			SELECT id, id FROM categories
+			UNION
+			SELECT subtree.root, c.id FROM categories c JOIN subtree ON c.parent_id = subtree.id
+		)
+		SELECT c.id, c.name, c.slug, c.description, COALESCE(c.parent_id, 0),
+			(SELECT COUNT(DISTINCT pc.post_id)
+			 FROM subtree JOIN post_categories pc ON pc.category_id = subtree.id
+			 WHERE subtree.root = c.id)
+		FROM categories c
+		ORDER BY c.id
+	`)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+
+	var all []models.Category
+	for rows.Next() {
+		var c models.Category
+		if err := rows.Scan(&c.ID, &c.Name, &c.Slug, &c.Description, &c.ParentID, &c.Posts); err == nil {
+			all = append(all, c)
+		}
+	}
+
+	known := make(map[int]bool, len(all))
+	children := make(map[int][]models.Category)
+	for _, c := range all {
+		known[c.ID] = true
+	}
+	for _, c := range all {
+		parent := c.ParentID
+		if !known[parent] {
+			// Родитель удалён — показываем категорию среди корневых
+			parent = 0
+		}
+		children[parent] = append(children[parent], c)
+	}
+
+	categories := make([]models.Category, 0, len(all))
+	var walk func(parent, depth int)
+	walk = func(parent, depth int) {
+		for _, c := range children[parent] {
+			c.Depth = depth
+			categories = append(categories, c)
+			walk(c.ID, depth+1)
+		}
+	}
+	walk(0, 0)
+	return categories
+}
+
+// CategoryTree собирает дерево для боковой панели из списка LoadAllCategories.
+// Категории из selected (id) и их предки помечаются как активные.
+func CategoryTree(categories []models.Category, selected []string) []*models.Category {
+	nodes := make(map[int]*models.Category, len(categories))
+	var roots []*models.Category
+	for i := range categories {
+		c := categories[i]
+		c.Children = nil
+		nodes[c.ID] = &c
+		if parent, ok := nodes[c.ParentID]; ok && c.Depth > 0 {
+			parent.Children = append(parent.Children, &c)
+		} else {
+			roots = append(roots, &c)
+		}
+	}
+	for _, raw := range selected {
+		id, _ := strconv.Atoi(raw)
+		for c := nodes[id]; c != nil && !c.Active; c = nodes[c.ParentID] {
+			c.Active = true
+		}
+	}
+	return roots
+}
+
+// categoryPath возвращает цепочку от корня до категории id для «хлебных крошек»
+func categoryPath(categories []models.Category, id int) []models.Category {
+	byID := make(map[int]models.Category, len(categories))
+	for _, c := range categories {
+		byID[c.ID] = c
+	}
+	var path []models.Category
+	for c, ok := byID[id]; ok && len(path) <= len(categories); c, ok = byID[c.ParentID] {
+		path = append([]models.Category{c}, path...)
+	}
+	return path
+}
+
+func loadCategoriesForPost(db *sql.DB, postID int) ([]models.Category, error) {
+	rows, err := db.Query(`
+		SELECT c.id, c.name, c.slug
+		FROM categories c
+		JOIN post_categories pc ON c.id = pc.category_id
+		WHERE pc.post_id = ?
+	`, postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cats []models.Category
+	for rows.Next() {
+		var c models.Category
+		if err := rows.Scan(&c.ID, &c.Name, &c.Slug); err == nil {
+			cats = append(cats, c)
+		}
+	}
+	return cats, nil
+}
+
+// CategoryPage — страница категории /c/<slug>: посты категории и всех её
+// подкатегорий. Фильтры из строки запроса сочетаются с ней, как на главной.
+func (h *FilterHandler) CategoryPage(w http.ResponseWriter, r *http.Request) {
+	slug := strings.TrimPrefix(r.URL.Path, "/c/")
+	categories := LoadAllCategories(h.DB)
+
+	var category *models.Category
+	for i := range categories {
+		if categories[i].Slug == slug {
+			category = &categories[i]
+			break
+		}
+	}
+	if category == nil {
+		if lower := strings.ToLower(slug); lower != slug {
+			target := &url.URL{Path: "/c/" + lower, RawQuery: r.URL.RawQuery}
+			http.Redirect(w, r, target.String(), http.StatusMovedPermanently)
+			return
+		}
+		h.Err.NotFound(w, r)
+		return
+	}
+
+	r.ParseForm()
+	filter := PostFilter{
+		Query:      r.FormValue("q"),
+		Categories: r.Form["category"],
+		Within:     category.ID,
+		Tags:       normalizeTags(r.Form["tag"]),
+		Liked:      r.FormValue("liked") == "1",
+	}
+	userID, _, _ := GetUserFromSession(h.DB, r)
+	h.renderPosts(w, r, filter, categories, map[string]interface{}{
+		"Category":          category,
+		"CategoryPath":      categoryPath(categories, category.ID),
+		"FollowingCategory": userID != 0 && IsFollowing(h.DB, userID, "category", category.ID),
+	})
+}
@@ -0,0 +1,272 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"forum/internal/chat"
+	"forum/internal/config"
+	"forum/internal/models"
+
+	"github.com/coder/websocket"
+)
+
+// Код закрытия для удалённого модератором: клиент не переподключается
+const closeKicked websocket.StatusCode = 4001
+
+// Сроки ограничений по умолчанию и наибольший срок
+const (
+	chatDefaultMinutes = 10
+	chatMaxMinutes     = 7 * 24 * 60
+)
+
+// ChatHandler — страница чата категории и WebSocket-подключение к ней
+type ChatHandler struct {
+	DB        *sql.DB
+	Templates *template.Template
+	Err       *ErrorHandler
+	Hub       *chat.Hub
+	// Частота сообщений для одного подключения
+	Limit config.RateLimit
+	// Как часто проверять, что клиент на связи
+	PingInterval time.Duration
+	Now          func() time.Time
+}
+
+func (h *ChatHandler) now() time.Time {
+	if h.Now != nil {
+		return h.Now()
+	}
+	return time.Now()
+}
+
+func (h *ChatHandler) pingInterval() time.Duration {
+	if h.PingInterval > 0 {
+		return h.PingInterval
+	}
+	return 30 * time.Second
+}
+
+// chatCommand — то, что присылает клиент
+type chatCommand struct {
+	Type    string `json:"type"` // message, history, mute, kick
+	Text    string `json:"text"`
+	Before  int64  `json:"before"`
+	UserID  int    `json:"user_id"`
+	Minutes int    `json:"minutes"`
+}
+
+func (h *ChatHandler) category(slug string) (models.Category, bool) {
+	var c models.Category
+	err := h.DB.QueryRow(`SELECT id, name, slug, description FROM categories WHERE slug = ?`, slug).
+		Scan(&c.ID, &c.Name, &c.Slug, &c.Description)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Println("Ошибка загрузки категории:", err)
+		}
+		return c, false
+	}
+	return c, true
+}
+
+// Room — GET /chat/<slug>: страница чата категории
+func (h *ChatHandler) Room(w http.ResponseWriter, r *http.Request) {
+	category, ok := h.category(strings.TrimPrefix(r.URL.Path, "/chat/"))
+	if !ok {
+		h.Err.NotFound(w, r)
+		return
+	}
+
+	data := map[string]interface{}{
+		"Page":     "chat",
+		"Category": category,
+		"Flash":    GetFlash(w, r, "flash"),
+	}
+	if userID, username, ok := GetUserFromSession(h.DB, r); ok {
+		role := GetUserRole(h.DB, userID)
+		data["User"] = username
+		data["UserID"] = userID
+		data["Moderator"] = role == "moderator" || role == "admin"
+		if until, err := h.Hub.Restriction(category.ID, userID, "kick"); err == nil && until != nil {
+			data["KickedUntil"] = until.Format("02.01.2006 15:04")
+		}
+	}
+	h.Templates.ExecuteTemplate(w, "layout", pageData(r, data))
+}
+
+// Socket — GET /ws/chat/<slug>: WebSocket-подключение к комнате.
+// Пользователь определяется по cookie сессии, как и на обычных страницах.
+func (h *ChatHandler) Socket(w http.ResponseWriter, r *http.Request) {
+	category, ok := h.category(strings.TrimPrefix(r.URL.Path, "/ws/chat/"))
+	if !ok {
+		h.Err.NotFound(w, r)
+		return
+	}
+	userID, username, ok := GetUserFromSession(h.DB, r)
+	if !ok {
+		h.Err.Render(w, r, http.StatusUnauthorized, "Авторизуйтесь, чтобы писать в чат")
+		return
+	}
+	role := GetUserRole(h.DB, userID)
+	user := chat.User{ID: userID, Name: username, Moderator: role == "moderator" || role == "admin"}
+
+	client, err := h.Hub.Join(category.ID, user)
+	if errors.Is(err, chat.ErrKicked) {
+		h.Err.Render(w, r, http.StatusForbidden, "Модератор удалил вас из этой комнаты")
+		return
+	}
+	if err != nil {
+		log.Println("Ошибка входа в чат:", err)
+		h.Err.Render(w, r, http.StatusInternalServerError, "Ошибка базы данных")
+		return
+	}
+
+	// Accept отклоняет запросы со страниц другого сайта: браузер присылает
+	// с ними cookie сессии, и чужая страница могла бы писать в чат от имени
+	// пользователя. Ответ при ошибке рукопожатия Accept пишет сам.
+	conn, err := websocket.Accept(w, r, nil)
+	if err != nil {
+		client.Leave()
+		return
+	}
+	// Одно сообщение — JSON с текстом не длиннее MaxLength символов
+	conn.SetReadLimit(int64(h.Hub.MaxLength)*4 + 1024)
+
+	ctx, cancel := context.WithCancel(r.Context())
+	done := make(chan struct{})
+	go h.writeLoop(ctx, conn, client, done)
+
+	// У каждого подключения своя корзина: лимит не зависит от других вкладок
+	limits := NewMemoryStore()
+	for {
+		_, data, err := conn.Read(ctx)
+		if err != nil {
+			break
+		}
+		var cmd chatCommand
+		if err := json.Unmarshal(data, &cmd); err != nil {
+			client.Reply(chat.Event{Type: "error", Text: "Некорректная команда"})
+			continue
+		}
+		if cmd.Type == "message" {
+			if allowed, wait := limits.Take("chat", h.Limit, h.now()); !allowed {
+				client.Reply(chat.Event{Type: "error",
+					Text: fmt.Sprintf("Слишком много сообщений. Повторите через %d сек.", int(math.Ceil(wait.Seconds())))})
+				continue
+			}
+		}
+		h.handle(client, cmd)
+	}
+
+	client.Leave()
+	<-done
+	cancel()
+	conn.CloseNow()
+}
+
+// writeLoop отправляет события комнаты и проверяет связь ping-ами.
+// Клиент, не ответивший на ping за интервал, отключается.
+func (h *ChatHandler) writeLoop(ctx context.Context, conn *websocket.Conn, client *chat.Client, done chan<- struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(h.pingInterval())
+	defer ticker.Stop()
+	for {
+		select {
+		case data, ok := <-client.C:
+			if !ok {
+				// Закрытие прерывает и чтение в Socket
+				switch {
+				case client.Kicked():
+					conn.Close(closeKicked, "kicked")
+				case client.Lagged():
+					conn.Close(websocket.StatusTryAgainLater, "too slow")
+				default:
+					conn.Close(websocket.StatusNormalClosure, "")
+				}
+				return
+			}
+			writeCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+			err := conn.Write(writeCtx, websocket.MessageText, data)
+			cancel()
+			if err != nil {
+				conn.CloseNow()
+				client.Leave()
+				return
+			}
+		case <-ticker.C:
+			pingCtx, cancel := context.WithTimeout(ctx, h.pingInterval())
+			err := conn.Ping(pingCtx)
+			cancel()
+			if err != nil {
+				conn.CloseNow()
+				client.Leave()
+				return
+			}
+		}
+	}
+}
+
+func (h *ChatHandler) handle(client *chat.Client, cmd chatCommand) {
+	var err error
+	switch cmd.Type {
+	case "message":
+		_, err = h.Hub.Send(client, cmd.Text)
+	case "history":
+		var messages []chat.Message
+		var more bool
+		messages, more, err = h.Hub.History(client.Room, cmd.Before)
+		if err == nil {
+			client.Reply(chat.Event{Type: "history", Messages: messages, More: more})
+		}
+	case "mute":
+		err = h.Hub.Mute(client.Room, client.User, cmd.UserID, chatDuration(cmd.Minutes, 0))
+	case "kick":
+		err = h.Hub.Kick(client.Room, client.User, cmd.UserID, chatDuration(cmd.Minutes, chatDefaultMinutes))
+	default:
+		err = errUnknownCommand
+	}
+
+	var text string
+	switch {
+	case err == nil:
+		return
+	case errors.Is(err, chat.ErrEmpty):
+		text = "Пустое сообщение"
+	case errors.Is(err, chat.ErrTooLong):
+		text = fmt.Sprintf("Сообщение длиннее %d символов", h.Hub.MaxLength)
+	case errors.Is(err, chat.ErrMuted):
+		text = "Модератор запретил вам писать в этой комнате"
+	case errors.Is(err, chat.ErrForbidden):
+		text = "Действие доступно только модераторам"
+	case errors.Is(err, chat.ErrTarget):
+		text = "Этого участника нельзя ограничить"
+	case errors.Is(err, errUnknownCommand):
+		text = "Неизвестная команда"
+	default:
+		log.Println("Ошибка чата:", err)
+		text = "Ошибка базы данных"
+	}
+	client.Reply(chat.Event{Type: "error", Text: text})
+}
+
+var errUnknownCommand = errors.New("неизвестная команда чата")
+
+// chatDuration — срок ограничения в минутах; 0 заменяется на fallback
+func chatDuration(minutes, fallback int) time.Duration {
+	if minutes <= 0 {
+		minutes = fallback
+	}
+	if minutes > chatMaxMinutes {
+		minutes = chatMaxMinutes
+	}
+	return time.Duration(minutes) * time.Minute
+}
@@ -2,11 +2,16 @@ package handlers
 
 import (
 	"database/sql"
+	"errors"
+	"fmt"
+	"forum/internal/live"
 	"forum/internal/models"
+	"forum/internal/spam"
 	"html/template"
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -14,6 +19,10 @@ type CommentHandler struct {
 	DB        *sql.DB
 	Templates *template.Template
 	Err       *ErrorHandler
+	Notify    *Notifier
+	Live      *live.Hub
+	// Фильтры спама; сработавший задерживает комментарий до проверки
+	Spam spam.Chain
 }
 
 // Добавление комментария
@@ -24,11 +33,11 @@ func (h *CommentHandler) AddComment(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := r.ParseForm(); err != nil {
-		h.Err.Render(w, http.StatusBadRequest, "Ошибка формы")
+		h.Err.Render(w, r, http.StatusBadRequest, "Ошибка формы")
 		return
 	}
 
-	userID, _, ok := GetUserFromSession(h.DB, r)
+	userID, username, ok := GetUserFromSession(h.DB, r)
 	if !ok {
 		SetFlash(w, "flash", "Авторизуйтесь, чтобы комментировать")
 		http.Redirect(w, r, "/login", http.StatusSeeOther)
@@ -44,36 +53,159 @@ func (h *CommentHandler) AddComment(w http.ResponseWriter, r *http.Request) {
 	}
 
 	content := r.FormValue("content")
-	if content == "" {
+	if strings.TrimSpace(content) == "" {
 		SetFlash(w, "flash", "Комментарий не может быть пустым")
 		http.Redirect(w, r, "/post/"+postIDStr, http.StatusSeeOther)
 		return
 	}
-	createdAt := time.Now().UTC()
+	// Ответ на комментарий: родитель должен быть из того же поста
+	var parentID sql.NullInt64
+	var parentAuthor string
+	if raw := r.FormValue("parent_id"); raw != "" {
+		id, err := strconv.Atoi(raw)
+		var parentPost int
+		if err == nil {
+			err = h.DB.QueryRow(`
+				SELECT c.post_id, u.username FROM comments c JOIN users u ON u.id = c.user_id
+				WHERE c.id = ?`, id).Scan(&parentPost, &parentAuthor)
+		}
+		if err != nil || parentPost != postID {
+			h.Err.Render(w, r, http.StatusBadRequest, "Некорректный комментарий для ответа")
+			return
+		}
+		parentID = sql.NullInt64{Int64: int64(id), Valid: true}
+	}
+	moderator := isModerator(h.DB, userID)
+	if err := threadClosed(h.DB, postID, moderator); err != nil {
+		if errors.Is(err, errThreadLocked) || errors.Is(err, errThreadArchived) {
+			h.Err.Render(w, r, http.StatusForbidden, err.Error())
+		} else {
+			h.Err.Render(w, r, http.StatusInternalServerError, "Ошибка базы данных")
+		}
+		return
+	}
+	// Заблокированный не отвечает ни на пост, ни на комментарий заблокировавшего
+	if !moderator && replyBlocked(h.DB, postID, parentID.Int64, userID) {
+		h.Err.Render(w, r, http.StatusForbidden, errReplyBlocked.Error())
+		return
+	}
+	if flag := checkSpam(h.DB, h.Spam, userID, "comment", "", content, time.Now()); flag != nil {
+		held := models.HeldContent{TargetType: "comment", UserID: userID, PostID: postID, ParentID: int(parentID.Int64), Content: content}
+		if err := holdContent(h.DB, held, flag, time.Now().UTC()); err != nil {
+			log.Println("Ошибка отправки комментария на проверку:", err)
+			h.Err.Render(w, r, http.StatusInternalServerError, "Ошибка базы данных")
+			return
+		}
+		// Комментария на странице не будет: held=1 объясняет почему
+		http.Redirect(w, r, "/post/"+postIDStr+"?held=1", http.StatusSeeOther)
+		return
+	}
 
-	_, err = h.DB.Exec(`
-		INSERT INTO comments (post_id, user_id, content, created_at) 
-		VALUES (?, ?, ?, ?)`,
-		postID, userID, content, createdAt,
-	)
-	if err != nil {
+	if _, err := h.saveComment(postID, userID, username, parentID, parentAuthor, content); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			h.Err.NotFound(w, r)
+			return
+		}
 		log.Println("Ошибка при добавлении комментария:", err)
-		h.Err.Render(w, http.StatusInternalServerError, "Ошибка базы данных")
+		h.Err.Render(w, r, http.StatusInternalServerError, "Ошибка базы данных")
 		return
 	}
-
 	http.Redirect(w, r, "/post/"+postIDStr, http.StatusSeeOther)
 }
 
-// Получение комментариев для поста
-func GetCommentsByPostID(db *sql.DB, postID int) ([]models.Comment, error) {
+// saveComment записывает проверенный комментарий вместе со счётчиками
+// поста, рассылает уведомления и отправляет его в живую ленту обсуждения.
+// Если поста нет, возвращает sql.ErrNoRows.
+func (h *CommentHandler) saveComment(postID, userID int, username string, parentID sql.NullInt64, parentAuthor, content string) (int, error) {
+	tx, err := h.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	c, err := insertComment(tx, postID, userID, parentID, content)
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	h.commentAdded(c, username, parentAuthor)
+	return c.id, nil
+}
+
+// newComment — комментарий, записанный в транзакции. Уведомления и живая
+// лента получают его после фиксации, из commentAdded.
+type newComment struct {
+	id, postID, userID int
+	parentID           int64
+	html               string
+	mentioned          []int
+	createdAt          time.Time
+}
+
+// insertComment записывает комментарий, счётчики поста и упоминания в tx.
+// Если поста нет, возвращает sql.ErrNoRows.
+func insertComment(tx *sql.Tx, postID, userID int, parentID sql.NullInt64, content string) (newComment, error) {
+	c := newComment{postID: postID, userID: userID, parentID: parentID.Int64, createdAt: time.Now().UTC()}
+	var mentioned []int
+	c.html, mentioned = renderContent(tx, content)
+
+	// Комментарий и счётчики поста записываются вместе
+	res, err := tx.Exec(`
+		UPDATE posts SET comment_count = comment_count + 1, last_activity_at = ? WHERE id = ?`,
+		c.createdAt, postID)
+	if err != nil {
+		return c, fmt.Errorf("счётчики поста: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return c, sql.ErrNoRows
+	}
+	res, err = tx.Exec(`
+		INSERT INTO comments (post_id, user_id, content, content_html, parent_id, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		postID, userID, content, c.html, parentID, c.createdAt,
+	)
+	if err != nil {
+		return c, err
+	}
+	commentID, _ := res.LastInsertId()
+	c.id = int(commentID)
+	c.mentioned, err = saveMentions(tx, "comment", c.id, postID, userID, mentioned, c.createdAt)
+	if err != nil {
+		log.Println("Ошибка сохранения упоминаний:", err)
+	}
+	return c, nil
+}
+
+// commentAdded рассылает уведомления о сохранённом комментарии и
+// отправляет его в живую ленту обсуждения
+func (h *CommentHandler) commentAdded(c newComment, username, parentAuthor string) {
+	h.Notify.CommentAdded(c.postID, c.id, int(c.parentID), c.userID, c.mentioned)
+	h.Live.Publish(postTopic(c.postID), "comment", liveComment{
+		ID:           c.id,
+		PostID:       c.postID,
+		ParentID:     int(c.parentID),
+		ParentAuthor: parentAuthor,
+		Author:       username,
+		Reputation:   userReputation(h.DB, c.userID),
+		HTML:         c.html,
+		CreatedAt:    c.createdAt.String(),
+	})
+}
+
+// Получение комментариев для поста. Комментарии авторов, которых viewerID
+// заглушил или заблокировал, пропускаются; viewerID 0 — все комментарии.
+func GetCommentsByPostID(db *sql.DB, postID, viewerID int) ([]models.Comment, error) {
 	rows, err := db.Query(`
-		SELECT c.id, c.post_id, c.user_id, u.username, c.content, c.created_at
+		SELECT c.id, c.post_id, c.user_id, u.username, u.reputation, u.reputation_at, c.content, c.content_html, c.created_at,
+			COALESCE(c.parent_id, 0), COALESCE(pu.username, ''), c.likes, c.dislikes, c.reaction_counts
 		FROM comments c
 		JOIN users u ON c.user_id = u.id
-		WHERE c.post_id = ?
+		LEFT JOIN comments parent ON parent.id = c.parent_id
+		LEFT JOIN users pu ON pu.id = parent.user_id
+		WHERE c.post_id = ? AND NOT `+fmt.Sprintf(mutedAuthor, "c.user_id")+`
 		ORDER BY c.created_at ASC
-	`, postID)
+	`, postID, viewerID)
 	if err != nil {
 		return nil, err
 	}
@@ -81,17 +213,27 @@ func GetCommentsByPostID(db *sql.DB, postID int) ([]models.Comment, error) {
 	var comments []models.Comment
 	for rows.Next() {
 		var c models.Comment
-		rows.Scan(&c.ID, &c.PostID, &c.UserID, &c.Author, &c.Content, &c.CreatedAt)
-
-		// Подсчёт лайков и дизлайков
-		likes, dislikes, err := CountLikes(db, "comment_likes", "comment_id", c.ID)
-		if err != nil {
-			log.Println("Ошибка подсчёта лайков комментария:", err)
+		var cached, counts string
+		var score float64
+		var reputationAt sql.NullTime
+		if err := rows.Scan(&c.ID, &c.PostID, &c.UserID, &c.Author, &score, &reputationAt, &c.Content, &cached, &c.CreatedAt, &c.ParentID, &c.ParentAuthor,
+			&c.Likes, &c.Dislikes, &counts); err != nil {
+			return nil, err
 		}
-		c.Likes = likes
-		c.Dislikes = dislikes
+		c.ContentHTML = template.HTML(cached)
+		c.AuthorReputation = authorReputation(score, reputationAt)
+		c.Reactions = reactionList(decodeCounts(counts))
 
 		comments = append(comments, c)
 	}
+	rows.Close()
+
+	// Старые комментарии без кэша рендерим после закрытия выборки,
+	// чтобы UPDATE не ждал блокировку чтения
+	for i := range comments {
+		if comments[i].ContentHTML == "" {
+			comments[i].ContentHTML = contentHTML(db, "comments", comments[i].ID, comments[i].Content, "")
+		}
+	}
 	return comments, nil
 }
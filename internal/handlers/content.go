@@ -0,0 +1,20 @@
+package handlers
+
+import (
+	"database/sql"
+	"html/template"
+	"log"
+)
+
+// contentHTML возвращает закэшированный HTML текста. Записи, созданные до
+// появления Markdown, рендерятся при первом просмотре и сохраняются.
+func contentHTML(db *sql.DB, table string, id int, content, cached string) template.HTML {
+	if cached != "" {
+		return template.HTML(cached)
+	}
+	rendered, _ := renderContent(db, content)
+	if _, err := db.Exec("UPDATE "+table+" SET content_html = ? WHERE id = ?", rendered, id); err != nil {
+		log.Println("Ошибка сохранения HTML:", err)
+	}
+	return template.HTML(rendered)
+}
@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	csrfCookieName = "csrf_token"
+	csrfFieldName  = "csrf_token"
+	csrfHeaderName = "X-CSRF-Token"
+)
+
+type csrfContextKey struct{}
+
+// CSRF выдаёт токены, привязанные к сессии, и проверяет их во всех
+// запросах, изменяющих состояние.
+type CSRF struct {
+	Key []byte
+	Err *ErrorHandler
+}
+
+// NewCSRF создаёт защиту с заданным ключом подписи. Если ключ пустой,
+// генерируется случайный — тогда токены перестают действовать после перезапуска.
+func NewCSRF(key []byte, errHandler *ErrorHandler) *CSRF {
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			log.Fatal("Ошибка генерации CSRF-ключа:", err)
+		}
+	}
+	return &CSRF{Key: key, Err: errHandler}
+}
+
+func (c *CSRF) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Анонимным посетителям (формы входа и регистрации) выдаём отдельную cookie
+		anonID := ""
+		if cookie, err := r.Cookie(csrfCookieName); err == nil && cookie.Value != "" {
+			anonID = cookie.Value
+		} else if isSafeMethod(r.Method) {
+			anonID = randomToken()
+			http.SetCookie(w, &http.Cookie{
+				Name:     csrfCookieName,
+				Value:    anonID,
+				Path:     "/",
+				HttpOnly: true,
+				SameSite: http.SameSiteLaxMode,
+				Expires:  time.Now().Add(365 * 24 * time.Hour),
+			})
+		}
+
+		token := c.tokenFor(r, anonID)
+		r = r.WithContext(context.WithValue(r.Context(), csrfContextKey{}, token))
+
+		if isSafeMethod(r.Method) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if !sameOrigin(r) {
+			log.Println("CSRF: чужой Origin/Referer:", r.Method, r.URL.Path)
+			c.reject(w, r, "Запрос отклонён: неверный источник")
+			return
+		}
+
+		submitted := r.Header.Get(csrfHeaderName)
+		if submitted == "" {
+			submitted = r.FormValue(csrfFieldName)
+		}
+		if token == "" || subtle.ConstantTimeCompare([]byte(submitted), []byte(token)) != 1 {
+			log.Println("CSRF: неверный токен:", r.Method, r.URL.Path)
+			c.reject(w, r, "Запрос отклонён: недействительный CSRF-токен")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (c *CSRF) reject(w http.ResponseWriter, r *http.Request, msg string) {
+	if wantsJSON(r) {
+		writeJSONError(w, http.StatusForbidden, msg)
+		return
+	}
+	c.Err.Render(w, r, http.StatusForbidden, msg)
+}
+
+// Токен зависит от сессии, а до входа — от анонимной cookie
+func (c *CSRF) tokenFor(r *http.Request, anonID string) string {
+	var subject string
+	if cookie, err := r.Cookie("session_id"); err == nil && cookie.Value != "" {
+		subject = "session|" + cookie.Value
+	} else if anonID != "" {
+		subject = "anon|" + anonID
+	} else {
+		return ""
+	}
+	mac := hmac.New(sha256.New, c.Key)
+	mac.Write([]byte(subject))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// CSRFToken возвращает токен текущего запроса для вставки в формы
+func CSRFToken(r *http.Request) string {
+	token, _ := r.Context().Value(csrfContextKey{}).(string)
+	return token
+}
+
+// Скрытое поле формы с CSRF-токеном
+func csrfField(token string) template.HTML {
+	return template.HTML(`<input type="hidden" name="` + csrfFieldName + `" value="` +
+		template.HTMLEscapeString(token) + `">`)
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// Второй уровень защиты: Origin (или Referer) должен совпадать с хостом запроса
+func sameOrigin(r *http.Request) bool {
+	source := r.Header.Get("Origin")
+	if source == "" {
+		source = r.Header.Get("Referer")
+	}
+	if source == "" {
+		return true
+	}
+	if source == "null" {
+		return false
+	}
+	u, err := url.Parse(source)
+	if err != nil {
+		return false
+	}
+	return u.Host == r.Host
+}
+
+func randomToken() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		log.Println("Ошибка генерации токена:", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
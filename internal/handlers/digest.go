@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"forum/internal/digest"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// SetDigest сохраняет периодичность дайджеста: off, daily или weekly
+func (h *NotificationHandler) SetDigest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/notifications", http.StatusSeeOther)
+		return
+	}
+	userID, _, ok := GetUserFromSession(h.DB, r)
+	if !ok {
+		h.Err.Render(w, r, http.StatusUnauthorized, "Только для авторизованных пользователей")
+		return
+	}
+
+	mode := r.FormValue("digest")
+	if _, known := digest.Periods[mode]; !known && mode != digest.Off {
+		h.Err.Render(w, r, http.StatusBadRequest, "Некорректные параметры")
+		return
+	}
+	// При включении отсчёт периода начинается заново, чтобы первое письмо
+	// не собирало события из далёкого прошлого
+	if _, err := h.DB.Exec(`UPDATE users SET digest = ?, digest_sent_at = CASE WHEN digest = ? THEN digest_sent_at END WHERE id = ?`,
+		mode, mode, userID); err != nil {
+		log.Println("Ошибка сохранения настроек дайджеста:", err)
+		h.Err.Render(w, r, http.StatusInternalServerError, "Ошибка базы данных")
+		return
+	}
+
+	SetFlash(w, "flash", "Настройки дайджеста сохранены")
+	http.Redirect(w, r, "/notifications", http.StatusSeeOther)
+}
+
+// Unsubscribe — отписка по ссылке из письма. GET показывает подтверждение,
+// отписывает только POST: почтовые сканеры открывают ссылки сами.
+func (h *NotificationHandler) Unsubscribe(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		h.Err.Render(w, r, http.StatusMethodNotAllowed, "Метод не поддерживается")
+		return
+	}
+
+	userID, err := strconv.Atoi(r.FormValue("u"))
+	token := r.FormValue("t")
+	if err != nil || !digest.VerifyUnsubscribe(h.Secret, userID, token) {
+		h.Err.Render(w, r, http.StatusBadRequest, "Ссылка отписки недействительна")
+		return
+	}
+
+	var email string
+	err = h.DB.QueryRow(`SELECT email FROM users WHERE id = ?`, userID).Scan(&email)
+	if errors.Is(err, sql.ErrNoRows) {
+		h.Err.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		h.Err.Render(w, r, http.StatusInternalServerError, "Ошибка базы данных")
+		return
+	}
+
+	done := r.Method == http.MethodPost
+	if done {
+		if _, err := h.DB.Exec(`UPDATE users SET digest = ? WHERE id = ?`, digest.Off, userID); err != nil {
+			log.Println("Ошибка отписки от дайджеста:", err)
+			h.Err.Render(w, r, http.StatusInternalServerError, "Ошибка базы данных")
+			return
+		}
+	}
+
+	_, username, _ := GetUserFromSession(h.DB, r)
+	h.Templates.ExecuteTemplate(w, "layout", pageData(r, map[string]interface{}{
+		"Page":   "unsubscribe",
+		"User":   username,
+		"Email":  email,
+		"UserID": userID,
+		"Token":  token,
+		"Done":   done,
+	}))
+}
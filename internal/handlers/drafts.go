@@ -0,0 +1,494 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"forum/internal/media"
+	"forum/internal/models"
+	"forum/internal/spam"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	maxDrafts = 50 // черновиков у одного пользователя
+	// Дальше этого срока запланировать пост нельзя
+	maxScheduleAhead = 365 * 24 * time.Hour
+)
+
+var (
+	errDraftGone     = errors.New("Черновик уже опубликован или удалён")
+	errTooManyDrafts = fmt.Errorf("Не больше %d черновиков: опубликуйте или удалите старые", maxDrafts)
+)
+
+// Drafts — страница «Мои черновики»: черновики и запланированные посты
+func (h *PostHandler) Drafts(w http.ResponseWriter, r *http.Request) {
+	userID, username, ok := GetUserFromSession(h.DB, r)
+	if !ok {
+		SetFlash(w, "flash", "Авторизуйтесь, чтобы открыть черновики")
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	drafts, err := LoadDrafts(h.DB, userID)
+	if err != nil {
+		log.Println("Ошибка загрузки черновиков:", err)
+		h.Err.Render(w, r, http.StatusInternalServerError, "Ошибка базы данных")
+		return
+	}
+	h.Templates.ExecuteTemplate(w, "layout", pageData(r, map[string]interface{}{
+		"Page":   "drafts",
+		"User":   username,
+		"Drafts": drafts,
+		"Flash":  GetFlash(w, r, "flash"),
+	}))
+}
+
+// Autosave сохраняет форму поста в черновик без проверок публикации и
+// отвечает JSON с id черновика — форма передаёт его в следующих сохранениях.
+// Расписание черновика при автосохранении не меняется.
+func (h *PostHandler) Autosave(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSONError(w, http.StatusMethodNotAllowed, "Метод не поддерживается")
+		return
+	}
+	userID, _, ok := GetUserFromSession(h.DB, r)
+	if !ok {
+		writeJSONError(w, http.StatusUnauthorized, "Только для авторизованных пользователей")
+		return
+	}
+	if err := r.ParseMultipartForm(maxUploadMemory); err != nil && err != http.ErrNotMultipart {
+		writeJSONError(w, http.StatusBadRequest, "Ошибка формы")
+		return
+	}
+
+	in := postInputFromForm(r.Form)
+	draftID, _ := strconv.Atoi(r.FormValue("draft_id"))
+	var publishAt *time.Time
+	if draftID != 0 {
+		draft, err := GetDraft(h.DB, userID, draftID)
+		if err != nil {
+			writeJSONError(w, http.StatusConflict, errDraftGone.Error())
+			return
+		}
+		publishAt = draft.PublishAt
+	} else if in.empty() {
+		// Пустую форму не сохраняем
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"id": 0})
+		return
+	}
+	if msg := joinFieldErrors(in.checkDraft()); msg != "" {
+		writeJSONError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	id, err := saveDraft(h.DB, h.Store, userID, draftID, in, publishAt, nil)
+	if err != nil {
+		status := http.StatusInternalServerError
+		msg := "Ошибка базы данных"
+		switch {
+		case errors.Is(err, errDraftGone):
+			status, msg = http.StatusConflict, err.Error()
+		case errors.Is(err, errTooManyDrafts):
+			status, msg = http.StatusBadRequest, err.Error()
+		default:
+			log.Println("Ошибка автосохранения черновика:", err)
+		}
+		writeJSONError(w, status, msg)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":       id,
+		"saved_at": time.Now().Format("15:04"),
+	})
+}
+
+// DeleteDraft удаляет черновик вместе с расписанием
+func (h *PostHandler) DeleteDraft(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/drafts", http.StatusSeeOther)
+		return
+	}
+	userID, _, ok := GetUserFromSession(h.DB, r)
+	if !ok {
+		h.Err.Render(w, r, http.StatusUnauthorized, "Только для авторизованных пользователей")
+		return
+	}
+	id, _ := strconv.Atoi(r.FormValue("id"))
+	tx, err := h.DB.Begin()
+	if err != nil {
+		h.Err.Render(w, r, http.StatusInternalServerError, "Ошибка базы данных")
+		return
+	}
+	defer tx.Rollback()
+	if err := deleteDraft(tx, userID, id); errors.Is(err, errDraftGone) {
+		h.Err.NotFound(w, r)
+		return
+	} else if err != nil || tx.Commit() != nil {
+		h.Err.Render(w, r, http.StatusInternalServerError, "Ошибка базы данных")
+		return
+	}
+	SetFlash(w, "flash", "Черновик удалён")
+	http.Redirect(w, r, "/drafts", http.StatusSeeOther)
+}
+
+// draftError сообщает об ошибке сохранения черновика или публикации поста
+func (h *PostHandler) draftError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, errDraftGone):
+		h.Err.Render(w, r, http.StatusConflict, err.Error())
+	case errors.Is(err, errTooManyDrafts):
+		h.Err.Render(w, r, http.StatusBadRequest, err.Error())
+	default:
+		log.Println("Ошибка создания поста:", err)
+		h.Err.Render(w, r, http.StatusInternalServerError, "Ошибка создания поста")
+	}
+}
+
+// RunScheduler публикует запланированные посты каждые interval
+func (h *PostHandler) RunScheduler(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if published, err := h.PublishDue(time.Now()); err != nil {
+			log.Println("Ошибка публикации по расписанию:", err)
+		} else if published > 0 {
+			log.Printf("Опубликовано по расписанию: %d", published)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// PublishDue публикует черновики, время которых пришло, и возвращает их
+// число. Черновик, который больше не проходит проверку (например, тег
+// запретили), снимается с расписания и остаётся у автора с пояснением.
+func (h *PostHandler) PublishDue(now time.Time) (int, error) {
+	rows, err := h.DB.Query(`
+		SELECT d.id, d.user_id, u.username
+		FROM drafts d
+		JOIN users u ON u.id = d.user_id
+		WHERE d.publish_at IS NOT NULL AND d.publish_at <= ?
+		ORDER BY d.publish_at, d.id`, now.UTC())
+	if err != nil {
+		return 0, err
+	}
+	type due struct {
+		id, userID int
+		author     string
+	}
+	var list []due
+	for rows.Next() {
+		var d due
+		if err := rows.Scan(&d.id, &d.userID, &d.author); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		list = append(list, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	published := 0
+	for _, d := range list {
+		draft, err := GetDraft(h.DB, d.userID, d.id)
+		if err != nil {
+			continue // удалили, пока шёл проход
+		}
+		in := draftInput(*draft)
+		fieldErrors, tags, poll := in.check(h.DB, d.userID, now)
+		if msg := joinFieldErrors(fieldErrors); msg != "" {
+			if err := unschedule(h.DB, d.id, msg); err != nil {
+				return published, err
+			}
+			continue
+		}
+		if flag := checkSpam(h.DB, h.Spam, d.userID, "post", in.Title, in.Content, now); flag != nil {
+			if err := h.holdScheduled(d.id, d.userID, flag, now); err != nil {
+				return published, fmt.Errorf("черновик %d: %w", d.id, err)
+			}
+			continue
+		}
+		if _, err := h.createPost(d.userID, d.author, in, tags, poll, nil, d.id); err != nil {
+			if errors.Is(err, errDraftGone) {
+				continue
+			}
+			// Сбой одного поста не задерживает остальные: черновик снимается
+			// с расписания, иначе он падал бы на каждом проходе
+			log.Printf("Черновик %d: ошибка публикации по расписанию: %v", d.id, err)
+			if err := unschedule(h.DB, d.id, "Ошибка создания поста, запланируйте публикацию ещё раз"); err != nil {
+				return published, err
+			}
+			continue
+		}
+		published++
+	}
+	return published, nil
+}
+
+// unschedule снимает черновик с расписания и оставляет автору пояснение
+func unschedule(db *sql.DB, draftID int, msg string) error {
+	_, err := db.Exec(`UPDATE drafts SET publish_at = NULL, error = ? WHERE id = ?`, msg, draftID)
+	return err
+}
+
+// holdScheduled снимает задержанный фильтрами пост с расписания и ставит
+// в очередь проверки
+func (h *PostHandler) holdScheduled(draftID, userID int, flag *spam.Flag, now time.Time) error {
+	tx, err := h.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`UPDATE drafts SET publish_at = NULL WHERE id = ?`, draftID); err != nil {
+		return err
+	}
+	held := models.HeldContent{TargetType: "post", UserID: userID, DraftID: draftID}
+	if err := holdContent(tx, held, flag, now.UTC()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// joinFieldErrors собирает ошибки полей формы в одну строку
+func joinFieldErrors(fieldErrors map[string]string) string {
+	var parts []string
+	for _, field := range []string{"Title", "Content", "Categories", "Tags", "Poll"} {
+		if msg := fieldErrors[field]; msg != "" {
+			parts = append(parts, msg)
+		}
+	}
+	return strings.Join(parts, "; ")
+}
+
+// parsePublishAt разбирает время публикации из поля datetime-local,
+// заполненного в часовом поясе loc
+func parsePublishAt(raw string, loc *time.Location, now time.Time) (time.Time, string) {
+	if raw == "" {
+		return time.Time{}, "Укажите время публикации"
+	}
+	at, err := time.ParseInLocation(pollTimeLayout, raw, loc)
+	if err != nil {
+		return time.Time{}, "Некорректное время публикации"
+	}
+	if !at.After(now) {
+		return time.Time{}, "Время публикации должно быть в будущем"
+	}
+	if at.Sub(now) > maxScheduleAhead {
+		return time.Time{}, "Запланировать пост можно не дальше чем на год вперёд"
+	}
+	return at.UTC(), ""
+}
+
+// formZone — часовой пояс, в котором заполнено время в форме. Скрипт
+// страницы присылает в tz_offset смещение браузера от UTC в минутах, как
+// его возвращает Date.getTimezoneOffset (к востоку от Гринвича —
+// отрицательное). Без скрипта смещения нет, и время читается по часам
+// сервера.
+func formZone(offset string) *time.Location {
+	minutes, err := strconv.Atoi(offset)
+	if err != nil || minutes < -14*60 || minutes > 14*60 {
+		return time.Local
+	}
+	return time.FixedZone("", -minutes*60)
+}
+
+// zoneOffset — смещение t для поля tz_offset, обратное formZone
+func zoneOffset(t time.Time) string {
+	_, seconds := t.Zone()
+	return strconv.Itoa(-seconds / 60)
+}
+
+const draftColumns = `d.id, d.user_id, d.title, d.content, d.categories, d.tags, d.poll, d.publish_at, d.error,
+	(SELECT COUNT(*) FROM draft_attachments a WHERE a.draft_id = d.id),
+	EXISTS (SELECT 1 FROM held_content h WHERE h.draft_id = d.id), d.created_at, d.updated_at`
+
+func scanDraft(row interface{ Scan(...interface{}) error }) (models.Draft, error) {
+	var d models.Draft
+	var categories string
+	var publishAt sql.NullTime
+	err := row.Scan(&d.ID, &d.UserID, &d.Title, &d.Content, &categories, &d.Tags, &d.Poll, &publishAt, &d.Error,
+		&d.Images, &d.Held, &d.CreatedAt, &d.UpdatedAt)
+	if err != nil {
+		return d, err
+	}
+	if err := json.Unmarshal([]byte(categories), &d.Categories); err != nil {
+		log.Printf("Черновик %d: некорректные категории: %v", d.ID, err)
+	}
+	if publishAt.Valid {
+		d.PublishAt = &publishAt.Time
+	}
+	return d, nil
+}
+
+// GetDraft возвращает черновик пользователя; чужой черновик — sql.ErrNoRows
+func GetDraft(db *sql.DB, userID, id int) (*models.Draft, error) {
+	d, err := scanDraft(db.QueryRow(`SELECT `+draftColumns+` FROM drafts d WHERE d.id = ? AND d.user_id = ?`, id, userID))
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// LoadDrafts — черновики пользователя: сначала запланированные по времени
+// выхода, затем остальные, недавно изменённые сверху
+func LoadDrafts(db *sql.DB, userID int) ([]models.Draft, error) {
+	rows, err := db.Query(`
+		SELECT `+draftColumns+`
+		FROM drafts d
+		WHERE d.user_id = ?
+		ORDER BY d.publish_at IS NULL, d.publish_at, d.updated_at DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var drafts []models.Draft
+	for rows.Next() {
+		d, err := scanDraft(rows)
+		if err != nil {
+			return nil, err
+		}
+		drafts = append(drafts, d)
+	}
+	return drafts, rows.Err()
+}
+
+// draftInput восстанавливает форму поста из черновика
+func draftInput(d models.Draft) postInput {
+	in := postInput{
+		Title:      d.Title,
+		Content:    d.Content,
+		Categories: d.Categories,
+		Tags:       d.Tags,
+	}
+	if err := json.Unmarshal([]byte(d.Poll), &in.Poll); err != nil {
+		log.Printf("Черновик %d: некорректный опрос: %v", d.ID, err)
+	}
+	if d.PublishAt != nil {
+		local := d.PublishAt.Local()
+		in.PublishAt = local.Format(pollTimeLayout)
+		in.TZOffset = zoneOffset(local)
+	}
+	return in
+}
+
+// saveDraft создаёт черновик (draftID = 0) или обновляет его. publishAt —
+// время публикации по расписанию, nil — обычный черновик. Изображения
+// добавляются к уже сохранённым. Ошибка публикации при сохранении
+// сбрасывается, а изменённый черновик снимается с проверки модераторами:
+// при публикации фильтры спама проверят его заново.
+func saveDraft(db *sql.DB, store media.BlobStore, userID, draftID int, in postInput, publishAt *time.Time, images []*media.Image) (int, error) {
+	categories, err := json.Marshal(in.Categories)
+	if err != nil {
+		return 0, err
+	}
+	if in.Categories == nil {
+		categories = []byte("[]")
+	}
+	poll, err := json.Marshal(in.Poll)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	if draftID == 0 {
+		var count int
+		if err := tx.QueryRow(`SELECT COUNT(*) FROM drafts WHERE user_id = ?`, userID).Scan(&count); err != nil {
+			return 0, err
+		}
+		if count >= maxDrafts {
+			return 0, errTooManyDrafts
+		}
+		res, err := tx.Exec(`
+			INSERT INTO drafts (user_id, title, content, categories, tags, poll, publish_at, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			userID, in.Title, in.Content, string(categories), in.Tags, string(poll), publishAt, now, now)
+		if err != nil {
+			return 0, err
+		}
+		id, _ := res.LastInsertId()
+		draftID = int(id)
+	} else {
+		res, err := tx.Exec(`
+			UPDATE drafts SET title = ?, content = ?, categories = ?, tags = ?, poll = ?, publish_at = ?, error = '', updated_at = ?
+			WHERE id = ? AND user_id = ?`,
+			in.Title, in.Content, string(categories), in.Tags, string(poll), publishAt, now, draftID, userID)
+		if err != nil {
+			return 0, err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return 0, errDraftGone
+		}
+		if _, err := tx.Exec(`DELETE FROM held_content WHERE draft_id = ?`, draftID); err != nil {
+			return 0, err
+		}
+	}
+
+	for _, img := range images {
+		key, thumbKey := imageKeys(img)
+		_, err := tx.Exec(`
+			INSERT INTO draft_attachments (draft_id, user_id, blob_key, thumb_key, mime, width, height, size)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			draftID, userID, key, thumbKey, img.MIME, img.Width, img.Height, len(img.Data))
+		if err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	storeImages(store, images)
+	return draftID, nil
+}
+
+// takeDraft переносит изображения черновика к опубликованному посту и
+// удаляет черновик. Если черновик уже забрали, возвращает errDraftGone.
+func takeDraft(tx *sql.Tx, userID, draftID int, postID int64) error {
+	_, err := tx.Exec(`
+		INSERT INTO attachments (post_id, user_id, blob_key, thumb_key, mime, width, height, size)
+		SELECT ?, user_id, blob_key, thumb_key, mime, width, height, size
+		FROM draft_attachments WHERE draft_id = ? AND user_id = ?
+		ORDER BY id`, postID, draftID, userID)
+	if err != nil {
+		return err
+	}
+	return deleteDraft(tx, userID, draftID)
+}
+
+// deleteDraft удаляет черновик вместе с заявкой на проверку. Файлы изображений остаются в хранилище:
+// оно адресуется по содержимому, и те же файлы могут быть у других постов.
+func deleteDraft(tx *sql.Tx, userID, draftID int) error {
+	res, err := tx.Exec(`DELETE FROM drafts WHERE id = ? AND user_id = ?`, draftID, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errDraftGone
+	}
+	if _, err := tx.Exec(`DELETE FROM held_content WHERE draft_id = ?`, draftID); err != nil {
+		return err
+	}
+	_, err = tx.Exec(`DELETE FROM draft_attachments WHERE draft_id = ?`, draftID)
+	return err
+}
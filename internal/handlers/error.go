@@ -9,31 +9,33 @@ type ErrorHandler struct {
 	Templates *template.Template
 }
 
-func (h *ErrorHandler) Render(w http.ResponseWriter, status int, msg string) {
+// Render показывает страницу ошибки. Запрос нужен для общих данных
+// страницы: CSRF-токена формы выхода и nonce скриптов.
+func (h *ErrorHandler) Render(w http.ResponseWriter, r *http.Request, status int, msg string) {
 	if h == nil || h.Templates == nil {
 		http.Error(w, msg, status)
 		return
 	}
 	w.WriteHeader(status)
-	err := h.Templates.ExecuteTemplate(w, "layout", map[string]interface{}{
+	err := h.Templates.ExecuteTemplate(w, "layout", pageData(r, map[string]interface{}{
 		"Page":   "error",
 		"Error":  msg,
 		"Status": status,
-	})
+	}))
 	if err != nil {
 		http.Error(w, "Ошибка при отображении страницы ошибки", http.StatusInternalServerError)
 	}
 }
 
 func (h *ErrorHandler) NotFound(w http.ResponseWriter, r *http.Request) {
-	h.Render(w, http.StatusNotFound, "Страница не найдена")
+	h.Render(w, r, http.StatusNotFound, "Страница не найдена")
 }
 
 func (h *ErrorHandler) RecoveryMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
 			if rec := recover(); rec != nil {
-				h.Render(w, http.StatusInternalServerError, "Внутренняя ошибка сервера")
+				h.Render(w, r, http.StatusInternalServerError, "Внутренняя ошибка сервера")
 			}
 		}()
 		next.ServeHTTP(w, r)
@@ -3,10 +3,13 @@ package handlers
 import (
 	"database/sql"
 	"fmt"
+	"forum/internal/live"
 	"forum/internal/models"
 	"html/template"
 	"log"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 )
 
@@ -14,6 +17,7 @@ type FilterHandler struct {
 	DB        *sql.DB
 	Templates *template.Template
 	Err       *ErrorHandler
+	Live      *live.Hub
 }
 
 func (h *FilterHandler) FilteredPosts(w http.ResponseWriter, r *http.Request) {
@@ -22,81 +26,312 @@ func (h *FilterHandler) FilteredPosts(w http.ResponseWriter, r *http.Request) {
 	r.ParseForm()
 	fmt.Println("DEBUG form values:", r.Form)
 
-	query := r.FormValue("q")
-	selectedCategories := r.Form["category"]
-
 	log.Println("DEBUG selectedCategories:", r.Form["category"])
 
-	liked := r.FormValue("liked") == "1"
+	h.renderPosts(w, r, PostFilter{
+		Query:      r.FormValue("q"),
+		Categories: r.Form["category"],
+		Tags:       normalizeTags(r.Form["tag"]),
+		Liked:      r.FormValue("liked") == "1",
+	}, LoadAllCategories(h.DB), nil)
+}
+
+// TagPage — страница тега /tag/<имя>. Остальные фильтры из строки запроса
+// (категории, другие теги) сочетаются с ним.
+func (h *FilterHandler) TagPage(w http.ResponseWriter, r *http.Request) {
+	name := NormalizeTag(strings.TrimPrefix(r.URL.Path, "/tag/"))
+	canonical, banned, err := resolveTag(h.DB, name)
+	if err != nil {
+		h.Err.Render(w, r, http.StatusInternalServerError, "Ошибка базы данных")
+		return
+	}
+	if name == "" || banned {
+		h.Err.NotFound(w, r)
+		return
+	}
+	if canonical != name || r.URL.Path != "/tag/"+name {
+		// Синоним или ненормализованное имя — ведём на основной адрес
+		target := &url.URL{Path: "/tag/" + canonical, RawQuery: r.URL.RawQuery}
+		http.Redirect(w, r, target.String(), http.StatusMovedPermanently)
+		return
+	}
 
+	r.ParseForm()
+	h.renderPosts(w, r, PostFilter{
+		Query:      r.FormValue("q"),
+		Categories: r.Form["category"],
+		Tags:       normalizeTags(append([]string{name}, r.Form["tag"]...)),
+		Liked:      r.FormValue("liked") == "1",
+	}, LoadAllCategories(h.DB), map[string]interface{}{"TagPage": name})
+}
+
+// renderPosts выводит ленту; extra — данные конкретной страницы (тег, категория)
+func (h *FilterHandler) renderPosts(w http.ResponseWriter, r *http.Request, filter PostFilter, categories []models.Category, extra map[string]interface{}) {
 	userID, username, _ := GetUserFromSession(h.DB, r)
+	filter.UserID = userID
+	filter.ShowMuted = r.FormValue("muted") == "show"
+	switch sort := r.FormValue("sort"); sort {
+	case SortTop, SortActive:
+		filter.Sort = sort
+	}
 
-	posts, err := GetFilteredPosts(h.DB, query, selectedCategories, liked, userID)
+	posts, err := GetFilteredPosts(h.DB, filter)
 	if err != nil {
-		h.Err.Render(w, http.StatusInternalServerError, "Ошибка загрузки постов")
+		h.Err.Render(w, r, http.StatusInternalServerError, "Ошибка загрузки постов")
 		return
 	}
+	if userID != 0 {
+		markBookmarkedPosts(h.DB, userID, posts)
+	}
 
-	categories := LoadAllCategories(h.DB)
+	// В дереве категорий категория страницы отмечена вместе с выбранными
+	selected := filter.Categories
+	if filter.Within != 0 {
+		selected = append([]string{strconv.Itoa(filter.Within)}, selected...)
+	}
+	data := map[string]interface{}{
+		"Page":          "index",
+		"Posts":         posts,
+		"Categories":    categories,
+		"CategoryTree":  CategoryTree(categories, selected),
+		"Selected":      selected,
+		"Tags":          filter.Tags,
+		"User":          username,
+		"Query":         filter.Query,
+		"LikedView":     filter.Liked,
+		"LiveEventID":   h.Live.LastID(),
+		"Sort":          filter.Sort,
+		"SortNewURL":    sortURL(r, ""),
+		"SortTopURL":    sortURL(r, SortTop),
+		"SortActiveURL": sortURL(r, SortActive),
+		// Переключатель «показать скрытых», если скрывать есть кого
+		"HasMuted":  userID != 0 && filter.AuthorID == 0 && hasBlocks(h.DB, userID),
+		"ShowMuted": filter.ShowMuted,
+		"MutedURL":  mutedURL(r, !filter.ShowMuted),
+		"Muted":     liveMuted(h.DB, userID, filter.ShowMuted),
+		// Новые посты вставляются прямо в ленту только без фильтров,
+		// иначе показывается плашка «есть новые посты»
+		"LiveInsert": filter.Query == "" && len(selected) == 0 && len(filter.Tags) == 0 &&
+			!filter.Liked && !filter.Saved && filter.AuthorID == 0 && filter.MentionedID == 0 && filter.Sort == "",
+	}
+	for k, v := range extra {
+		data[k] = v
+	}
+	h.Templates.ExecuteTemplate(w, "layout", pageData(r, data))
+}
 
-	h.Templates.ExecuteTemplate(w, "layout", map[string]interface{}{
-		"Page":       "index",
-		"Posts":      posts,
-		"Categories": categories,
-		"Selected":   selectedCategories,
-		"User":       username,
-		"Query":      query,
-		"LikedView":  liked,
-	})
+// sortURL — адрес текущей ленты с другой сортировкой
+func sortURL(r *http.Request, sort string) string {
+	query := r.URL.Query()
+	query.Del("sort")
+	if sort != "" {
+		query.Set("sort", sort)
+	}
+	u := url.URL{Path: r.URL.Path, RawQuery: query.Encode()}
+	return u.String()
+}
+
+// liveMuted — кого не показывать среди новых постов и комментариев по SSE
+func liveMuted(db *sql.DB, userID int, show bool) string {
+	if userID == 0 || show {
+		return "[]"
+	}
+	return mutedNames(db, userID)
+}
+
+// mutedURL — адрес текущей страницы с показом скрытых авторов или без него
+func mutedURL(r *http.Request, show bool) string {
+	query := r.URL.Query()
+	query.Del("muted")
+	if show {
+		query.Set("muted", "show")
+	}
+	u := url.URL{Path: r.URL.Path, RawQuery: query.Encode()}
+	return u.String()
+}
+
+// PostFilter — условия выборки ленты. Все заданные условия объединяются через И.
+type PostFilter struct {
+	Query      string   // подстрока в заголовке или тексте
+	Categories []string // id категорий: подходит любая из них или их подкатегорий
+	Within     int      // id категории страницы: пост в ней или её подкатегориях
+	Tags       []string // нормализованные теги: нужны все
+	Liked      bool     // только понравившиеся пользователю UserID
+	UserID     int      // текущий пользователь (0 — гость)
+	AuthorID   int      // только посты этого автора
+	// Посты, где упомянут пользователь — в тексте или в комментариях
+	MentionedID int
+	// Только посты из закладок пользователя UserID, с Folder — из одной папки
+	Saved  bool
+	Folder int
+	Sort   string // "" — новые сверху, SortTop или SortActive
+	// Показать и посты тех, кого UserID заглушил или заблокировал
+	ShowMuted bool
+}
+
+// Сортировки ленты кроме «новые сверху»
+const (
+	// «Лучшие»: веса видов реакций задаются в настройках
+	SortTop = "top"
+	// «Обсуждаемые»: по времени последнего комментария
+	SortActive = "active"
+)
+
+func normalizeTags(raw []string) []string {
+	var tags []string
+	seen := map[string]bool{}
+	for _, t := range raw {
+		if name := NormalizeTag(t); name != "" && !seen[name] {
+			seen[name] = true
+			tags = append(tags, name)
+		}
+	}
+	return tags
+}
+
+// categoryScope возвращает рекурсивное CTE name с n категориями по id и всеми
+// их потомками и условие, что пост отмечен хотя бы одной из них
+func categoryScope(name string, n int) (cte, cond string) {
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", n), ",")
+	cte = name + `(id) AS (
+			SELECT id FROM categories WHERE id IN (` + placeholders + `)
+			UNION
+			SELECT c.id FROM categories c JOIN ` + name + ` s ON c.parent_id = s.id
+		)
+	`
+	cond = `
+		EXISTS (
+			SELECT 1 FROM post_categories pc
+			WHERE pc.post_id = p.id AND pc.category_id IN (SELECT id FROM ` + name + `)
+		)
+	`
+	return cte, cond
 }
 
-func GetFilteredPosts(db *sql.DB, query string, selectedCategories []string, liked bool, userID int) ([]models.Post, error) {
+func GetFilteredPosts(db *sql.DB, filter PostFilter) ([]models.Post, error) {
 	var posts []models.Post
 	var args []interface{}
 	conditions := []string{}
 
 	// Поиск по тексту
-	if query != "" {
+	if filter.Query != "" {
 		conditions = append(conditions, "(p.title LIKE ? OR p.content LIKE ?)")
-		likePattern := "%" + query + "%"
+		likePattern := "%" + filter.Query + "%"
 		args = append(args, likePattern, likePattern)
 	}
 
-	// Фильтрация по категориям
-	if len(selectedCategories) > 0 {
-		placeholders := strings.Repeat("?,", len(selectedCategories))
-		placeholders = placeholders[:len(placeholders)-1] // удалить последнюю запятую
+	// Фильтрация по категориям: выбранные вместе со всеми потомками.
+	// Параметры WITH идут в запросе раньше остальных.
+	var ctes []string
+	var cteArgs []interface{}
+	if len(filter.Categories) > 0 {
+		cte, cond := categoryScope("selected_categories", len(filter.Categories))
+		ctes = append(ctes, cte)
+		conditions = append(conditions, cond)
+		for _, catID := range filter.Categories {
+			cteArgs = append(cteArgs, catID)
+		}
+	}
+	// Категория страницы /c/<slug> сужает выборку независимо от выбранных
+	if filter.Within != 0 {
+		cte, cond := categoryScope("within_categories", 1)
+		ctes = append(ctes, cte)
+		conditions = append(conditions, cond)
+		cteArgs = append(cteArgs, filter.Within)
+	}
+	var with string
+	if len(ctes) > 0 {
+		with = "WITH RECURSIVE " + strings.Join(ctes, ", ")
+		args = append(cteArgs, args...)
+	}
+
+	// Фильтрация по тегам: у поста должен быть каждый из них
+	for _, tag := range filter.Tags {
 		conditions = append(conditions, `
 			EXISTS (
-				SELECT 1 FROM post_categories pc
-				WHERE pc.post_id = p.id AND pc.category_id IN (`+placeholders+`)
+				SELECT 1 FROM post_tags pt
+				JOIN tags t ON t.id = pt.tag_id
+				WHERE pt.post_id = p.id AND t.name = ?
 			)
 		`)
-		for _, catID := range selectedCategories {
-			args = append(args, catID)
-		}
+		args = append(args, tag)
 	}
 
 	// Фильтрация по лайкам
-	if liked {
+	if filter.Liked {
 		conditions = append(conditions, `
 			EXISTS (
-				SELECT 1 FROM post_likes pl
-				WHERE pl.post_id = p.id AND pl.user_id = ? AND pl.is_like = TRUE
+				SELECT 1 FROM reactions r
+				WHERE r.target_type = 'post' AND r.target_id = p.id AND r.user_id = ? AND r.kind = 'like'
 			)
 		`)
-		args = append(args, userID)
+		args = append(args, filter.UserID)
+	}
+
+	if filter.Saved {
+		saved := "SELECT 1 FROM bookmarks b WHERE b.user_id = ? AND b.target_type = 'post' AND b.target_id = p.id"
+		args = append(args, filter.UserID)
+		if filter.Folder != 0 {
+			saved += " AND b.folder_id = ?"
+			args = append(args, filter.Folder)
+		}
+		conditions = append(conditions, "EXISTS ("+saved+")")
 	}
 
-	queryStr := `
-		SELECT DISTINCT p.id, p.user_id, p.title, p.content, p.created_at, u.username
+	if filter.AuthorID != 0 {
+		conditions = append(conditions, "p.user_id = ?")
+		args = append(args, filter.AuthorID)
+	}
+
+	if filter.MentionedID != 0 {
+		conditions = append(conditions, "EXISTS (SELECT 1 FROM mentions m WHERE m.post_id = p.id AND m.user_id = ?)")
+		args = append(args, filter.MentionedID)
+	}
+
+	// Посты скрытых авторов не видны зрителю; в профиле автора — видны,
+	// раз его открыли намеренно
+	if filter.UserID != 0 && !filter.ShowMuted && filter.AuthorID == 0 {
+		conditions = append(conditions, "NOT "+fmt.Sprintf(mutedAuthor, "p.user_id"))
+		args = append(args, filter.UserID)
+	}
+
+	queryStr := with + `
+		SELECT DISTINCT p.id, p.user_id, p.title, p.content, p.created_at, u.username, u.reputation, u.reputation_at,
+			COALESCE(p.likes, 0), COALESCE(p.dislikes, 0), p.reaction_counts, p.comment_count, p.last_activity_at,
+			p.locked, p.pinned_at IS NOT NULL, COALESCE(p.pinned_category_id, 0), p.archived_at IS NOT NULL
 		FROM posts p
 		JOIN users u ON p.user_id = u.id
 	`
 	if len(conditions) > 0 {
 		queryStr += " WHERE " + strings.Join(conditions, " AND ")
 	}
-	queryStr += " ORDER BY p.created_at DESC"
+	// В ленте и категориях закреплённые посты идут первыми: закреплённые
+	// везде — всегда, закреплённые в категории — когда она выбрана
+	queryStr += " ORDER BY "
+	if !filter.Liked && !filter.Saved && filter.AuthorID == 0 && filter.MentionedID == 0 && filter.Query == "" {
+		pinned := "p.pinned_category_id IS NULL"
+		pinnedIn := filter.Categories
+		if filter.Within != 0 {
+			pinnedIn = append([]string{strconv.Itoa(filter.Within)}, pinnedIn...)
+		}
+		if len(pinnedIn) > 0 {
+			pinned = "(p.pinned_category_id IS NULL OR p.pinned_category_id IN (" + strings.TrimSuffix(strings.Repeat("?,", len(pinnedIn)), ",") + "))"
+			for _, catID := range pinnedIn {
+				args = append(args, catID)
+			}
+		}
+		queryStr += "CASE WHEN " + pinned + " THEN p.pinned_at END DESC, "
+	}
+	switch filter.Sort {
+	case SortTop:
+		score, scoreArgs := reactionScore()
+		queryStr += score + " DESC, p.created_at DESC"
+		args = append(args, scoreArgs...)
+	case SortActive:
+		queryStr += "COALESCE(p.last_activity_at, p.created_at) DESC"
+	default:
+		queryStr += "p.created_at DESC"
+	}
 
 	rows, err := db.Query(queryStr, args...)
 	if err != nil {
@@ -106,18 +341,31 @@ func GetFilteredPosts(db *sql.DB, query string, selectedCategories []string, lik
 
 	for rows.Next() {
 		var post models.Post
-		if err := rows.Scan(&post.ID, &post.UserID, &post.Title, &post.Content, &post.CreatedAt, &post.Author); err != nil {
+		var counts string
+		var activity, reputationAt sql.NullTime
+		var score float64
+		var pinnedIn int
+		if err := rows.Scan(&post.ID, &post.UserID, &post.Title, &post.Content, &post.CreatedAt, &post.Author, &score, &reputationAt,
+			&post.Likes, &post.Dislikes, &counts, &post.CommentCount, &activity,
+			&post.Locked, &post.Pinned, &pinnedIn, &post.Archived); err != nil {
+			log.Println("Ошибка чтения поста:", err)
 			continue
 		}
-
-		// Подсчёт лайков
-		post.Likes, post.Dislikes, _ = CountLikes(db, "post_likes", "post_id", post.ID)
+		post.AuthorReputation = authorReputation(score, reputationAt)
+		// Счётчики хранятся в самом посте: лента не обращается к таблице реакций
+		post.Reactions = reactionList(decodeCounts(counts))
+		post.LastActivity = post.CreatedAt
+		if activity.Valid {
+			post.LastActivity = activity.Time
+		}
 
 		// Категории поста
 		cats, err := loadCategoriesForPost(db, post.ID)
 		if err == nil {
 			post.Categories = cats
 		}
+		post.PinnedIn = categoryName(post.Categories, pinnedIn)
+		post.Tags, _ = loadTagsForPost(db, post.ID)
 
 		posts = append(posts, post)
 	}
@@ -125,41 +373,12 @@ func GetFilteredPosts(db *sql.DB, query string, selectedCategories []string, lik
 	return posts, nil
 }
 
-func loadCategoriesForPost(db *sql.DB, postID int) ([]models.Category, error) {
-	rows, err := db.Query(`
-		SELECT c.id, c.name
-		FROM categories c
-		JOIN post_categories pc ON c.id = pc.category_id
-		WHERE pc.post_id = ?
-	`, postID)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var cats []models.Category
-	for rows.Next() {
-		var c models.Category
-		if err := rows.Scan(&c.ID, &c.Name); err == nil {
-			cats = append(cats, c)
-		}
-	}
-	return cats, nil
-}
-
-func LoadAllCategories(db *sql.DB) []models.Category {
-	rows, err := db.Query("SELECT id, name FROM categories")
-	if err != nil {
-		return nil
-	}
-	defer rows.Close()
-
-	var categories []models.Category
-	for rows.Next() {
-		var c models.Category
-		if err := rows.Scan(&c.ID, &c.Name); err == nil {
-			categories = append(categories, c)
+// categoryName — название категории id среди категорий поста
+func categoryName(categories []models.Category, id int) string {
+	for _, c := range categories {
+		if c.ID == id {
+			return c.Name
 		}
 	}
-	return categories
+	return ""
 }
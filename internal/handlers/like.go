@@ -2,18 +2,33 @@ package handlers
 
 import (
 	"database/sql"
-	"fmt"
+	"encoding/json"
+	"forum/internal/live"
+	"forum/internal/reputation"
+	"log"
 	"net/http"
 	"strconv"
+	"time"
 )
 
 // Тип сущности для лайка: "post" или "comment"
 type LikeHandler struct {
-	DB  *sql.DB
-	Err *ErrorHandler
+	DB     *sql.DB
+	Err    *ErrorHandler
+	Notify *Notifier
+	Live   *live.Hub
 }
 
-// Обработчик для лайка/дизлайка поста или комментария
+// likeResponse — ответ Like в режиме JSON: новые счётчики и реакция пользователя
+type likeResponse struct {
+	liveReaction
+	Reaction string `json:"reaction"` // вид реакции или "" — реакция снята
+}
+
+// Обработчик реакции на пост или комментарий: у пользователя одна реакция,
+// повторное нажатие снимает её, другая — заменяет. Браузер без
+// JavaScript отправляет форму и получает редирект обратно на страницу;
+// script.js запрашивает JSON и обновляет счётчики на месте.
 func (h *LikeHandler) Like(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Redirect(w, r, "/", http.StatusSeeOther)
@@ -22,113 +37,196 @@ func (h *LikeHandler) Like(w http.ResponseWriter, r *http.Request) {
 
 	userID, _, ok := GetUserFromSession(h.DB, r)
 	if !ok {
-		h.Err.Render(w, http.StatusUnauthorized, "Только для авторизованных пользователей")
+		h.fail(w, r, http.StatusUnauthorized, "Только для авторизованных пользователей")
 		return
 	}
 
 	if err := r.ParseForm(); err != nil {
-		h.Err.Render(w, http.StatusBadRequest, "Ошибка формы")
+		h.fail(w, r, http.StatusBadRequest, "Ошибка формы")
 		return
 	}
 
 	typ := r.FormValue("type")      // "post" или "comment"
 	idStr := r.FormValue("id")      // post_id или comment_id
-	action := r.FormValue("action") // "like" или "dislike"
+	action := r.FormValue("action") // вид реакции: like, dislike, fire…
 	targetID, err := strconv.Atoi(idStr)
-	if err != nil || (action != "like" && action != "dislike") {
-		h.Err.Render(w, http.StatusBadRequest, "Некорректные параметры")
+	kind, known := findReaction(action)
+	if err != nil || !known {
+		h.fail(w, r, http.StatusBadRequest, "Некорректные параметры")
 		return
 	}
-
-	isLike := action == "like"
-
-	var table, column string
-
-	switch typ {
-	case "post":
-		table = "post_likes"
-		column = "post_id"
-	case "comment":
-		table = "comment_likes"
-		column = "comment_id"
-	default:
-		h.Err.Render(w, http.StatusBadRequest, "Неверный тип")
+	if typ != "post" && typ != "comment" {
+		h.fail(w, r, http.StatusBadRequest, "Неверный тип")
 		return
 	}
+	if targetArchived(h.DB, typ, targetID) {
+		h.fail(w, r, http.StatusForbidden, errThreadArchived.Error())
+		return
+	}
+
+	// Минусовать можно только с достаточной репутацией; снять свой минус — всегда
+	if isDownvote(action) && UserReaction(h.DB, typ, targetID, userID) != action {
+		if msg := privilegeError(h.DB, userID, privileges.Downvote, "Ставить такую реакцию"); msg != "" {
+			h.fail(w, r, http.StatusForbidden, msg)
+			return
+		}
+	}
 
 	tx, err := h.DB.Begin()
 	if err != nil {
-		h.Err.Render(w, http.StatusInternalServerError, "Ошибка транзакции")
+		h.fail(w, r, http.StatusInternalServerError, "Ошибка транзакции")
 		return
 	}
 
-	// Проверим, был ли лайк/дизлайк ранее
-	var currentValue bool
+	// Проверим, была ли реакция ранее
+	var current string
+	var currentAt sql.NullTime
 	err = tx.QueryRow(
-		fmt.Sprintf("SELECT is_like FROM %s WHERE %s = ? AND user_id = ?", table, column),
-		targetID, userID,
-	).Scan(&currentValue)
-
+		"SELECT kind, created_at FROM reactions WHERE target_type = ? AND target_id = ? AND user_id = ?",
+		typ, targetID, userID,
+	).Scan(&current, &currentAt)
+
+	// Уведомляем автора, только когда появилась одобрительная реакция, а не снята
+	notify := false
+	// Реакция пользователя после нажатия
+	reaction := action
 	if err == sql.ErrNoRows {
-		// Ещё не было лайка — добавим
+		notify = kind.Weight > 0
+		// Реакции ещё не было — добавим
 		_, err = tx.Exec(
-			fmt.Sprintf("INSERT INTO %s (%s, user_id, is_like) VALUES (?, ?, ?)", table, column),
-			targetID, userID, isLike,
+			"INSERT INTO reactions (target_type, target_id, user_id, kind) VALUES (?, ?, ?, ?)",
+			typ, targetID, userID, action,
 		)
 		if err != nil {
 			tx.Rollback()
-			h.Err.Render(w, http.StatusInternalServerError, "Ошибка при добавлении лайка")
+			h.fail(w, r, http.StatusInternalServerError, "Ошибка при добавлении реакции")
 			return
 		}
 	} else if err == nil {
-		if currentValue == isLike {
+		if current == action {
+			reaction = ""
 			// Повторное нажатие — удалим
 			_, err = tx.Exec(
-				fmt.Sprintf("DELETE FROM %s WHERE %s = ? AND user_id = ?", table, column),
-				targetID, userID,
+				"DELETE FROM reactions WHERE target_type = ? AND target_id = ? AND user_id = ?",
+				typ, targetID, userID,
 			)
 			if err != nil {
 				tx.Rollback()
-				h.Err.Render(w, http.StatusInternalServerError, "Ошибка при удалении лайка")
+				h.fail(w, r, http.StatusInternalServerError, "Ошибка при удалении реакции")
 				return
 			}
 		} else {
-			// Меняем статус
+			notify = kind.Weight > 0
+			// Меняем вид реакции
 			_, err = tx.Exec(
-				fmt.Sprintf("UPDATE %s SET is_like = ? WHERE %s = ? AND user_id = ?", table, column),
-				isLike, targetID, userID,
+				"UPDATE reactions SET kind = ?, created_at = CURRENT_TIMESTAMP WHERE target_type = ? AND target_id = ? AND user_id = ?",
+				action, typ, targetID, userID,
 			)
 			if err != nil {
 				tx.Rollback()
-				h.Err.Render(w, http.StatusInternalServerError, "Ошибка при обновлении лайка")
+				h.fail(w, r, http.StatusInternalServerError, "Ошибка при обновлении реакции")
 				return
 			}
 		}
 	} else {
 		tx.Rollback()
-		h.Err.Render(w, http.StatusInternalServerError, "Ошибка проверки состояния")
+		h.fail(w, r, http.StatusInternalServerError, "Ошибка проверки состояния")
 		return
 	}
 
+	// Счётчики меняются в той же транзакции, что и сама реакция
+	err = adjustReactionCounters(tx, typ, targetID, current, reaction)
+	if err == sql.ErrNoRows {
+		tx.Rollback()
+		h.fail(w, r, http.StatusNotFound, "Не найдено")
+		return
+	}
+	if err != nil {
+		tx.Rollback()
+		log.Println("Ошибка обновления счётчиков реакций:", err)
+		h.fail(w, r, http.StatusInternalServerError, "Ошибка при обновлении счётчиков")
+		return
+	}
+	// Репутация автора — тоже; реакции на свои посты её не меняют
+	authorID, err := reactionAuthor(tx, typ, targetID)
+	if err == nil && authorID != userID {
+		err = reputation.Apply(tx, reputationRules, reputation.Change{
+			AuthorID: authorID,
+			OldKind:  current,
+			OldAt:    currentAt.Time,
+			NewKind:  reaction,
+		}, time.Now())
+	}
+	if err != nil {
+		tx.Rollback()
+		log.Println("Ошибка обновления репутации:", err)
+		h.fail(w, r, http.StatusInternalServerError, "Ошибка при обновлении репутации")
+		return
+	}
+	counts, err := CountReactions(tx, typ, targetID)
+	if err != nil {
+		log.Println("Ошибка чтения счётчиков реакций:", err)
+	}
+
 	if err := tx.Commit(); err != nil {
-		h.Err.Render(w, http.StatusInternalServerError, "Ошибка при коммите")
+		h.fail(w, r, http.StatusInternalServerError, "Ошибка при коммите")
 		return
 	}
+	if notify {
+		h.Notify.Liked(typ, targetID, userID)
+	}
+
+	ev := newLiveReaction(typ, targetID, counts)
+	h.publishCounts(ev)
 
-	http.Redirect(w, r, r.Header.Get("Referer"), http.StatusSeeOther)
+	if wantsJSON(r) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(likeResponse{liveReaction: ev, Reaction: reaction})
+		return
+	}
+	http.Redirect(w, r, h.backURL(r, typ, targetID), http.StatusSeeOther)
 }
 
-// Получить количество лайков и дизлайков для сущности
-func CountLikes(db *sql.DB, table string, column string, targetID int) (likes, dislikes int, err error) {
-	likeQuery := fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE %s = ? AND is_like = 1", table, column)
-	dislikeQuery := fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE %s = ? AND is_like = 0", table, column)
+// fail сообщает об ошибке в том виде, который ждёт клиент
+func (h *LikeHandler) fail(w http.ResponseWriter, r *http.Request, status int, msg string) {
+	if wantsJSON(r) {
+		writeJSONError(w, status, msg)
+		return
+	}
+	h.Err.Render(w, r, status, msg)
+}
 
-	err = db.QueryRow(likeQuery, targetID).Scan(&likes)
-	if err != nil {
+// backURL — куда вернуть после отправки формы: на страницу, с которой она
+// отправлена, а без Referer — к самому посту. Комментарий остаётся в поле
+// зрения благодаря якорю.
+func (h *LikeHandler) backURL(r *http.Request, typ string, targetID int) string {
+	anchor := ""
+	postID := targetID
+	if typ == "comment" {
+		anchor = "#comment-" + strconv.Itoa(targetID)
+		postID = GetPostIDByCommentID(h.DB, targetID)
+	}
+	if back, ok := sameOriginReferer(r); ok {
+		return back + anchor
+	}
+	if postID == 0 {
+		return "/"
+	}
+	return "/post/" + strconv.Itoa(postID) + anchor
+}
+
+// publishCounts рассылает новые счётчики открытому обсуждению, а для
+// постов — ещё и ленте
+func (h *LikeHandler) publishCounts(ev liveReaction) {
+	if h.Live == nil {
+		return
+	}
+	if ev.Type == "post" {
+		h.Live.Publish(postTopic(ev.ID), "reaction", ev)
+		h.Live.Publish(feedTopic, "reaction", ev)
 		return
 	}
-	err = db.QueryRow(dislikeQuery, targetID).Scan(&dislikes)
-	return
+	h.Live.Publish(postTopic(GetPostIDByCommentID(h.DB, ev.ID)), "reaction", ev)
 }
 
 // Получить postID по commentID (реализуйте в зависимости от вашей схемы)
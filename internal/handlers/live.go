@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"database/sql"
+	"forum/internal/live"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Темы хаба: лента и обсуждение отдельного поста
+const feedTopic = "feed"
+
+func postTopic(postID int) string {
+	return "post:" + strconv.Itoa(postID)
+}
+
+// userTopic — личная тема пользователя: сообщения и отметки о прочтении
+func userTopic(userID int) string {
+	return "user:" + strconv.Itoa(userID)
+}
+
+// LiveHandler — потоки Server-Sent Events для ленты и постов
+type LiveHandler struct {
+	DB        *sql.DB
+	Hub       *live.Hub
+	Err       *ErrorHandler
+	Heartbeat time.Duration
+}
+
+func (h *LiveHandler) heartbeat() time.Duration {
+	if h.Heartbeat > 0 {
+		return h.Heartbeat
+	}
+	return 25 * time.Second
+}
+
+// Feed — GET /events/feed: новые посты и реакции на них
+func (h *LiveHandler) Feed(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.Err.Render(w, r, http.StatusMethodNotAllowed, "Метод не поддерживается")
+		return
+	}
+	h.Hub.Stream(w, r, h.heartbeat(), feedTopic)
+}
+
+// Post — GET /events/post/<id>: новые комментарии и реакции в обсуждении
+func (h *LiveHandler) Post(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.Err.Render(w, r, http.StatusMethodNotAllowed, "Метод не поддерживается")
+		return
+	}
+	postID, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/events/post/"))
+	if err != nil {
+		h.Err.NotFound(w, r)
+		return
+	}
+	var exists bool
+	h.DB.QueryRow(`SELECT EXISTS (SELECT 1 FROM posts WHERE id = ?)`, postID).Scan(&exists)
+	if !exists {
+		h.Err.NotFound(w, r)
+		return
+	}
+	h.Hub.Stream(w, r, h.heartbeat(), postTopic(postID))
+}
+
+// Messages — GET /events/messages: личные сообщения текущего пользователя
+func (h *LiveHandler) Messages(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.Err.Render(w, r, http.StatusMethodNotAllowed, "Метод не поддерживается")
+		return
+	}
+	userID, _, ok := GetUserFromSession(h.DB, r)
+	if !ok {
+		h.Err.Render(w, r, http.StatusUnauthorized, "Только для авторизованных пользователей")
+		return
+	}
+	h.Hub.Stream(w, r, h.heartbeat(), userTopic(userID))
+}
+
+// Содержимое событий. Текст комментария — уже санитизированный HTML.
+type liveComment struct {
+	ID           int    `json:"id"`
+	PostID       int    `json:"post_id"`
+	ParentID     int    `json:"parent_id,omitempty"`
+	ParentAuthor string `json:"parent_author,omitempty"`
+	Author       string `json:"author"`
+	Reputation   int    `json:"reputation"`
+	HTML         string `json:"html"`
+	CreatedAt    string `json:"created_at"`
+}
+
+type liveReaction struct {
+	Type     string `json:"type"` // post или comment
+	ID       int    `json:"id"`
+	Likes    int    `json:"likes"`
+	Dislikes int    `json:"dislikes"`
+	// Все виды реакций, включая нулевые
+	Counts map[string]int `json:"counts"`
+}
+
+func newLiveReaction(typ string, id int, counts map[string]int) liveReaction {
+	ev := liveReaction{Type: typ, ID: id, Likes: counts["like"], Dislikes: counts["dislike"], Counts: map[string]int{}}
+	for _, k := range reactionKinds {
+		ev.Counts[k.Kind] = counts[k.Kind]
+	}
+	return ev
+}
+
+type livePost struct {
+	ID         int            `json:"id"`
+	Title      string         `json:"title"`
+	Author     string         `json:"author"`
+	Reputation int            `json:"reputation"`
+	Content    string         `json:"content"`
+	CreatedAt  string         `json:"created_at"`
+	Categories []liveCategory `json:"categories"`
+}
+
+type liveCategory struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	Slug string `json:"slug"`
+}
+
+// Личное сообщение: текст обычный, экранирует script.js
+type liveMessage struct {
+	ID             int    `json:"id"`
+	ConversationID int    `json:"conversation_id"`
+	Author         string `json:"author"`
+	Content        string `json:"content"`
+	CreatedAt      string `json:"created_at"`
+}
+
+// Участник прочитал переписку до сообщения LastReadID включительно
+type liveRead struct {
+	ConversationID int    `json:"conversation_id"`
+	User           string `json:"user"`
+	LastReadID     int    `json:"last_read_id"`
+}
@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// LoginGuard считает неудачные попытки входа по аккаунту и по IP и после
+// порога блокирует вход с экспоненциально растущей задержкой.
+type LoginGuard struct {
+	DB        *sql.DB
+	Threshold int           // сколько ошибок допускается без блокировки
+	BaseDelay time.Duration // блокировка после первой ошибки сверх порога
+	MaxDelay  time.Duration // верхняя граница блокировки
+	Window    time.Duration // через сколько без ошибок счётчик обнуляется
+	Now       func() time.Time
+}
+
+// LockedKey — запись о заблокированном аккаунте или адресе для админки
+type LockedKey struct {
+	Key         string
+	Failures    int
+	LastFailure time.Time
+	LockedUntil time.Time
+}
+
+// LoginFailure — запись журнала неудачных входов
+type LoginFailure struct {
+	Email     string
+	IP        string
+	Reason    string
+	CreatedAt time.Time
+}
+
+func NewLoginGuard(db *sql.DB) *LoginGuard {
+	return &LoginGuard{
+		DB:        db,
+		Threshold: 5,
+		BaseDelay: time.Minute,
+		MaxDelay:  time.Hour,
+		Window:    24 * time.Hour,
+		Now:       time.Now,
+	}
+}
+
+func accountKey(email string) string { return "account:" + strings.ToLower(email) }
+func ipKey(ip string) string         { return "ip:" + ip }
+
+// Remaining возвращает, сколько ещё действует блокировка для email или IP
+func (g *LoginGuard) Remaining(email, ip string) (time.Duration, error) {
+	now := g.Now().UTC()
+	var longest time.Duration
+	for _, key := range []string{accountKey(email), ipKey(ip)} {
+		var until sql.NullTime
+		err := g.DB.QueryRow("SELECT locked_until FROM login_throttle WHERE key = ?", key).Scan(&until)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		if until.Valid && until.Time.After(now) && until.Time.Sub(now) > longest {
+			longest = until.Time.Sub(now)
+		}
+	}
+	return longest, nil
+}
+
+// Fail фиксирует неудачную попытку в журнале и в счётчиках
+func (g *LoginGuard) Fail(email, ip string, userID int, reason string) error {
+	var uid interface{}
+	if userID != 0 {
+		uid = userID
+	}
+	now := g.Now().UTC()
+	if _, err := g.DB.Exec(
+		"INSERT INTO login_failures (email, ip, user_id, reason, created_at) VALUES (?, ?, ?, ?, ?)",
+		email, ip, uid, reason, now,
+	); err != nil {
+		return err
+	}
+	if reason == "locked" {
+		// Попытки во время блокировки не продлевают её
+		return nil
+	}
+
+	for _, key := range []string{accountKey(email), ipKey(ip)} {
+		failures := 0
+		var last time.Time
+		err := g.DB.QueryRow("SELECT failures, last_failure_at FROM login_throttle WHERE key = ?", key).
+			Scan(&failures, &last)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		if err == nil && now.Sub(last) > g.Window {
+			failures = 0
+		}
+		failures++
+
+		var lockedUntil interface{}
+		if failures >= g.Threshold {
+			lockedUntil = now.Add(g.delay(failures))
+		}
+		_, err = g.DB.Exec(`
+			INSERT INTO login_throttle (key, failures, last_failure_at, locked_until) VALUES (?, ?, ?, ?)
+			ON CONFLICT(key) DO UPDATE SET failures = excluded.failures,
+				last_failure_at = excluded.last_failure_at, locked_until = excluded.locked_until`,
+			key, failures, now, lockedUntil,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Succeed сбрасывает счётчик аккаунта. Счётчик IP не сбрасываем, чтобы
+// вход в свой аккаунт не обнулял перебор чужих.
+func (g *LoginGuard) Succeed(email string) error {
+	_, err := g.DB.Exec("DELETE FROM login_throttle WHERE key = ?", accountKey(email))
+	return err
+}
+
+// Блокировка удваивается с каждой ошибкой сверх порога
+func (g *LoginGuard) delay(failures int) time.Duration {
+	d := g.BaseDelay
+	for i := g.Threshold; i < failures; i++ {
+		d *= 2
+		if d >= g.MaxDelay {
+			return g.MaxDelay
+		}
+	}
+	return d
+}
+
+// Locked возвращает действующие блокировки
+func (g *LoginGuard) Locked() ([]LockedKey, error) {
+	rows, err := g.DB.Query(`
+		SELECT key, failures, last_failure_at, locked_until
+		FROM login_throttle
+		WHERE locked_until > ?
+		ORDER BY locked_until DESC`, g.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var locked []LockedKey
+	for rows.Next() {
+		var l LockedKey
+		if err := rows.Scan(&l.Key, &l.Failures, &l.LastFailure, &l.LockedUntil); err != nil {
+			return nil, err
+		}
+		locked = append(locked, l)
+	}
+	return locked, rows.Err()
+}
+
+// RecentFailures возвращает последние записи журнала неудачных входов
+func (g *LoginGuard) RecentFailures(limit int) ([]LoginFailure, error) {
+	rows, err := g.DB.Query(`
+		SELECT email, ip, reason, created_at
+		FROM login_failures
+		ORDER BY id DESC
+		LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var failures []LoginFailure
+	for rows.Next() {
+		var f LoginFailure
+		if err := rows.Scan(&f.Email, &f.IP, &f.Reason, &f.CreatedAt); err != nil {
+			return nil, err
+		}
+		failures = append(failures, f)
+	}
+	return failures, rows.Err()
+}
+
+// Unlock снимает блокировку и обнуляет счётчик
+func (g *LoginGuard) Unlock(key string) error {
+	_, err := g.DB.Exec("DELETE FROM login_throttle WHERE key = ?", key)
+	return err
+}
+
+// IP клиента без порта
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func logGuardError(err error) {
+	if err != nil {
+		log.Println("Ошибка учёта попыток входа:", err)
+	}
+}
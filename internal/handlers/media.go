@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"strings"
+
+	"forum/internal/media"
+	"forum/internal/models"
+)
+
+// MediaHandler отдаёт файлы из хранилища блобов по адресу /media/<ключ>
+type MediaHandler struct {
+	Store media.BlobStore
+	Err   *ErrorHandler
+}
+
+func (h *MediaHandler) Serve(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		h.Err.Render(w, r, http.StatusMethodNotAllowed, "Метод не поддерживается")
+		return
+	}
+
+	key := strings.TrimPrefix(r.URL.Path, "/media/")
+	blob, modTime, err := h.Store.Open(key)
+	if errors.Is(err, media.ErrNotFound) {
+		h.Err.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Println("Ошибка чтения файла:", err)
+		h.Err.Render(w, r, http.StatusInternalServerError, "Ошибка чтения файла")
+		return
+	}
+	defer blob.Close()
+
+	// Содержимое по ключу никогда не меняется, поэтому кэшируем навсегда.
+	// Content-Type ServeContent определит по первым байтам файла.
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.Header().Set("ETag", `"`+key+`"`)
+	w.Header().Set("Content-Disposition", "inline")
+	http.ServeContent(w, r, "", modTime, blob)
+}
+
+// BodyLimiter ограничивает размер тела запроса, чтобы большие загрузки
+// отсекались до разбора формы (его выполняет уже CSRF-middleware).
+type BodyLimiter struct {
+	Limits  map[string]int64 // по точному пути маршрута
+	Default int64
+	Err     *ErrorHandler
+}
+
+func (l *BodyLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit, ok := l.Limits[r.URL.Path]
+		if !ok {
+			limit = l.Default
+		}
+		if limit > 0 {
+			if r.ContentLength > limit {
+				l.Err.Render(w, r, http.StatusRequestEntityTooLarge, "Слишком большой запрос")
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// processUploads читает и проверяет прикреплённые к форме изображения.
+// Ошибка пригодна для показа пользователю.
+func processUploads(files []*multipart.FileHeader, maxFiles int, lim media.Limits) ([]*media.Image, error) {
+	if len(files) > maxFiles {
+		return nil, fmt.Errorf("можно прикрепить не больше %d изображений", maxFiles)
+	}
+
+	var images []*media.Image
+	for _, fh := range files {
+		if fh.Size > lim.MaxBytes {
+			return nil, fmt.Errorf("%s: %w (до %d МБ)", fh.Filename, media.ErrTooLarge, lim.MaxBytes>>20)
+		}
+		f, err := fh.Open()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", fh.Filename, media.ErrCorrupt)
+		}
+		data, err := io.ReadAll(io.LimitReader(f, lim.MaxBytes+1))
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", fh.Filename, media.ErrCorrupt)
+		}
+
+		img, err := media.Process(data, lim)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", fh.Filename, err)
+		}
+		images = append(images, img)
+	}
+	return images, nil
+}
+
+// saveAttachments привязывает изображения к посту. Сами файлы кладёт
+// storeImages после коммита: ключ известен заранее, а откат транзакции
+// не должен оставлять в хранилище файлов, на которые никто не ссылается.
+func saveAttachments(tx *sql.Tx, postID int64, userID int, images []*media.Image) error {
+	for _, img := range images {
+		key, thumbKey := imageKeys(img)
+		_, err := tx.Exec(`
+			INSERT INTO attachments (post_id, user_id, blob_key, thumb_key, mime, width, height, size)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			postID, userID, key, thumbKey, img.MIME, img.Width, img.Height, len(img.Data))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// imageKeys — ключи изображения и его миниатюры в хранилище
+func imageKeys(img *media.Image) (key, thumbKey string) {
+	key = media.Key(img.Data)
+	thumbKey = key
+	if img.Thumb != nil {
+		thumbKey = media.Key(img.Thumb)
+	}
+	return key, thumbKey
+}
+
+// storeImages кладёт изображения и миниатюры в хранилище. Вызывается после
+// коммита транзакции, сохранившей ссылки на них; ошибку пишет в лог: пост
+// или черновик уже сохранён, без файла вложение просто не покажется.
+func storeImages(store media.BlobStore, images []*media.Image) {
+	for _, img := range images {
+		if _, err := store.Put(img.Data); err != nil {
+			log.Println("Ошибка сохранения изображения:", err)
+		}
+		if img.Thumb != nil {
+			if _, err := store.Put(img.Thumb); err != nil {
+				log.Println("Ошибка сохранения миниатюры:", err)
+			}
+		}
+	}
+}
+
+// GetAttachments возвращает изображения поста в порядке загрузки
+func GetAttachments(db *sql.DB, postID int) ([]models.Attachment, error) {
+	rows, err := db.Query(`
+		SELECT id, post_id, blob_key, thumb_key, mime, width, height, size
+		FROM attachments
+		WHERE post_id = ?
+		ORDER BY id
+	`, postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var attachments []models.Attachment
+	for rows.Next() {
+		var a models.Attachment
+		if err := rows.Scan(&a.ID, &a.PostID, &a.Key, &a.ThumbKey, &a.MIME, &a.Width, &a.Height, &a.Size); err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, a)
+	}
+	return attachments, rows.Err()
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"forum/internal/markdown"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Сколько разных пользователей можно упомянуть в одном тексте.
+// Остальные упоминания остаются текстом и не рассылают уведомлений.
+const maxMentions = 10
+
+// dbtx — общее у *sql.DB и *sql.Tx, чтобы рендерить текст и внутри транзакции
+type dbtx interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// renderContent рендерит Markdown и превращает упоминания существующих
+// пользователей в ссылки на профиль. Возвращает HTML и id упомянутых.
+func renderContent(q dbtx, content string) (string, []int) {
+	rendered := markdown.Render(content)
+	names := markdown.Mentions(rendered)
+	if len(names) == 0 {
+		return rendered, nil
+	}
+
+	var ids []int
+	profiles := map[string]string{} // имя в нижнем регистре → настоящее имя
+	for _, name := range names {
+		if len(ids) == maxMentions {
+			break
+		}
+		var id int
+		var username string
+		err := q.QueryRow(`SELECT id, username FROM users WHERE username = ? COLLATE NOCASE`, name).Scan(&id, &username)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			log.Println("Ошибка поиска упомянутого пользователя:", err)
+			continue
+		}
+		profiles[strings.ToLower(name)] = username
+		ids = append(ids, id)
+	}
+
+	rendered = markdown.LinkMentions(rendered, func(name string) (string, bool) {
+		username, ok := profiles[strings.ToLower(name)]
+		return profileURL(username), ok
+	})
+	return rendered, ids
+}
+
+func profileURL(username string) string {
+	return "/u/" + url.PathEscape(username)
+}
+
+// saveMentions записывает упоминания в посте или комментарии. Упоминание
+// самого себя и тех, кто заблокировал автора, не сохраняется.
+// Возвращает тех, кого упомянули впервые.
+func saveMentions(q dbtx, targetType string, targetID, postID, authorID int, userIDs []int, now time.Time) ([]int, error) {
+	var added []int
+	for _, userID := range userIDs {
+		if userID == authorID || blockedBy(q, userID, authorID) {
+			continue
+		}
+		res, err := q.Exec(`
+			INSERT OR IGNORE INTO mentions (target_type, target_id, post_id, user_id, author_id, created_at)
+			VALUES (?, ?, ?, ?, ?, ?)`, targetType, targetID, postID, userID, authorID, now)
+		if err != nil {
+			return nil, err
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			added = append(added, userID)
+		}
+	}
+	return added, nil
+}
@@ -0,0 +1,640 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"forum/internal/live"
+	"forum/internal/models"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	messagesPageSize  = 50
+	maxGroupTitle     = 100
+	messagePreviewLen = 80
+)
+
+var (
+	errNoRecipients     = errors.New("Укажите, кому написать")
+	errEmptyMessage     = errors.New("Сообщение не может быть пустым")
+	errConversationGone = errors.New("Переписка не найдена")
+	errMessageBlocked   = errors.New("Собеседник ограничил вам сообщения")
+)
+
+// Сообщения тех, кого зритель заблокировал, ему не показываются и не
+// считаются непрочитанными — в группе их видят остальные участники
+const blockedSender = `NOT EXISTS (SELECT 1 FROM user_blocks ub WHERE ub.user_id = ? AND ub.kind = 'block' AND ub.target_id = %s)`
+
+// MessageHandler — личные переписки: входящие, диалоги и небольшие группы
+type MessageHandler struct {
+	DB        *sql.DB
+	Templates *template.Template
+	Err       *ErrorHandler
+	Live      *live.Hub
+	// Символов в сообщении и участников группы вместе с создателем
+	MaxLength  int
+	MaxMembers int
+}
+
+// Inbox — GET /messages: переписки с непрочитанными и форма нового сообщения.
+// ?to=<имя> подставляет получателя, например со страницы профиля.
+func (h *MessageHandler) Inbox(w http.ResponseWriter, r *http.Request) {
+	userID, username, ok := GetUserFromSession(h.DB, r)
+	if !ok {
+		SetFlash(w, "flash", "Авторизуйтесь, чтобы читать сообщения")
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	h.renderInbox(w, r, userID, username, url.Values{"to": {r.URL.Query().Get("to")}}, "")
+}
+
+func (h *MessageHandler) renderInbox(w http.ResponseWriter, r *http.Request, userID int, username string, form url.Values, formError string) {
+	conversations, err := LoadConversations(h.DB, userID)
+	if err != nil {
+		log.Println("Ошибка загрузки переписок:", err)
+		h.Err.Render(w, r, http.StatusInternalServerError, "Ошибка базы данных")
+		return
+	}
+	h.Templates.ExecuteTemplate(w, "layout", pageData(r, map[string]interface{}{
+		"Page":          "messages",
+		"User":          username,
+		"Flash":         GetFlash(w, r, "flash"),
+		"Conversations": conversations,
+		"Form":          form,
+		"FormError":     formError,
+		"MaxMembers":    h.MaxMembers,
+		"MaxLength":     h.MaxLength,
+		"LiveEventID":   h.Live.LastID(),
+	}))
+}
+
+// New — POST /messages/new: начать переписку. Сообщение одному человеку
+// без названия продолжает уже существующий диалог с ним.
+func (h *MessageHandler) New(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/messages", http.StatusSeeOther)
+		return
+	}
+	userID, username, ok := GetUserFromSession(h.DB, r)
+	if !ok {
+		h.Err.Render(w, r, http.StatusUnauthorized, "Только для авторизованных пользователей")
+		return
+	}
+
+	title := strings.TrimSpace(r.FormValue("title"))
+	content := strings.TrimSpace(r.FormValue("content"))
+	recipients, err := h.resolveRecipients(userID, r.FormValue("to"))
+	if err == nil {
+		err = h.checkMessage(content)
+	}
+	if err == nil && utf8.RuneCountInString(title) > maxGroupTitle {
+		err = fmt.Errorf("Название слишком длинное (до %d символов)", maxGroupTitle)
+	}
+	if err != nil {
+		h.renderInbox(w, r, userID, username, r.Form, err.Error())
+		return
+	}
+
+	now := time.Now().UTC()
+	tx, err := h.DB.Begin()
+	if err != nil {
+		h.Err.Render(w, r, http.StatusInternalServerError, "Ошибка базы данных")
+		return
+	}
+	defer tx.Rollback()
+
+	group := len(recipients) > 1 || title != ""
+	var conversationID int
+	if !group {
+		conversationID = directConversation(tx, userID, recipients[0])
+	}
+	if conversationID == 0 {
+		res, err := tx.Exec(`
+			INSERT INTO conversations (title, is_group, created_by, created_at, last_message_at)
+			VALUES (?, ?, ?, ?, ?)`, title, group, userID, now, now)
+		if err != nil {
+			log.Println("Ошибка создания переписки:", err)
+			h.Err.Render(w, r, http.StatusInternalServerError, "Ошибка базы данных")
+			return
+		}
+		id, _ := res.LastInsertId()
+		conversationID = int(id)
+		for _, memberID := range append([]int{userID}, recipients...) {
+			if _, err := tx.Exec(`
+				INSERT INTO conversation_members (conversation_id, user_id, joined_at) VALUES (?, ?, ?)`,
+				conversationID, memberID, now); err != nil {
+				log.Println("Ошибка создания переписки:", err)
+				h.Err.Render(w, r, http.StatusInternalServerError, "Ошибка базы данных")
+				return
+			}
+		}
+	}
+	msg, err := addMessage(tx, conversationID, userID, content, now)
+	if err != nil {
+		log.Println("Ошибка отправки сообщения:", err)
+		h.Err.Render(w, r, http.StatusInternalServerError, "Ошибка базы данных")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		h.Err.Render(w, r, http.StatusInternalServerError, "Ошибка базы данных")
+		return
+	}
+	msg.Author = username
+	h.publishMessage(msg)
+	http.Redirect(w, r, conversationURL(conversationID), http.StatusSeeOther)
+}
+
+// resolveRecipients разбирает список имён через запятую или пробел.
+// Автор в списке пропускается; тех, кто его заблокировал, добавить нельзя.
+func (h *MessageHandler) resolveRecipients(userID int, raw string) ([]int, error) {
+	names := strings.FieldsFunc(raw, func(r rune) bool { return r == ',' || unicode.IsSpace(r) })
+	var ids []int
+	seen := map[int]bool{userID: true}
+	for _, name := range names {
+		name = strings.TrimPrefix(name, "@")
+		if name == "" {
+			continue
+		}
+		var id int
+		var username string
+		err := h.DB.QueryRow(`SELECT id, username FROM users WHERE username = ? COLLATE NOCASE`, name).Scan(&id, &username)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("Пользователь %s не найден", name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if seen[id] {
+			continue
+		}
+		if blockedBy(h.DB, id, userID) {
+			return nil, fmt.Errorf("%s ограничил вам сообщения", username)
+		}
+		seen[id] = true
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		return nil, errNoRecipients
+	}
+	if len(ids)+1 > h.MaxMembers {
+		return nil, fmt.Errorf("В переписке может быть не больше %d участников", h.MaxMembers)
+	}
+	return ids, nil
+}
+
+func (h *MessageHandler) checkMessage(content string) error {
+	if content == "" {
+		return errEmptyMessage
+	}
+	if utf8.RuneCountInString(content) > h.MaxLength {
+		return fmt.Errorf("Сообщение слишком длинное (до %d символов)", h.MaxLength)
+	}
+	return nil
+}
+
+// Conversation — GET /messages/<id>: сообщения переписки. Открытая
+// переписка считается прочитанной; ?before=<id> — более ранние сообщения.
+func (h *MessageHandler) Conversation(w http.ResponseWriter, r *http.Request) {
+	userID, username, ok := GetUserFromSession(h.DB, r)
+	if !ok {
+		SetFlash(w, "flash", "Авторизуйтесь, чтобы читать сообщения")
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	conversationID, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/messages/"))
+	if err != nil {
+		h.Err.NotFound(w, r)
+		return
+	}
+	conv, members, err := loadConversation(h.DB, conversationID, userID)
+	if errors.Is(err, errConversationGone) {
+		h.Err.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Println("Ошибка загрузки переписки:", err)
+		h.Err.Render(w, r, http.StatusInternalServerError, "Ошибка базы данных")
+		return
+	}
+
+	before, _ := strconv.Atoi(r.URL.Query().Get("before"))
+	messages, err := LoadMessages(h.DB, conversationID, userID, before, messagesPageSize)
+	if err != nil {
+		log.Println("Ошибка загрузки сообщений:", err)
+		h.Err.Render(w, r, http.StatusInternalServerError, "Ошибка базы данных")
+		return
+	}
+	if before == 0 {
+		h.markRead(conversationID, userID, username)
+	}
+	markReceipts(messages, members, userID)
+
+	var older string
+	if len(messages) == messagesPageSize {
+		older = conversationURL(conversationID) + "?before=" + strconv.Itoa(messages[0].ID)
+	}
+	h.Templates.ExecuteTemplate(w, "layout", pageData(r, map[string]interface{}{
+		"Page":         "conversation",
+		"User":         username,
+		"UserID":       userID,
+		"Flash":        GetFlash(w, r, "flash"),
+		"Conversation": conv,
+		"Messages":     messages,
+		"OlderURL":     older,
+		"BlockedError": sendBlocked(h.DB, conv, members, userID),
+		"MaxLength":    h.MaxLength,
+		"LiveEventID":  h.Live.LastID(),
+	}))
+}
+
+// Send — POST /messages/send: сообщение в переписку. Для fetch из
+// script.js отвечает JSON, иначе возвращает на страницу переписки.
+func (h *MessageHandler) Send(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/messages", http.StatusSeeOther)
+		return
+	}
+	userID, username, ok := GetUserFromSession(h.DB, r)
+	if !ok {
+		h.fail(w, r, http.StatusUnauthorized, "Только для авторизованных пользователей")
+		return
+	}
+	conversationID, _ := strconv.Atoi(r.FormValue("conversation_id"))
+	conv, members, err := loadConversation(h.DB, conversationID, userID)
+	if errors.Is(err, errConversationGone) {
+		h.fail(w, r, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		h.fail(w, r, http.StatusInternalServerError, "Ошибка базы данных")
+		return
+	}
+	if msg := sendBlocked(h.DB, conv, members, userID); msg != "" {
+		h.fail(w, r, http.StatusForbidden, msg)
+		return
+	}
+	content := strings.TrimSpace(r.FormValue("content"))
+	if err := h.checkMessage(content); err != nil {
+		h.fail(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		h.fail(w, r, http.StatusInternalServerError, "Ошибка базы данных")
+		return
+	}
+	defer tx.Rollback()
+	msg, err := addMessage(tx, conversationID, userID, content, time.Now().UTC())
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Println("Ошибка отправки сообщения:", err)
+		h.fail(w, r, http.StatusInternalServerError, "Ошибка базы данных")
+		return
+	}
+	msg.Author = username
+	h.publishMessage(msg)
+
+	if wantsJSON(r) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"id":%d}`, msg.ID)
+		return
+	}
+	http.Redirect(w, r, conversationURL(conversationID)+"#message-"+strconv.Itoa(msg.ID), http.StatusSeeOther)
+}
+
+// Read — POST /messages/read: script.js отмечает прочитанными сообщения,
+// пришедшие в открытую переписку
+func (h *MessageHandler) Read(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.fail(w, r, http.StatusMethodNotAllowed, "Метод не поддерживается")
+		return
+	}
+	userID, username, ok := GetUserFromSession(h.DB, r)
+	if !ok {
+		h.fail(w, r, http.StatusUnauthorized, "Только для авторизованных пользователей")
+		return
+	}
+	conversationID, _ := strconv.Atoi(r.FormValue("conversation_id"))
+	if _, _, err := loadConversation(h.DB, conversationID, userID); err != nil {
+		h.fail(w, r, http.StatusNotFound, errConversationGone.Error())
+		return
+	}
+	h.markRead(conversationID, userID, username)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Leave — POST /messages/leave: выйти из группы. Из диалога выйти нельзя.
+func (h *MessageHandler) Leave(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/messages", http.StatusSeeOther)
+		return
+	}
+	userID, _, ok := GetUserFromSession(h.DB, r)
+	if !ok {
+		h.Err.Render(w, r, http.StatusUnauthorized, "Только для авторизованных пользователей")
+		return
+	}
+	conversationID, _ := strconv.Atoi(r.FormValue("conversation_id"))
+	res, err := h.DB.Exec(`
+		DELETE FROM conversation_members
+		WHERE conversation_id = ? AND user_id = ?
+			AND (SELECT is_group FROM conversations WHERE id = ?)`,
+		conversationID, userID, conversationID)
+	if err != nil {
+		h.Err.Render(w, r, http.StatusInternalServerError, "Ошибка базы данных")
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		h.Err.NotFound(w, r)
+		return
+	}
+	SetFlash(w, "flash", "Вы вышли из переписки")
+	http.Redirect(w, r, "/messages", http.StatusSeeOther)
+}
+
+func (h *MessageHandler) fail(w http.ResponseWriter, r *http.Request, status int, msg string) {
+	if wantsJSON(r) {
+		writeJSONError(w, status, msg)
+		return
+	}
+	h.Err.Render(w, r, status, msg)
+}
+
+// markRead отмечает прочитанной всю переписку и сообщает об этом остальным
+// участникам для отметок о прочтении
+func (h *MessageHandler) markRead(conversationID, userID int, username string) {
+	res, err := h.DB.Exec(`
+		UPDATE conversation_members
+		SET last_read_id = (SELECT COALESCE(MAX(id), 0) FROM messages WHERE conversation_id = ?)
+		WHERE conversation_id = ? AND user_id = ?
+			AND last_read_id < (SELECT COALESCE(MAX(id), 0) FROM messages WHERE conversation_id = ?)`,
+		conversationID, conversationID, userID, conversationID)
+	if err != nil {
+		log.Println("Ошибка отметки о прочтении:", err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return
+	}
+	var lastRead int
+	h.DB.QueryRow(`SELECT last_read_id FROM conversation_members WHERE conversation_id = ? AND user_id = ?`,
+		conversationID, userID).Scan(&lastRead)
+	for _, memberID := range conversationMembers(h.DB, conversationID) {
+		if memberID != userID {
+			h.Live.Publish(userTopic(memberID), "read", liveRead{ConversationID: conversationID, User: username, LastReadID: lastRead})
+		}
+	}
+}
+
+// publishMessage доставляет сообщение участникам, кроме заблокировавших автора
+func (h *MessageHandler) publishMessage(msg models.Message) {
+	event := liveMessage{
+		ID:             msg.ID,
+		ConversationID: msg.ConversationID,
+		Author:         msg.Author,
+		Content:        msg.Content,
+		CreatedAt:      msg.CreatedAt.Format("02.01.2006 15:04"),
+	}
+	for _, memberID := range conversationMembers(h.DB, msg.ConversationID) {
+		if memberID == msg.UserID || !blockedBy(h.DB, memberID, msg.UserID) {
+			h.Live.Publish(userTopic(memberID), "message", event)
+		}
+	}
+}
+
+func conversationURL(id int) string {
+	return "/messages/" + strconv.Itoa(id)
+}
+
+// addMessage записывает сообщение; своё сообщение автор уже прочитал
+func addMessage(tx *sql.Tx, conversationID, userID int, content string, now time.Time) (models.Message, error) {
+	msg := models.Message{ConversationID: conversationID, UserID: userID, Content: content, CreatedAt: now}
+	res, err := tx.Exec(`INSERT INTO messages (conversation_id, user_id, content, created_at) VALUES (?, ?, ?, ?)`,
+		conversationID, userID, content, now)
+	if err != nil {
+		return msg, err
+	}
+	id, _ := res.LastInsertId()
+	msg.ID = int(id)
+	if _, err := tx.Exec(`UPDATE conversations SET last_message_at = ? WHERE id = ?`, now, conversationID); err != nil {
+		return msg, err
+	}
+	_, err = tx.Exec(`UPDATE conversation_members SET last_read_id = ? WHERE conversation_id = ? AND user_id = ?`,
+		msg.ID, conversationID, userID)
+	return msg, err
+}
+
+// directConversation ищет диалог двух пользователей, 0 — диалога нет
+func directConversation(q dbtx, userID, otherID int) int {
+	var id int
+	q.QueryRow(`
+		SELECT c.id FROM conversations c
+		JOIN conversation_members a ON a.conversation_id = c.id AND a.user_id = ?
+		JOIN conversation_members b ON b.conversation_id = c.id AND b.user_id = ?
+		WHERE NOT c.is_group
+		ORDER BY c.id LIMIT 1`, userID, otherID).Scan(&id)
+	return id
+}
+
+// conversationMembers — id участников переписки
+func conversationMembers(db *sql.DB, conversationID int) []int {
+	rows, err := db.Query(`SELECT user_id FROM conversation_members WHERE conversation_id = ?`, conversationID)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+	var ids []int
+	for rows.Next() {
+		var id int
+		if rows.Scan(&id) == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// member — участник переписки и докуда он прочитал
+type member struct {
+	ID       int
+	Name     string
+	LastRead int
+}
+
+// loadConversation возвращает переписку с участниками, если userID в ней состоит
+func loadConversation(db *sql.DB, conversationID, userID int) (models.Conversation, []member, error) {
+	conv := models.Conversation{ID: conversationID}
+	err := db.QueryRow(`
+		SELECT c.title, c.is_group, c.last_message_at FROM conversations c
+		JOIN conversation_members cm ON cm.conversation_id = c.id AND cm.user_id = ?
+		WHERE c.id = ?`, userID, conversationID).Scan(&conv.Title, &conv.Group, &conv.LastMessageAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return conv, nil, errConversationGone
+	}
+	if err != nil {
+		return conv, nil, err
+	}
+
+	rows, err := db.Query(`
+		SELECT cm.user_id, u.username, cm.last_read_id
+		FROM conversation_members cm JOIN users u ON u.id = cm.user_id
+		WHERE cm.conversation_id = ?
+		ORDER BY cm.joined_at, u.username`, conversationID)
+	if err != nil {
+		return conv, nil, err
+	}
+	defer rows.Close()
+	var members []member
+	for rows.Next() {
+		var m member
+		if err := rows.Scan(&m.ID, &m.Name, &m.LastRead); err != nil {
+			return conv, nil, err
+		}
+		members = append(members, m)
+		if m.ID != userID {
+			conv.Members = append(conv.Members, m.Name)
+		}
+	}
+	conv.Title = conversationTitle(conv)
+	return conv, members, rows.Err()
+}
+
+// conversationTitle — название группы или имена собеседников
+func conversationTitle(conv models.Conversation) string {
+	switch {
+	case conv.Title != "":
+		return conv.Title
+	case len(conv.Members) == 0:
+		return "Только вы"
+	}
+	return strings.Join(conv.Members, ", ")
+}
+
+// sendBlocked — почему userID не может писать в переписку, "" — может.
+// В диалог нельзя писать тому, кого собеседник заблокировал.
+func sendBlocked(db *sql.DB, conv models.Conversation, members []member, userID int) string {
+	if conv.Group {
+		return ""
+	}
+	for _, m := range members {
+		if m.ID != userID && blockedBy(db, m.ID, userID) {
+			return errMessageBlocked.Error()
+		}
+	}
+	return ""
+}
+
+// markReceipts заполняет у своих сообщений, кто их уже прочитал
+func markReceipts(messages []models.Message, members []member, userID int) {
+	for i := range messages {
+		if messages[i].UserID != userID {
+			continue
+		}
+		for _, m := range members {
+			if m.ID != userID && m.LastRead >= messages[i].ID {
+				messages[i].ReadBy = append(messages[i].ReadBy, m.Name)
+			}
+		}
+	}
+}
+
+// LoadConversations — переписки пользователя, свежие сверху
+func LoadConversations(db *sql.DB, userID int) ([]models.Conversation, error) {
+	rows, err := db.Query(`
+		SELECT c.id, c.title, c.is_group, c.last_message_at,
+			COALESCE((SELECT group_concat(u.username, char(31)) FROM conversation_members om
+				JOIN users u ON u.id = om.user_id
+				WHERE om.conversation_id = c.id AND om.user_id != cm.user_id), ''),
+			COALESCE(lm.content, ''), COALESCE(lu.username, ''),
+			(SELECT COUNT(*) FROM messages m
+				WHERE m.conversation_id = c.id AND m.id > cm.last_read_id AND m.user_id != cm.user_id
+					AND `+fmt.Sprintf(blockedSender, "m.user_id")+`)
+		FROM conversation_members cm
+		JOIN conversations c ON c.id = cm.conversation_id
+		LEFT JOIN messages lm ON lm.id = (
+			SELECT MAX(m.id) FROM messages m
+			WHERE m.conversation_id = c.id AND `+fmt.Sprintf(blockedSender, "m.user_id")+`)
+		LEFT JOIN users lu ON lu.id = lm.user_id
+		WHERE cm.user_id = ?
+		ORDER BY c.last_message_at DESC, c.id DESC`, userID, userID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var conversations []models.Conversation
+	for rows.Next() {
+		var c models.Conversation
+		var members string
+		if err := rows.Scan(&c.ID, &c.Title, &c.Group, &c.LastMessageAt, &members,
+			&c.LastMessage, &c.LastAuthor, &c.Unread); err != nil {
+			return nil, err
+		}
+		if members != "" {
+			c.Members = strings.Split(members, "\x1f")
+		}
+		c.Title = conversationTitle(c)
+		if utf8.RuneCountInString(c.LastMessage) > messagePreviewLen {
+			c.LastMessage = string([]rune(c.LastMessage)[:messagePreviewLen]) + "…"
+		}
+		conversations = append(conversations, c)
+	}
+	return conversations, rows.Err()
+}
+
+// LoadMessages — до limit сообщений переписки раньше before (0 — последние),
+// по порядку отправки. Сообщения заблокированных зрителем пропускаются.
+func LoadMessages(db *sql.DB, conversationID, viewerID, before, limit int) ([]models.Message, error) {
+	query := `
+		SELECT m.id, m.conversation_id, m.user_id, u.username, m.content, m.created_at
+		FROM messages m JOIN users u ON u.id = m.user_id
+		WHERE m.conversation_id = ? AND ` + fmt.Sprintf(blockedSender, "m.user_id")
+	args := []interface{}{conversationID, viewerID}
+	if before > 0 {
+		query += ` AND m.id < ?`
+		args = append(args, before)
+	}
+	query += ` ORDER BY m.id DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var messages []models.Message
+	for rows.Next() {
+		var m models.Message
+		if err := rows.Scan(&m.ID, &m.ConversationID, &m.UserID, &m.Author, &m.Content, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		messages = append(messages, m)
+	}
+	// Выбирали с конца — возвращаем по порядку
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	return messages, rows.Err()
+}
+
+// countUnreadMessages — непрочитанные сообщения во всех переписках пользователя
+func countUnreadMessages(db *sql.DB, userID int) int {
+	var count int
+	db.QueryRow(`
+		SELECT COUNT(*) FROM conversation_members cm
+		JOIN messages m ON m.conversation_id = cm.conversation_id AND m.id > cm.last_read_id
+		WHERE cm.user_id = ? AND m.user_id != cm.user_id AND `+fmt.Sprintf(blockedSender, "m.user_id"),
+		userID, userID).Scan(&count)
+	return count
+}
@@ -0,0 +1,281 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"forum/internal/models"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	maxModerationReason = 200
+	moderationLogLimit  = 200
+)
+
+// postActions — действия модераторов с обсуждениями и как они звучат в журнале
+var postActions = map[string]string{
+	"lock":      "закрыл обсуждение",
+	"unlock":    "открыл обсуждение",
+	"pin":       "закрепил пост",
+	"unpin":     "открепил пост",
+	"archive":   "отправил в архив",
+	"unarchive": "вернул из архива",
+}
+
+var (
+	errThreadLocked   = errors.New("Обсуждение закрыто модератором")
+	errThreadArchived = errors.New("Обсуждение в архиве")
+)
+
+// ModeratePost закрывает и открывает обсуждение, закрепляет пост везде или
+// в одной из его категорий, отправляет в архив и возвращает из него.
+// Каждое действие записывается в журнал модерации.
+func (h *AdminHandler) ModeratePost(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	moderatorID, _, ok := h.requireModerator(w, r)
+	if !ok {
+		return
+	}
+
+	postID, err := strconv.Atoi(r.FormValue("post_id"))
+	if err != nil {
+		h.Err.Render(w, r, http.StatusBadRequest, "Некорректные параметры")
+		return
+	}
+	action := r.FormValue("action")
+	if _, known := postActions[action]; !known {
+		h.Err.Render(w, r, http.StatusBadRequest, "Неизвестное действие")
+		return
+	}
+	reason := strings.TrimSpace(r.FormValue("reason"))
+	if utf8.RuneCountInString(reason) > maxModerationReason {
+		h.Err.Render(w, r, http.StatusBadRequest, "Причина слишком длинная (до 200 символов)")
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		h.Err.Render(w, r, http.StatusInternalServerError, "Ошибка базы данных")
+		return
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	var details string
+	var res sql.Result
+	switch action {
+	case "lock", "unlock":
+		res, err = tx.Exec(`UPDATE posts SET locked = ? WHERE id = ?`, action == "lock", postID)
+	case "pin":
+		// Закрепить можно везде или в одной из категорий самого поста
+		var categoryID sql.NullInt64
+		details = "везде"
+		if raw := r.FormValue("category"); raw != "" {
+			id, _ := strconv.Atoi(raw)
+			err := tx.QueryRow(`
+				SELECT c.id, c.name FROM post_categories pc JOIN categories c ON c.id = pc.category_id
+				WHERE pc.post_id = ? AND pc.category_id = ?`, postID, id).Scan(&categoryID, &details)
+			if err != nil {
+				h.Err.Render(w, r, http.StatusBadRequest, "Пост не относится к этой категории")
+				return
+			}
+			details = "в категории «" + details + "»"
+		}
+		res, err = tx.Exec(`UPDATE posts SET pinned_at = ?, pinned_category_id = ? WHERE id = ?`, now, categoryID, postID)
+	case "unpin":
+		res, err = tx.Exec(`UPDATE posts SET pinned_at = NULL, pinned_category_id = NULL WHERE id = ?`, postID)
+	case "archive":
+		res, err = tx.Exec(`UPDATE posts SET archived_at = ? WHERE id = ?`, now, postID)
+	case "unarchive":
+		res, err = tx.Exec(`UPDATE posts SET archived_at = NULL, unarchived_at = ? WHERE id = ?`, now, postID)
+	}
+	if err != nil {
+		log.Println("Ошибка модерации поста:", err)
+		h.Err.Render(w, r, http.StatusInternalServerError, "Ошибка базы данных")
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		h.Err.NotFound(w, r)
+		return
+	}
+	if err := logModeration(tx, moderatorID, action, "post", postID, details, reason, now); err != nil {
+		log.Println("Ошибка записи в журнал модерации:", err)
+		h.Err.Render(w, r, http.StatusInternalServerError, "Ошибка базы данных")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		h.Err.Render(w, r, http.StatusInternalServerError, "Ошибка базы данных")
+		return
+	}
+
+	SetFlash(w, "flash", "Готово: "+postActions[action])
+	http.Redirect(w, r, "/post/"+strconv.Itoa(postID), http.StatusSeeOther)
+}
+
+// ModerationLog — журнал модерации; ?post=<id> — действия с одним постом
+func (h *AdminHandler) ModerationLog(w http.ResponseWriter, r *http.Request) {
+	_, username, ok := h.requireModerator(w, r)
+	if !ok {
+		return
+	}
+	postID, _ := strconv.Atoi(r.URL.Query().Get("post"))
+	entries, err := LoadModerationLog(h.DB, postID, moderationLogLimit)
+	if err != nil {
+		log.Println("Ошибка загрузки журнала модерации:", err)
+		h.Err.Render(w, r, http.StatusInternalServerError, "Ошибка базы данных")
+		return
+	}
+	h.Templates.ExecuteTemplate(w, "layout", pageData(r, map[string]interface{}{
+		"Page":    "moderationlog",
+		"User":    username,
+		"Entries": entries,
+		"PostID":  postID,
+	}))
+}
+
+// logModeration записывает действие модератора в журнал
+func logModeration(tx *sql.Tx, moderatorID int, action, targetType string, targetID int, details, reason string, now time.Time) error {
+	_, err := tx.Exec(`
+		INSERT INTO moderation_log (moderator_id, action, target_type, target_id, details, reason, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		moderatorID, action, targetType, targetID, details, reason, now)
+	return err
+}
+
+// LoadModerationLog возвращает последние записи журнала, новые сверху.
+// postID ограничивает журнал одним постом, 0 — все записи.
+func LoadModerationLog(db *sql.DB, postID, limit int) ([]models.ModerationEntry, error) {
+	query := `
+		SELECT l.id, l.moderator_id, u.username, l.action, l.target_type, l.target_id,
+			COALESCE(p.title, ''), l.details, l.reason, l.created_at
+		FROM moderation_log l
+		JOIN users u ON u.id = l.moderator_id
+		LEFT JOIN posts p ON l.target_type = 'post' AND p.id = l.target_id`
+	args := []interface{}{}
+	if postID != 0 {
+		query += ` WHERE l.target_type = 'post' AND l.target_id = ?`
+		args = append(args, postID)
+	}
+	query += ` ORDER BY l.id DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []models.ModerationEntry
+	for rows.Next() {
+		var e models.ModerationEntry
+		if err := rows.Scan(&e.ID, &e.ModeratorID, &e.Moderator, &e.Action, &e.TargetType, &e.TargetID,
+			&e.TargetTitle, &e.Details, &e.Reason, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		e.Text = postActions[e.Action]
+		if e.Text == "" {
+			e.Text = spamActions[e.Action]
+		}
+		if e.Text == "" {
+			e.Text = e.Action
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// threadClosed сообщает, можно ли оставить комментарий к посту: в архиве
+// нельзя никому, в закрытом обсуждении — никому, кроме модераторов.
+func threadClosed(q dbtx, postID int, moderator bool) error {
+	var locked, archived bool
+	err := q.QueryRow(`SELECT locked, archived_at IS NOT NULL FROM posts WHERE id = ?`, postID).Scan(&locked, &archived)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil // несуществующий пост обработает вызывающий
+	case err != nil:
+		return err
+	case archived:
+		return errThreadArchived
+	case locked && !moderator:
+		return errThreadLocked
+	}
+	return nil
+}
+
+// targetArchived сообщает, что пост или комментарий — из архивного
+// обсуждения: реакции на них больше не принимаются
+func targetArchived(q dbtx, targetType string, targetID int) bool {
+	query := `SELECT archived_at IS NOT NULL FROM posts WHERE id = ?`
+	if targetType == "comment" {
+		query = `SELECT p.archived_at IS NOT NULL FROM comments c JOIN posts p ON p.id = c.post_id WHERE c.id = ?`
+	}
+	var archived bool
+	q.QueryRow(query, targetID).Scan(&archived)
+	return archived
+}
+
+// isModerator — модераторы и администраторы
+func isModerator(db *sql.DB, userID int) bool {
+	role := GetUserRole(db, userID)
+	return role == "moderator" || role == "admin"
+}
+
+// Archiver отправляет в архив посты без комментариев дольше After.
+// Отсчёт идёт от последней активности или возвращения из архива.
+type Archiver struct {
+	DB    *sql.DB
+	After time.Duration
+	Now   func() time.Time
+}
+
+func (a *Archiver) now() time.Time {
+	if a.Now != nil {
+		return a.Now()
+	}
+	return time.Now()
+}
+
+// Run архивирует неактивные посты каждые interval
+func (a *Archiver) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if archived, err := a.RunOnce(); err != nil {
+			log.Println("Ошибка архивирования:", err)
+		} else if archived > 0 {
+			log.Printf("Отправлено в архив постов: %d", archived)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce архивирует неактивные посты и возвращает их число.
+// Закреплённые посты не архивируются.
+func (a *Archiver) RunOnce() (int, error) {
+	now := a.now().UTC()
+	cutoff := now.Add(-a.After)
+	res, err := a.DB.Exec(`
+		UPDATE posts SET archived_at = ?
+		WHERE archived_at IS NULL AND pinned_at IS NULL
+			AND COALESCE(last_activity_at, created_at) < ?
+			AND (unarchived_at IS NULL OR unarchived_at < ?)`,
+		now, cutoff, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
@@ -0,0 +1,552 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"forum/internal/models"
+)
+
+// Notifier рассылает уведомления о событиях на форуме. Ошибки рассылки только
+// логируются: само действие (комментарий, лайк, пост) к этому моменту сохранено.
+// Методы безопасно вызывать на nil — тогда уведомления отключены.
+type Notifier struct {
+	DB  *sql.DB
+	Now func() time.Time
+}
+
+func (n *Notifier) now() time.Time {
+	if n.Now != nil {
+		return n.Now()
+	}
+	return time.Now()
+}
+
+// event — событие для одного получателя
+type event struct {
+	kind       string
+	targetType string
+	targetID   int
+	postID     int
+	actorID    int
+}
+
+// deliveries — получатели события. Каждый получает одно уведомление:
+// первое добавленное важнее (ответ на комментарий важнее «новый комментарий»).
+type deliveries map[int]event
+
+func (d deliveries) add(userID int, ev event) {
+	if userID == 0 || userID == ev.actorID {
+		return
+	}
+	if _, ok := d[userID]; !ok {
+		d[userID] = ev
+	}
+}
+
+// deliver записывает уведомления. Событие склеивается с непрочитанным
+// уведомлением того же вида о том же объекте, если такое есть.
+func (n *Notifier) deliver(d deliveries) error {
+	if len(d) == 0 {
+		return nil
+	}
+	tx, err := n.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := n.now().UTC()
+	for userID, ev := range d {
+		var id int64
+		err := tx.QueryRow(`
+			INSERT INTO notifications (user_id, kind, target_type, target_id, post_id, actor_id, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT (user_id, kind, target_type, target_id) WHERE NOT read DO UPDATE SET
+				events = events + 1,
+				post_id = excluded.post_id,
+				actor_id = excluded.actor_id,
+				updated_at = excluded.updated_at
+			RETURNING id`,
+			userID, ev.kind, ev.targetType, ev.targetID, ev.postID, ev.actorID, now, now).Scan(&id)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`INSERT OR IGNORE INTO notification_actors (notification_id, actor_id) VALUES (?, ?)`, id, ev.actorID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// queryIDs выполняет запрос, возвращающий пары (получатель, id объекта)
+func queryIDs(db *sql.DB, query string, args ...interface{}) ([][2]int, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var pairs [][2]int
+	for rows.Next() {
+		var p [2]int
+		if err := rows.Scan(&p[0], &p[1]); err != nil {
+			return nil, err
+		}
+		pairs = append(pairs, p)
+	}
+	return pairs, rows.Err()
+}
+
+// CommentAdded уведомляет упомянутых в комментарии commentID, автора
+// комментария parentID (если это ответ), автора поста и подписчиков поста.
+// Каждый получает одно уведомление — самое конкретное.
+func (n *Notifier) CommentAdded(postID, commentID, parentID, actorID int, mentioned []int) {
+	if n == nil {
+		return
+	}
+	d := deliveries{}
+	addMentions(d, "comment", commentID, postID, actorID, mentioned)
+	if parentID != 0 {
+		var parentAuthor int
+		n.DB.QueryRow(`SELECT user_id FROM comments WHERE id = ?`, parentID).Scan(&parentAuthor)
+		d.add(parentAuthor, event{models.NotifyReply, "comment", parentID, postID, actorID})
+	}
+
+	comment := event{models.NotifyComment, "post", postID, postID, actorID}
+	var postAuthor int
+	n.DB.QueryRow(`SELECT user_id FROM posts WHERE id = ?`, postID).Scan(&postAuthor)
+	d.add(postAuthor, comment)
+
+	followers, err := queryIDs(n.DB, `SELECT user_id, target_id FROM follows WHERE target_type = 'post' AND target_id = ?`, postID)
+	if err != nil {
+		log.Println("Ошибка выборки подписчиков поста:", err)
+	}
+	for _, f := range followers {
+		d.add(f[0], comment)
+	}
+
+	if err := n.deliver(d); err != nil {
+		log.Println("Ошибка записи уведомлений о комментарии:", err)
+	}
+}
+
+// addMentions добавляет уведомления упомянутым в посте или комментарии
+func addMentions(d deliveries, targetType string, targetID, postID, actorID int, mentioned []int) {
+	for _, userID := range mentioned {
+		d.add(userID, event{models.NotifyMention, targetType, targetID, postID, actorID})
+	}
+}
+
+// Liked уведомляет автора поста или комментария о лайке
+func (n *Notifier) Liked(targetType string, targetID, actorID int) {
+	if n == nil {
+		return
+	}
+	var author, postID int
+	var err error
+	switch targetType {
+	case "post":
+		err = n.DB.QueryRow(`SELECT user_id, id FROM posts WHERE id = ?`, targetID).Scan(&author, &postID)
+	case "comment":
+		err = n.DB.QueryRow(`SELECT user_id, post_id FROM comments WHERE id = ?`, targetID).Scan(&author, &postID)
+	default:
+		return
+	}
+	if err != nil {
+		return
+	}
+	d := deliveries{}
+	d.add(author, event{models.NotifyLike, targetType, targetID, postID, actorID})
+	if err := n.deliver(d); err != nil {
+		log.Println("Ошибка записи уведомления о лайке:", err)
+	}
+}
+
+// PostCreated уведомляет упомянутых в посте, подписчиков автора и подписчиков
+// категорий поста, включая родительские: подписка на «Футбол» покрывает
+// «Премьер-лигу».
+func (n *Notifier) PostCreated(postID, actorID int, mentioned []int) {
+	if n == nil {
+		return
+	}
+	d := deliveries{}
+	addMentions(d, "post", postID, postID, actorID, mentioned)
+
+	authorFollowers, err := queryIDs(n.DB, `SELECT user_id, target_id FROM follows WHERE target_type = 'user' AND target_id = ?`, actorID)
+	if err != nil {
+		log.Println("Ошибка выборки подписчиков автора:", err)
+	}
+	for _, f := range authorFollowers {
+		d.add(f[0], event{models.NotifyPost, "user", actorID, postID, actorID})
+	}
+
+	categoryFollowers, err := queryIDs(n.DB, `
+		WITH RECURSIVE ancestors(id) AS (
+			SELECT category_id FROM post_categories WHERE post_id = ?
+			UNION
+			SELECT c.parent_id FROM categories c JOIN ancestors a ON c.id = a.id WHERE c.parent_id IS NOT NULL
+		)
+		SELECT user_id, target_id FROM follows
+		WHERE target_type = 'category' AND target_id IN (SELECT id FROM ancestors)
+		ORDER BY target_id`, postID)
+	if err != nil {
+		log.Println("Ошибка выборки подписчиков категорий:", err)
+	}
+	for _, f := range categoryFollowers {
+		d.add(f[0], event{models.NotifyPost, "category", f[1], postID, actorID})
+	}
+
+	if err := n.deliver(d); err != nil {
+		log.Println("Ошибка записи уведомлений о посте:", err)
+	}
+}
+
+// LoadNotifications возвращает последние уведомления пользователя
+func LoadNotifications(db *sql.DB, userID, limit int) ([]models.Notification, error) {
+	rows, err := db.Query(`
+		SELECT n.id, n.kind, n.target_type, n.target_id, n.post_id, n.events, n.read, n.updated_at,
+			u.username,
+			(SELECT COUNT(*) FROM notification_actors a WHERE a.notification_id = n.id),
+			COALESCE(p.title, ''), COALESCE(p.user_id, 0),
+			COALESCE(c.name, '')
+		FROM notifications n
+		JOIN users u ON u.id = n.actor_id
+		LEFT JOIN posts p ON p.id = n.post_id
+		LEFT JOIN categories c ON n.target_type = 'category' AND c.id = n.target_id
+		WHERE n.user_id = ?
+		ORDER BY n.updated_at DESC, n.id DESC
+		LIMIT ?
+	`, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []models.Notification
+	for rows.Next() {
+		var (
+			nt                              models.Notification
+			targetType, actor, title, cat   string
+			targetID, postID, events, count int
+			postAuthor                      int
+		)
+		if err := rows.Scan(&nt.ID, &nt.Kind, &targetType, &targetID, &postID, &events, &nt.Read, &nt.UpdatedAt,
+			&actor, &count, &title, &postAuthor, &cat); err != nil {
+			return nil, err
+		}
+		nt.Text = notificationText(nt.Kind, targetType, events, count, actor, title, cat, postAuthor == userID)
+		nt.Link = "/post/" + strconv.Itoa(postID)
+		if targetType == "comment" {
+			nt.Link += "#comment-" + strconv.Itoa(targetID)
+		}
+		list = append(list, nt)
+	}
+	return list, rows.Err()
+}
+
+// notificationText собирает текст уведомления: actors — сколько разных людей
+// вызвали events событий, actor — последний из них.
+func notificationText(kind, targetType string, events, actors int, actor, title, category string, ownPost bool) string {
+	who, verb := actor, func(one, many string) string { return one }
+	if actors > 1 {
+		who = fmt.Sprintf("%s и ещё %d %s", actor, actors-1, plural(actors-1, "человек", "человека", "человек"))
+		verb = func(one, many string) string { return many }
+	}
+
+	switch kind {
+	case models.NotifyLike:
+		if targetType == "comment" {
+			return fmt.Sprintf("%s %s ваш комментарий к посту «%s»", who, verb("оценил", "оценили"), title)
+		}
+		return fmt.Sprintf("%s %s ваш пост «%s»", who, verb("оценил", "оценили"), title)
+	case models.NotifyComment:
+		object := "пост"
+		if ownPost {
+			object = "ваш пост"
+		}
+		return fmt.Sprintf("%s %s %s «%s»", who, verb("прокомментировал", "прокомментировали"), object, title)
+	case models.NotifyReply:
+		return fmt.Sprintf("%s %s на ваш комментарий к посту «%s»", who, verb("ответил", "ответили"), title)
+	case models.NotifyMention:
+		return fmt.Sprintf("%s %s вас в обсуждении «%s»", who, verb("упомянул", "упомянули"), title)
+	case models.NotifyPost:
+		if targetType == "category" {
+			if events == 1 {
+				return fmt.Sprintf("Новый пост в категории «%s»: «%s»", category, title)
+			}
+			return fmt.Sprintf("%d %s в категории «%s», последний — «%s»",
+				events, plural(events, "новый пост", "новых поста", "новых постов"), category, title)
+		}
+		if events == 1 {
+			return fmt.Sprintf("%s опубликовал пост «%s»", actor, title)
+		}
+		return fmt.Sprintf("%s опубликовал %d %s, последний — «%s»", actor, events, plural(events, "пост", "поста", "постов"), title)
+	}
+	return title
+}
+
+// plural выбирает форму слова для числа: 1 пост, 2 поста, 5 постов
+func plural(n int, one, few, many string) string {
+	n %= 100
+	if n >= 11 && n <= 14 {
+		return many
+	}
+	switch n % 10 {
+	case 1:
+		return one
+	case 2, 3, 4:
+		return few
+	}
+	return many
+}
+
+// MarkNotificationsRead отмечает прочитанным уведомление id или все (id = 0)
+func MarkNotificationsRead(db *sql.DB, userID, id int) error {
+	if id == 0 {
+		_, err := db.Exec(`UPDATE notifications SET read = TRUE WHERE user_id = ? AND NOT read`, userID)
+		return err
+	}
+	_, err := db.Exec(`UPDATE notifications SET read = TRUE WHERE user_id = ? AND id = ?`, userID, id)
+	return err
+}
+
+func countUnread(db *sql.DB, userID int) int {
+	var count int
+	db.QueryRow(`SELECT COUNT(*) FROM notifications WHERE user_id = ? AND NOT read`, userID).Scan(&count)
+	return count
+}
+
+type unreadContextKey struct{}
+
+// unreadCounter считает непрочитанные уведомления и сообщения при первом
+// обращении, так что запрос к базе делают только страницы, которые выводят счётчик.
+type unreadCounter struct {
+	once     sync.Once
+	db       *sql.DB
+	r        *http.Request
+	count    int
+	messages int
+}
+
+func (c *unreadCounter) load() {
+	c.once.Do(func() {
+		if userID, _, ok := GetUserFromSession(c.db, c.r); ok {
+			c.count = countUnread(c.db, userID)
+			c.messages = countUnreadMessages(c.db, userID)
+		}
+	})
+}
+
+// Middleware делает счётчик непрочитанных доступным шаблонам через pageData
+func (n *Notifier) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		counter := &unreadCounter{db: n.DB, r: r}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), unreadContextKey{}, counter)))
+	})
+}
+
+// UnreadNotifications возвращает число непрочитанных уведомлений текущего пользователя
+func UnreadNotifications(r *http.Request) int {
+	c, ok := r.Context().Value(unreadContextKey{}).(*unreadCounter)
+	if !ok {
+		return 0
+	}
+	c.load()
+	return c.count
+}
+
+// UnreadMessages возвращает число непрочитанных личных сообщений текущего пользователя
+func UnreadMessages(r *http.Request) int {
+	c, ok := r.Context().Value(unreadContextKey{}).(*unreadCounter)
+	if !ok {
+		return 0
+	}
+	c.load()
+	return c.messages
+}
+
+// followTargets — на что можно подписаться и где это хранится
+var followTargets = map[string]string{
+	"post":     "posts",
+	"category": "categories",
+	"user":     "users",
+}
+
+// SetFollow подписывает пользователя на объект или отписывает от него
+func SetFollow(db *sql.DB, userID int, targetType string, targetID int, follow bool) error {
+	if !follow {
+		_, err := db.Exec(`DELETE FROM follows WHERE user_id = ? AND target_type = ? AND target_id = ?`, userID, targetType, targetID)
+		return err
+	}
+	_, err := db.Exec(`INSERT OR IGNORE INTO follows (user_id, target_type, target_id) VALUES (?, ?, ?)`, userID, targetType, targetID)
+	return err
+}
+
+// IsFollowing сообщает, подписан ли пользователь на объект
+func IsFollowing(db *sql.DB, userID int, targetType string, targetID int) bool {
+	var exists bool
+	db.QueryRow(`SELECT EXISTS (SELECT 1 FROM follows WHERE user_id = ? AND target_type = ? AND target_id = ?)`,
+		userID, targetType, targetID).Scan(&exists)
+	return exists
+}
+
+// LoadFollows возвращает подписки пользователя для страницы уведомлений
+func LoadFollows(db *sql.DB, userID int) ([]models.Follow, error) {
+	rows, err := db.Query(`
+		SELECT f.target_type, f.target_id, COALESCE(p.title, c.name, u.username, ''), COALESCE(c.slug, '')
+		FROM follows f
+		LEFT JOIN posts p ON f.target_type = 'post' AND p.id = f.target_id
+		LEFT JOIN categories c ON f.target_type = 'category' AND c.id = f.target_id
+		LEFT JOIN users u ON f.target_type = 'user' AND u.id = f.target_id
+		WHERE f.user_id = ?
+		ORDER BY f.created_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var follows []models.Follow
+	for rows.Next() {
+		var f models.Follow
+		var slug string
+		if err := rows.Scan(&f.TargetType, &f.TargetID, &f.Name, &slug); err != nil {
+			return nil, err
+		}
+		switch f.TargetType {
+		case "post":
+			f.Link = "/post/" + strconv.Itoa(f.TargetID)
+		case "category":
+			f.Link = "/c/" + slug
+		case "user":
+			f.Link = profileURL(f.Name)
+		}
+		follows = append(follows, f)
+	}
+	return follows, rows.Err()
+}
+
+type NotificationHandler struct {
+	DB        *sql.DB
+	Templates *template.Template
+	Err       *ErrorHandler
+	// Ключ подписи ссылок отписки от дайджеста
+	Secret []byte
+}
+
+// List — страница уведомлений и подписок
+func (h *NotificationHandler) List(w http.ResponseWriter, r *http.Request) {
+	userID, username, ok := GetUserFromSession(h.DB, r)
+	if !ok {
+		SetFlash(w, "flash", "Авторизуйтесь, чтобы видеть уведомления")
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	notifications, err := LoadNotifications(h.DB, userID, 50)
+	if err != nil {
+		log.Println("Ошибка загрузки уведомлений:", err)
+		h.Err.Render(w, r, http.StatusInternalServerError, "Ошибка базы данных")
+		return
+	}
+	follows, err := LoadFollows(h.DB, userID)
+	if err != nil {
+		log.Println("Ошибка загрузки подписок:", err)
+	}
+	var digestMode string
+	if err := h.DB.QueryRow(`SELECT digest FROM users WHERE id = ?`, userID).Scan(&digestMode); err != nil {
+		log.Println("Ошибка загрузки настроек дайджеста:", err)
+	}
+
+	h.Templates.ExecuteTemplate(w, "layout", pageData(r, map[string]interface{}{
+		"Page":          "notifications",
+		"User":          username,
+		"Flash":         GetFlash(w, r, "flash"),
+		"Notifications": notifications,
+		"Follows":       follows,
+		"Digest":        digestMode,
+	}))
+}
+
+// MarkRead отмечает прочитанным одно уведомление (id) или все
+func (h *NotificationHandler) MarkRead(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/notifications", http.StatusSeeOther)
+		return
+	}
+	userID, _, ok := GetUserFromSession(h.DB, r)
+	if !ok {
+		h.Err.Render(w, r, http.StatusUnauthorized, "Только для авторизованных пользователей")
+		return
+	}
+
+	id, _ := strconv.Atoi(r.FormValue("id"))
+	if err := MarkNotificationsRead(h.DB, userID, id); err != nil {
+		h.Err.Render(w, r, http.StatusInternalServerError, "Ошибка базы данных")
+		return
+	}
+	http.Redirect(w, r, "/notifications", http.StatusSeeOther)
+}
+
+// Follow подписывает на пост, категорию или пользователя (action=unfollow — отписка)
+func (h *NotificationHandler) Follow(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	userID, _, ok := GetUserFromSession(h.DB, r)
+	if !ok {
+		h.Err.Render(w, r, http.StatusUnauthorized, "Только для авторизованных пользователей")
+		return
+	}
+
+	targetType := r.FormValue("type")
+	targetID, err := strconv.Atoi(r.FormValue("id"))
+	table, known := followTargets[targetType]
+	if err != nil || !known || (targetType == "user" && targetID == userID) {
+		h.Err.Render(w, r, http.StatusBadRequest, "Некорректные параметры")
+		return
+	}
+	var exists bool
+	h.DB.QueryRow(fmt.Sprintf("SELECT EXISTS (SELECT 1 FROM %s WHERE id = ?)", table), targetID).Scan(&exists)
+	if !exists {
+		h.Err.NotFound(w, r)
+		return
+	}
+
+	if err := SetFollow(h.DB, userID, targetType, targetID, r.FormValue("action") != "unfollow"); err != nil {
+		h.Err.Render(w, r, http.StatusInternalServerError, "Ошибка базы данных")
+		return
+	}
+
+	http.Redirect(w, r, h.backURL(r, targetType, targetID), http.StatusSeeOther)
+}
+
+// backURL — куда вернуться после подписки: на страницу, откуда пришёл
+// запрос, а если Referer чужой или его нет — на страницу самого объекта
+func (h *NotificationHandler) backURL(r *http.Request, targetType string, targetID int) string {
+	if back, ok := sameOriginReferer(r); ok {
+		return back
+	}
+	var name string
+	switch targetType {
+	case "post":
+		return "/post/" + strconv.Itoa(targetID)
+	case "category":
+		if h.DB.QueryRow(`SELECT slug FROM categories WHERE id = ?`, targetID).Scan(&name) == nil && name != "" {
+			return "/c/" + name
+		}
+	case "user":
+		if h.DB.QueryRow(`SELECT username FROM users WHERE id = ?`, targetID).Scan(&name) == nil {
+			return profileURL(name)
+		}
+	}
+	return "/"
+}
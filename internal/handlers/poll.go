@@ -0,0 +1,360 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"forum/internal/models"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+const (
+	maxPollOptions      = 10
+	maxPollOptionLength = 100
+	// Формат поля datetime-local
+	pollTimeLayout = "2006-01-02T15:04"
+)
+
+var errAlreadyVoted = errors.New("вы уже проголосовали в этом опросе")
+
+type PollHandler struct {
+	DB  *sql.DB
+	Err *ErrorHandler
+	Now func() time.Time
+}
+
+func (h *PollHandler) now() time.Time {
+	if h.Now != nil {
+		return h.Now()
+	}
+	return time.Now()
+}
+
+// pollInput — опрос из формы создания поста
+type pollInput struct {
+	Question string
+	Options  []string
+	Multiple bool
+	ClosesAt *time.Time
+	Results  string
+}
+
+// pollForm — поля опроса как их прислала форма; в таком виде опрос
+// хранится и в черновике. TZOffset — пояс, в котором набрано ClosesAt,
+// см. formZone: с ним черновик опубликуется с тем же временем закрытия.
+type pollForm struct {
+	Question string `json:"question,omitempty"`
+	Options  string `json:"options,omitempty"`
+	Multiple string `json:"multiple,omitempty"`
+	ClosesAt string `json:"closes_at,omitempty"`
+	Results  string `json:"results,omitempty"`
+	TZOffset string `json:"tz_offset,omitempty"`
+}
+
+func pollFormFromValues(form url.Values) pollForm {
+	return pollForm{
+		Question: form.Get("poll_question"),
+		Options:  form.Get("poll_options"),
+		Multiple: form.Get("poll_multiple"),
+		ClosesAt: form.Get("poll_closes_at"),
+		Results:  form.Get("poll_results"),
+		TZOffset: form.Get("tz_offset"),
+	}
+}
+
+// parsePollForm проверяет поля опроса. Пустой вопрос означает пост без опроса.
+func parsePollForm(f pollForm, now time.Time) (*pollInput, string) {
+	question := strings.TrimSpace(f.Question)
+	if question == "" {
+		return nil, ""
+	}
+	if tooLong(question, maxTitleLength) {
+		return nil, "Вопрос опроса слишком длинный (до 200 символов)"
+	}
+
+	in := &pollInput{
+		Question: question,
+		Multiple: f.Multiple != "",
+		Results:  f.Results,
+	}
+	seen := map[string]bool{}
+	for _, line := range strings.Split(f.Options, "\n") {
+		option := strings.TrimSpace(line)
+		if option == "" {
+			continue
+		}
+		if tooLong(option, maxPollOptionLength) {
+			return nil, "Вариант ответа слишком длинный (до 100 символов)"
+		}
+		if seen[strings.ToLower(option)] {
+			return nil, "Варианты ответа не должны повторяться"
+		}
+		seen[strings.ToLower(option)] = true
+		in.Options = append(in.Options, option)
+	}
+	if len(in.Options) < 2 || len(in.Options) > maxPollOptions {
+		return nil, "В опросе должно быть от 2 до 10 вариантов ответа"
+	}
+
+	switch in.Results {
+	case models.PollResultsAlways, models.PollResultsVoted, models.PollResultsClosed:
+	case "":
+		in.Results = models.PollResultsAlways
+	default:
+		return nil, "Неизвестный режим показа итогов"
+	}
+
+	if raw := f.ClosesAt; raw != "" {
+		closesAt, err := time.ParseInLocation(pollTimeLayout, raw, formZone(f.TZOffset))
+		if err != nil {
+			return nil, "Некорректное время закрытия опроса"
+		}
+		if !closesAt.After(now) {
+			return nil, "Время закрытия опроса должно быть в будущем"
+		}
+		closesAt = closesAt.UTC()
+		in.ClosesAt = &closesAt
+	} else if in.Results == models.PollResultsClosed {
+		return nil, "Чтобы скрыть итоги до закрытия, укажите время закрытия"
+	}
+	return in, ""
+}
+
+// createPoll сохраняет опрос вместе с постом
+func createPoll(tx *sql.Tx, postID int64, in *pollInput) error {
+	res, err := tx.Exec(`INSERT INTO polls (post_id, question, multiple, closes_at, results) VALUES (?, ?, ?, ?, ?)`,
+		postID, in.Question, in.Multiple, in.ClosesAt, in.Results)
+	if err != nil {
+		return err
+	}
+	pollID, _ := res.LastInsertId()
+	for i, option := range in.Options {
+		if _, err := tx.Exec(`INSERT INTO poll_options (poll_id, position, text) VALUES (?, ?, ?)`, pollID, i, option); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetPoll возвращает опрос поста (nil, если его нет) с итогами,
+// видимыми пользователю userID (0 — гость).
+func GetPoll(db *sql.DB, postID, userID int, now time.Time) (*models.Poll, error) {
+	var poll models.Poll
+	var closesAt sql.NullTime
+	err := db.QueryRow(`SELECT id, post_id, question, multiple, closes_at, results FROM polls WHERE post_id = ?`, postID).
+		Scan(&poll.ID, &poll.PostID, &poll.Question, &poll.Multiple, &closesAt, &poll.Results)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if closesAt.Valid {
+		poll.ClosesAt = &closesAt.Time
+		poll.Closed = !now.Before(closesAt.Time)
+	}
+
+	if err := db.QueryRow(`SELECT COUNT(*) FROM poll_ballots WHERE poll_id = ?`, poll.ID).Scan(&poll.Voters); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`
+		SELECT o.id, o.text, COUNT(v.user_id), MAX(v.user_id = ?)
+		FROM poll_options o
+		LEFT JOIN poll_votes v ON v.option_id = o.id
+		WHERE o.poll_id = ?
+		GROUP BY o.id
+		ORDER BY o.position
+	`, userID, poll.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var o models.PollOption
+		var chosen sql.NullBool
+		if err := rows.Scan(&o.ID, &o.Text, &o.Votes, &chosen); err != nil {
+			return nil, err
+		}
+		o.Chosen = chosen.Bool
+		poll.Voted = poll.Voted || o.Chosen
+		poll.Options = append(poll.Options, o)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range poll.Options {
+		if poll.Voters > 0 {
+			poll.Options[i].Percent = poll.Options[i].Votes * 100 / poll.Voters
+		}
+	}
+
+	switch poll.Results {
+	case models.PollResultsVoted:
+		poll.ShowResults = poll.Voted || poll.Closed
+	case models.PollResultsClosed:
+		poll.ShowResults = poll.Closed
+	default:
+		poll.ShowResults = true
+	}
+	return &poll, nil
+}
+
+// Vote принимает голос из формы опроса на странице поста
+func (h *PollHandler) Vote(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	userID, _, ok := GetUserFromSession(h.DB, r)
+	if !ok {
+		SetFlash(w, "flash", "Авторизуйтесь, чтобы голосовать")
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	pollID, err := strconv.Atoi(r.FormValue("poll_id"))
+	if err != nil {
+		h.Err.Render(w, r, http.StatusBadRequest, "Некорректный опрос")
+		return
+	}
+	var postID int
+	var multiple bool
+	var closesAt sql.NullTime
+	err = h.DB.QueryRow(`SELECT post_id, multiple, closes_at FROM polls WHERE id = ?`, pollID).Scan(&postID, &multiple, &closesAt)
+	if err == sql.ErrNoRows {
+		h.Err.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		h.Err.Render(w, r, http.StatusInternalServerError, "Ошибка базы данных")
+		return
+	}
+	back := "/post/" + strconv.Itoa(postID)
+
+	if closesAt.Valid && !h.now().Before(closesAt.Time) {
+		SetFlash(w, "flash", "Опрос уже закрыт")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+
+	// Один и тот же вариант, присланный дважды, считается одним голосом
+	var optionIDs []int
+	seen := make(map[int]bool)
+	for _, raw := range r.Form["option"] {
+		id, err := strconv.Atoi(raw)
+		if err != nil {
+			h.Err.Render(w, r, http.StatusBadRequest, "Некорректный вариант ответа")
+			return
+		}
+		if !seen[id] {
+			seen[id] = true
+			optionIDs = append(optionIDs, id)
+		}
+	}
+	if len(optionIDs) == 0 || (!multiple && len(optionIDs) > 1) {
+		SetFlash(w, "flash", "Выберите вариант ответа")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+
+	err = h.castVote(pollID, userID, optionIDs)
+	switch {
+	case errors.Is(err, errAlreadyVoted):
+		SetFlash(w, "flash", "Вы уже проголосовали в этом опросе")
+	case errors.Is(err, sql.ErrNoRows):
+		h.Err.Render(w, r, http.StatusBadRequest, "Некорректный вариант ответа")
+		return
+	case err != nil:
+		log.Println("Ошибка голосования:", err)
+		h.Err.Render(w, r, http.StatusInternalServerError, "Ошибка базы данных")
+		return
+	}
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
+
+// castVote записывает бюллетень. Повторный голос отсекает первичный ключ
+// poll_ballots, так что два одновременных запроса не пройдут оба.
+func (h *PollHandler) castVote(pollID, userID int, optionIDs []int) error {
+	tx, err := h.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`INSERT INTO poll_ballots (poll_id, user_id, created_at) VALUES (?, ?, ?)`,
+		pollID, userID, h.now().UTC())
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.Code == sqlite3.ErrConstraint {
+		return errAlreadyVoted
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, optionID := range optionIDs {
+		// Вариант должен принадлежать этому опросу
+		res, err := tx.Exec(`
+			INSERT OR IGNORE INTO poll_votes (poll_id, user_id, option_id)
+			SELECT ?, ?, id FROM poll_options WHERE id = ? AND poll_id = ?`,
+			pollID, userID, optionID, pollID)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return sql.ErrNoRows
+		}
+	}
+	return tx.Commit()
+}
+
+// Results отдаёт итоги опроса в JSON для обновления полос без перезагрузки
+func (h *PollHandler) Results(w http.ResponseWriter, r *http.Request) {
+	postID, err := strconv.Atoi(r.URL.Query().Get("post"))
+	if err != nil {
+		h.Err.NotFound(w, r)
+		return
+	}
+	userID, _, _ := GetUserFromSession(h.DB, r)
+	poll, err := GetPoll(h.DB, postID, userID, h.now())
+	if err != nil {
+		h.Err.Render(w, r, http.StatusInternalServerError, "Ошибка базы данных")
+		return
+	}
+	if poll == nil {
+		h.Err.NotFound(w, r)
+		return
+	}
+	if !poll.ShowResults {
+		h.Err.Render(w, r, http.StatusForbidden, "Итоги опроса пока скрыты")
+		return
+	}
+
+	type option struct {
+		ID      int `json:"id"`
+		Votes   int `json:"votes"`
+		Percent int `json:"percent"`
+	}
+	resp := struct {
+		Voters  int      `json:"voters"`
+		Closed  bool     `json:"closed"`
+		Options []option `json:"options"`
+	}{Voters: poll.Voters, Closed: poll.Closed}
+	for _, o := range poll.Options {
+		resp.Options = append(resp.Options, option{o.ID, o.Votes, o.Percent})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -5,23 +5,40 @@ import (
 	"fmt"
 	"html/template"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
+	"forum/internal/live"
+	"forum/internal/media"
 	"forum/internal/models"
+	"forum/internal/spam"
 	"log"
 )
 
 const (
 	maxTitleLength   = 200
 	maxContentLength = 10000
+	// Ограничения поста считаются в символах, а не в байтах
+	maxPostLength = 5000
+	// Загрузки крупнее хранятся во временных файлах, а не в памяти
+	maxUploadMemory = 8 << 20
 )
 
 type PostHandler struct {
 	DB        *sql.DB
 	Templates *template.Template
 	Err       *ErrorHandler
+	// Хранилище вложений; без него загрузка изображений отключена
+	Store    media.BlobStore
+	Limits   media.Limits
+	MaxFiles int
+	Notify   *Notifier
+	Live     *live.Hub
+	// Фильтры спама; сработавший задерживает пост до проверки
+	Spam spam.Chain
 }
 
 func (h *PostHandler) ListPosts(w http.ResponseWriter, r *http.Request) {
@@ -29,7 +46,8 @@ func (h *PostHandler) ListPosts(w http.ResponseWriter, r *http.Request) {
 	categoryIDs := r.URL.Query()["category"]
 
 	query := `
-                SELECT DISTINCT p.id, p.title, p.content, p.created_at, u.username
+                SELECT DISTINCT p.id, p.title, p.content, p.created_at, u.username,
+                        COALESCE(p.likes, 0), COALESCE(p.dislikes, 0), p.reaction_counts, p.comment_count
                 FROM posts p
                 JOIN users u ON p.user_id = u.id
                 LEFT JOIN post_categories pc ON p.id = pc.post_id
@@ -54,7 +72,7 @@ func (h *PostHandler) ListPosts(w http.ResponseWriter, r *http.Request) {
 
 	rows, err := h.DB.Query(query, args...)
 	if err != nil {
-		h.Err.Render(w, http.StatusInternalServerError, "Ошибка базы данных")
+		h.Err.Render(w, r, http.StatusInternalServerError, "Ошибка базы данных")
 		return
 	}
 	defer rows.Close()
@@ -62,7 +80,10 @@ func (h *PostHandler) ListPosts(w http.ResponseWriter, r *http.Request) {
 	var posts []models.Post
 	for rows.Next() {
 		var post models.Post
-		if err := rows.Scan(&post.ID, &post.Title, &post.Content, &post.CreatedAt, &post.Author); err == nil {
+		var counts string
+		if err := rows.Scan(&post.ID, &post.Title, &post.Content, &post.CreatedAt, &post.Author,
+			&post.Likes, &post.Dislikes, &counts, &post.CommentCount); err == nil {
+			post.Reactions = reactionList(decodeCounts(counts))
 			// Загрузка категорий для поста
 			catRows, err := h.DB.Query(`
 				SELECT c.id, c.name
@@ -79,9 +100,6 @@ func (h *PostHandler) ListPosts(w http.ResponseWriter, r *http.Request) {
 				catRows.Close()
 			}
 
-			// Загрузка лайков/дизлайков (если используешь)
-			post.Likes, post.Dislikes, _ = CountLikes(h.DB, "post_likes", "post_id", post.ID)
-
 			posts = append(posts, post)
 		}
 	}
@@ -100,14 +118,14 @@ func (h *PostHandler) ListPosts(w http.ResponseWriter, r *http.Request) {
 
 	_, username, _ := GetUserFromSession(h.DB, r)
 
-	h.Templates.ExecuteTemplate(w, "layout", map[string]interface{}{
+	h.Templates.ExecuteTemplate(w, "layout", pageData(r, map[string]interface{}{
 		"Posts":      posts,
 		"Categories": categories,
 		"Selected":   categoryIDs,
 		"Page":       "index",
 		"User":       username,
 		"Query":      search,
-	})
+	}))
 }
 
 // Получение одного поста по id
@@ -120,55 +138,108 @@ func (h *PostHandler) GetPost(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var post models.Post
-	var author string
+	var author, cached, counts string
+	var score float64
+	var reputationAt sql.NullTime
+	var pinnedIn int
 	err = h.DB.QueryRow(`
-		SELECT p.id, p.user_id, p.title, p.content, p.created_at, u.username
+		SELECT p.id, p.user_id, p.title, p.content, p.content_html, p.created_at, u.username, u.reputation, u.reputation_at,
+			COALESCE(p.likes, 0), COALESCE(p.dislikes, 0), p.reaction_counts, p.comment_count,
+			p.locked, p.pinned_at IS NOT NULL, COALESCE(p.pinned_category_id, 0), p.archived_at IS NOT NULL
 		FROM posts p
 		JOIN users u ON p.user_id = u.id
 		WHERE p.id = ?
-	`, id).Scan(&post.ID, &post.UserID, &post.Title, &post.Content, &post.CreatedAt, &author)
+	`, id).Scan(&post.ID, &post.UserID, &post.Title, &post.Content, &cached, &post.CreatedAt, &author, &score, &reputationAt,
+		&post.Likes, &post.Dislikes, &counts, &post.CommentCount,
+		&post.Locked, &post.Pinned, &pinnedIn, &post.Archived)
 	if err != nil {
 		h.Err.NotFound(w, r)
 		return
 	}
+	post.AuthorReputation = authorReputation(score, reputationAt)
+	post.ContentHTML = contentHTML(h.DB, "posts", post.ID, post.Content, cached)
 
 	post.Author = author
 
-	likes, dislikes, err := CountLikes(h.DB, "post_likes", "post_id", post.ID)
+	post.Reactions = reactionList(decodeCounts(counts))
+
+	// Получение категорий поста
+	post.Categories, err = loadCategoriesForPost(h.DB, post.ID)
 	if err != nil {
-		log.Println("Ошибка подсчёта лайков:", err)
+		log.Println("Ошибка загрузки категорий:", err)
 	}
-	post.Likes = likes
-	post.Dislikes = dislikes
+	post.PinnedIn = categoryName(post.Categories, pinnedIn)
 
-	// Получение категорий поста
-	catRows, err := h.DB.Query(`
-		SELECT c.id, c.name
-		FROM categories c
-		JOIN post_categories pc ON c.id = pc.category_id
-		WHERE pc.post_id = ?
-	`, post.ID)
-	if err == nil {
-		defer catRows.Close()
-		for catRows.Next() {
-			var cat models.Category
-			catRows.Scan(&cat.ID, &cat.Name)
-			post.Categories = append(post.Categories, cat)
-		}
+	post.Tags, err = loadTagsForPost(h.DB, post.ID)
+	if err != nil {
+		log.Println("Ошибка загрузки тегов:", err)
 	}
 
-	comments, _ := GetCommentsByPostID(h.DB, post.ID)
-	_, username, _ := GetUserFromSession(h.DB, r)
+	post.Attachments, err = GetAttachments(h.DB, post.ID)
+	if err != nil {
+		log.Println("Ошибка загрузки вложений:", err)
+	}
+
+	userID, username, _ := GetUserFromSession(h.DB, r)
+	poll, err := GetPoll(h.DB, post.ID, userID, time.Now())
+	if err != nil {
+		log.Println("Ошибка загрузки опроса:", err)
+	}
+
+	// Комментарии заглушённых скрыты, пока зритель не попросит ?muted=show
+	showMuted := r.URL.Query().Get("muted") == "show"
+	viewerID := userID
+	if showMuted {
+		viewerID = 0
+	}
+	comments, _ := GetCommentsByPostID(h.DB, post.ID, viewerID)
+	hiddenComments := 0
+	if viewerID != 0 {
+		hiddenComments = max(post.CommentCount-len(comments), 0)
+	}
+	var folders []models.BookmarkFolder
+	if userID != 0 {
+		post.Reaction = UserReaction(h.DB, "post", post.ID, userID)
+		mine := commentReactions(h.DB, post.ID, userID)
+		for i := range comments {
+			comments[i].Reaction = mine[comments[i].ID]
+		}
+		if post.Bookmark, err = GetBookmark(h.DB, userID, "post", post.ID); err != nil {
+			log.Println("Ошибка загрузки закладок:", err)
+		}
+		markBookmarkedComments(h.DB, userID, comments)
+		folders, _ = LoadBookmarkFolders(h.DB, userID)
+	}
 	flash := GetFlash(w, r, "flash")
+	if flash == "" && r.URL.Query().Get("held") == "1" {
+		flash = heldCommentMessage
+	}
+	followingPost := userID != 0 && IsFollowing(h.DB, userID, "post", post.ID)
+	followingAuthor := userID != 0 && IsFollowing(h.DB, userID, "user", post.UserID)
+	moderator := userID != 0 && isModerator(h.DB, userID)
 	log.Printf(">>> POST #%d: 👍 %d 👎 %d", post.ID, post.Likes, post.Dislikes)
-	h.Templates.ExecuteTemplate(w, "layout", map[string]interface{}{
-		"Post":     post,
-		"Comments": comments,
-		"Author":   author,
-		"Page":     "post",
-		"Flash":    flash,
-		"User":     username,
-	})
+	h.Templates.ExecuteTemplate(w, "layout", pageData(r, map[string]interface{}{
+		"Post":            post,
+		"Poll":            poll,
+		"Comments":        comments,
+		"Author":          author,
+		"Page":            "post",
+		"Flash":           flash,
+		"User":            username,
+		"UserID":          userID,
+		"FollowingPost":   followingPost,
+		"FollowingAuthor": followingAuthor,
+		"LiveEventID":     h.Live.LastID(),
+		"Folders":         folders,
+		"Moderator":       moderator,
+		// Форма комментария и «Ответить»: в архиве — никому, в закрытом обсуждении — только модераторам
+		"CommentsClosed": post.Archived || (post.Locked && !moderator),
+		"ReplyBlocked":   userID != 0 && !moderator && blockedBy(h.DB, post.UserID, userID),
+		"HiddenComments": hiddenComments,
+		"ShowMuted":      showMuted && userID != 0 && hasBlocks(h.DB, userID),
+		"MutedURL":       mutedURL(r, !showMuted),
+		"Muted":          liveMuted(h.DB, userID, showMuted),
+	}))
 }
 
 func (h *PostHandler) CreatePost(w http.ResponseWriter, r *http.Request) {
@@ -179,90 +250,354 @@ func (h *PostHandler) CreatePost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Получение списка категорий
-	getCategories := func() []models.Category {
-		rows, err := h.DB.Query("SELECT id, name FROM categories")
+	if r.Method == http.MethodGet {
+		// /create?draft=<id> — продолжить черновик
+		var in postInput
+		var draft *models.Draft
+		if raw := r.URL.Query().Get("draft"); raw != "" {
+			id, _ := strconv.Atoi(raw)
+			d, err := GetDraft(h.DB, userID, id)
+			if err != nil {
+				h.Err.NotFound(w, r)
+				return
+			}
+			draft, in = d, draftInput(*d)
+		}
+		h.renderCreate(w, r, userID, username, in, draft, map[string]string{})
+		return
+	}
+
+	if err := r.ParseMultipartForm(maxUploadMemory); err != nil && err != http.ErrNotMultipart {
+		h.Err.Render(w, r, http.StatusBadRequest, "Ошибка формы")
+		return
+	}
+
+	in := postInputFromForm(r.Form)
+	var draft *models.Draft
+	if raw := r.FormValue("draft_id"); raw != "" {
+		id, _ := strconv.Atoi(raw)
+		d, err := GetDraft(h.DB, userID, id)
 		if err != nil {
-			h.Err.Render(w, http.StatusInternalServerError, "Ошибка базы данных")
-			return nil
+			h.Err.NotFound(w, r)
+			return
+		}
+		draft = d
+	}
+
+	// action: пусто — опубликовать сразу, draft — сохранить черновик,
+	// schedule — опубликовать в publish_at
+	action := r.FormValue("action")
+	now := time.Now()
+	var fieldErrors map[string]string
+	var tags []string
+	var poll *pollInput
+	var publishAt *time.Time
+	switch action {
+	case "draft":
+		fieldErrors = in.checkDraft()
+	case "schedule":
+		at, msg := parsePublishAt(in.PublishAt, formZone(in.TZOffset), now)
+		if msg != "" {
+			fieldErrors = in.checkDraft()
+			fieldErrors["PublishAt"] = msg
+			break
 		}
-		defer rows.Close()
-		var categories []models.Category
-		for rows.Next() {
-			var cat models.Category
-			rows.Scan(&cat.ID, &cat.Name)
-			categories = append(categories, cat)
+		publishAt = &at
+		// Опрос должен быть открыт на момент публикации
+		fieldErrors, tags, poll = in.check(h.DB, userID, at)
+	default:
+		fieldErrors, tags, poll = in.check(h.DB, userID, now)
+	}
+	var images []*media.Image
+	if r.MultipartForm != nil && len(r.MultipartForm.File["images"]) > 0 {
+		var err error
+		stored := 0
+		if draft != nil {
+			stored = draft.Images
+		}
+		if h.Store == nil {
+			fieldErrors["Images"] = "Загрузка изображений отключена"
+		} else if images, err = processUploads(r.MultipartForm.File["images"], h.MaxFiles-stored, h.Limits); err != nil {
+			fieldErrors["Images"] = err.Error()
 		}
-		return categories
 	}
 
-	if r.Method == http.MethodGet {
-		h.Templates.ExecuteTemplate(w, "layout", map[string]interface{}{
-			"Page":               "create",
-			"Categories":         getCategories(),
-			"User":               username,
-			"Errors":             map[string]string{},
-			"FormValues":         map[string]string{},
-			"SelectedCategories": []string{},
-		})
+	if len(fieldErrors) > 0 {
+		h.renderCreate(w, r, userID, username, in, draft, fieldErrors)
 		return
 	}
 
-	if err := r.ParseForm(); err != nil {
-		h.Err.Render(w, http.StatusBadRequest, "Ошибка формы")
+	draftID := 0
+	if draft != nil {
+		draftID = draft.ID
+	}
+	if action == "draft" || action == "schedule" {
+		if _, err := saveDraft(h.DB, h.Store, userID, draftID, in, publishAt, images); err != nil {
+			h.draftError(w, r, err)
+			return
+		}
+		if publishAt != nil {
+			SetFlash(w, "flash", "Пост будет опубликован "+publishAt.Local().Format("02.01.2006 в 15:04"))
+		} else {
+			SetFlash(w, "flash", "Черновик сохранён")
+		}
+		http.Redirect(w, r, "/drafts", http.StatusSeeOther)
 		return
 	}
 
-	title := r.FormValue("title")
-	content := r.FormValue("content")
-	catIDs := r.Form["categories"]
+	// Задержанный пост ждёт проверки в черновиках автора
+	if flag := checkSpam(h.DB, h.Spam, userID, "post", in.Title, in.Content, now); flag != nil {
+		id, err := saveDraft(h.DB, h.Store, userID, draftID, in, nil, images)
+		if err == nil {
+			err = holdContent(h.DB, models.HeldContent{TargetType: "post", UserID: userID, DraftID: id}, flag, now.UTC())
+		}
+		if err != nil {
+			h.draftError(w, r, err)
+			return
+		}
+		SetFlash(w, "flash", heldPostMessage)
+		http.Redirect(w, r, "/drafts", http.StatusSeeOther)
+		return
+	}
+
+	postID, err := h.createPost(userID, username, in, tags, poll, images, draftID)
+	if err != nil {
+		h.draftError(w, r, err)
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("/post/%d", postID), http.StatusSeeOther)
+}
+
+// postInput — поля формы поста. Из них же состоит черновик: запланированный
+// пост проверяется ещё раз, когда приходит время публикации.
+type postInput struct {
+	Title      string
+	Content    string
+	Categories []string
+	Tags       string
+	Poll       pollForm
+	PublishAt  string // datetime-local, только для формы
+	TZOffset   string // часовой пояс PublishAt, см. formZone
+}
+
+func postInputFromForm(form url.Values) postInput {
+	return postInput{
+		Title:      form.Get("title"),
+		Content:    form.Get("content"),
+		Categories: form["categories"],
+		Tags:       form.Get("tags"),
+		Poll:       pollFormFromValues(form),
+		PublishAt:  form.Get("publish_at"),
+		TZOffset:   form.Get("tz_offset"),
+	}
+}
+
+// empty — в форме ещё ничего не написано
+func (in postInput) empty() bool {
+	return strings.TrimSpace(in.Title) == "" && strings.TrimSpace(in.Content) == ""
+}
+
+// tooLong сравнивает длину в символах: кириллица занимает по два байта
+func tooLong(s string, limit int) bool {
+	return utf8.RuneCountInString(s) > limit
+}
+
+// checkDraft — черновику хватает ограничений длины
+func (in postInput) checkDraft() map[string]string {
+	errors := make(map[string]string)
+	if tooLong(in.Title, maxTitleLength) {
+		errors["Title"] = "Название обязательно (до 200 символов)"
+	}
+	if tooLong(in.Content, maxPostLength) {
+		errors["Content"] = "Описание обязательно (до 5000 символов)"
+	}
+	return errors
+}
 
+// check проверяет пост перед публикацией в момент now
+func (in postInput) check(db *sql.DB, userID int, now time.Time) (map[string]string, []string, *pollInput) {
 	errors := make(map[string]string)
-	if title == "" || len(title) > 200 {
+	if in.Title == "" || tooLong(in.Title, maxTitleLength) {
 		errors["Title"] = "Название обязательно (до 200 символов)"
 	}
-	if content == "" || len(content) > 5000 {
+	if in.Content == "" || tooLong(in.Content, maxPostLength) {
 		errors["Content"] = "Описание обязательно (до 5000 символов)"
 	}
-	if len(catIDs) == 0 {
+	if len(in.Categories) == 0 {
 		errors["Categories"] = "Выберите хотя бы одну категорию"
 	}
+	tags, tagsErr := parseTags(db, in.Tags)
+	if tagsErr != "" {
+		errors["Tags"] = tagsErr
+	}
+	poll, pollErr := parsePollForm(in.Poll, now)
+	if pollErr != "" {
+		errors["Poll"] = pollErr
+	} else if poll != nil {
+		if msg := canCreatePoll(db, userID); msg != "" {
+			errors["Poll"] = msg
+		}
+	}
+	return errors, tags, poll
+}
 
-	if len(errors) > 0 {
-		h.Templates.ExecuteTemplate(w, "layout", map[string]interface{}{
-			"Page":       "create",
-			"User":       username,
-			"Categories": getCategories(),
-			"Errors":     errors,
-			"FormValues": map[string]string{
-				"Title":   title,
-				"Content": content,
-			},
-			"SelectedCategories": catIDs,
-		})
-		return
+// formValues — значения полей для повторного показа формы
+func (in postInput) formValues() map[string]string {
+	return map[string]string{
+		"Title":        in.Title,
+		"Content":      in.Content,
+		"Tags":         in.Tags,
+		"PollQuestion": in.Poll.Question,
+		"PollOptions":  in.Poll.Options,
+		"PollMultiple": in.Poll.Multiple,
+		"PollClosesAt": in.Poll.ClosesAt,
+		"PollResults":  in.Poll.Results,
+		"PublishAt":    in.PublishAt,
+		"TZOffset":     in.TZOffset,
+	}
+}
+
+// renderCreate показывает форму поста: пустую, из черновика или с ошибками
+func (h *PostHandler) renderCreate(w http.ResponseWriter, r *http.Request, userID int, username string, in postInput, draft *models.Draft, errors map[string]string) {
+	selected := in.Categories
+	if selected == nil {
+		selected = []string{}
 	}
+	h.Templates.ExecuteTemplate(w, "layout", pageData(r, map[string]interface{}{
+		"Page":               "create",
+		"User":               username,
+		"Categories":         LoadAllCategories(h.DB),
+		"Errors":             errors,
+		"FormValues":         in.formValues(),
+		"SelectedCategories": selected,
+		"PollDenied":         canCreatePoll(h.DB, userID),
+		"Draft":              draft,
+	}))
+}
 
-	// Сохраняем пост
+// createPost сохраняет проверенный пост вместе с изображениями — новыми и
+// перенесёнными из черновика draftID — и оповещает подписчиков и ленту.
+// Черновик при этом удаляется.
+func (h *PostHandler) createPost(userID int, author string, in postInput, tags []string, poll *pollInput, images []*media.Image, draftID int) (int, error) {
 	tx, err := h.DB.Begin()
 	if err != nil {
-		h.Err.Render(w, http.StatusInternalServerError, "Ошибка базы данных")
-		return
+		return 0, err
 	}
 	defer tx.Rollback()
 
-	res, err := tx.Exec("INSERT INTO posts (user_id, title, content, created_at) VALUES (?, ?, ?, ?)",
-		userID, title, content, time.Now().UTC())
+	p, err := insertPost(tx, userID, in, tags, poll, images, draftID)
 	if err != nil {
-		h.Err.Render(w, http.StatusInternalServerError, "Ошибка создания поста")
-		return
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	storeImages(h.Store, images)
+	h.postCreated(p, author, in)
+	return p.id, nil
+}
+
+// newPost — пост, записанный в транзакции. Подписчики и лента узнают
+// о нём после фиксации, из postCreated.
+type newPost struct {
+	id, userID int
+	mentioned  []int
+	createdAt  time.Time
+}
+
+// insertPost записывает пост с категориями, тегами, опросом и вложениями
+// в tx и забирает черновик draftID
+func insertPost(tx *sql.Tx, userID int, in postInput, tags []string, poll *pollInput, images []*media.Image, draftID int) (newPost, error) {
+	p := newPost{userID: userID, createdAt: time.Now().UTC()}
+	rendered, mentioned := renderContent(tx, in.Content)
+	res, err := tx.Exec("INSERT INTO posts (user_id, title, content, content_html, created_at, last_activity_at) VALUES (?, ?, ?, ?, ?, ?)",
+		userID, in.Title, in.Content, rendered, p.createdAt, p.createdAt)
+	if err != nil {
+		return p, err
 	}
 	postID, _ := res.LastInsertId()
+	p.id = int(postID)
 
-	for _, catID := range catIDs {
+	p.mentioned, err = saveMentions(tx, "post", p.id, p.id, userID, mentioned, p.createdAt)
+	if err != nil {
+		return p, fmt.Errorf("упоминания: %w", err)
+	}
+
+	for _, catID := range in.Categories {
 		tx.Exec("INSERT INTO post_categories (post_id, category_id) VALUES (?, ?)", postID, catID)
 	}
 
-	tx.Commit()
-	http.Redirect(w, r, fmt.Sprintf("/post/%d", postID), http.StatusSeeOther)
+	if err := attachTags(tx, postID, tags); err != nil {
+		return p, fmt.Errorf("теги: %w", err)
+	}
+
+	if poll != nil {
+		if err := createPoll(tx, postID, poll); err != nil {
+			return p, fmt.Errorf("опрос: %w", err)
+		}
+	}
+
+	if err := saveAttachments(tx, postID, userID, images); err != nil {
+		return p, fmt.Errorf("вложения: %w", err)
+	}
+
+	if draftID != 0 {
+		if err := takeDraft(tx, userID, draftID, postID); err != nil {
+			return p, err
+		}
+	}
+	return p, nil
+}
+
+// postCreated оповещает подписчиков и ленту о сохранённом посте
+func (h *PostHandler) postCreated(p newPost, author string, in postInput) {
+	h.Notify.PostCreated(p.id, p.userID, p.mentioned)
+	h.publishPost(p.id, p.userID, author, in.Title, in.Content, p.createdAt)
+}
+
+// publishPost сообщает ленте о новом посте
+func (h *PostHandler) publishPost(postID, authorID int, author, title, content string, createdAt time.Time) {
+	if h.Live == nil {
+		return
+	}
+	categories, err := loadCategoriesForPost(h.DB, postID)
+	if err != nil {
+		log.Println("Ошибка загрузки категорий поста:", err)
+	}
+	ev := livePost{
+		ID:         postID,
+		Title:      title,
+		Author:     author,
+		Reputation: userReputation(h.DB, authorID),
+		Content:    content,
+		CreatedAt:  createdAt.Format("02.01.2006"),
+		Categories: []liveCategory{},
+	}
+	for _, c := range categories {
+		ev.Categories = append(ev.Categories, liveCategory{ID: c.ID, Name: c.Name, Slug: c.Slug})
+	}
+	h.Live.Publish(feedTopic, "post", ev)
+}
+
+// Preview рендерит Markdown из формы создания поста без сохранения
+func (h *PostHandler) Preview(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		h.Err.Render(w, r, http.StatusMethodNotAllowed, "Метод не поддерживается")
+		return
+	}
+	if _, _, ok := GetUserFromSession(h.DB, r); !ok {
+		h.Err.Render(w, r, http.StatusUnauthorized, "Авторизуйтесь, чтобы создать пост")
+		return
+	}
+
+	content := r.FormValue("content")
+	if tooLong(content, maxPostLength) {
+		h.Err.Render(w, r, http.StatusRequestEntityTooLarge, "Текст слишком длинный (до 5000 символов)")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	rendered, _ := renderContent(h.DB, content)
+	w.Write([]byte(rendered))
 }
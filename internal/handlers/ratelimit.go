@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"forum/internal/config"
+)
+
+// LimitStore хранит состояние корзин. MemoryStore подходит для одного
+// процесса; для нескольких экземпляров форума нужна общая реализация.
+type LimitStore interface {
+	// Take пополняет корзину key на момент now и пытается взять из неё токен.
+	// Если токенов нет, возвращает время до появления следующего.
+	Take(key string, limit config.RateLimit, now time.Time) (bool, time.Duration)
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: make(map[string]*bucket)}
+}
+
+func (s *MemoryStore) Take(key string, limit config.RateLimit, now time.Time) (bool, time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep(now)
+
+	perSecond := limit.PerMinute / 60
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), updated: now}
+		s.buckets[key] = b
+	} else if elapsed := now.Sub(b.updated).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(float64(limit.Burst), b.tokens+elapsed*perSecond)
+		b.updated = now
+	}
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	if perSecond <= 0 {
+		return false, time.Hour
+	}
+	wait := time.Duration((1 - b.tokens) / perSecond * float64(time.Second))
+	return false, wait
+}
+
+// Раз в минуту удаляем корзины, которые давно не использовались
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+	for key, b := range s.buckets {
+		if now.Sub(b.updated) > time.Hour {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+// RateLimiter ограничивает частоту изменяющих запросов по маршрутам.
+// Ключ — пользователь из сессии, для анонимов — IP.
+type RateLimiter struct {
+	DB     *sql.DB
+	Store  LimitStore
+	Limits map[string]config.RateLimit
+	Err    *ErrorHandler
+	Now    func() time.Time
+}
+
+func NewRateLimiter(db *sql.DB, limits map[string]config.RateLimit, errHandler *ErrorHandler) *RateLimiter {
+	return &RateLimiter{
+		DB:     db,
+		Store:  NewMemoryStore(),
+		Limits: limits,
+		Err:    errHandler,
+		Now:    time.Now,
+	}
+}
+
+func (l *RateLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit, ok := l.Limits[r.URL.Path]
+		if !ok || isSafeMethod(r.Method) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if allowed, wait := l.Allow(r.URL.Path, l.clientKey(r), limit); !allowed {
+			seconds := int(math.Ceil(wait.Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(seconds))
+			msg := fmt.Sprintf("Слишком много запросов. Повторите через %d сек.", seconds)
+			if wantsJSON(r) {
+				writeJSONError(w, http.StatusTooManyRequests, msg)
+				return
+			}
+			l.Err.Render(w, r, http.StatusTooManyRequests, msg)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Allow берёт токен из корзины scope для клиента key
+func (l *RateLimiter) Allow(scope, key string, limit config.RateLimit) (bool, time.Duration) {
+	return l.Store.Take(scope+"|"+key, limit, l.Now())
+}
+
+func (l *RateLimiter) clientKey(r *http.Request) string {
+	if userID, _, ok := GetUserFromSession(l.DB, r); ok {
+		return "user:" + strconv.Itoa(userID)
+	}
+	return "ip:" + clientIP(r)
+}
@@ -0,0 +1,320 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"forum/internal/config"
+	"forum/internal/models"
+	"html/template"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Виды реакций в порядке показа; при запуске их задаёт ConfigureReactions
+var reactionKinds = config.Default().Reactions
+
+var reactionKindPattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,19}$`)
+
+// Сколько имён показывать для одного вида реакции в списке «кто отреагировал»
+const reactionUsersLimit = 100
+
+// ConfigureReactions задаёт набор реакций из настроек
+func ConfigureReactions(kinds []config.Reaction) error {
+	if len(kinds) == 0 {
+		return errors.New("не задано ни одной реакции")
+	}
+	seen := map[string]bool{}
+	for _, k := range kinds {
+		if !reactionKindPattern.MatchString(k.Kind) {
+			return fmt.Errorf("некорректное имя реакции %q: нужны строчные латинские буквы, цифры и _", k.Kind)
+		}
+		if seen[k.Kind] {
+			return fmt.Errorf("реакция %q указана дважды", k.Kind)
+		}
+		if k.Emoji == "" {
+			return fmt.Errorf("у реакции %q не задан эмодзи", k.Kind)
+		}
+		seen[k.Kind] = true
+	}
+	reactionKinds = append([]config.Reaction(nil), kinds...)
+	return nil
+}
+
+func findReaction(kind string) (config.Reaction, bool) {
+	for _, k := range reactionKinds {
+		if k.Kind == kind {
+			return k, true
+		}
+	}
+	return config.Reaction{}, false
+}
+
+// reactionList раскладывает счётчики по видам в порядке из настроек.
+// Виды, убранные из настроек, не показываются.
+func reactionList(counts map[string]int) []models.ReactionCount {
+	list := make([]models.ReactionCount, 0, len(reactionKinds))
+	for _, k := range reactionKinds {
+		list = append(list, models.ReactionCount{Kind: k.Kind, Emoji: k.Emoji, Title: k.Title, Count: counts[k.Kind]})
+	}
+	return list
+}
+
+// reactionTables — где хранятся счётчики реакций объекта
+var reactionTables = map[string]string{"post": "posts", "comment": "comments"}
+
+// decodeCounts разбирает счётчики реакций, сохранённые в reaction_counts
+func decodeCounts(raw string) map[string]int {
+	counts := map[string]int{}
+	if raw != "" {
+		if err := json.Unmarshal([]byte(raw), &counts); err != nil {
+			log.Println("Ошибка разбора счётчиков реакций:", err)
+		}
+	}
+	return counts
+}
+
+// CountReactions возвращает число реакций каждого вида на пост или комментарий
+// по сохранённым счётчикам
+func CountReactions(db dbtx, targetType string, targetID int) (map[string]int, error) {
+	table, ok := reactionTables[targetType]
+	if !ok {
+		return nil, fmt.Errorf("неизвестный тип объекта: %s", targetType)
+	}
+	var raw string
+	err := db.QueryRow("SELECT reaction_counts FROM "+table+" WHERE id = ?", targetID).Scan(&raw)
+	return decodeCounts(raw), err
+}
+
+// adjustReactionCounters меняет счётчики объекта в транзакции реакции:
+// прежний вид (если был) уменьшается, новый (если есть) увеличивается.
+// Возвращает sql.ErrNoRows, если объекта нет.
+func adjustReactionCounters(tx *sql.Tx, targetType string, targetID int, oldKind, newKind string) error {
+	table, ok := reactionTables[targetType]
+	if !ok {
+		return fmt.Errorf("неизвестный тип объекта: %s", targetType)
+	}
+	for _, change := range []struct {
+		kind  string
+		delta int
+	}{{oldKind, -1}, {newKind, 1}} {
+		if change.kind == "" {
+			continue
+		}
+		// Имя вида проверено по reactionKindPattern и безопасно как путь JSON
+		path := "$." + change.kind
+		res, err := tx.Exec(`
+			UPDATE `+table+` SET
+				reaction_counts = json_set(reaction_counts, ?, COALESCE(json_extract(reaction_counts, ?), 0) + ?),
+				likes = COALESCE(likes, 0) + CASE WHEN ? = 'like' THEN ? ELSE 0 END,
+				dislikes = COALESCE(dislikes, 0) + CASE WHEN ? = 'dislike' THEN ? ELSE 0 END
+			WHERE id = ?`,
+			path, path, change.delta, change.kind, change.delta, change.kind, change.delta, targetID)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return sql.ErrNoRows
+		}
+	}
+	return nil
+}
+
+// UserReaction возвращает вид реакции пользователя на пост или комментарий или ""
+func UserReaction(db *sql.DB, targetType string, targetID, userID int) string {
+	var kind string
+	db.QueryRow(`SELECT kind FROM reactions WHERE target_type = ? AND target_id = ? AND user_id = ?`,
+		targetType, targetID, userID).Scan(&kind)
+	return kind
+}
+
+// commentReactions — реакции пользователя на комментарии поста
+func commentReactions(db *sql.DB, postID, userID int) map[int]string {
+	mine := map[int]string{}
+	rows, err := db.Query(`
+		SELECT r.target_id, r.kind FROM reactions r
+		JOIN comments c ON c.id = r.target_id
+		WHERE r.target_type = 'comment' AND c.post_id = ? AND r.user_id = ?
+	`, postID, userID)
+	if err != nil {
+		log.Println("Ошибка загрузки реакций пользователя:", err)
+		return mine
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		var kind string
+		if rows.Scan(&id, &kind) == nil {
+			mine[id] = kind
+		}
+	}
+	return mine
+}
+
+// reactionScore — SQL-выражение рейтинга поста p для сортировки «Лучшие»:
+// сумма весов всех его реакций по сохранённым счётчикам
+func reactionScore() (string, []interface{}) {
+	terms := []string{"0"}
+	var args []interface{}
+	for _, k := range reactionKinds {
+		terms = append(terms, "COALESCE(json_extract(p.reaction_counts, ?), 0) * ?")
+		args = append(args, "$."+k.Kind, k.Weight)
+	}
+	return "(" + strings.Join(terms, " + ") + ")", args
+}
+
+// reactionBar — данные шаблона "reactionbar": кнопки реакций поста или
+// комментария. Без ID шаблон даёт заготовку для script.js.
+type reactionBar struct {
+	Type      string
+	ID        int
+	Counts    []models.ReactionCount
+	Mine      string
+	User      interface{}
+	CSRFToken string
+}
+
+func newReactionBar(typ string, id int, counts []models.ReactionCount, mine string, user interface{}, token string) reactionBar {
+	if counts == nil {
+		counts = reactionList(nil)
+	}
+	return reactionBar{Type: typ, ID: id, Counts: counts, Mine: mine, User: user, CSRFToken: token}
+}
+
+// ReactionsHandler — списки пользователей, поставивших реакции
+type ReactionsHandler struct {
+	DB        *sql.DB
+	Templates *template.Template
+	Err       *ErrorHandler
+}
+
+// reactionGroup — кто поставил реакцию одного вида
+type reactionGroup struct {
+	Kind  string   `json:"kind"`
+	Emoji string   `json:"emoji"`
+	Title string   `json:"title"`
+	Count int      `json:"count"`
+	Users []string `json:"users"` // последние reactionUsersLimit
+	More  int      `json:"more"`  // сколько не вошло в Users
+}
+
+// List — GET /reactions?type=post&id=1: кто и как отреагировал.
+// script.js запрашивает JSON для всплывающего списка, без JavaScript
+// открывается отдельная страница.
+func (h *ReactionsHandler) List(w http.ResponseWriter, r *http.Request) {
+	typ := r.FormValue("type")
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		h.notFound(w, r)
+		return
+	}
+	postID, title, err := reactionTarget(h.DB, typ, id)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Println("Ошибка загрузки объекта реакций:", err)
+		}
+		h.notFound(w, r)
+		return
+	}
+
+	groups, err := reactedBy(h.DB, typ, id)
+	if err != nil {
+		log.Println("Ошибка загрузки реакций:", err)
+		if wantsJSON(r) {
+			writeJSONError(w, http.StatusInternalServerError, "Ошибка базы данных")
+			return
+		}
+		h.Err.Render(w, r, http.StatusInternalServerError, "Ошибка базы данных")
+		return
+	}
+
+	if wantsJSON(r) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"type": typ, "id": id, "reactions": groups})
+		return
+	}
+	back := "/post/" + strconv.Itoa(postID)
+	if typ == "comment" {
+		back += "#comment-" + strconv.Itoa(id)
+	}
+	_, username, _ := GetUserFromSession(h.DB, r)
+	h.Templates.ExecuteTemplate(w, "layout", pageData(r, map[string]interface{}{
+		"Page":       "reactions",
+		"User":       username,
+		"TargetType": typ,
+		"PostTitle":  title,
+		"Back":       back,
+		"Groups":     groups,
+	}))
+}
+
+func (h *ReactionsHandler) notFound(w http.ResponseWriter, r *http.Request) {
+	if wantsJSON(r) {
+		writeJSONError(w, http.StatusNotFound, "Не найдено")
+		return
+	}
+	h.Err.NotFound(w, r)
+}
+
+// reactionTarget находит пост, к которому относится объект реакций
+func reactionTarget(db *sql.DB, targetType string, targetID int) (postID int, title string, err error) {
+	switch targetType {
+	case "post":
+		err = db.QueryRow(`SELECT id, title FROM posts WHERE id = ?`, targetID).Scan(&postID, &title)
+	case "comment":
+		err = db.QueryRow(`SELECT p.id, p.title FROM comments c JOIN posts p ON p.id = c.post_id WHERE c.id = ?`, targetID).
+			Scan(&postID, &title)
+	default:
+		err = sql.ErrNoRows
+	}
+	return
+}
+
+// reactedBy группирует поставивших реакции по видам, новые — первыми.
+// Виды без реакций пропускаются.
+func reactedBy(db *sql.DB, targetType string, targetID int) ([]reactionGroup, error) {
+	rows, err := db.Query(`
+		SELECT r.kind, u.username FROM reactions r
+		JOIN users u ON u.id = r.user_id
+		WHERE r.target_type = ? AND r.target_id = ?
+		ORDER BY r.created_at DESC, r.user_id DESC
+	`, targetType, targetID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	byKind := map[string]*reactionGroup{}
+	for rows.Next() {
+		var kind, name string
+		if err := rows.Scan(&kind, &name); err != nil {
+			return nil, err
+		}
+		g := byKind[kind]
+		if g == nil {
+			g = &reactionGroup{Kind: kind}
+			byKind[kind] = g
+		}
+		g.Count++
+		if len(g.Users) < reactionUsersLimit {
+			g.Users = append(g.Users, name)
+		} else {
+			g.More++
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	groups := []reactionGroup{}
+	for _, k := range reactionKinds {
+		if g := byKind[k.Kind]; g != nil {
+			g.Emoji, g.Title = k.Emoji, k.Title
+			groups = append(groups, *g)
+		}
+	}
+	return groups, nil
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"forum/internal/models"
+	"html/template"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// TemplateFuncs возвращает функции, доступные во всех шаблонах
+func TemplateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"inSlice": func(slice []string, val string) bool {
+			for _, s := range slice {
+				if s == val {
+					return true
+				}
+			}
+			return false
+		},
+		"contains": func(m map[string][]string, key string, val interface{}) bool {
+			for _, v := range m[key] {
+				if fmt.Sprint(v) == fmt.Sprint(val) {
+					return true
+				}
+			}
+			return false
+		},
+		"csrfField": csrfField,
+		// indent — отступ подкатегории в плоских списках (выпадающий фильтр, форма поста)
+		"indent": func(depth int) string {
+			return strings.Repeat("— ", depth)
+		},
+		"commentView": newCommentView,
+		"messageView": newMessageView,
+		"reactionBar": newReactionBar,
+		// bookmarkButton — данные кнопки и редактора закладки
+		"bookmarkButton": newBookmarkButton,
+		// reactionKinds — все виды реакций с нулевыми счётчиками для заготовок script.js
+		"reactionKinds": func() []models.ReactionCount {
+			return reactionList(nil)
+		},
+	}
+}
+
+// commentView — данные шаблона "comment": комментарий и то, что нужно
+// от страницы. Без комментария шаблон даёт заготовку для script.js.
+type commentView struct {
+	Comment   *models.Comment
+	User      interface{}
+	CSRFToken string
+	// Обсуждение закрыто или в архиве: отвечать нельзя
+	Closed bool
+}
+
+func newCommentView(c interface{}, page map[string]interface{}) commentView {
+	v := commentView{User: page["User"]}
+	v.CSRFToken, _ = page["CSRFToken"].(string)
+	v.Closed, _ = page["CommentsClosed"].(bool)
+	if comment, ok := c.(models.Comment); ok {
+		v.Comment = &comment
+	}
+	return v
+}
+
+// messageView — данные шаблона "message": сообщение (nil для заготовки
+// script.js), своё ли оно и групповая ли переписка
+type messageView struct {
+	Message *models.Message
+	Mine    bool
+	Group   bool
+}
+
+func newMessageView(m interface{}, userID int, group bool) messageView {
+	v := messageView{Group: group}
+	if msg, ok := m.(models.Message); ok {
+		v.Message = &msg
+		v.Mine = msg.UserID == userID
+	}
+	return v
+}
+
+// pageData дополняет данные шаблона значениями, общими для всех страниц
+func pageData(r *http.Request, data map[string]interface{}) map[string]interface{} {
+	data["CSRFToken"] = CSRFToken(r)
+	data["Nonce"] = CSPNonce(r)
+	data["Unread"] = UnreadNotifications(r)
+	data["UnreadMessages"] = UnreadMessages(r)
+	return data
+}
+
+// wantsJSON сообщает, что клиент (fetch из script.js) просит JSON вместо
+// HTML-страницы или редиректа
+func wantsJSON(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil || mediaType != "application/json" {
+			continue
+		}
+		return params["q"] != "0" && params["q"] != "0.0"
+	}
+	return false
+}
+
+// writeJSONError отвечает ошибкой в виде {"error": "..."}
+func writeJSONError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
+
+// sameOriginReferer возвращает путь страницы из Referer, если она с этого
+// же сайта. Чужой или отсутствующий Referer не годится для редиректа.
+func sameOriginReferer(r *http.Request) (string, bool) {
+	ref, err := url.Parse(r.Referer())
+	if err != nil || ref.Host == "" || !strings.EqualFold(ref.Host, r.Host) {
+		return "", false
+	}
+	back := &url.URL{Path: ref.Path, RawQuery: ref.RawQuery}
+	if back.Path == "" {
+		back.Path = "/"
+	}
+	return back.String(), true
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"forum/internal/config"
+	"forum/internal/reputation"
+	"log"
+	"time"
+)
+
+// Правила репутации и пороги привилегий; при запуске их задаёт ConfigureReputation
+var (
+	reputationRules = reputation.NewRules(config.Default().Reputation, config.Default().Reactions)
+	privileges      = config.Default().Reputation.Privileges
+)
+
+// ConfigureReputation задаёт правила репутации из настроек. Вызывается после
+// ConfigureReactions: очки по умолчанию берутся из весов реакций.
+func ConfigureReputation(cfg config.Reputation) reputation.Rules {
+	reputationRules = reputation.NewRules(cfg, reactionKinds)
+	privileges = cfg.Privileges
+	return reputationRules
+}
+
+// authorReputation — репутация автора для показа рядом с именем
+func authorReputation(score float64, at sql.NullTime) int {
+	return reputation.Display(reputationRules.Current(score, at, time.Now()))
+}
+
+// userReputation — текущая репутация пользователя для показа
+func userReputation(db *sql.DB, userID int) int {
+	score, err := reputation.Of(db, reputationRules, userID, time.Now())
+	if err != nil {
+		log.Println("Ошибка чтения репутации:", err)
+	}
+	return reputation.Display(score)
+}
+
+// privilegeError проверяет порог репутации для действия и возвращает
+// сообщение об отказе или "". Модераторы и администраторы порогов не имеют.
+func privilegeError(db *sql.DB, userID int, threshold float64, action string) string {
+	if threshold <= 0 {
+		return ""
+	}
+	if role := GetUserRole(db, userID); role == "moderator" || role == "admin" {
+		return ""
+	}
+	score, err := reputation.Of(db, reputationRules, userID, time.Now())
+	if err != nil {
+		log.Println("Ошибка чтения репутации:", err)
+		return "Не удалось проверить репутацию"
+	}
+	if score >= threshold {
+		return ""
+	}
+	return fmt.Sprintf("%s можно с репутацией от %g (у вас %d)", action, threshold, reputation.Display(score))
+}
+
+// canCreatePoll — хватает ли репутации, чтобы добавить к посту опрос
+func canCreatePoll(db *sql.DB, userID int) string {
+	return privilegeError(db, userID, privileges.CreatePoll, "Создавать опросы")
+}
+
+// isDownvote — реакция отнимает у автора очки
+func isDownvote(kind string) bool {
+	return reputationRules.Points(kind) < 0
+}
+
+// reactionAuthor — автор поста или комментария
+func reactionAuthor(tx *sql.Tx, targetType string, targetID int) (int, error) {
+	table, ok := reactionTables[targetType]
+	if !ok {
+		return 0, fmt.Errorf("неизвестный тип объекта: %s", targetType)
+	}
+	var authorID int
+	err := tx.QueryRow("SELECT user_id FROM "+table+" WHERE id = ?", targetID).Scan(&authorID)
+	return authorID, err
+}
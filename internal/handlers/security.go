@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"forum/internal/config"
+)
+
+type nonceContextKey struct{}
+
+// SecurityHeaders добавляет к каждому ответу заголовки безопасности и CSP
+// с одноразовым nonce для скриптов.
+type SecurityHeaders struct {
+	Config config.Security
+}
+
+func NewSecurityHeaders(cfg config.Security) *SecurityHeaders {
+	return &SecurityHeaders{Config: cfg}
+}
+
+func (s *SecurityHeaders) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nonce := newNonce()
+		r = r.WithContext(context.WithValue(r.Context(), nonceContextKey{}, nonce))
+
+		h := w.Header()
+		cspHeader := "Content-Security-Policy"
+		if s.Config.ReportOnly {
+			cspHeader = "Content-Security-Policy-Report-Only"
+		}
+		h.Set(cspHeader, s.policy(nonce))
+		h.Set("X-Content-Type-Options", "nosniff")
+		if s.Config.ReferrerPolicy != "" {
+			h.Set("Referrer-Policy", s.Config.ReferrerPolicy)
+		}
+		if len(s.Config.FrameAncestors) == 1 && s.Config.FrameAncestors[0] == "'none'" {
+			// Для старых браузеров без поддержки frame-ancestors
+			h.Set("X-Frame-Options", "DENY")
+		}
+		if s.Config.HSTSMaxAge > 0 && s.isTLS(r) {
+			h.Set("Strict-Transport-Security", "max-age="+strconv.Itoa(s.Config.HSTSMaxAge)+"; includeSubDomains")
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *SecurityHeaders) policy(nonce string) string {
+	directives := []string{
+		"default-src 'self'",
+		"script-src " + strings.Join(append(append([]string{}, s.Config.ScriptSources...), "'nonce-"+nonce+"'"), " "),
+		"object-src 'none'",
+		"base-uri 'self'",
+		"form-action 'self'",
+	}
+	if len(s.Config.StyleSources) > 0 {
+		directives = append(directives, "style-src "+strings.Join(s.Config.StyleSources, " "))
+	}
+	if len(s.Config.ImgSources) > 0 {
+		directives = append(directives, "img-src "+strings.Join(s.Config.ImgSources, " "))
+	}
+	if len(s.Config.ConnectSources) > 0 {
+		directives = append(directives, "connect-src "+strings.Join(s.Config.ConnectSources, " "))
+	}
+	if len(s.Config.FrameAncestors) > 0 {
+		directives = append(directives, "frame-ancestors "+strings.Join(s.Config.FrameAncestors, " "))
+	}
+	return strings.Join(directives, "; ")
+}
+
+func (s *SecurityHeaders) isTLS(r *http.Request) bool {
+	if r.TLS != nil {
+		return true
+	}
+	return s.Config.TrustForwardedProto && r.Header.Get("X-Forwarded-Proto") == "https"
+}
+
+// CSPNonce возвращает nonce текущего запроса для атрибута nonce у <script>
+func CSPNonce(r *http.Request) string {
+	nonce, _ := r.Context().Value(nonceContextKey{}).(string)
+	return nonce
+}
+
+func newNonce() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,304 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"forum/internal/models"
+	"forum/internal/spam"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	heldPostMessage    = "Пост отправлен на проверку модераторам и появится после одобрения. Пока он лежит в черновиках."
+	heldCommentMessage = "Комментарий отправлен на проверку модераторам и появится после одобрения"
+	spamQueueLimit     = 100
+)
+
+// spamActions — решения по очереди проверки и как они звучат в журнале
+var spamActions = map[string]string{
+	"approve": "одобрил",
+	"spam":    "отклонил как спам",
+}
+
+// checkSpam прогоняет текст через фильтры спама и возвращает, почему его
+// надо задержать, или nil. Модераторов фильтры не касаются. Если фильтр
+// не смог отработать, текст проходит, а ошибка пишется в лог.
+func checkSpam(db *sql.DB, chain spam.Chain, userID int, kind, title, text string, at time.Time) *spam.Flag {
+	if len(chain) == 0 || isModerator(db, userID) {
+		return nil
+	}
+	c := spam.Content{Kind: kind, UserID: userID, Title: title, Text: text, At: at}
+	var joined sql.NullTime
+	if err := db.QueryRow(`SELECT created_at FROM users WHERE id = ?`, userID).Scan(&joined); err != nil {
+		log.Println("Ошибка чтения даты регистрации:", err)
+	}
+	c.Joined = joined.Time
+	flag, err := chain.Check(c)
+	if err != nil {
+		log.Println("Ошибка фильтра спама:", err)
+	}
+	return flag
+}
+
+// holdContent ставит пост или комментарий в очередь проверки. Пост к этому
+// времени сохранён черновиком item.DraftID; прежняя заявка того же
+// черновика заменяется.
+func holdContent(q dbtx, item models.HeldContent, flag *spam.Flag, now time.Time) error {
+	var draftID, postID, parentID sql.NullInt64
+	if item.DraftID != 0 {
+		draftID = sql.NullInt64{Int64: int64(item.DraftID), Valid: true}
+		if _, err := q.Exec(`DELETE FROM held_content WHERE draft_id = ?`, item.DraftID); err != nil {
+			return err
+		}
+	}
+	if item.PostID != 0 {
+		postID = sql.NullInt64{Int64: int64(item.PostID), Valid: true}
+	}
+	if item.ParentID != 0 {
+		parentID = sql.NullInt64{Int64: int64(item.ParentID), Valid: true}
+	}
+	_, err := q.Exec(`
+		INSERT INTO held_content (target_type, user_id, draft_id, post_id, parent_id, content, filter, reason, score, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		item.TargetType, item.UserID, draftID, postID, parentID, item.Content, flag.Filter, flag.Reason, flag.Score, now)
+	return err
+}
+
+// SpamQueue — очередь проверки для модераторов. GET показывает задержанные
+// посты и комментарии, POST принимает решение: approve публикует,
+// spam удаляет. Оба решения обучают классификатор и попадают в журнал.
+func (h *AdminHandler) SpamQueue(w http.ResponseWriter, r *http.Request) {
+	moderatorID, username, ok := h.requireModerator(w, r)
+	if !ok {
+		return
+	}
+	if r.Method != http.MethodPost {
+		items, err := LoadHeld(h.DB, spamQueueLimit)
+		if err != nil {
+			log.Println("Ошибка загрузки очереди проверки:", err)
+			h.Err.Render(w, r, http.StatusInternalServerError, "Ошибка базы данных")
+			return
+		}
+		h.Templates.ExecuteTemplate(w, "layout", pageData(r, map[string]interface{}{
+			"Page":  "spamqueue",
+			"User":  username,
+			"Flash": GetFlash(w, r, "flash"),
+			"Items": items,
+		}))
+		return
+	}
+
+	id, _ := strconv.Atoi(r.FormValue("id"))
+	action := r.FormValue("action")
+	if _, known := spamActions[action]; !known {
+		h.Err.Render(w, r, http.StatusBadRequest, "Неизвестное действие")
+		return
+	}
+	reason := strings.TrimSpace(r.FormValue("reason"))
+	if utf8.RuneCountInString(reason) > maxModerationReason {
+		h.Err.Render(w, r, http.StatusBadRequest, "Причина слишком длинная (до 200 символов)")
+		return
+	}
+	item, err := getHeld(h.DB, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		h.Err.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Println("Ошибка загрузки задержанного:", err)
+		h.Err.Render(w, r, http.StatusInternalServerError, "Ошибка базы данных")
+		return
+	}
+
+	now := time.Now().UTC()
+	var post heldPost
+	if action == "approve" && item.TargetType == "post" {
+		post = h.checkHeldPost(item, now)
+	}
+
+	// Заявка снимается с очереди в одной транзакции с публикацией: два
+	// модератора не опубликуют одно и то же дважды, а при сбое публикации
+	// заявка останется в очереди
+	tx, err := h.DB.Begin()
+	if err != nil {
+		h.Err.Render(w, r, http.StatusInternalServerError, "Ошибка базы данных")
+		return
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec(`DELETE FROM held_content WHERE id = ?`, id)
+	if err != nil {
+		h.Err.Render(w, r, http.StatusInternalServerError, "Ошибка базы данных")
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		h.Err.NotFound(w, r)
+		return
+	}
+	err = spam.Train(tx, strings.TrimSpace(item.Title+"\n"+item.Content), action == "spam")
+	if err == nil && action == "spam" && item.DraftID != 0 {
+		if err = deleteDraft(tx, item.UserID, item.DraftID); errors.Is(err, errDraftGone) {
+			err = nil
+		}
+	}
+	flash := "Отклонено как спам"
+	var published func()
+	if err == nil && action == "approve" {
+		flash, published, err = h.publishHeld(tx, item, post)
+	}
+	if err == nil {
+		err = logModeration(tx, moderatorID, action, "held", id, heldDetails(item), reason, now)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Println("Ошибка решения по очереди проверки:", err)
+		h.Err.Render(w, r, http.StatusInternalServerError, "Ошибка базы данных")
+		return
+	}
+	if published != nil {
+		published()
+	}
+
+	SetFlash(w, "flash", flash)
+	http.Redirect(w, r, "/admin/spam", http.StatusSeeOther)
+}
+
+// heldPost — задержанный пост, проверенный перед публикацией как
+// запланированный. problem — почему он не прошёл проверку формы.
+type heldPost struct {
+	in      postInput
+	tags    []string
+	poll    *pollInput
+	problem string
+}
+
+// checkHeldPost проверяет черновик задержанного поста. Проверка читает базу
+// вне транзакции решения, поэтому идёт до неё.
+func (h *AdminHandler) checkHeldPost(item models.HeldContent, now time.Time) heldPost {
+	draft, err := GetDraft(h.DB, item.UserID, item.DraftID)
+	if err != nil {
+		return heldPost{}
+	}
+	post := heldPost{in: draftInput(*draft)}
+	var fieldErrors map[string]string
+	fieldErrors, post.tags, post.poll = post.in.check(h.DB, item.UserID, now)
+	post.problem = joinFieldErrors(fieldErrors)
+	return post
+}
+
+// publishHeld публикует одобренное в транзакции решения и возвращает
+// сообщение для модератора и то, что надо сделать после фиксации
+// (уведомления, живая лента). Пост, не прошедший проверку формы, остаётся
+// у автора в черновиках с пояснением. Комментарий не публикуется, если
+// за время проверки обсуждение закрыли или автор поста либо комментария,
+// на который он отвечает, заблокировал пишущего.
+func (h *AdminHandler) publishHeld(tx *sql.Tx, item models.HeldContent, post heldPost) (string, func(), error) {
+	if item.TargetType == "comment" {
+		err := threadClosed(tx, item.PostID, false)
+		if errors.Is(err, errThreadLocked) || errors.Is(err, errThreadArchived) {
+			return "Комментарий не опубликован: " + strings.ToLower(err.Error()), nil, nil
+		}
+		if err != nil {
+			return "", nil, err
+		}
+		if replyBlocked(tx, item.PostID, int64(item.ParentID), item.UserID) {
+			return "Комментарий не опубликован: автор поста или комментария заблокировал пишущего", nil, nil
+		}
+
+		var parentID sql.NullInt64
+		var parentAuthor string
+		if item.ParentID != 0 {
+			parentID = sql.NullInt64{Int64: int64(item.ParentID), Valid: true}
+			tx.QueryRow(`
+				SELECT u.username FROM comments c JOIN users u ON u.id = c.user_id WHERE c.id = ?`,
+				item.ParentID).Scan(&parentAuthor)
+		}
+		c, err := insertComment(tx, item.PostID, item.UserID, parentID, item.Content)
+		if errors.Is(err, sql.ErrNoRows) {
+			return "Пост удалён, комментарий опубликовать некуда", nil, nil
+		}
+		if err != nil {
+			return "", nil, fmt.Errorf("публикация комментария: %w", err)
+		}
+		return "Комментарий опубликован", func() { h.Comments.commentAdded(c, item.Author, parentAuthor) }, nil
+	}
+
+	// Черновик могли удалить и после проверки: тогда пост не создаётся вовсе
+	var exists bool
+	if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM drafts WHERE id = ? AND user_id = ?)`,
+		item.DraftID, item.UserID).Scan(&exists); err != nil {
+		return "", nil, err
+	}
+	if !exists {
+		return "Автор уже удалил черновик", nil, nil
+	}
+	if post.problem != "" {
+		if _, err := tx.Exec(`UPDATE drafts SET error = ? WHERE id = ?`, post.problem, item.DraftID); err != nil {
+			return "", nil, err
+		}
+		return "Пост не прошёл проверку формы и возвращён автору: " + post.problem, nil, nil
+	}
+	p, err := insertPost(tx, item.UserID, post.in, post.tags, post.poll, nil, item.DraftID)
+	if err != nil {
+		return "", nil, fmt.Errorf("публикация поста: %w", err)
+	}
+	return "Пост опубликован", func() { h.Posts.postCreated(p, item.Author, post.in) }, nil
+}
+
+// heldDetails — что именно решал модератор, для журнала
+func heldDetails(item models.HeldContent) string {
+	if item.TargetType == "post" {
+		return "пост «" + item.Title + "» от " + item.Author
+	}
+	return "комментарий от " + item.Author + " к посту «" + item.PostTitle + "»"
+}
+
+const heldColumns = `h.id, h.target_type, h.user_id, u.username, u.created_at,
+	COALESCE(h.draft_id, 0), COALESCE(h.post_id, 0), COALESCE(p.title, ''), COALESCE(h.parent_id, 0),
+	COALESCE(d.title, ''), CASE WHEN h.target_type = 'post' THEN COALESCE(d.content, '') ELSE h.content END,
+	h.filter, h.reason, h.score, h.created_at`
+
+const heldFrom = `
+	FROM held_content h
+	JOIN users u ON u.id = h.user_id
+	LEFT JOIN drafts d ON d.id = h.draft_id
+	LEFT JOIN posts p ON p.id = h.post_id`
+
+func scanHeld(row interface{ Scan(...interface{}) error }) (models.HeldContent, error) {
+	var item models.HeldContent
+	var joined sql.NullTime
+	err := row.Scan(&item.ID, &item.TargetType, &item.UserID, &item.Author, &joined,
+		&item.DraftID, &item.PostID, &item.PostTitle, &item.ParentID,
+		&item.Title, &item.Content, &item.Filter, &item.Reason, &item.Score, &item.CreatedAt)
+	item.Joined = joined.Time
+	return item, err
+}
+
+func getHeld(db *sql.DB, id int) (models.HeldContent, error) {
+	return scanHeld(db.QueryRow(`SELECT `+heldColumns+heldFrom+` WHERE h.id = ?`, id))
+}
+
+// LoadHeld — очередь проверки, давно ждущие сверху
+func LoadHeld(db *sql.DB, limit int) ([]models.HeldContent, error) {
+	rows, err := db.Query(`SELECT `+heldColumns+heldFrom+` ORDER BY h.id LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []models.HeldContent
+	for rows.Next() {
+		item, err := scanHeld(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
@@ -0,0 +1,288 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode"
+
+	"forum/internal/models"
+)
+
+const (
+	maxTagsPerPost = 5
+	maxTagLength   = 32
+)
+
+// NormalizeTag приводит тег к каноническому виду: строчные буквы и цифры,
+// пробелы и подчёркивания заменяются дефисом ("#Лига Чемпионов" → "лига-чемпионов").
+// Возвращает пустую строку, если от тега ничего не осталось.
+func NormalizeTag(raw string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.TrimLeft(strings.TrimSpace(raw), "#") {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			dash = false
+			b.WriteRune(unicode.ToLower(r))
+		case r == '-' || r == '_' || unicode.IsSpace(r):
+			dash = true
+		}
+	}
+	return b.String()
+}
+
+// parseTags разбирает поле "tags" формы (через запятую) и сверяет теги
+// с базой: синонимы заменяются основным тегом, запрещённые отклоняются.
+func parseTags(db *sql.DB, raw string) ([]string, string) {
+	var tags []string
+	seen := map[string]bool{}
+	for _, part := range strings.Split(raw, ",") {
+		name := NormalizeTag(part)
+		if name == "" {
+			continue
+		}
+		if len([]rune(name)) > maxTagLength {
+			return nil, fmt.Sprintf("Тег «%s» слишком длинный (до %d символов)", name, maxTagLength)
+		}
+
+		canonical, banned, err := resolveTag(db, name)
+		if err != nil {
+			return nil, "Ошибка базы данных"
+		}
+		if banned {
+			return nil, fmt.Sprintf("Тег «%s» запрещён модераторами", name)
+		}
+		if !seen[canonical] {
+			seen[canonical] = true
+			tags = append(tags, canonical)
+		}
+	}
+	if len(tags) > maxTagsPerPost {
+		return nil, fmt.Sprintf("Не больше %d тегов на пост", maxTagsPerPost)
+	}
+	return tags, ""
+}
+
+// resolveTag возвращает основное имя тега с учётом синонимов.
+// Неизвестный тег возвращается как есть: он будет создан вместе с постом.
+func resolveTag(db *sql.DB, name string) (string, bool, error) {
+	var canonical string
+	var banned bool
+	err := db.QueryRow(`
+		SELECT t.name, t.banned FROM tag_aliases a JOIN tags t ON t.id = a.tag_id WHERE a.alias = ?
+		UNION ALL
+		SELECT name, banned FROM tags WHERE name = ?
+		LIMIT 1
+	`, name, name).Scan(&canonical, &banned)
+	if err == sql.ErrNoRows {
+		return name, false, nil
+	}
+	return canonical, banned, err
+}
+
+// attachTags привязывает к посту теги, создавая недостающие
+func attachTags(tx *sql.Tx, postID int64, tags []string) error {
+	for _, name := range tags {
+		if _, err := tx.Exec(`INSERT OR IGNORE INTO tags (name) VALUES (?)`, name); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`
+			INSERT OR IGNORE INTO post_tags (post_id, tag_id)
+			SELECT ?, id FROM tags WHERE name = ? AND NOT banned`, postID, name)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func loadTagsForPost(db *sql.DB, postID int) ([]models.Tag, error) {
+	rows, err := db.Query(`
+		SELECT t.id, t.name
+		FROM tags t
+		JOIN post_tags pt ON pt.tag_id = t.id
+		WHERE pt.post_id = ?
+		ORDER BY t.name
+	`, postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tags []models.Tag
+	for rows.Next() {
+		var t models.Tag
+		if err := rows.Scan(&t.ID, &t.Name); err == nil {
+			tags = append(tags, t)
+		}
+	}
+	return tags, nil
+}
+
+// SuggestTags — подсказки для автодополнения: теги, начинающиеся с prefix,
+// самые популярные первыми. Синонимы подсказывают основной тег.
+func SuggestTags(db *sql.DB, prefix string, limit int) ([]string, error) {
+	prefix = NormalizeTag(prefix)
+	if prefix == "" {
+		return nil, nil
+	}
+	// Экранируем спецсимволы LIKE, хотя после нормализации их быть не должно
+	pattern := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(prefix) + "%"
+	rows, err := db.Query(`
+		SELECT t.name
+		FROM tags t
+		LEFT JOIN post_tags pt ON pt.tag_id = t.id
+		WHERE NOT t.banned AND (t.name LIKE ? ESCAPE '\'
+			OR t.id IN (SELECT tag_id FROM tag_aliases WHERE alias LIKE ? ESCAPE '\'))
+		GROUP BY t.id
+		ORDER BY COUNT(pt.post_id) DESC, t.name
+		LIMIT ?
+	`, pattern, pattern, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	names := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err == nil {
+			names = append(names, name)
+		}
+	}
+	return names, rows.Err()
+}
+
+// TagHandler отвечает на запросы автодополнения тегов в форме поста
+type TagHandler struct {
+	DB  *sql.DB
+	Err *ErrorHandler
+}
+
+func (h *TagHandler) Suggest(w http.ResponseWriter, r *http.Request) {
+	names, err := SuggestTags(h.DB, r.URL.Query().Get("q"), 10)
+	if err != nil {
+		h.Err.Render(w, r, http.StatusInternalServerError, "Ошибка базы данных")
+		return
+	}
+	if names == nil {
+		names = []string{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(names)
+}
+
+// ListTags возвращает все теги с числом постов для страницы модерации
+func ListTags(db *sql.DB) ([]models.Tag, error) {
+	rows, err := db.Query(`
+		SELECT t.id, t.name, t.banned, COUNT(pt.post_id)
+		FROM tags t
+		LEFT JOIN post_tags pt ON pt.tag_id = t.id
+		GROUP BY t.id
+		ORDER BY t.banned, COUNT(pt.post_id) DESC, t.name
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tags []models.Tag
+	for rows.Next() {
+		var t models.Tag
+		if err := rows.Scan(&t.ID, &t.Name, &t.Banned, &t.Posts); err != nil {
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+	return tags, rows.Err()
+}
+
+// MergeTags переносит посты тега from в тег into, а имя from
+// (и все его синонимы) становится синонимом into.
+func MergeTags(db *sql.DB, from, into string) error {
+	from, into = NormalizeTag(from), NormalizeTag(into)
+	if from == "" || into == "" || from == into {
+		return fmt.Errorf("укажите два разных тега")
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var fromID, intoID int
+	if err := tx.QueryRow(`SELECT id FROM tags WHERE name = ?`, from).Scan(&fromID); err != nil {
+		return fmt.Errorf("тег «%s» не найден", from)
+	}
+	if err := tx.QueryRow(`SELECT id FROM tags WHERE name = ?`, into).Scan(&intoID); err != nil {
+		return fmt.Errorf("тег «%s» не найден", into)
+	}
+
+	steps := []struct {
+		query string
+		args  []interface{}
+	}{
+		{`INSERT OR IGNORE INTO post_tags (post_id, tag_id) SELECT post_id, ? FROM post_tags WHERE tag_id = ?`, []interface{}{intoID, fromID}},
+		{`DELETE FROM post_tags WHERE tag_id = ?`, []interface{}{fromID}},
+		{`UPDATE tag_aliases SET tag_id = ? WHERE tag_id = ?`, []interface{}{intoID, fromID}},
+		{`INSERT OR REPLACE INTO tag_aliases (alias, tag_id) VALUES (?, ?)`, []interface{}{from, intoID}},
+		{`DELETE FROM tags WHERE id = ?`, []interface{}{fromID}},
+	}
+	for _, step := range steps {
+		if _, err := tx.Exec(step.query, step.args...); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// TagAliasError — запрет синонима ничего бы не дал: при создании поста
+// синоним заменяется основным тегом, и проверяется запрет уже его
+type TagAliasError struct {
+	Alias, Canonical string
+}
+
+func (e *TagAliasError) Error() string {
+	return "«" + e.Alias + "» — синоним тега «" + e.Canonical + "», запрещайте основной тег"
+}
+
+// SetTagBanned запрещает тег (снимая его со всех постов) или разрешает снова.
+// Для синонима возвращает *TagAliasError с основным тегом.
+func SetTagBanned(db *sql.DB, name string, banned bool) error {
+	name = NormalizeTag(name)
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var canonical string
+	err = tx.QueryRow(`SELECT t.name FROM tag_aliases a JOIN tags t ON t.id = a.tag_id WHERE a.alias = ?`, name).Scan(&canonical)
+	if err == nil {
+		return &TagAliasError{Alias: name, Canonical: canonical}
+	}
+	if err != sql.ErrNoRows {
+		return err
+	}
+
+	// Запретить можно и тег, которого ещё нет, — заранее
+	if _, err := tx.Exec(`INSERT OR IGNORE INTO tags (name) VALUES (?)`, name); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE tags SET banned = ? WHERE name = ?`, banned, name); err != nil {
+		return err
+	}
+	if banned {
+		if _, err := tx.Exec(`DELETE FROM post_tags WHERE tag_id = (SELECT id FROM tags WHERE name = ?)`, name); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
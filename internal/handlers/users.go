@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// SuggestUsers возвращает имена пользователей, начинающиеся с prefix
+func SuggestUsers(db *sql.DB, prefix string, limit int) ([]string, error) {
+	prefix = strings.TrimPrefix(strings.TrimSpace(prefix), "@")
+	if prefix == "" || len(prefix) > 20 {
+		return nil, nil
+	}
+	pattern := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(prefix) + "%"
+	rows, err := db.Query(`
+		SELECT username FROM users
+		WHERE username LIKE ? ESCAPE '\'
+		ORDER BY length(username), username
+		LIMIT ?
+	`, pattern, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	names := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err == nil {
+			names = append(names, name)
+		}
+	}
+	return names, rows.Err()
+}
+
+type UserHandler struct {
+	DB        *sql.DB
+	Templates *template.Template
+	Err       *ErrorHandler
+}
+
+// Suggest — автодополнение @упоминаний в формах
+func (h *UserHandler) Suggest(w http.ResponseWriter, r *http.Request) {
+	names, err := SuggestUsers(h.DB, r.URL.Query().Get("q"), 8)
+	if err != nil {
+		h.Err.Render(w, r, http.StatusInternalServerError, "Ошибка базы данных")
+		return
+	}
+	if names == nil {
+		names = []string{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(names)
+}
+
+// Profile — данные шапки страницы пользователя
+type Profile struct {
+	ID       int
+	Username string
+	Joined   time.Time
+	Posts    int
+	Comments int
+	// Очки за реакции на посты и комментарии с учётом затухания
+	Reputation int
+}
+
+// UserPage — профиль /u/<имя>: посты пользователя, а с ?tab=mentions —
+// посты и обсуждения, где его упомянули
+func (h *FilterHandler) UserPage(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/u/")
+	var p Profile
+	var joined, reputationAt sql.NullTime
+	var score float64
+	err := h.DB.QueryRow(`
+		SELECT id, username, created_at, reputation, reputation_at,
+			(SELECT COUNT(*) FROM posts WHERE user_id = users.id),
+			(SELECT COUNT(*) FROM comments WHERE user_id = users.id)
+		FROM users WHERE username = ? COLLATE NOCASE`, name).Scan(&p.ID, &p.Username, &joined, &score, &reputationAt, &p.Posts, &p.Comments)
+	if errors.Is(err, sql.ErrNoRows) {
+		h.Err.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		h.Err.Render(w, r, http.StatusInternalServerError, "Ошибка базы данных")
+		return
+	}
+	p.Joined = joined.Time
+	p.Reputation = authorReputation(score, reputationAt)
+	if name != p.Username {
+		// Имя в другом регистре — ведём на основной адрес
+		target := &url.URL{Path: "/u/" + p.Username, RawQuery: r.URL.RawQuery}
+		http.Redirect(w, r, target.String(), http.StatusMovedPermanently)
+		return
+	}
+
+	r.ParseForm()
+	mentions := r.FormValue("tab") == "mentions"
+	filter := PostFilter{
+		Query:      r.FormValue("q"),
+		Categories: r.Form["category"],
+		Tags:       normalizeTags(r.Form["tag"]),
+	}
+	if mentions {
+		filter.MentionedID = p.ID
+	} else {
+		filter.AuthorID = p.ID
+	}
+	userID, _, _ := GetUserFromSession(h.DB, r)
+	h.renderPosts(w, r, filter, LoadAllCategories(h.DB), map[string]interface{}{
+		"Profile":         p,
+		"MentionsTab":     mentions,
+		"FollowingAuthor": userID != 0 && IsFollowing(h.DB, userID, "user", p.ID),
+		"BlockKind":       BlockKind(h.DB, userID, p.ID),
+		"UserID":          userID,
+	})
+}
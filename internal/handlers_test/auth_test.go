@@ -24,13 +24,22 @@ func setupTestDB(t *testing.T) *sql.DB {
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
 			email TEXT UNIQUE,
 			username TEXT UNIQUE,
-			password TEXT
+			password TEXT,
+			reputation REAL NOT NULL DEFAULT 0,
+			reputation_at DATETIME
 		);
 		CREATE TABLE sessions (
 			id TEXT PRIMARY KEY,
 			user_id INTEGER,
 			expires_at TIMESTAMP
 		);
+		CREATE TABLE user_blocks (
+			user_id INTEGER,
+			target_id INTEGER,
+			kind TEXT,
+			created_at DATETIME,
+			PRIMARY KEY (user_id, target_id)
+		);
 	`)
 	if err != nil {
 		t.Fatal(err)
@@ -42,16 +51,7 @@ func TestRegister_Success(t *testing.T) {
 	db := setupTestDB(t)
 	defer db.Close()
 
-	tmpl := template.New("").Funcs(template.FuncMap{
-		"inSlice": func(slice []string, val string) bool {
-			for _, s := range slice {
-				if s == val {
-					return true
-				}
-			}
-			return false
-		},
-	})
+	tmpl := template.New("").Funcs(handlers.TemplateFuncs())
 	tmpl = template.Must(tmpl.ParseGlob("../../templates/*.html"))
 
 	handler := handlers.AuthHandler{
@@ -85,16 +85,7 @@ func TestLogin_Success(t *testing.T) {
 	hashed, _ := bcrypt.GenerateFromPassword([]byte("123456"), bcrypt.DefaultCost)
 	db.Exec(`INSERT INTO users (email, username, password) VALUES (?, ?, ?)`, "test@example.com", "testuser", string(hashed))
 
-	tmpl := template.New("").Funcs(template.FuncMap{
-		"inSlice": func(slice []string, val string) bool {
-			for _, s := range slice {
-				if s == val {
-					return true
-				}
-			}
-			return false
-		},
-	})
+	tmpl := template.New("").Funcs(handlers.TemplateFuncs())
 	tmpl = template.Must(tmpl.ParseGlob("../../templates/*.html"))
 
 	handler := handlers.AuthHandler{DB: db, Templates: tmpl, Err: &handlers.ErrorHandler{Templates: tmpl}}
@@ -114,3 +105,21 @@ func TestLogin_Success(t *testing.T) {
 		t.Errorf("ожидался редирект после входа, получен статус %d", resp.StatusCode)
 	}
 }
+
+func TestFlash_RoundTripCyrillic(t *testing.T) {
+	const msg = "Опрос уже закрыт; попробуйте «другой»"
+	w := httptest.NewRecorder()
+	handlers.SetFlash(w, "flash", msg)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, c := range w.Result().Cookies() {
+		req.AddCookie(c)
+	}
+	w = httptest.NewRecorder()
+	if got := handlers.GetFlash(w, req, "flash"); got != msg {
+		t.Errorf("flash = %q, want %q", got, msg)
+	}
+	if cookies := w.Result().Cookies(); len(cookies) != 1 || cookies[0].MaxAge >= 0 {
+		t.Error("flash must be cleared after reading")
+	}
+}
@@ -0,0 +1,147 @@
+package handlers_test
+
+import (
+	"forum/internal/handlers"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func setupBlocks(t *testing.T) (*notifyEnv, *handlers.UserHandler) {
+	e := setupNotifications(t)
+	return e, &handlers.UserHandler{DB: e.db, Templates: e.posts.Templates, Err: e.posts.Err}
+}
+
+func setBlock(t *testing.T, h *handlers.UserHandler, session string, form url.Values) *httptest.ResponseRecorder {
+	t.Helper()
+	w := httptest.NewRecorder()
+	h.Blocks(w, postForm("/settings/blocks", session, form))
+	return w
+}
+
+func TestBlocks_MutedHidden(t *testing.T) {
+	e, h := setupBlocks(t)
+	e.db.Exec(`INSERT INTO posts (id, user_id, title, content, created_at) VALUES (2, 2, 'Вброс', 'текст', datetime('now'))`)
+	e.comment(t, "s2", url.Values{"content": {"троллинг"}})
+	e.comment(t, "s4", url.Values{"content": {"по делу"}})
+
+	if w := setBlock(t, h, "s3", url.Values{"user": {"@FAN2"}, "kind": {"mute"}}); w.Code != http.StatusSeeOther {
+		t.Fatalf("mute: %d", w.Code)
+	}
+	if got := postTitles(t, e.db, handlers.PostFilter{UserID: 3}); got != "Финал" {
+		t.Errorf("muted author's posts must be hidden: %q", got)
+	}
+	if got := postTitles(t, e.db, handlers.PostFilter{UserID: 3, ShowMuted: true}); !strings.Contains(got, "Вброс") {
+		t.Errorf("show anyway must bring them back: %q", got)
+	}
+	if got := postTitles(t, e.db, handlers.PostFilter{UserID: 3, AuthorID: 2}); got != "Вброс" {
+		t.Errorf("author's own profile stays visible: %q", got)
+	}
+	if got := postTitles(t, e.db, handlers.PostFilter{UserID: 4}); !strings.Contains(got, "Вброс") {
+		t.Errorf("mute is personal: %q", got)
+	}
+
+	comments, err := handlers.GetCommentsByPostID(e.db, 1, 3)
+	if err != nil || len(comments) != 1 || comments[0].Author != "fan4" {
+		t.Fatalf("muted author's comments must be hidden: %+v %v", comments, err)
+	}
+	if comments, _ := handlers.GetCommentsByPostID(e.db, 1, 0); len(comments) != 2 {
+		t.Errorf("viewer 0 sees every comment, got %d", len(comments))
+	}
+
+	page := func(target string) string {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.AddCookie(&http.Cookie{Name: "session_id", Value: "s3"})
+		w := httptest.NewRecorder()
+		e.posts.GetPost(w, req)
+		return w.Body.String()
+	}
+	if body := page("/post/1"); strings.Contains(body, "троллинг") || !strings.Contains(body, "заблокированных: 1") {
+		t.Error("post page must hide the muted comment and say so")
+	}
+	if body := page("/post/1?muted=show"); !strings.Contains(body, "троллинг") {
+		t.Error("post page must show the muted comment on request")
+	}
+
+	setBlock(t, h, "s3", url.Values{"id": {"2"}, "kind": {""}})
+	if got := postTitles(t, e.db, handlers.PostFilter{UserID: 3}); !strings.Contains(got, "Вброс") {
+		t.Errorf("unmuted author must be visible again: %q", got)
+	}
+}
+
+func TestBlocks_NoReplies(t *testing.T) {
+	e, h := setupBlocks(t)
+	e.db.Exec(`INSERT INTO posts (id, user_id, title, content, created_at) VALUES (2, 3, 'Чужой пост', 'текст', datetime('now'))`)
+	e.db.Exec(`INSERT INTO comments (id, post_id, user_id, content, created_at) VALUES (1, 2, 1, 'мнение автора', datetime('now'))`)
+	comment := func(session string, form url.Values) int {
+		w := httptest.NewRecorder()
+		e.comments.AddComment(w, postForm("/post/comment", session, form))
+		return w.Code
+	}
+
+	// Заглушённый по-прежнему может отвечать
+	setBlock(t, h, "s1", url.Values{"id": {"2"}, "kind": {"mute"}})
+	if code := comment("s2", url.Values{"post_id": {"1"}, "content": {"ответ"}}); code != http.StatusSeeOther {
+		t.Errorf("muted user may comment: %d", code)
+	}
+
+	notified := len(e.texts(t, 1))
+
+	setBlock(t, h, "s1", url.Values{"id": {"2"}, "kind": {"block"}})
+	if code := comment("s2", url.Values{"post_id": {"1"}, "content": {"ответ"}}); code != http.StatusForbidden {
+		t.Errorf("blocked user must not comment on blocker's post: %d", code)
+	}
+	if code := comment("s2", url.Values{"post_id": {"2"}, "parent_id": {"1"}, "content": {"ответ"}}); code != http.StatusForbidden {
+		t.Errorf("blocked user must not reply to blocker's comment: %d", code)
+	}
+	if code := comment("s2", url.Values{"post_id": {"2"}, "content": {"привет, @author"}}); code != http.StatusSeeOther {
+		t.Fatalf("blocked user may still comment elsewhere: %d", code)
+	}
+	var mentions int
+	e.db.QueryRow(`SELECT COUNT(*) FROM mentions WHERE user_id = 1`).Scan(&mentions)
+	if mentions != 0 || len(e.texts(t, 1)) != notified {
+		t.Errorf("blocked user's mention must not reach the blocker: %d mentions, %v", mentions, e.texts(t, 1))
+	}
+	if code := comment("s3", url.Values{"post_id": {"2"}, "content": {"@author, смотри"}}); code != http.StatusSeeOther || len(e.texts(t, 1)) != notified+1 {
+		t.Errorf("others still mention the blocker: %d %v", code, e.texts(t, 1))
+	}
+}
+
+func TestBlocks_Settings(t *testing.T) {
+	e, h := setupBlocks(t)
+
+	if w := setBlock(t, h, "s1", url.Values{"id": {"1"}, "kind": {"block"}}); w.Code != http.StatusSeeOther || handlers.BlockKind(e.db, 1, 1) != "" {
+		t.Errorf("self-block must be refused: %d", w.Code)
+	}
+	if w := setBlock(t, h, "s1", url.Values{"user": {"nobody"}, "kind": {"mute"}}); w.Code != http.StatusSeeOther {
+		t.Errorf("unknown user: %d", w.Code)
+	}
+	if w := setBlock(t, h, "s1", url.Values{"id": {"2"}, "kind": {"ban"}}); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown kind: %d", w.Code)
+	}
+	setBlock(t, h, "s1", url.Values{"user": {"fan2"}, "kind": {"mute"}})
+	setBlock(t, h, "s1", url.Values{"user": {"fan3"}, "kind": {"mute"}})
+	setBlock(t, h, "s1", url.Values{"id": {"3"}, "kind": {"block"}})
+
+	req := httptest.NewRequest(http.MethodGet, "/settings/blocks", nil)
+	req.AddCookie(&http.Cookie{Name: "session_id", Value: "s1"})
+	w := httptest.NewRecorder()
+	h.Blocks(w, req)
+	body := w.Body.String()
+	if !strings.Contains(body, "fan2") || !strings.Contains(body, "fan3") || !strings.Contains(body, "заблокирован") {
+		t.Error("settings page must list muted and blocked users")
+	}
+	blocks, err := handlers.LoadBlocks(e.db, 1)
+	if err != nil || len(blocks) != 2 {
+		t.Fatal(blocks, err)
+	}
+	for _, b := range blocks {
+		if want := map[string]string{"fan2": "mute", "fan3": "block"}[b.Username]; b.Kind != want {
+			t.Errorf("%s: kind %q, want %q", b.Username, b.Kind, want)
+		}
+	}
+}
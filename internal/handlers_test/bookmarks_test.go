@@ -0,0 +1,165 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"forum/internal/handlers"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func setupBookmarks(t *testing.T) (*notifyEnv, *handlers.BookmarkHandler, *handlers.FilterHandler) {
+	e := setupNotifications(t)
+	e.db.Exec(`CREATE TABLE tags (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT UNIQUE, banned BOOLEAN NOT NULL DEFAULT FALSE, created_at DATETIME);`)
+	e.db.Exec(`CREATE TABLE post_tags (post_id INTEGER, tag_id INTEGER, PRIMARY KEY (post_id, tag_id));`)
+	e.db.Exec(`CREATE TABLE bookmark_folders (id INTEGER PRIMARY KEY AUTOINCREMENT, user_id INTEGER NOT NULL, name TEXT NOT NULL, created_at DATETIME NOT NULL, UNIQUE (user_id, name));`)
+	e.db.Exec(`CREATE TABLE bookmarks (user_id INTEGER NOT NULL, target_type TEXT NOT NULL, target_id INTEGER NOT NULL, post_id INTEGER NOT NULL, folder_id INTEGER, note TEXT NOT NULL DEFAULT '', created_at DATETIME NOT NULL, PRIMARY KEY (user_id, target_type, target_id));`)
+	e.db.Exec(`INSERT INTO posts (id, user_id, title, content, created_at) VALUES (2, 1, 'Полуфинал', 'текст', datetime('now'))`)
+	e.comment(t, "s2", url.Values{"content": {"Лучший матч сезона"}})
+
+	bookmarks := &handlers.BookmarkHandler{DB: e.db, Err: e.posts.Err}
+	filter := &handlers.FilterHandler{DB: e.db, Templates: e.posts.Templates, Err: e.posts.Err}
+	return e, bookmarks, filter
+}
+
+func bookmarkJSON(t *testing.T, h *handlers.BookmarkHandler, session string, form url.Values) (int, map[string]interface{}) {
+	t.Helper()
+	req := postForm("/bookmark", session, form)
+	req.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+	h.Bookmark(w, req)
+	var resp map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid JSON %q: %v", w.Body.String(), err)
+	}
+	return w.Code, resp
+}
+
+func TestBookmarks_SaveAndToggle(t *testing.T) {
+	e, h, _ := setupBookmarks(t)
+
+	code, resp := bookmarkJSON(t, h, "s3", url.Values{"type": {"post"}, "id": {"1"}, "action": {"toggle"}})
+	if code != http.StatusOK || resp["saved"] != true {
+		t.Fatalf("toggle must save: %d %v", code, resp)
+	}
+	code, resp = bookmarkJSON(t, h, "s3", url.Values{"type": {"comment"}, "id": {"1"}, "new_folder": {"Разборы"}, "note": {"перечитать"}})
+	if code != http.StatusOK || resp["folder"] != "Разборы" || resp["note"] != "перечитать" {
+		t.Fatalf("save with a new folder: %d %v", code, resp)
+	}
+	var postID int
+	e.db.QueryRow(`SELECT post_id FROM bookmarks WHERE target_type = 'comment' AND target_id = 1`).Scan(&postID)
+	if postID != 1 {
+		t.Errorf("comment bookmark must remember its post, got %d", postID)
+	}
+
+	if _, resp = bookmarkJSON(t, h, "s3", url.Values{"type": {"post"}, "id": {"1"}, "action": {"toggle"}}); resp["saved"] != false {
+		t.Errorf("second toggle must remove: %v", resp)
+	}
+	if code, _ = bookmarkJSON(t, h, "s3", url.Values{"type": {"post"}, "id": {"99"}}); code != http.StatusNotFound {
+		t.Errorf("missing post: %d", code)
+	}
+	if code, _ = bookmarkJSON(t, h, "s3", url.Values{"type": {"user"}, "id": {"1"}}); code != http.StatusBadRequest {
+		t.Errorf("unknown target type: %d", code)
+	}
+	if code, _ = bookmarkJSON(t, h, "s3", url.Values{"type": {"post"}, "id": {"1"}, "note": {strings.Repeat("я", 501)}}); code != http.StatusBadRequest {
+		t.Errorf("long note: %d", code)
+	}
+	if code, _ = bookmarkJSON(t, h, "", url.Values{"type": {"post"}, "id": {"1"}}); code != http.StatusUnauthorized {
+		t.Errorf("guest: %d", code)
+	}
+
+	// Чужую папку указать нельзя
+	folderID, err := handlers.CreateBookmarkFolder(e.db, 2, "Чужая")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code, _ = bookmarkJSON(t, h, "s3", url.Values{"type": {"post"}, "id": {"2"}, "folder": {strconv.Itoa(folderID)}}); code != http.StatusBadRequest {
+		t.Errorf("foreign folder: %d", code)
+	}
+}
+
+func TestBookmarks_Folders(t *testing.T) {
+	e, h, _ := setupBookmarks(t)
+	folder := func(form url.Values) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.Folder(w, postForm("/saved/folder", "s3", form))
+		return w
+	}
+
+	w := folder(url.Values{"action": {"create"}, "name": {"Тактика"}})
+	if w.Code != http.StatusSeeOther || !strings.HasPrefix(w.Header().Get("Location"), "/saved?folder=") {
+		t.Fatalf("create: %d %s", w.Code, w.Header().Get("Location"))
+	}
+	id := strings.TrimPrefix(w.Header().Get("Location"), "/saved?folder=")
+	folder(url.Values{"action": {"create"}, "name": {"Трансферы"}})
+	bookmarkJSON(t, h, "s3", url.Values{"type": {"post"}, "id": {"1"}, "folder": {id}})
+
+	folder(url.Values{"action": {"rename"}, "id": {id}, "name": {"Трансферы"}})
+	folders, _ := handlers.LoadBookmarkFolders(e.db, 3)
+	if len(folders) != 2 || folders[0].Name != "Тактика" || folders[0].Count != 1 {
+		t.Fatalf("rename to a taken name must fail: %+v", folders)
+	}
+	folder(url.Values{"action": {"rename"}, "id": {id}, "name": {"Схемы"}})
+	if b, _ := handlers.GetBookmark(e.db, 3, "post", 1); b == nil || b.Folder != "Схемы" {
+		t.Errorf("bookmark must follow the renamed folder: %+v", b)
+	}
+
+	w = httptest.NewRecorder()
+	h.Folder(w, postForm("/saved/folder", "s2", url.Values{"action": {"delete"}, "id": {id}}))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("deleting another user's folder: %d", w.Code)
+	}
+	folder(url.Values{"action": {"delete"}, "id": {id}})
+	b, _ := handlers.GetBookmark(e.db, 3, "post", 1)
+	if b == nil || b.FolderID != 0 {
+		t.Errorf("bookmark must survive its folder: %+v", b)
+	}
+}
+
+func TestBookmarks_SavedFilter(t *testing.T) {
+	e, h, filter := setupBookmarks(t)
+	folderID, _ := handlers.CreateBookmarkFolder(e.db, 3, "Финалы")
+	bookmarkJSON(t, h, "s3", url.Values{"type": {"post"}, "id": {"1"}, "folder": {strconv.Itoa(folderID)}})
+	bookmarkJSON(t, h, "s3", url.Values{"type": {"post"}, "id": {"2"}})
+	bookmarkJSON(t, h, "s2", url.Values{"type": {"post"}, "id": {"2"}})
+
+	if got := postTitles(t, e.db, handlers.PostFilter{UserID: 3, Saved: true}); got != "Полуфинал,Финал" && got != "Финал,Полуфинал" {
+		t.Errorf("saved posts: %s", got)
+	}
+	if got := postTitles(t, e.db, handlers.PostFilter{UserID: 3, Saved: true, Folder: folderID}); got != "Финал" {
+		t.Errorf("one folder: %s", got)
+	}
+	if got := postTitles(t, e.db, handlers.PostFilter{UserID: 2, Saved: true}); got != "Полуфинал" {
+		t.Errorf("bookmarks are private: %s", got)
+	}
+
+	page := func(session, target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if session != "" {
+			req.AddCookie(&http.Cookie{Name: "session_id", Value: session})
+		}
+		w := httptest.NewRecorder()
+		filter.SavedPage(w, req)
+		return w
+	}
+	if w := page("", "/saved"); w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/login" {
+		t.Errorf("guest must log in: %d", w.Code)
+	}
+	if w := page("s2", "/saved?folder="+strconv.Itoa(folderID)); w.Code != http.StatusNotFound {
+		t.Errorf("another user's folder: %d", w.Code)
+	}
+	bookmarkJSON(t, h, "s3", url.Values{"type": {"comment"}, "id": {"1"}, "note": {"цитата"}})
+	w := page("s3", "/saved")
+	body := w.Body.String()
+	if w.Code != http.StatusOK || !strings.Contains(body, "Полуфинал") || !strings.Contains(body, "Лучший матч сезона") || !strings.Contains(body, "цитата") {
+		t.Errorf("saved page: %d", w.Code)
+	}
+	if body := page("s3", "/saved?folder="+strconv.Itoa(folderID)).Body.String(); strings.Contains(body, "Полуфинал") || strings.Contains(body, "Лучший матч сезона") {
+		t.Error("folder page must show only its bookmarks")
+	}
+}
@@ -0,0 +1,137 @@
+package handlers_test
+
+import (
+	"database/sql"
+	"fmt"
+	"forum/internal/handlers"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func setupCategories(t *testing.T) (*sql.DB, *handlers.FilterHandler) {
+	db := setupTestDB(t)
+	t.Cleanup(func() { db.Close() })
+	db.Exec(`CREATE TABLE posts (id INTEGER PRIMARY KEY AUTOINCREMENT, user_id INTEGER, title TEXT, content TEXT, content_html TEXT NOT NULL DEFAULT '', created_at TIMESTAMP, likes INTEGER DEFAULT 0, dislikes INTEGER DEFAULT 0, reaction_counts TEXT NOT NULL DEFAULT '{}', comment_count INTEGER NOT NULL DEFAULT 0, last_activity_at DATETIME, locked BOOLEAN NOT NULL DEFAULT FALSE, pinned_at DATETIME, pinned_category_id INTEGER, archived_at DATETIME, unarchived_at DATETIME);`)
+	db.Exec(`CREATE TABLE categories (id INTEGER PRIMARY KEY, name TEXT, parent_id INTEGER, slug TEXT NOT NULL DEFAULT '', description TEXT NOT NULL DEFAULT '');`)
+	db.Exec(`CREATE TABLE post_categories (post_id INTEGER, category_id INTEGER);`)
+	db.Exec(`CREATE TABLE reactions (target_type TEXT, target_id INTEGER, user_id INTEGER, kind TEXT, created_at DATETIME DEFAULT CURRENT_TIMESTAMP);`)
+	db.Exec(`CREATE TABLE tags (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT UNIQUE, banned BOOLEAN NOT NULL DEFAULT FALSE);`)
+	db.Exec(`CREATE TABLE post_tags (post_id INTEGER, tag_id INTEGER);`)
+	db.Exec(`INSERT INTO users (id, email, username, password) VALUES (1, 'a@example.com', 'fan1', 'x')`)
+	db.Exec(`INSERT INTO categories (id, name, slug, description, parent_id) VALUES
+		(1, 'Футбол', 'football', 'Всё о футболе', NULL),
+		(2, 'Премьер-лига', 'premier-league', '', 1),
+		(3, 'Арсенал', 'arsenal', 'Канониры', 2),
+		(4, 'Бокс', 'boxing', '', NULL)`)
+	db.Exec(`INSERT INTO posts (id, user_id, title, content, created_at) VALUES
+		(1, 1, 'Сборная', 'x', '2025-01-01'),
+		(2, 1, 'Дерби', 'x', '2025-01-02'),
+		(3, 1, 'Трансфер', 'x', '2025-01-03'),
+		(4, 1, 'Бой года', 'x', '2025-01-04')`)
+	// Пост 3 отмечен и в Арсенале, и в Премьер-лиге — в счётчиках он один
+	db.Exec(`INSERT INTO post_categories (post_id, category_id) VALUES (1, 1), (2, 2), (3, 3), (3, 2), (4, 4)`)
+
+	tmpl := template.Must(template.New("").Funcs(handlers.TemplateFuncs()).ParseGlob("../../templates/*.html"))
+	return db, &handlers.FilterHandler{DB: db, Templates: tmpl, Err: &handlers.ErrorHandler{Templates: tmpl}}
+}
+
+func TestGetFilteredPosts_IncludesSubcategories(t *testing.T) {
+	db, _ := setupCategories(t)
+
+	tests := []struct {
+		categories []string
+		want       string
+	}{
+		{[]string{"1"}, "Трансфер,Дерби,Сборная"},
+		{[]string{"2"}, "Трансфер,Дерби"},
+		{[]string{"3"}, "Трансфер"},
+		{[]string{"3", "4"}, "Бой года,Трансфер"},
+	}
+	for _, tt := range tests {
+		if got := postTitles(t, db, handlers.PostFilter{Categories: tt.categories}); got != tt.want {
+			t.Errorf("categories %v: got %q, want %q", tt.categories, got, tt.want)
+		}
+	}
+}
+
+func TestGetFilteredPosts_WithinCategory(t *testing.T) {
+	db, _ := setupCategories(t)
+
+	tests := []struct {
+		within     int
+		categories []string
+		want       string
+	}{
+		{2, nil, "Трансфер,Дерби"},
+		{2, []string{"3"}, "Трансфер"},
+		// Выбранная категория вне страницы не расширяет выборку
+		{2, []string{"4"}, ""},
+		{2, []string{"1"}, "Трансфер,Дерби"},
+	}
+	for _, tt := range tests {
+		filter := handlers.PostFilter{Within: tt.within, Categories: tt.categories}
+		if got := postTitles(t, db, filter); got != tt.want {
+			t.Errorf("within %d, categories %v: got %q, want %q", tt.within, tt.categories, got, tt.want)
+		}
+	}
+}
+
+func TestLoadAllCategories_Tree(t *testing.T) {
+	db, _ := setupCategories(t)
+
+	categories := handlers.LoadAllCategories(db)
+	var got []string
+	for _, c := range categories {
+		got = append(got, fmt.Sprintf("%s%s:%d", strings.Repeat("-", c.Depth), c.Slug, c.Posts))
+	}
+	want := "football:3 -premier-league:2 --arsenal:1 boxing:1"
+	if strings.Join(got, " ") != want {
+		t.Errorf("got %q, want %q", strings.Join(got, " "), want)
+	}
+
+	tree := handlers.CategoryTree(categories, []string{"3"})
+	if len(tree) != 2 || len(tree[0].Children) != 1 || len(tree[0].Children[0].Children) != 1 {
+		t.Fatalf("unexpected tree shape")
+	}
+	if !tree[0].Active || !tree[0].Children[0].Active || tree[1].Active {
+		t.Error("selected category and its ancestors must be active")
+	}
+}
+
+func TestCategoryPage(t *testing.T) {
+	_, h := setupCategories(t)
+
+	w := httptest.NewRecorder()
+	h.CategoryPage(w, httptest.NewRequest(http.MethodGet, "/c/premier-league", nil))
+	body := w.Body.String()
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if !strings.Contains(body, "Дерби") || !strings.Contains(body, "Трансфер") || strings.Contains(body, "Сборная") {
+		t.Error("category page must list posts of the category and its subcategories only")
+	}
+	if !strings.Contains(body, `<a href="/c/football">Футбол</a>`) {
+		t.Error("breadcrumbs must link to the parent category")
+	}
+
+	w = httptest.NewRecorder()
+	h.CategoryPage(w, httptest.NewRequest(http.MethodGet, "/c/premier-league?category=4", nil))
+	if body := w.Body.String(); strings.Contains(body, "Бой года") || strings.Contains(body, "Дерби") {
+		t.Error("category filter on a category page must narrow the page, not widen it")
+	}
+
+	w = httptest.NewRecorder()
+	h.CategoryPage(w, httptest.NewRequest(http.MethodGet, "/c/Arsenal?q=x", nil))
+	if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "/c/arsenal?q=x" {
+		t.Errorf("expected redirect to lowercase slug, got %d %s", w.Code, w.Header().Get("Location"))
+	}
+
+	w = httptest.NewRecorder()
+	h.CategoryPage(w, httptest.NewRequest(http.MethodGet, "/c/curling", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", w.Code)
+	}
+}
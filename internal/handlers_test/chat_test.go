@@ -0,0 +1,232 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"forum/internal/chat"
+	"forum/internal/config"
+	"forum/internal/handlers"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+)
+
+func setupChat(t *testing.T, limit config.RateLimit) *httptest.Server {
+	db := setupTestDB(t)
+	t.Cleanup(func() { db.Close() })
+	// Подключения обслуживаются параллельно, а :memory: у каждого соединения свой
+	db.SetMaxOpenConns(1)
+	db.Exec(`ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'user'`)
+	db.Exec(`CREATE TABLE categories (id INTEGER PRIMARY KEY, name TEXT, parent_id INTEGER, slug TEXT NOT NULL DEFAULT '', description TEXT NOT NULL DEFAULT '');`)
+	db.Exec(`CREATE TABLE chat_messages (id INTEGER PRIMARY KEY AUTOINCREMENT, category_id INTEGER, user_id INTEGER, content TEXT, created_at DATETIME);`)
+	db.Exec(`CREATE TABLE chat_restrictions (category_id INTEGER, user_id INTEGER, kind TEXT, until DATETIME, moderator_id INTEGER, created_at DATETIME, PRIMARY KEY (category_id, user_id, kind));`)
+	db.Exec(`INSERT INTO users (id, email, username, password, role) VALUES
+		(1, 'a@example.com', 'alice', 'x', 'user'), (2, 'b@example.com', 'bob', 'x', 'user'), (3, 'm@example.com', 'mod', 'x', 'moderator')`)
+	db.Exec(`INSERT INTO sessions (id, user_id, expires_at) VALUES
+		('s1', 1, datetime('now', '+1 hour')), ('s2', 2, datetime('now', '+1 hour')), ('s3', 3, datetime('now', '+1 hour'))`)
+	db.Exec(`INSERT INTO categories (id, name, slug) VALUES (1, 'Футбол', 'football')`)
+
+	tmpl := template.Must(template.New("").Funcs(handlers.TemplateFuncs()).ParseGlob("../../templates/*.html"))
+	h := &handlers.ChatHandler{
+		DB:        db,
+		Templates: tmpl,
+		Err:       &handlers.ErrorHandler{Templates: tmpl},
+		Hub:       chat.NewHub(db),
+		Limit:     limit,
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/chat/", h.Room)
+	mux.HandleFunc("/ws/chat/", h.Socket)
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func dialChat(t *testing.T, server *httptest.Server, session string) (*websocket.Conn, *http.Response, error) {
+	header := http.Header{}
+	if session != "" {
+		header.Set("Cookie", "session_id="+session)
+	}
+	conn, resp, err := websocket.Dial(context.Background(), "ws"+strings.TrimPrefix(server.URL, "http")+"/ws/chat/football",
+		&websocket.DialOptions{HTTPHeader: header})
+	if err == nil {
+		t.Cleanup(func() { conn.CloseNow() })
+	}
+	return conn, resp, err
+}
+
+// chatExpect читает события до первого события типа typ
+func chatExpect(t *testing.T, conn *websocket.Conn, typ string) chat.Event {
+	t.Helper()
+	for {
+		_, data, err := chatRead(conn)
+		if err != nil {
+			t.Fatalf("waiting for %s: %v", typ, err)
+		}
+		var ev chat.Event
+		if err := json.Unmarshal(data, &ev); err != nil {
+			t.Fatal(err)
+		}
+		if ev.Type == typ {
+			return ev
+		}
+	}
+}
+
+// chatRead читает одно сообщение, ожидая не дольше двух секунд
+func chatRead(conn *websocket.Conn) (websocket.MessageType, []byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	return conn.Read(ctx)
+}
+
+func chatSend(t *testing.T, conn *websocket.Conn, cmd string) {
+	t.Helper()
+	if err := conn.Write(context.Background(), websocket.MessageText, []byte(cmd)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestChat_RoomPage(t *testing.T) {
+	server := setupChat(t, config.RateLimit{PerMinute: 60, Burst: 10})
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/chat/football", nil)
+	req.AddCookie(&http.Cookie{Name: "session_id", Value: "s3"})
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var body strings.Builder
+	buf := make([]byte, 4096)
+	for {
+		n, err := resp.Body.Read(buf)
+		body.Write(buf[:n])
+		if err != nil {
+			break
+		}
+	}
+	if resp.StatusCode != http.StatusOK || !strings.Contains(body.String(), `data-chat="football"`) || !strings.Contains(body.String(), "data-moderator") {
+		t.Errorf("unexpected room page %d", resp.StatusCode)
+	}
+
+	resp, _ = http.Get(server.URL + "/chat/nope")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", resp.StatusCode)
+	}
+}
+
+func TestChat_RequiresSession(t *testing.T) {
+	server := setupChat(t, config.RateLimit{PerMinute: 60, Burst: 10})
+	_, resp, err := dialChat(t, server, "")
+	if err == nil || resp == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("anonymous connection must be refused with 401, got %v", err)
+	}
+}
+
+func TestChat_RejectsOtherOrigin(t *testing.T) {
+	server := setupChat(t, config.RateLimit{PerMinute: 60, Burst: 10})
+	header := http.Header{}
+	header.Set("Cookie", "session_id=s1")
+	header.Set("Origin", "https://evil.example")
+	_, resp, err := websocket.Dial(context.Background(), "ws"+strings.TrimPrefix(server.URL, "http")+"/ws/chat/football",
+		&websocket.DialOptions{HTTPHeader: header})
+	if err == nil || resp == nil || resp.StatusCode != http.StatusForbidden {
+		t.Errorf("cross-origin connection must be refused with 403, got %v", err)
+	}
+}
+
+func TestChat_MessagesAndScrollback(t *testing.T) {
+	server := setupChat(t, config.RateLimit{PerMinute: 60, Burst: 10})
+	alice, _, err := dialChat(t, server, "s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	chatExpect(t, alice, "history")
+	bob, _, err := dialChat(t, server, "s2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ev := chatExpect(t, bob, "presence"); len(ev.Users) != 2 {
+		t.Errorf("expected both users present, got %+v", ev.Users)
+	}
+
+	chatSend(t, alice, `{"type":"message","text":"Гол на 90-й минуте!"}`)
+	ev := chatExpect(t, bob, "message")
+	if ev.Message.Author != "alice" || ev.Message.Text != "Гол на 90-й минуте!" {
+		t.Errorf("unexpected message %+v", ev.Message)
+	}
+
+	chatSend(t, bob, `{"type":"dance"}`)
+	if ev := chatExpect(t, bob, "error"); ev.Text != "Неизвестная команда" {
+		t.Errorf("unexpected error %q", ev.Text)
+	}
+
+	// Переподключение получает историю из базы
+	late, _, err := dialChat(t, server, "s3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ev := chatExpect(t, late, "history"); len(ev.Messages) != 1 || ev.Messages[0].Author != "alice" {
+		t.Errorf("unexpected history %+v", ev.Messages)
+	}
+}
+
+func TestChat_RateLimitPerConnection(t *testing.T) {
+	server := setupChat(t, config.RateLimit{PerMinute: 1, Burst: 2})
+	first, _, _ := dialChat(t, server, "s1")
+	second, _, _ := dialChat(t, server, "s1")
+
+	for i := 0; i < 2; i++ {
+		chatSend(t, first, `{"type":"message","text":"раз"}`)
+		chatExpect(t, first, "message")
+	}
+	chatSend(t, first, `{"type":"message","text":"три"}`)
+	if ev := chatExpect(t, first, "error"); !strings.Contains(ev.Text, "Слишком много сообщений") {
+		t.Errorf("expected rate limit error, got %q", ev.Text)
+	}
+	// У другой вкладки своя корзина
+	chatSend(t, second, `{"type":"message","text":"из второй вкладки"}`)
+	for {
+		ev := chatExpect(t, second, "message")
+		if ev.Message.Text == "из второй вкладки" {
+			break
+		}
+	}
+}
+
+func TestChat_ModeratorKick(t *testing.T) {
+	server := setupChat(t, config.RateLimit{PerMinute: 60, Burst: 10})
+	bob, _, _ := dialChat(t, server, "s2")
+	chatExpect(t, bob, "history")
+	mod, _, _ := dialChat(t, server, "s3")
+	chatExpect(t, mod, "history")
+
+	chatSend(t, bob, `{"type":"kick","user_id":3}`)
+	if ev := chatExpect(t, bob, "error"); ev.Text != "Действие доступно только модераторам" {
+		t.Errorf("unexpected error %q", ev.Text)
+	}
+
+	chatSend(t, mod, `{"type":"mute","user_id":2,"minutes":5}`)
+	chatExpect(t, bob, "muted")
+	chatSend(t, bob, `{"type":"message","text":"судью на мыло"}`)
+	if ev := chatExpect(t, bob, "error"); !strings.Contains(ev.Text, "запретил") {
+		t.Errorf("muted user must not post, got %q", ev.Text)
+	}
+
+	chatSend(t, mod, `{"type":"kick","user_id":2}`)
+	chatExpect(t, bob, "kicked")
+	_, _, err := chatRead(bob)
+	if websocket.CloseStatus(err) != 4001 {
+		t.Errorf("expected close 4001, got %v", err)
+	}
+	if _, resp, err := dialChat(t, server, "s2"); err == nil || resp.StatusCode != http.StatusForbidden {
+		t.Errorf("kicked user must not reconnect, got %v", err)
+	}
+}
@@ -16,21 +16,13 @@ func TestAddComment_Success(t *testing.T) {
 	db := setupTestDB(t)
 	defer db.Close()
 
-	db.Exec(`CREATE TABLE comments (id INTEGER PRIMARY KEY, post_id INTEGER, user_id INTEGER, content TEXT, created_at TIMESTAMP);`)
+	db.Exec(`CREATE TABLE comments (id INTEGER PRIMARY KEY, post_id INTEGER, user_id INTEGER, content TEXT, content_html TEXT NOT NULL DEFAULT '', parent_id INTEGER, created_at TIMESTAMP, likes INTEGER NOT NULL DEFAULT 0, dislikes INTEGER NOT NULL DEFAULT 0, reaction_counts TEXT NOT NULL DEFAULT '{}');`)
+	db.Exec(`CREATE TABLE posts (id INTEGER PRIMARY KEY, user_id INTEGER, title TEXT, content TEXT, created_at TIMESTAMP, likes INTEGER DEFAULT 0, dislikes INTEGER DEFAULT 0, reaction_counts TEXT NOT NULL DEFAULT '{}', comment_count INTEGER NOT NULL DEFAULT 0, last_activity_at DATETIME, locked BOOLEAN NOT NULL DEFAULT FALSE, pinned_at DATETIME, pinned_category_id INTEGER, archived_at DATETIME, unarchived_at DATETIME);`)
 	db.Exec(`INSERT INTO users (id, email, username, password) VALUES (1, 'user@example.com', 'user1', 'pass')`)
 	db.Exec(`INSERT INTO posts (id, user_id, title, content, created_at) VALUES (1, 1, 'Title', 'Body', datetime('now'))`)
 	db.Exec(`INSERT INTO sessions (id, user_id, expires_at) VALUES ('session123', 1, datetime('now', '+1 hour'))`)
 
-	tmpl := template.New("").Funcs(template.FuncMap{
-		"inSlice": func(slice []string, val string) bool {
-			for _, s := range slice {
-				if s == val {
-					return true
-				}
-			}
-			return false
-		},
-	})
+	tmpl := template.New("").Funcs(handlers.TemplateFuncs())
 	tmpl = template.Must(tmpl.ParseGlob("../../templates/*.html"))
 
 	handler := handlers.CommentHandler{DB: db, Templates: tmpl, Err: &handlers.ErrorHandler{Templates: tmpl}}
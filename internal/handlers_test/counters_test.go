@@ -0,0 +1,109 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"forum/internal/handlers"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func postCounters(t *testing.T, e *notifyEnv) (likes, dislikes, comments int, reactions string, activity time.Time) {
+	t.Helper()
+	err := e.db.QueryRow(`SELECT likes, dislikes, comment_count, reaction_counts, last_activity_at FROM posts WHERE id = 1`).
+		Scan(&likes, &dislikes, &comments, &reactions, &activity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+func sameJSON(got, want string) bool {
+	var a, b map[string]int
+	json.Unmarshal([]byte(got), &a)
+	json.Unmarshal([]byte(want), &b)
+	return reflect.DeepEqual(a, b)
+}
+
+func TestCounters_Reactions(t *testing.T) {
+	e := setupNotifications(t)
+	e.db.Exec(`UPDATE posts SET last_activity_at = created_at`)
+	react := func(session, typ, id, kind string) int {
+		w := httptest.NewRecorder()
+		e.likes.Like(w, postForm("/like", session, url.Values{"type": {typ}, "id": {id}, "action": {kind}}))
+		return w.Code
+	}
+
+	react("s2", "post", "1", "like")
+	react("s3", "post", "1", "like")
+	react("s4", "post", "1", "fire")
+	react("s3", "post", "1", "dislike") // смена вида
+	react("s4", "post", "1", "fire")    // снятие
+	likes, dislikes, _, reactions, _ := postCounters(t, e)
+	if likes != 1 || dislikes != 1 || !sameJSON(reactions, `{"like":1,"dislike":1,"fire":0}`) {
+		t.Errorf("post counters: %d %d %s", likes, dislikes, reactions)
+	}
+
+	e.comment(t, "s2", url.Values{"content": {"Отличный матч"}})
+	react("s3", "comment", "1", "laugh")
+	var commentCounts string
+	e.db.QueryRow(`SELECT reaction_counts FROM comments WHERE id = 1`).Scan(&commentCounts)
+	if !sameJSON(commentCounts, `{"laugh":1}`) {
+		t.Errorf("comment counters: %s", commentCounts)
+	}
+
+	// Реакция на несуществующий объект не сохраняется
+	if code := react("s2", "post", "42", "like"); code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", code)
+	}
+	var orphans int
+	e.db.QueryRow(`SELECT COUNT(*) FROM reactions WHERE target_id = 42`).Scan(&orphans)
+	if orphans != 0 {
+		t.Error("reaction to a missing post must be rolled back")
+	}
+
+	// Лента читает только счётчики поста
+	e.db.Exec(`DROP TABLE reactions`)
+	posts, err := handlers.GetFilteredPosts(e.db, handlers.PostFilter{})
+	if err != nil || len(posts) != 1 {
+		t.Fatal(posts, err)
+	}
+	if p := posts[0]; p.Likes != 1 || p.Dislikes != 1 || p.CommentCount != 1 || p.Reactions[0].Kind != "like" || p.Reactions[0].Count != 1 {
+		t.Errorf("feed counters: %+v", p)
+	}
+}
+
+func TestCounters_Comments(t *testing.T) {
+	e := setupNotifications(t)
+	e.db.Exec(`UPDATE posts SET created_at = '2024-05-01 10:00:00', last_activity_at = '2024-05-01 10:00:00'`)
+	e.db.Exec(`INSERT INTO posts (id, user_id, title, content, created_at, last_activity_at) VALUES (2, 1, 'Полуфинал', 'текст', '2024-05-02 10:00:00', '2024-05-02 10:00:00')`)
+
+	before := time.Now().Add(-time.Second)
+	e.comment(t, "s2", url.Values{"content": {"Первый"}})
+	e.comment(t, "s3", url.Values{"content": {"Второй"}})
+	_, _, comments, _, activity := postCounters(t, e)
+	if comments != 2 || activity.Before(before) {
+		t.Errorf("comment_count = %d, last_activity_at = %v", comments, activity)
+	}
+
+	// Свежий комментарий поднимает старый пост в «Обсуждаемых»
+	if got := postTitles(t, e.db, handlers.PostFilter{}); got != "Полуфинал,Финал" {
+		t.Errorf("newest: %q", got)
+	}
+	if got := postTitles(t, e.db, handlers.PostFilter{Sort: handlers.SortActive}); got != "Финал,Полуфинал" {
+		t.Errorf("active: %q", got)
+	}
+
+	w := httptest.NewRecorder()
+	e.comments.AddComment(w, postForm("/post/comment", "s2", url.Values{"post_id": {"42"}, "content": {"x"}}))
+	var stray int
+	e.db.QueryRow(`SELECT COUNT(*) FROM comments WHERE post_id = 42`).Scan(&stray)
+	if w.Code != http.StatusNotFound || stray != 0 {
+		t.Errorf("comment to a missing post: %d, stored %d", w.Code, stray)
+	}
+}
@@ -0,0 +1,113 @@
+package handlers_test
+
+import (
+	"forum/internal/handlers"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func setupCSRF(t *testing.T) (http.Handler, *bool) {
+	tmpl := template.New("").Funcs(handlers.TemplateFuncs())
+	tmpl = template.Must(tmpl.ParseGlob("../../templates/*.html"))
+
+	reached := false
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+		w.Write([]byte(handlers.CSRFToken(r)))
+	})
+	csrf := handlers.NewCSRF([]byte("test-key"), &handlers.ErrorHandler{Templates: tmpl})
+	return csrf.Middleware(next), &reached
+}
+
+func postWithToken(token string) *http.Request {
+	form := url.Values{}
+	form.Set("content", "hello")
+	if token != "" {
+		form.Set("csrf_token", token)
+	}
+	req := httptest.NewRequest(http.MethodPost, "http://example.com/post/comment", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(&http.Cookie{Name: "session_id", Value: "session123"})
+	return req
+}
+
+func TestCSRF_RejectsForgedPost(t *testing.T) {
+	handler, reached := setupCSRF(t)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, postWithToken(""))
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected 403, got %d", w.Code)
+	}
+	if *reached {
+		t.Error("forged request reached the handler")
+	}
+}
+
+func TestCSRF_AcceptsValidToken(t *testing.T) {
+	handler, reached := setupCSRF(t)
+
+	// Токен берём со страницы, отданной той же сессии
+	get := httptest.NewRequest(http.MethodGet, "http://example.com/post/1", nil)
+	get.AddCookie(&http.Cookie{Name: "session_id", Value: "session123"})
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, get)
+	token := w.Body.String()
+	if token == "" {
+		t.Fatal("token was not issued")
+	}
+
+	*reached = false
+	req := postWithToken(token)
+	req.Header.Set("Origin", "http://example.com")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK || !*reached {
+		t.Errorf("expected request to pass, got %d", w.Code)
+	}
+}
+
+func TestCSRF_RejectsForeignOrigin(t *testing.T) {
+	handler, reached := setupCSRF(t)
+
+	get := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+	get.AddCookie(&http.Cookie{Name: "session_id", Value: "session123"})
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, get)
+
+	*reached = false
+	req := postWithToken(w.Body.String())
+	req.Header.Set("Origin", "http://evil.example")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusForbidden || *reached {
+		t.Errorf("expected 403 for foreign origin, got %d", w.Code)
+	}
+}
+
+func TestLogout_GetDoesNotLogOut(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	db.Exec(`INSERT INTO sessions (id, user_id, expires_at) VALUES ('session123', 1, datetime('now', '+1 hour'))`)
+
+	handler := handlers.AuthHandler{DB: db}
+
+	req := httptest.NewRequest(http.MethodGet, "/logout", nil)
+	req.AddCookie(&http.Cookie{Name: "session_id", Value: "session123"})
+	w := httptest.NewRecorder()
+	handler.Logout(w, req)
+
+	var count int
+	db.QueryRow("SELECT COUNT(*) FROM sessions WHERE id = 'session123'").Scan(&count)
+	if count != 1 {
+		t.Error("GET /logout must not delete the session")
+	}
+}
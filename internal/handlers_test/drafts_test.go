@@ -0,0 +1,221 @@
+package handlers_test
+
+import (
+	"database/sql"
+	"encoding/json"
+	"forum/internal/handlers"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func setupDrafts(t *testing.T) (*sql.DB, *handlers.PostHandler, *handlers.FilterHandler) {
+	db, posts, filter := setupTags(t)
+	db.Exec(`CREATE TABLE drafts (id INTEGER PRIMARY KEY AUTOINCREMENT, user_id INTEGER NOT NULL, title TEXT NOT NULL DEFAULT '', content TEXT NOT NULL DEFAULT '', categories TEXT NOT NULL DEFAULT '[]', tags TEXT NOT NULL DEFAULT '', poll TEXT NOT NULL DEFAULT '{}', publish_at DATETIME, error TEXT NOT NULL DEFAULT '', created_at DATETIME NOT NULL, updated_at DATETIME NOT NULL);`)
+	db.Exec(`CREATE TABLE draft_attachments (id INTEGER PRIMARY KEY AUTOINCREMENT, draft_id INTEGER NOT NULL, user_id INTEGER NOT NULL, blob_key TEXT NOT NULL, thumb_key TEXT NOT NULL, mime TEXT NOT NULL, width INTEGER NOT NULL, height INTEGER NOT NULL, size INTEGER NOT NULL);`)
+	db.Exec(`CREATE TABLE attachments (id INTEGER PRIMARY KEY AUTOINCREMENT, post_id INTEGER NOT NULL, user_id INTEGER NOT NULL, blob_key TEXT NOT NULL, thumb_key TEXT NOT NULL, mime TEXT NOT NULL, width INTEGER NOT NULL, height INTEGER NOT NULL, size INTEGER NOT NULL, created_at DATETIME DEFAULT CURRENT_TIMESTAMP);`)
+	db.Exec(`CREATE TABLE held_content (id INTEGER PRIMARY KEY AUTOINCREMENT, target_type TEXT NOT NULL, user_id INTEGER NOT NULL, draft_id INTEGER, post_id INTEGER, parent_id INTEGER, content TEXT NOT NULL DEFAULT '', filter TEXT NOT NULL, reason TEXT NOT NULL DEFAULT '', score REAL NOT NULL DEFAULT 0, created_at DATETIME NOT NULL);`)
+	db.Exec(`INSERT INTO users (id, email, username, password) VALUES (2, 'b@example.com', 'fan2', 'x')`)
+	db.Exec(`INSERT INTO sessions (id, user_id, expires_at) VALUES ('s2', 2, datetime('now', '+1 hour'))`)
+	return db, posts, filter
+}
+
+func autosave(t *testing.T, h *handlers.PostHandler, session string, form url.Values) (int, map[string]interface{}) {
+	t.Helper()
+	req := postForm("/drafts/autosave", session, form)
+	req.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+	h.Autosave(w, req)
+	var resp map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid JSON %q: %v", w.Body.String(), err)
+	}
+	return w.Code, resp
+}
+
+func countRows(db *sql.DB, table string) int {
+	var n int
+	db.QueryRow(`SELECT COUNT(*) FROM ` + table).Scan(&n)
+	return n
+}
+
+func TestDrafts_SaveAndPublish(t *testing.T) {
+	db, h, _ := setupDrafts(t)
+
+	if _, resp := autosave(t, h, "s1", url.Values{"title": {" "}}); resp["id"] != float64(0) {
+		t.Errorf("empty form must not be saved: %v", resp)
+	}
+	code, resp := autosave(t, h, "s1", url.Values{"title": {"Разбор"}})
+	if code != http.StatusOK || resp["id"] != float64(1) {
+		t.Fatalf("autosave: %d %v", code, resp)
+	}
+	// Следующие сохранения обновляют тот же черновик, даже без категорий
+	autosave(t, h, "s1", url.Values{"draft_id": {"1"}, "title": {"Разбор матча"}, "content": {"черновик"}})
+	if code, _ := autosave(t, h, "s2", url.Values{"draft_id": {"1"}, "title": {"чужой"}}); code != http.StatusConflict {
+		t.Errorf("another user's draft: %d", code)
+	}
+	if n := countRows(db, "drafts"); n != 1 {
+		t.Fatalf("drafts = %d, want 1", n)
+	}
+	if n := countRows(db, "posts"); n != 0 {
+		t.Fatalf("draft must not become a post, posts = %d", n)
+	}
+
+	// Форма черновика открывается только у автора
+	req := httptest.NewRequest(http.MethodGet, "/create?draft=1", nil)
+	req.AddCookie(&http.Cookie{Name: "session_id", Value: "s1"})
+	w := httptest.NewRecorder()
+	h.CreatePost(w, req)
+	if !strings.Contains(w.Body.String(), "Разбор матча") || !strings.Contains(w.Body.String(), `name="draft_id" value="1"`) {
+		t.Error("create form must be filled from the draft")
+	}
+	req = httptest.NewRequest(http.MethodGet, "/create?draft=1", nil)
+	req.AddCookie(&http.Cookie{Name: "session_id", Value: "s2"})
+	w = httptest.NewRecorder()
+	h.CreatePost(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("another user's draft form: %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	h.CreatePost(w, postForm("/create", "s1", url.Values{"draft_id": {"1"}, "title": {"Разбор матча"}, "content": {"текст"}, "categories": {"1"}}))
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("publish draft: %d", w.Code)
+	}
+	if countRows(db, "posts") != 1 || countRows(db, "drafts") != 0 {
+		t.Error("published draft must turn into a post")
+	}
+	w = httptest.NewRecorder()
+	h.CreatePost(w, postForm("/create", "s1", url.Values{"draft_id": {"1"}, "title": {"Ещё раз"}, "content": {"текст"}, "categories": {"1"}}))
+	if w.Code != http.StatusNotFound || countRows(db, "posts") != 1 {
+		t.Errorf("draft must be published once: %d", w.Code)
+	}
+}
+
+func TestDrafts_Schedule(t *testing.T) {
+	db, h, _ := setupDrafts(t)
+	schedule := func(form url.Values) *httptest.ResponseRecorder {
+		form.Set("action", "schedule")
+		w := httptest.NewRecorder()
+		h.CreatePost(w, postForm("/create", "s1", form))
+		return w
+	}
+	at := time.Now().Add(2 * time.Hour).Truncate(time.Minute)
+
+	w := schedule(url.Values{"title": {"Анонс"}, "content": {"текст"}, "categories": {"1"}, "publish_at": {time.Now().Add(-time.Hour).Format("2006-01-02T15:04")}})
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Время публикации должно быть в будущем") {
+		t.Errorf("past time must be rejected: %d", w.Code)
+	}
+	w = schedule(url.Values{"title": {"Анонс"}, "content": {"текст"}, "publish_at": {at.Format("2006-01-02T15:04")}})
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Выберите хотя бы одну категорию") {
+		t.Errorf("scheduled post is checked right away: %d", w.Code)
+	}
+	w = schedule(url.Values{"title": {"Анонс"}, "content": {"текст"}, "categories": {"1"}, "tags": {"финал"}, "publish_at": {at.Format("2006-01-02T15:04")}})
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/drafts" {
+		t.Fatalf("schedule: %d", w.Code)
+	}
+	schedule(url.Values{"title": {"Запрещённое"}, "content": {"текст"}, "categories": {"2"}, "tags": {"слухи"}, "publish_at": {at.Format("2006-01-02T15:04")}})
+
+	if published, err := h.PublishDue(time.Now()); err != nil || published != 0 {
+		t.Fatalf("nothing is due yet: %d %v", published, err)
+	}
+	if got := postTitles(t, db, handlers.PostFilter{}); got != "" {
+		t.Errorf("scheduled posts must stay hidden: %q", got)
+	}
+
+	// Пока пост ждал, тег запретили: такой черновик остаётся у автора
+	db.Exec(`INSERT INTO tags (name, banned) VALUES ('слухи', TRUE)`)
+	published, err := h.PublishDue(at.Add(time.Minute))
+	if err != nil || published != 1 {
+		t.Fatalf("published = %d, %v", published, err)
+	}
+	if got := postTitles(t, db, handlers.PostFilter{Tags: []string{"финал"}, Categories: []string{"1"}}); got != "Анонс" {
+		t.Errorf("scheduled post must keep its tags and categories: %q", got)
+	}
+	drafts, err := handlers.LoadDrafts(db, 1)
+	if err != nil || len(drafts) != 1 {
+		t.Fatal(drafts, err)
+	}
+	if drafts[0].PublishAt != nil || !strings.Contains(drafts[0].Error, "запрещён") {
+		t.Errorf("invalid draft must be unscheduled with a reason: %+v", drafts[0])
+	}
+	if published, _ := h.PublishDue(at.Add(time.Hour)); published != 0 {
+		t.Error("unscheduled draft must not be retried")
+	}
+}
+
+// Сбой при создании одного поста не мешает публикации остальных
+func TestDrafts_PublishDueSkipsFailedDraft(t *testing.T) {
+	db, h, _ := setupDrafts(t)
+	at := time.Now().Add(2 * time.Hour).Truncate(time.Minute)
+	for _, title := range []string{"Сбой", "Анонс"} {
+		form := url.Values{"action": {"schedule"}, "title": {title}, "content": {"текст"}, "categories": {"1"}, "publish_at": {at.Format("2006-01-02T15:04")}}
+		h.CreatePost(httptest.NewRecorder(), postForm("/create", "s1", form))
+	}
+	db.Exec(`CREATE TRIGGER fail_post BEFORE INSERT ON posts WHEN NEW.title = 'Сбой' BEGIN SELECT RAISE(ABORT, 'сбой'); END`)
+
+	published, err := h.PublishDue(at.Add(time.Minute))
+	if err != nil || published != 1 {
+		t.Fatalf("published = %d, %v", published, err)
+	}
+	if got := postTitles(t, db, handlers.PostFilter{}); got != "Анонс" {
+		t.Errorf("posts = %q", got)
+	}
+	drafts, err := handlers.LoadDrafts(db, 1)
+	if err != nil || len(drafts) != 1 {
+		t.Fatal(drafts, err)
+	}
+	if drafts[0].Title != "Сбой" || drafts[0].PublishAt != nil || drafts[0].Error == "" {
+		t.Errorf("failed draft must be unscheduled with a reason: %+v", drafts[0])
+	}
+}
+
+func TestDrafts_ScheduleInClientTimeZone(t *testing.T) {
+	db, h, _ := setupDrafts(t)
+	at := time.Now().UTC().Add(48 * time.Hour).Truncate(time.Minute)
+	// Браузер в UTC+3 показывает это время на три часа позже
+	form := url.Values{"action": {"schedule"}, "title": {"Анонс"}, "content": {"текст"}, "categories": {"1"},
+		"publish_at": {at.Add(3 * time.Hour).Format("2006-01-02T15:04")}, "tz_offset": {"-180"}}
+	w := httptest.NewRecorder()
+	h.CreatePost(w, postForm("/create", "s1", form))
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("schedule: %d", w.Code)
+	}
+	drafts, err := handlers.LoadDrafts(db, 1)
+	if err != nil || len(drafts) != 1 || drafts[0].PublishAt == nil {
+		t.Fatal(drafts, err)
+	}
+	if !drafts[0].PublishAt.Equal(at) {
+		t.Errorf("publish_at = %v, want %v", drafts[0].PublishAt.UTC(), at)
+	}
+}
+
+func TestDrafts_Page(t *testing.T) {
+	_, h, _ := setupDrafts(t)
+	autosave(t, h, "s1", url.Values{"title": {"Мой черновик"}})
+	autosave(t, h, "s2", url.Values{"title": {"Чужой черновик"}})
+
+	req := httptest.NewRequest(http.MethodGet, "/drafts", nil)
+	req.AddCookie(&http.Cookie{Name: "session_id", Value: "s1"})
+	w := httptest.NewRecorder()
+	h.Drafts(w, req)
+	if body := w.Body.String(); !strings.Contains(body, "Мой черновик") || strings.Contains(body, "Чужой черновик") {
+		t.Error("drafts page must list only own drafts")
+	}
+
+	w = httptest.NewRecorder()
+	h.DeleteDraft(w, postForm("/drafts/delete", "s1", url.Values{"id": {"2"}}))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("deleting another user's draft: %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	h.DeleteDraft(w, postForm("/drafts/delete", "s1", url.Values{"id": {"1"}}))
+	if drafts, _ := handlers.LoadDrafts(h.DB, 1); w.Code != http.StatusSeeOther || len(drafts) != 0 {
+		t.Errorf("delete: %d, left %d", w.Code, len(drafts))
+	}
+}
@@ -14,22 +14,13 @@ func TestFilteredPosts_Empty(t *testing.T) {
 	db := setupTestDB(t)
 	defer db.Close()
 
-	db.Exec(`CREATE TABLE posts (id INTEGER PRIMARY KEY, user_id INTEGER, title TEXT, content TEXT, created_at TIMESTAMP);`)
-	db.Exec(`CREATE TABLE users (id INTEGER PRIMARY KEY, email TEXT, username TEXT, password TEXT);`)
-	db.Exec(`CREATE TABLE categories (id INTEGER PRIMARY KEY, name TEXT);`)
+	db.Exec(`CREATE TABLE posts (id INTEGER PRIMARY KEY, user_id INTEGER, title TEXT, content TEXT, created_at TIMESTAMP, likes INTEGER DEFAULT 0, dislikes INTEGER DEFAULT 0, reaction_counts TEXT NOT NULL DEFAULT '{}', comment_count INTEGER NOT NULL DEFAULT 0, last_activity_at DATETIME, locked BOOLEAN NOT NULL DEFAULT FALSE, pinned_at DATETIME, pinned_category_id INTEGER, archived_at DATETIME, unarchived_at DATETIME);`)
+	db.Exec(`CREATE TABLE users (id INTEGER PRIMARY KEY, email TEXT, username TEXT, password TEXT, reputation REAL NOT NULL DEFAULT 0, reputation_at DATETIME);`)
+	db.Exec(`CREATE TABLE categories (id INTEGER PRIMARY KEY, name TEXT, parent_id INTEGER, slug TEXT NOT NULL DEFAULT '', description TEXT NOT NULL DEFAULT '');`)
 	db.Exec(`CREATE TABLE post_categories (post_id INTEGER, category_id INTEGER);`)
-	db.Exec(`CREATE TABLE post_likes (post_id INTEGER, user_id INTEGER, is_like BOOLEAN);`)
-
-	tmpl := template.New("").Funcs(template.FuncMap{
-		"inSlice": func(slice []string, val string) bool {
-			for _, s := range slice {
-				if s == val {
-					return true
-				}
-			}
-			return false
-		},
-	})
+	db.Exec(`CREATE TABLE reactions (target_type TEXT, target_id INTEGER, user_id INTEGER, kind TEXT, created_at DATETIME DEFAULT CURRENT_TIMESTAMP);`)
+
+	tmpl := template.New("").Funcs(handlers.TemplateFuncs())
 	tmpl = template.Must(tmpl.ParseGlob("../../templates/*.html"))
 
 	handler := handlers.FilterHandler{DB: db, Templates: tmpl, Err: &handlers.ErrorHandler{Templates: tmpl}}
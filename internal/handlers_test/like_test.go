@@ -1,6 +1,7 @@
 package handlers_test
 
 import (
+	"encoding/json"
 	"forum/internal/handlers"
 	"html/template"
 	"net/http"
@@ -16,21 +17,13 @@ func TestLikePost_NewLike(t *testing.T) {
 	db := setupTestDB(t)
 	defer db.Close()
 
-	db.Exec(`CREATE TABLE post_likes (post_id INTEGER, user_id INTEGER, is_like BOOLEAN);`)
+	db.Exec(`CREATE TABLE reactions (target_type TEXT, target_id INTEGER, user_id INTEGER, kind TEXT, created_at DATETIME DEFAULT CURRENT_TIMESTAMP);`)
+	db.Exec(`CREATE TABLE posts (id INTEGER PRIMARY KEY, user_id INTEGER, title TEXT, content TEXT, created_at TIMESTAMP, likes INTEGER DEFAULT 0, dislikes INTEGER DEFAULT 0, reaction_counts TEXT NOT NULL DEFAULT '{}', comment_count INTEGER NOT NULL DEFAULT 0, last_activity_at DATETIME, locked BOOLEAN NOT NULL DEFAULT FALSE, pinned_at DATETIME, pinned_category_id INTEGER, archived_at DATETIME, unarchived_at DATETIME);`)
 	db.Exec(`INSERT INTO users (id, email, username, password) VALUES (1, 'user@example.com', 'user1', 'pass')`)
 	db.Exec(`INSERT INTO posts (id, user_id, title, content, created_at) VALUES (1, 1, 'Title', 'Body', datetime('now'))`)
 	db.Exec(`INSERT INTO sessions (id, user_id, expires_at) VALUES ('session123', 1, datetime('now', '+1 hour'))`)
 
-	tmpl := template.New("").Funcs(template.FuncMap{
-		"inSlice": func(slice []string, val string) bool {
-			for _, s := range slice {
-				if s == val {
-					return true
-				}
-			}
-			return false
-		},
-	})
+	tmpl := template.New("").Funcs(handlers.TemplateFuncs())
 	tmpl = template.Must(tmpl.ParseGlob("../../templates/*.html"))
 
 	handler := handlers.LikeHandler{DB: db, Err: &handlers.ErrorHandler{Templates: tmpl}}
@@ -51,3 +44,85 @@ func TestLikePost_NewLike(t *testing.T) {
 		t.Errorf("expected redirect, got %d", w.Code)
 	}
 }
+
+func setupLikes(t *testing.T) *handlers.LikeHandler {
+	db := setupTestDB(t)
+	t.Cleanup(func() { db.Close() })
+	db.Exec(`CREATE TABLE reactions (target_type TEXT, target_id INTEGER, user_id INTEGER, kind TEXT, created_at DATETIME DEFAULT CURRENT_TIMESTAMP);`)
+	db.Exec(`CREATE TABLE comments (id INTEGER PRIMARY KEY, post_id INTEGER, user_id INTEGER, content TEXT, likes INTEGER NOT NULL DEFAULT 0, dislikes INTEGER NOT NULL DEFAULT 0, reaction_counts TEXT NOT NULL DEFAULT '{}');`)
+	db.Exec(`CREATE TABLE posts (id INTEGER PRIMARY KEY, user_id INTEGER, title TEXT, content TEXT, created_at TIMESTAMP, likes INTEGER DEFAULT 0, dislikes INTEGER DEFAULT 0, reaction_counts TEXT NOT NULL DEFAULT '{}', comment_count INTEGER NOT NULL DEFAULT 0, last_activity_at DATETIME, locked BOOLEAN NOT NULL DEFAULT FALSE, pinned_at DATETIME, pinned_category_id INTEGER, archived_at DATETIME, unarchived_at DATETIME);`)
+	db.Exec(`INSERT INTO users (id, email, username, password) VALUES (1, 'user@example.com', 'user1', 'pass')`)
+	db.Exec(`INSERT INTO posts (id, user_id, title, content) VALUES (1, 1, 'Финал', 'текст')`)
+	db.Exec(`INSERT INTO comments (id, post_id, user_id, content) VALUES (5, 1, 1, 'Отличный матч')`)
+	db.Exec(`INSERT INTO sessions (id, user_id, expires_at) VALUES ('session123', 1, datetime('now', '+1 hour'))`)
+	tmpl := template.Must(template.New("").Funcs(handlers.TemplateFuncs()).ParseGlob("../../templates/*.html"))
+	return &handlers.LikeHandler{DB: db, Err: &handlers.ErrorHandler{Templates: tmpl}}
+}
+
+func likeJSON(t *testing.T, h *handlers.LikeHandler, session, action string) map[string]interface{} {
+	t.Helper()
+	req := postForm("/like", session, url.Values{"type": {"post"}, "id": {"1"}, "action": {action}})
+	req.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+	h.Like(w, req)
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("expected JSON, got %q (%d)", ct, w.Code)
+	}
+	var resp map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	resp["status"] = float64(w.Code)
+	return resp
+}
+
+func TestLike_JSON(t *testing.T) {
+	h := setupLikes(t)
+
+	steps := []struct {
+		action          string
+		likes, dislikes float64
+		reaction        string
+	}{
+		{"like", 1, 0, "like"},
+		{"dislike", 0, 1, "dislike"},
+		{"dislike", 0, 0, ""},
+	}
+	for _, step := range steps {
+		resp := likeJSON(t, h, "session123", step.action)
+		if resp["status"] != float64(http.StatusOK) || resp["type"] != "post" || resp["id"] != float64(1) ||
+			resp["likes"] != step.likes || resp["dislikes"] != step.dislikes || resp["reaction"] != step.reaction {
+			t.Errorf("%s: unexpected response %v", step.action, resp)
+		}
+	}
+
+	resp := likeJSON(t, h, "nope", "like")
+	if resp["status"] != float64(http.StatusUnauthorized) || resp["error"] == nil {
+		t.Errorf("expected JSON 401, got %v", resp)
+	}
+}
+
+func TestLike_RedirectBack(t *testing.T) {
+	h := setupLikes(t)
+	cases := []struct {
+		typ, id, referer, want string
+	}{
+		// Без Referer раньше получался редирект в никуда
+		{"post", "1", "", "/post/1"},
+		{"comment", "5", "", "/post/1#comment-5"},
+		{"post", "1", "http://example.com/?q=final&category=2", "/?q=final&category=2"},
+		{"comment", "5", "http://example.com/post/1", "/post/1#comment-5"},
+		{"post", "1", "https://evil.example/phish", "/post/1"},
+	}
+	for _, c := range cases {
+		req := postForm("/like", "session123", url.Values{"type": {c.typ}, "id": {c.id}, "action": {"like"}})
+		if c.referer != "" {
+			req.Header.Set("Referer", c.referer)
+		}
+		w := httptest.NewRecorder()
+		h.Like(w, req)
+		if w.Code != http.StatusSeeOther || w.Header().Get("Location") != c.want {
+			t.Errorf("%s %q: expected redirect to %s, got %d %s", c.typ, c.referer, c.want, w.Code, w.Header().Get("Location"))
+		}
+	}
+}
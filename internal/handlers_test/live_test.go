@@ -0,0 +1,142 @@
+package handlers_test
+
+import (
+	"bufio"
+	"context"
+	"forum/internal/handlers"
+	"forum/internal/live"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sseLines подключается к потоку и отдаёт строки по одной
+func sseLines(t *testing.T, rawURL, lastEventID string) <-chan string {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	lines := make(chan string, 64)
+	go func() {
+		defer resp.Body.Close()
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			select {
+			case lines <- scanner.Text():
+			case <-ctx.Done():
+				return
+			}
+		}
+		close(lines)
+	}()
+	return lines
+}
+
+// waitLine ждёт строку с префиксом prefix и возвращает её
+func waitLine(t *testing.T, lines <-chan string, prefix string) string {
+	t.Helper()
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				t.Fatalf("stream closed before %q", prefix)
+			}
+			if strings.HasPrefix(line, prefix) {
+				return line
+			}
+		case <-timeout:
+			t.Fatalf("no line %q", prefix)
+		}
+	}
+}
+
+func TestLive_PostStream(t *testing.T) {
+	env := setupNotifications(t)
+	hub := live.NewHub(64, 16)
+	env.comments.Live = hub
+	env.likes.Live = hub
+	liveHandler := &handlers.LiveHandler{DB: env.db, Hub: hub, Err: env.comments.Err, Heartbeat: 50 * time.Millisecond}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/events/post/", liveHandler.Post)
+	server := httptest.NewServer(mux)
+	// Cleanup, а не defer: сначала должны отключиться клиенты, иначе Close ждёт их вечно
+	t.Cleanup(server.Close)
+
+	lines := sseLines(t, server.URL+"/events/post/1", "")
+	waitLine(t, lines, "retry:")
+
+	env.comment(t, "s2", url.Values{"content": {"Привет, @author!"}})
+	id := waitLine(t, lines, "id: ")
+	waitLine(t, lines, "event: comment")
+	data := waitLine(t, lines, "data: ")
+	for _, want := range []string{`"author":"fan2"`, `"post_id":1`, `href=\"/u/author\"`} {
+		if !strings.Contains(data, want) {
+			t.Errorf("comment event %s must contain %s", data, want)
+		}
+	}
+
+	env.like("s3", "comment", "1")
+	waitLine(t, lines, "event: reaction")
+	if data := waitLine(t, lines, "data: "); !strings.Contains(data, `"type":"comment","id":1,"likes":1`) {
+		t.Errorf("unexpected reaction event %s", data)
+	}
+	waitLine(t, lines, ": ping")
+
+	// Переподключение с Last-Event-ID досылает пропущенную реакцию
+	replay := sseLines(t, server.URL+"/events/post/1", strings.TrimPrefix(id, "id: "))
+	waitLine(t, replay, "event: reaction")
+
+	// Несуществующий ID из прошлого запуска сервера — клиенту нужно перезагрузиться
+	reset := sseLines(t, server.URL+"/events/post/1", "1000")
+	waitLine(t, reset, "event: reset")
+}
+
+func TestLive_FeedReceivesNewPosts(t *testing.T) {
+	env := setupNotifications(t)
+	hub := live.NewHub(64, 16)
+	env.posts.Live = hub
+	liveHandler := &handlers.LiveHandler{DB: env.db, Hub: hub, Err: env.posts.Err}
+	server := httptest.NewServer(http.HandlerFunc(liveHandler.Feed))
+	t.Cleanup(server.Close)
+
+	lines := sseLines(t, server.URL, "")
+	waitLine(t, lines, "retry:")
+
+	w := httptest.NewRecorder()
+	env.posts.CreatePost(w, postForm("/create", "s1", url.Values{"title": {"Новый пост"}, "content": {"текст"}, "categories": {"2"}}))
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("expected redirect, got %d: %s", w.Code, w.Body.String())
+	}
+	waitLine(t, lines, "event: post")
+	data := waitLine(t, lines, "data: ")
+	for _, want := range []string{`"title":"Новый пост"`, `"author":"author"`, `"slug":"premier-league"`} {
+		if !strings.Contains(data, want) {
+			t.Errorf("post event %s must contain %s", data, want)
+		}
+	}
+}
+
+func TestLive_UnknownPost(t *testing.T) {
+	env := setupNotifications(t)
+	liveHandler := &handlers.LiveHandler{DB: env.db, Hub: live.NewHub(8, 8), Err: env.comments.Err}
+	w := httptest.NewRecorder()
+	liveHandler.Post(w, httptest.NewRequest(http.MethodGet, "/events/post/42", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", w.Code)
+	}
+}
@@ -0,0 +1,129 @@
+package handlers_test
+
+import (
+	"database/sql"
+	"forum/internal/handlers"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type fakeClock struct{ now time.Time }
+
+func (c *fakeClock) Now() time.Time          { return c.now }
+func (c *fakeClock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+func setupGuard(t *testing.T) (*sql.DB, handlers.AuthHandler, *fakeClock) {
+	db := setupTestDB(t)
+	db.Exec(`CREATE TABLE login_throttle (key TEXT PRIMARY KEY, failures INTEGER, last_failure_at DATETIME, locked_until DATETIME);`)
+	db.Exec(`CREATE TABLE login_failures (id INTEGER PRIMARY KEY, email TEXT, ip TEXT, user_id INTEGER, reason TEXT, created_at DATETIME);`)
+
+	hashed, _ := bcrypt.GenerateFromPassword([]byte("123456"), bcrypt.MinCost)
+	db.Exec(`INSERT INTO users (email, username, password) VALUES (?, ?, ?)`, "test@example.com", "testuser", string(hashed))
+
+	tmpl := template.New("").Funcs(handlers.TemplateFuncs())
+	tmpl = template.Must(tmpl.ParseGlob("../../templates/*.html"))
+
+	clock := &fakeClock{now: time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)}
+	guard := handlers.NewLoginGuard(db)
+	guard.Threshold = 3
+	guard.Now = clock.Now
+
+	handler := handlers.AuthHandler{DB: db, Templates: tmpl, Err: &handlers.ErrorHandler{Templates: tmpl}, Guard: guard}
+	return db, handler, clock
+}
+
+func login(handler handlers.AuthHandler, email, password string) *httptest.ResponseRecorder {
+	form := url.Values{}
+	form.Set("email", email)
+	form.Set("password", password)
+
+	req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	handler.Login(w, req)
+	return w
+}
+
+func TestLogin_UniformErrors(t *testing.T) {
+	db, handler, _ := setupGuard(t)
+	defer db.Close()
+
+	unknown := login(handler, "nobody@example.com", "123456").Body.String()
+	wrong := login(handler, "test@example.com", "wrong-password").Body.String()
+
+	for _, body := range []string{unknown, wrong} {
+		if !strings.Contains(body, "Неверный email или пароль") {
+			t.Error("expected uniform error message")
+		}
+		if strings.Contains(body, "Пользователь не найден") || strings.Contains(body, "Неверный пароль") {
+			t.Error("error message reveals whether the account exists")
+		}
+	}
+
+	var logged int
+	db.QueryRow("SELECT COUNT(*) FROM login_failures").Scan(&logged)
+	if logged != 2 {
+		t.Errorf("expected 2 audit records, got %d", logged)
+	}
+}
+
+func TestLogin_LockoutAfterFailures(t *testing.T) {
+	db, handler, clock := setupGuard(t)
+	defer db.Close()
+
+	for i := 0; i < 3; i++ {
+		login(handler, "test@example.com", "wrong-password")
+	}
+
+	// Даже верный пароль не принимается во время блокировки
+	w := login(handler, "test@example.com", "123456")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 while locked, got %d", w.Code)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("expected Retry-After header")
+	}
+
+	clock.Advance(2 * time.Minute)
+	w = login(handler, "test@example.com", "123456")
+	if w.Code != http.StatusSeeOther {
+		t.Errorf("expected login after lock expired, got %d", w.Code)
+	}
+}
+
+func TestLoginGuard_ExponentialBackoff(t *testing.T) {
+	db, handler, clock := setupGuard(t)
+	defer db.Close()
+	guard := handler.Guard
+
+	var previous time.Duration
+	for i := 0; i < 5; i++ {
+		guard.Fail("victim@example.com", "10.0.0.1", 0, "bad_password")
+		if i < 2 {
+			continue
+		}
+		remaining, _ := guard.Remaining("victim@example.com", "10.0.0.2")
+		if remaining <= previous {
+			t.Errorf("attempt %d: lock %v did not grow (previous %v)", i+1, remaining, previous)
+		}
+		previous = remaining
+	}
+
+	locked, err := guard.Locked()
+	if err != nil || len(locked) != 2 {
+		t.Errorf("expected account and IP locks, got %d (%v)", len(locked), err)
+	}
+
+	clock.Advance(time.Hour)
+	if remaining, _ := guard.Remaining("victim@example.com", "10.0.0.1"); remaining != 0 {
+		t.Errorf("lock should have expired, %v remaining", remaining)
+	}
+}
@@ -0,0 +1,182 @@
+package handlers_test
+
+import (
+	"bytes"
+	"database/sql"
+	"forum/internal/handlers"
+	"forum/internal/media"
+	"html/template"
+	"image"
+	"image/png"
+	"io/fs"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func setupUploads(t *testing.T) (*sql.DB, *handlers.PostHandler, *media.DiskStore) {
+	db := setupTestDB(t)
+	t.Cleanup(func() { db.Close() })
+	db.Exec(`CREATE TABLE posts (id INTEGER PRIMARY KEY AUTOINCREMENT, user_id INTEGER, title TEXT, content TEXT, content_html TEXT NOT NULL DEFAULT '', created_at TIMESTAMP, likes INTEGER DEFAULT 0, dislikes INTEGER DEFAULT 0, reaction_counts TEXT NOT NULL DEFAULT '{}', comment_count INTEGER NOT NULL DEFAULT 0, last_activity_at DATETIME, locked BOOLEAN NOT NULL DEFAULT FALSE, pinned_at DATETIME, pinned_category_id INTEGER, archived_at DATETIME, unarchived_at DATETIME);`)
+	db.Exec(`CREATE TABLE categories (id INTEGER PRIMARY KEY, name TEXT, parent_id INTEGER, slug TEXT NOT NULL DEFAULT '', description TEXT NOT NULL DEFAULT '');`)
+	db.Exec(`CREATE TABLE post_categories (post_id INTEGER, category_id INTEGER);`)
+	db.Exec(`CREATE TABLE attachments (id INTEGER PRIMARY KEY AUTOINCREMENT, post_id INTEGER, user_id INTEGER, blob_key TEXT, thumb_key TEXT, mime TEXT, width INTEGER, height INTEGER, size INTEGER, created_at TIMESTAMP);`)
+	db.Exec(`INSERT INTO users (id, email, username, password) VALUES (1, 'user@example.com', 'user1', 'pass')`)
+	db.Exec(`INSERT INTO sessions (id, user_id, expires_at) VALUES ('session123', 1, datetime('now', '+1 hour'))`)
+	db.Exec(`INSERT INTO categories (id, name) VALUES (1, 'Футбол')`)
+
+	store, err := media.NewDiskStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := template.Must(template.New("").Funcs(handlers.TemplateFuncs()).ParseGlob("../../templates/*.html"))
+	h := &handlers.PostHandler{
+		DB:        db,
+		Templates: tmpl,
+		Err:       &handlers.ErrorHandler{Templates: tmpl},
+		Store:     store,
+		Limits:    media.Limits{MaxBytes: 1 << 20, MaxWidth: 1000, MaxHeight: 1000, ThumbSize: 50},
+		MaxFiles:  2,
+	}
+	return db, h, store
+}
+
+func uploadRequest(t *testing.T, files map[string][]byte) *http.Request {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("title", "Счёт матча")
+	mw.WriteField("content", "Скриншот табло")
+	mw.WriteField("categories", "1")
+	for name, data := range files {
+		fw, _ := mw.CreateFormFile("images", name)
+		fw.Write(data)
+	}
+	mw.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/create", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.AddCookie(&http.Cookie{Name: "session_id", Value: "session123"})
+	return req
+}
+
+func TestCreatePost_WithImage(t *testing.T) {
+	db, h, store := setupUploads(t)
+
+	var img bytes.Buffer
+	png.Encode(&img, image.NewGray(image.Rect(0, 0, 200, 100)))
+
+	w := httptest.NewRecorder()
+	h.CreatePost(w, uploadRequest(t, map[string][]byte{"score.png": img.Bytes()}))
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("expected redirect, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var key, thumbKey, mime string
+	var width, height int
+	err := db.QueryRow(`SELECT blob_key, thumb_key, mime, width, height FROM attachments WHERE post_id = 1`).
+		Scan(&key, &thumbKey, &mime, &width, &height)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mime != "image/png" || width != 200 || height != 100 || key == thumbKey {
+		t.Errorf("unexpected attachment: %s %dx%d key=%s thumb=%s", mime, width, height, key, thumbKey)
+	}
+
+	// Отдача файла с долгим кэшем и поддержкой условных запросов
+	mh := &handlers.MediaHandler{Store: store}
+	w = httptest.NewRecorder()
+	mh.Serve(w, httptest.NewRequest(http.MethodGet, "/media/"+thumbKey, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "image/jpeg" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if cc := w.Header().Get("Cache-Control"); !strings.Contains(cc, "immutable") {
+		t.Errorf("Cache-Control = %q", cc)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/media/"+thumbKey, nil)
+	req.Header.Set("If-None-Match", w.Header().Get("ETag"))
+	w = httptest.NewRecorder()
+	mh.Serve(w, req)
+	if w.Code != http.StatusNotModified {
+		t.Errorf("expected 304, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	mh.Serve(w, httptest.NewRequest(http.MethodGet, "/media/../forum.db", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for invalid key, got %d", w.Code)
+	}
+}
+
+func TestCreatePost_RejectsNonImage(t *testing.T) {
+	db, h, _ := setupUploads(t)
+
+	w := httptest.NewRecorder()
+	h.CreatePost(w, uploadRequest(t, map[string][]byte{"photo.png": []byte("<script>alert(1)</script>")}))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "поддерживаются только изображения") {
+		t.Errorf("expected form with error, got %d", w.Code)
+	}
+
+	var posts int
+	db.QueryRow("SELECT COUNT(*) FROM posts").Scan(&posts)
+	if posts != 0 {
+		t.Error("post must not be created with invalid attachment")
+	}
+}
+
+func TestCreatePost_FailureLeavesNoFiles(t *testing.T) {
+	db, h, store := setupUploads(t)
+	db.Exec(`DROP TABLE attachments`)
+
+	var img bytes.Buffer
+	png.Encode(&img, image.NewGray(image.Rect(0, 0, 200, 100)))
+	w := httptest.NewRecorder()
+	h.CreatePost(w, uploadRequest(t, map[string][]byte{"score.png": img.Bytes()}))
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d", w.Code)
+	}
+
+	var files []string
+	filepath.WalkDir(store.Root, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if len(files) != 0 {
+		t.Errorf("failed post must not leave files in the store: %v", files)
+	}
+}
+
+func TestBodyLimiter(t *testing.T) {
+	limiter := &handlers.BodyLimiter{Limits: map[string]int64{"/create": 100}, Default: 10}
+	handler := limiter.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+
+	for _, tt := range []struct {
+		path string
+		size int
+		want int
+	}{
+		{"/create", 50, http.StatusOK},
+		{"/create", 150, http.StatusRequestEntityTooLarge},
+		{"/post/comment", 50, http.StatusRequestEntityTooLarge},
+	} {
+		req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader("a="+strings.Repeat("x", tt.size)))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("%s with %d bytes: got %d, want %d", tt.path, tt.size, w.Code, tt.want)
+		}
+	}
+}
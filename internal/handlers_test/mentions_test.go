@@ -0,0 +1,96 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"forum/internal/handlers"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestMentions_CommentLinksAndNotifies(t *testing.T) {
+	e := setupNotifications(t)
+
+	e.comment(t, "s2", url.Values{"content": {"@FAN3 смотри, и @author тоже. @ghost, `@fan4`, @fan2"}})
+
+	var html string
+	e.db.QueryRow(`SELECT content_html FROM comments WHERE id = 1`).Scan(&html)
+	if !strings.Contains(html, `<a href="/u/fan3">@FAN3</a>`) || !strings.Contains(html, `<a href="/u/author">@author</a>`) {
+		t.Errorf("mentions of existing users must link to profiles: %s", html)
+	}
+	if strings.Contains(html, "/u/ghost") || strings.Contains(html, "/u/fan4") {
+		t.Errorf("unknown users and code must stay text: %s", html)
+	}
+
+	var stored int
+	e.db.QueryRow(`SELECT COUNT(*) FROM mentions WHERE target_type = 'comment' AND target_id = 1`).Scan(&stored)
+	if stored != 2 {
+		t.Errorf("expected 2 stored mentions (self-mention skipped), got %d", stored)
+	}
+
+	if got := e.texts(t, 3); len(got) != 1 || got[0] != "fan2 упомянул вас в обсуждении «Финал»" {
+		t.Errorf("mentioned user: %q", got)
+	}
+	// Автора поста упомянули в комментарии к его посту — одно уведомление, об упоминании
+	if got := e.texts(t, 1); len(got) != 1 || got[0] != "fan2 упомянул вас в обсуждении «Финал»" {
+		t.Errorf("post author: %q", got)
+	}
+	if got := e.texts(t, 2); len(got) != 0 {
+		t.Errorf("self-mention must not notify: %q", got)
+	}
+}
+
+func TestMentions_PostAndProfile(t *testing.T) {
+	e := setupNotifications(t)
+
+	w := httptest.NewRecorder()
+	e.posts.CreatePost(w, postForm("/create", "s1", url.Values{"title": {"Разбор"}, "content": {"Спасибо @fan4 за идею"}, "categories": {"1"}}))
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("create post: got %d", w.Code)
+	}
+	if got := e.texts(t, 4); len(got) != 1 || got[0] != "author упомянул вас в обсуждении «Разбор»" {
+		t.Errorf("mentioned in post: %q", got)
+	}
+
+	filter := &handlers.FilterHandler{DB: e.db, Templates: e.posts.Templates, Err: e.posts.Err}
+	w = httptest.NewRecorder()
+	filter.UserPage(w, httptest.NewRequest(http.MethodGet, "/u/fan4?tab=mentions", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Разбор") || strings.Contains(w.Body.String(), "Финал") {
+		t.Errorf("mentions tab must list posts mentioning the user, got %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	filter.UserPage(w, httptest.NewRequest(http.MethodGet, "/u/author", nil))
+	if body := w.Body.String(); !strings.Contains(body, "Разбор") || !strings.Contains(body, "Финал") {
+		t.Error("profile must list the author's posts")
+	}
+	w = httptest.NewRecorder()
+	filter.UserPage(w, httptest.NewRequest(http.MethodGet, "/u/FAN4?tab=mentions", nil))
+	if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "/u/fan4?tab=mentions" {
+		t.Errorf("expected redirect to canonical name, got %d %s", w.Code, w.Header().Get("Location"))
+	}
+	w = httptest.NewRecorder()
+	filter.UserPage(w, httptest.NewRequest(http.MethodGet, "/u/ghost", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("unknown user: expected 404, got %d", w.Code)
+	}
+}
+
+func TestSuggestUsers(t *testing.T) {
+	e := setupNotifications(t)
+	h := &handlers.UserHandler{DB: e.db, Err: e.posts.Err}
+
+	w := httptest.NewRecorder()
+	h.Suggest(w, httptest.NewRequest(http.MethodGet, "/users/suggest?q=@FA", nil))
+	var names []string
+	if err := json.NewDecoder(w.Body).Decode(&names); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(names, ",") != "fan2,fan3,fan4" {
+		t.Errorf("suggestions: %v", names)
+	}
+	if names, _ := handlers.SuggestUsers(e.db, "%", 10); len(names) != 0 {
+		t.Errorf("LIKE wildcards must be escaped: %v", names)
+	}
+}
@@ -0,0 +1,199 @@
+package handlers_test
+
+import (
+	"forum/internal/handlers"
+	"forum/internal/live"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func setupMessages(t *testing.T) (*notifyEnv, *handlers.MessageHandler) {
+	e := setupNotifications(t)
+	e.db.Exec(`CREATE TABLE conversations (id INTEGER PRIMARY KEY AUTOINCREMENT, title TEXT NOT NULL DEFAULT '', is_group BOOLEAN NOT NULL DEFAULT FALSE, created_by INTEGER NOT NULL, created_at DATETIME NOT NULL, last_message_at DATETIME NOT NULL);`)
+	e.db.Exec(`CREATE TABLE conversation_members (conversation_id INTEGER NOT NULL, user_id INTEGER NOT NULL, last_read_id INTEGER NOT NULL DEFAULT 0, joined_at DATETIME NOT NULL, PRIMARY KEY (conversation_id, user_id));`)
+	e.db.Exec(`CREATE TABLE messages (id INTEGER PRIMARY KEY AUTOINCREMENT, conversation_id INTEGER NOT NULL, user_id INTEGER NOT NULL, content TEXT NOT NULL, created_at DATETIME NOT NULL);`)
+	return e, &handlers.MessageHandler{
+		DB: e.db, Templates: e.posts.Templates, Err: e.posts.Err,
+		MaxLength: 100, MaxMembers: 3,
+	}
+}
+
+func sendMessage(h *handlers.MessageHandler, path, session string, form url.Values) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := postForm(path, session, form)
+	if path == "/messages/new" {
+		h.New(w, req)
+	} else {
+		h.Send(w, req)
+	}
+	return w
+}
+
+func openConversation(h *handlers.MessageHandler, target, session string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	req.AddCookie(&http.Cookie{Name: "session_id", Value: session})
+	w := httptest.NewRecorder()
+	h.Conversation(w, req)
+	return w
+}
+
+func unreadIn(t *testing.T, h *handlers.MessageHandler, userID int) map[int]int {
+	t.Helper()
+	conversations, err := handlers.LoadConversations(h.DB, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unread := map[int]int{}
+	for _, c := range conversations {
+		unread[c.ID] = c.Unread
+	}
+	return unread
+}
+
+func TestMessages_DirectUnreadAndReceipts(t *testing.T) {
+	_, h := setupMessages(t)
+	hub := live.NewHub(16, 16)
+	h.Live = hub
+	sub, _, _ := hub.Subscribe(0, "user:2")
+	defer sub.Close()
+
+	w := sendMessage(h, "/messages/new", "s1", url.Values{"to": {"@FAN2"}, "content": {"привет"}})
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/messages/1" {
+		t.Fatalf("new conversation: %d %s", w.Code, w.Header().Get("Location"))
+	}
+	// Второе сообщение тому же человеку продолжает диалог
+	w = sendMessage(h, "/messages/new", "s1", url.Values{"to": {"fan2"}, "content": {"как дела?"}})
+	if w.Header().Get("Location") != "/messages/1" {
+		t.Errorf("direct conversation must be reused: %s", w.Header().Get("Location"))
+	}
+	if got := unreadIn(t, h, 2)[1]; got != 2 {
+		t.Errorf("recipient must have 2 unread, got %d", got)
+	}
+	if got := unreadIn(t, h, 1)[1]; got != 0 {
+		t.Errorf("own messages are never unread, got %d", got)
+	}
+	select {
+	case ev := <-sub.C:
+		if ev.Type != "message" || !strings.Contains(string(ev.Data), `"content":"привет"`) {
+			t.Errorf("unexpected event %s %s", ev.Type, ev.Data)
+		}
+	default:
+		t.Error("recipient must get the message live")
+	}
+
+	if body := openConversation(h, "/messages/1", "s1").Body.String(); strings.Contains(body, "прочитано") {
+		t.Error("unread messages must not show a read receipt")
+	}
+	if body := openConversation(h, "/messages/1", "s2").Body.String(); !strings.Contains(body, "как дела?") {
+		t.Error("recipient must see the messages")
+	}
+	if got := unreadIn(t, h, 2)[1]; got != 0 {
+		t.Errorf("opening the conversation must mark it read, got %d", got)
+	}
+	if body := openConversation(h, "/messages/1", "s1").Body.String(); !strings.Contains(body, "прочитано") {
+		t.Error("sender must see the read receipt")
+	}
+
+	w = sendMessage(h, "/messages/send", "s2", url.Values{"conversation_id": {"1"}, "content": {strings.Repeat("а", 101)}})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("too long message: %d", w.Code)
+	}
+	if w = sendMessage(h, "/messages/send", "s3", url.Values{"conversation_id": {"1"}, "content": {"можно к вам?"}}); w.Code != http.StatusNotFound {
+		t.Errorf("non-member must not write: %d", w.Code)
+	}
+	if w = openConversation(h, "/messages/1", "s3"); w.Code != http.StatusNotFound {
+		t.Errorf("non-member must not read: %d", w.Code)
+	}
+}
+
+func TestMessages_Group(t *testing.T) {
+	e, h := setupMessages(t)
+
+	w := sendMessage(h, "/messages/new", "s1", url.Values{"to": {"fan2, fan3 fan4"}, "content": {"всем привет"}})
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "не больше 3") {
+		t.Errorf("group over the limit must be refused: %d", w.Code)
+	}
+	w = sendMessage(h, "/messages/new", "s1", url.Values{"to": {"fan2 nobody"}, "content": {"всем привет"}})
+	if !strings.Contains(w.Body.String(), "nobody") {
+		t.Error("unknown recipient must be reported")
+	}
+	if countRows(e.db, "conversations") != 0 {
+		t.Fatal("refused conversations must not be created")
+	}
+
+	w = sendMessage(h, "/messages/new", "s1", url.Values{"to": {"fan2, fan3"}, "content": {"всем привет"}})
+	if w.Header().Get("Location") != "/messages/1" {
+		t.Fatalf("group: %d %s", w.Code, w.Header().Get("Location"))
+	}
+	req := httptest.NewRequest(http.MethodPost, "/messages/send", strings.NewReader(url.Values{"conversation_id": {"1"}, "content": {"привет!"}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.AddCookie(&http.Cookie{Name: "session_id", Value: "s2"})
+	w = httptest.NewRecorder()
+	h.Send(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"id":2`) {
+		t.Errorf("send from script.js: %d %s", w.Code, w.Body.String())
+	}
+	if got := unreadIn(t, h, 3)[1]; got != 2 {
+		t.Errorf("group member must have 2 unread, got %d", got)
+	}
+
+	// Личный диалог с тем же человеком — отдельная переписка
+	sendMessage(h, "/messages/new", "s1", url.Values{"to": {"fan2"}, "content": {"лично"}})
+	if countRows(e.db, "conversations") != 2 {
+		t.Error("a group must not be reused as a direct conversation")
+	}
+
+	leave := func(session, id string) int {
+		w := httptest.NewRecorder()
+		h.Leave(w, postForm("/messages/leave", session, url.Values{"conversation_id": {id}}))
+		return w.Code
+	}
+	if code := leave("s3", "1"); code != http.StatusSeeOther {
+		t.Errorf("leave group: %d", code)
+	}
+	if _, ok := unreadIn(t, h, 3)[1]; ok {
+		t.Error("left group must disappear from the inbox")
+	}
+	if code := leave("s2", "2"); code != http.StatusNotFound {
+		t.Errorf("direct conversation cannot be left: %d", code)
+	}
+}
+
+func TestMessages_Blocks(t *testing.T) {
+	e, h := setupMessages(t)
+	users := &handlers.UserHandler{DB: e.db, Templates: e.posts.Templates, Err: e.posts.Err}
+
+	sendMessage(h, "/messages/new", "s2", url.Values{"to": {"author"}, "content": {"привет"}})
+	sendMessage(h, "/messages/new", "s2", url.Values{"to": {"author fan3"}, "content": {"группа"}})
+	setBlock(t, users, "s1", url.Values{"user": {"fan2"}, "kind": {"block"}})
+
+	if w := sendMessage(h, "/messages/new", "s2", url.Values{"to": {"author"}, "content": {"ответь"}}); !strings.Contains(w.Body.String(), "author ограничил") {
+		t.Error("blocked user must not start a conversation with the blocker")
+	}
+	if w := sendMessage(h, "/messages/send", "s2", url.Values{"conversation_id": {"1"}, "content": {"ответь"}}); w.Code != http.StatusForbidden {
+		t.Errorf("blocked user must not write to the blocker: %d", w.Code)
+	}
+	if w := sendMessage(h, "/messages/send", "s1", url.Values{"conversation_id": {"1"}, "content": {"пока"}}); w.Code != http.StatusSeeOther {
+		t.Errorf("blocker may still write: %d", w.Code)
+	}
+
+	// В группе заблокированный пишет, но заблокировавший этого не видит
+	if w := sendMessage(h, "/messages/send", "s2", url.Values{"conversation_id": {"2"}, "content": {"я тут"}}); w.Code != http.StatusSeeOther {
+		t.Fatalf("group message: %d", w.Code)
+	}
+	if got := unreadIn(t, h, 1)[2]; got != 0 {
+		t.Errorf("blocked sender's messages are not unread for the blocker, got %d", got)
+	}
+	if got := unreadIn(t, h, 3)[2]; got != 2 {
+		t.Errorf("other members see them, got %d", got)
+	}
+	if messages, _ := handlers.LoadMessages(e.db, 2, 1, 0, 10); len(messages) != 0 {
+		t.Errorf("blocker must not see the blocked sender's messages: %+v", messages)
+	}
+}
@@ -0,0 +1,181 @@
+package handlers_test
+
+import (
+	"forum/internal/handlers"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func setupModeration(t *testing.T) (*notifyEnv, *handlers.AdminHandler) {
+	e := setupNotifications(t)
+	e.db.Exec(`ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'user'`)
+	e.db.Exec(`UPDATE users SET role = 'moderator' WHERE id = 4`)
+	e.db.Exec(`CREATE TABLE moderation_log (id INTEGER PRIMARY KEY AUTOINCREMENT, moderator_id INTEGER NOT NULL, action TEXT NOT NULL, target_type TEXT NOT NULL, target_id INTEGER NOT NULL, details TEXT NOT NULL DEFAULT '', reason TEXT NOT NULL DEFAULT '', created_at DATETIME NOT NULL);`)
+	e.db.Exec(`INSERT INTO post_categories (post_id, category_id) VALUES (1, 1)`)
+	return e, &handlers.AdminHandler{DB: e.db, Templates: e.posts.Templates, Err: e.posts.Err}
+}
+
+func moderate(h *handlers.AdminHandler, session string, form url.Values) *httptest.ResponseRecorder {
+	form.Set("post_id", "1")
+	w := httptest.NewRecorder()
+	h.ModeratePost(w, postForm("/post/moderate", session, form))
+	return w
+}
+
+func tryComment(e *notifyEnv, session string) int {
+	w := httptest.NewRecorder()
+	e.comments.AddComment(w, postForm("/post/comment", session, url.Values{"post_id": {"1"}, "content": {"мнение"}}))
+	return w.Code
+}
+
+func TestModeration_Lock(t *testing.T) {
+	e, h := setupModeration(t)
+
+	if w := moderate(h, "s2", url.Values{"action": {"lock"}}); w.Code != http.StatusForbidden {
+		t.Fatalf("regular user must not moderate: %d", w.Code)
+	}
+	if w := moderate(h, "s4", url.Values{"action": {"lock"}, "reason": {"флуд"}}); w.Code != http.StatusSeeOther {
+		t.Fatalf("lock: %d", w.Code)
+	}
+	if code := tryComment(e, "s2"); code != http.StatusForbidden {
+		t.Errorf("locked thread must reject comments: %d", code)
+	}
+	if code := tryComment(e, "s4"); code != http.StatusSeeOther {
+		t.Errorf("moderator may still comment in a locked thread: %d", code)
+	}
+
+	// Страница поста прячет форму комментария, но не от модератора
+	page := func(session string) string {
+		req := httptest.NewRequest(http.MethodGet, "/post/1", nil)
+		req.AddCookie(&http.Cookie{Name: "session_id", Value: session})
+		w := httptest.NewRecorder()
+		e.posts.GetPost(w, req)
+		return w.Body.String()
+	}
+	if body := page("s2"); strings.Contains(body, `id="comment-form"`) || !strings.Contains(body, "Обсуждение закрыто") {
+		t.Error("locked thread must hide the comment form")
+	}
+	if body := page("s4"); !strings.Contains(body, `id="comment-form"`) || !strings.Contains(body, `action="/post/moderate"`) {
+		t.Error("moderator must see the comment form and moderation panel")
+	}
+
+	moderate(h, "s4", url.Values{"action": {"unlock"}})
+	if code := tryComment(e, "s2"); code != http.StatusSeeOther {
+		t.Errorf("unlocked thread must accept comments: %d", code)
+	}
+}
+
+func TestModeration_Archive(t *testing.T) {
+	e, h := setupModeration(t)
+	e.comment(t, "s2", url.Values{"content": {"до архива"}})
+
+	moderate(h, "s4", url.Values{"action": {"archive"}})
+	if code := tryComment(e, "s4"); code != http.StatusForbidden {
+		t.Errorf("archived thread must reject comments even from moderators: %d", code)
+	}
+	for _, target := range []url.Values{
+		{"type": {"post"}, "id": {"1"}, "action": {"like"}},
+		{"type": {"comment"}, "id": {"1"}, "action": {"like"}},
+	} {
+		w := httptest.NewRecorder()
+		e.likes.Like(w, postForm("/like", "s3", target))
+		if w.Code != http.StatusForbidden {
+			t.Errorf("archived %s must reject reactions: %d", target.Get("type"), w.Code)
+		}
+	}
+
+	moderate(h, "s4", url.Values{"action": {"unarchive"}})
+	if code := tryComment(e, "s3"); code != http.StatusSeeOther {
+		t.Errorf("unarchived thread must accept comments: %d", code)
+	}
+}
+
+func TestModeration_Log(t *testing.T) {
+	e, h := setupModeration(t)
+	if w := moderate(h, "s4", url.Values{"action": {"pin"}, "category": {"2"}}); w.Code != http.StatusBadRequest {
+		t.Errorf("post can be pinned only in its own category: %d", w.Code)
+	}
+	moderate(h, "s4", url.Values{"action": {"pin"}, "category": {"1"}, "reason": {"важно"}})
+	moderate(h, "s4", url.Values{"action": {"lock"}})
+	if w := moderate(h, "s4", url.Values{"action": {"delete"}}); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown action: %d", w.Code)
+	}
+
+	entries, err := handlers.LoadModerationLog(e.db, 1, 10)
+	if err != nil || len(entries) != 2 {
+		t.Fatal(entries, err)
+	}
+	if got := entries[1]; got.Moderator != "fan4" || got.Text != "закрепил пост" || got.Details != "в категории «Футбол»" ||
+		got.Reason != "важно" || got.TargetTitle != "Финал" {
+		t.Errorf("unexpected entry: %+v", got)
+	}
+	if entries[0].Action != "lock" {
+		t.Errorf("newest entries come first: %+v", entries[0])
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/log", nil)
+	req.AddCookie(&http.Cookie{Name: "session_id", Value: "s2"})
+	w := httptest.NewRecorder()
+	h.ModerationLog(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("log is for moderators only: %d", w.Code)
+	}
+}
+
+func TestModeration_PinnedFirst(t *testing.T) {
+	db, _, _ := setupTags(t)
+	now := time.Now().UTC()
+	db.Exec(`INSERT INTO posts (id, user_id, title, content, created_at) VALUES
+		(1, 1, 'Правила', 'текст', ?), (2, 1, 'Анонс', 'текст', ?), (3, 1, 'Свежее', 'текст', ?)`,
+		now.Add(-3*time.Hour), now.Add(-2*time.Hour), now.Add(-time.Hour))
+	db.Exec(`INSERT INTO post_categories (post_id, category_id) VALUES (1, 1), (2, 2), (3, 2)`)
+	db.Exec(`UPDATE posts SET pinned_at = ? WHERE id = 1`, now)
+	db.Exec(`UPDATE posts SET pinned_at = ?, pinned_category_id = 2 WHERE id = 2`, now.Add(-time.Minute))
+
+	tests := []struct {
+		filter handlers.PostFilter
+		want   string
+	}{
+		{handlers.PostFilter{}, "Правила,Свежее,Анонс"},
+		{handlers.PostFilter{Categories: []string{"2"}}, "Анонс,Свежее"},
+		{handlers.PostFilter{Categories: []string{"1", "2"}}, "Правила,Анонс,Свежее"},
+		// В поиске закрепление не влияет на порядок
+		{handlers.PostFilter{Query: "текст"}, "Свежее,Анонс,Правила"},
+	}
+	for _, tt := range tests {
+		if got := postTitles(t, db, tt.filter); got != tt.want {
+			t.Errorf("%+v: got %q, want %q", tt.filter, got, tt.want)
+		}
+	}
+}
+
+func TestArchiver(t *testing.T) {
+	db, _, _ := setupTags(t)
+	now := time.Now().UTC()
+	old := now.Add(-200 * 24 * time.Hour)
+	db.Exec(`INSERT INTO posts (id, user_id, title, content, created_at, last_activity_at) VALUES
+		(1, 1, 'Старый', 'текст', ?, ?), (2, 1, 'Живой', 'текст', ?, ?), (3, 1, 'Закреплённый', 'текст', ?, ?),
+		(4, 1, 'Возвращённый', 'текст', ?, ?)`,
+		old, old, old, now.Add(-time.Hour), old, old, old, old)
+	db.Exec(`UPDATE posts SET pinned_at = ? WHERE id = 3`, old)
+	db.Exec(`UPDATE posts SET unarchived_at = ? WHERE id = 4`, now.Add(-24*time.Hour))
+
+	a := &handlers.Archiver{DB: db, After: 180 * 24 * time.Hour, Now: func() time.Time { return now }}
+	if n, err := a.RunOnce(); err != nil || n != 1 {
+		t.Fatalf("archived = %d, %v", n, err)
+	}
+	var archived string
+	db.QueryRow(`SELECT group_concat(title) FROM posts WHERE archived_at IS NOT NULL`).Scan(&archived)
+	if archived != "Старый" {
+		t.Errorf("archived %q, want only the inactive unpinned post", archived)
+	}
+	if n, _ := a.RunOnce(); n != 0 {
+		t.Errorf("second run archived %d more", n)
+	}
+}
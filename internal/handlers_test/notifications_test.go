@@ -0,0 +1,269 @@
+package handlers_test
+
+import (
+	"database/sql"
+	"forum/internal/digest"
+	"forum/internal/handlers"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+type notifyEnv struct {
+	db       *sql.DB
+	notifier *handlers.Notifier
+	comments *handlers.CommentHandler
+	likes    *handlers.LikeHandler
+	posts    *handlers.PostHandler
+	pages    *handlers.NotificationHandler
+}
+
+func setupNotifications(t *testing.T) *notifyEnv {
+	db := setupTestDB(t)
+	t.Cleanup(func() { db.Close() })
+	db.Exec(`CREATE TABLE posts (id INTEGER PRIMARY KEY AUTOINCREMENT, user_id INTEGER, title TEXT, content TEXT, content_html TEXT NOT NULL DEFAULT '', created_at TIMESTAMP, likes INTEGER DEFAULT 0, dislikes INTEGER DEFAULT 0, reaction_counts TEXT NOT NULL DEFAULT '{}', comment_count INTEGER NOT NULL DEFAULT 0, last_activity_at DATETIME, locked BOOLEAN NOT NULL DEFAULT FALSE, pinned_at DATETIME, pinned_category_id INTEGER, archived_at DATETIME, unarchived_at DATETIME);`)
+	db.Exec(`CREATE TABLE comments (id INTEGER PRIMARY KEY AUTOINCREMENT, post_id INTEGER, user_id INTEGER, content TEXT, content_html TEXT NOT NULL DEFAULT '', parent_id INTEGER, created_at TIMESTAMP, likes INTEGER NOT NULL DEFAULT 0, dislikes INTEGER NOT NULL DEFAULT 0, reaction_counts TEXT NOT NULL DEFAULT '{}');`)
+	db.Exec(`CREATE TABLE reactions (target_type TEXT, target_id INTEGER, user_id INTEGER, kind TEXT, created_at DATETIME DEFAULT CURRENT_TIMESTAMP);`)
+	db.Exec(`CREATE TABLE categories (id INTEGER PRIMARY KEY, name TEXT, parent_id INTEGER, slug TEXT NOT NULL DEFAULT '', description TEXT NOT NULL DEFAULT '');`)
+	db.Exec(`CREATE TABLE post_categories (post_id INTEGER, category_id INTEGER);`)
+	db.Exec(`CREATE TABLE follows (user_id INTEGER, target_type TEXT, target_id INTEGER, created_at DATETIME DEFAULT CURRENT_TIMESTAMP, PRIMARY KEY (user_id, target_type, target_id));`)
+	db.Exec(`CREATE TABLE notifications (id INTEGER PRIMARY KEY AUTOINCREMENT, user_id INTEGER, kind TEXT, target_type TEXT, target_id INTEGER, post_id INTEGER, actor_id INTEGER, events INTEGER NOT NULL DEFAULT 1, read BOOLEAN NOT NULL DEFAULT FALSE, created_at DATETIME, updated_at DATETIME);`)
+	db.Exec(`CREATE UNIQUE INDEX idx_notifications_unread ON notifications(user_id, kind, target_type, target_id) WHERE NOT read;`)
+	db.Exec(`CREATE TABLE notification_actors (notification_id INTEGER, actor_id INTEGER, PRIMARY KEY (notification_id, actor_id));`)
+	db.Exec(`ALTER TABLE users ADD COLUMN digest TEXT NOT NULL DEFAULT 'off'`)
+	db.Exec(`ALTER TABLE users ADD COLUMN digest_sent_at DATETIME`)
+	db.Exec(`ALTER TABLE users ADD COLUMN created_at DATETIME`)
+	db.Exec(`CREATE TABLE mentions (target_type TEXT, target_id INTEGER, post_id INTEGER, user_id INTEGER, author_id INTEGER, created_at DATETIME, PRIMARY KEY (target_type, target_id, user_id));`)
+	db.Exec(`INSERT INTO users (id, email, username, password) VALUES
+		(1, 'a@example.com', 'author', 'x'), (2, 'b@example.com', 'fan2', 'x'),
+		(3, 'c@example.com', 'fan3', 'x'), (4, 'd@example.com', 'fan4', 'x')`)
+	db.Exec(`INSERT INTO sessions (id, user_id, expires_at) VALUES
+		('s1', 1, datetime('now', '+1 hour')), ('s2', 2, datetime('now', '+1 hour')),
+		('s3', 3, datetime('now', '+1 hour')), ('s4', 4, datetime('now', '+1 hour'))`)
+	db.Exec(`INSERT INTO categories (id, name, slug, parent_id) VALUES (1, 'Футбол', 'football', NULL), (2, 'Премьер-лига', 'premier-league', 1)`)
+	db.Exec(`INSERT INTO posts (id, user_id, title, content, created_at) VALUES (1, 1, 'Финал', 'текст', datetime('now'))`)
+
+	tmpl := template.Must(template.New("").Funcs(handlers.TemplateFuncs()).ParseGlob("../../templates/*.html"))
+	errHandler := &handlers.ErrorHandler{Templates: tmpl}
+	notifier := &handlers.Notifier{DB: db}
+	return &notifyEnv{
+		db:       db,
+		notifier: notifier,
+		comments: &handlers.CommentHandler{DB: db, Templates: tmpl, Err: errHandler, Notify: notifier},
+		likes:    &handlers.LikeHandler{DB: db, Err: errHandler, Notify: notifier},
+		posts:    &handlers.PostHandler{DB: db, Templates: tmpl, Err: errHandler, Notify: notifier},
+		pages:    &handlers.NotificationHandler{DB: db, Templates: tmpl, Err: errHandler, Secret: []byte("secret")},
+	}
+}
+
+func (e *notifyEnv) comment(t *testing.T, session string, form url.Values) {
+	form.Set("post_id", "1")
+	w := httptest.NewRecorder()
+	e.comments.AddComment(w, postForm("/post/comment", session, form))
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("comment: expected redirect, got %d", w.Code)
+	}
+}
+
+func (e *notifyEnv) like(session, typ, id string) {
+	e.likes.Like(httptest.NewRecorder(), postForm("/like", session, url.Values{"type": {typ}, "id": {id}, "action": {"like"}}))
+}
+
+func (e *notifyEnv) texts(t *testing.T, userID int) []string {
+	list, err := handlers.LoadNotifications(e.db, userID, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var texts []string
+	for _, n := range list {
+		texts = append(texts, n.Text)
+	}
+	return texts
+}
+
+func TestNotifications_CommentsAndReplies(t *testing.T) {
+	e := setupNotifications(t)
+
+	e.comment(t, "s2", url.Values{"content": {"Отличный матч"}})
+	e.comment(t, "s3", url.Values{"content": {"Согласен"}, "parent_id": {"1"}})
+	e.comment(t, "s1", url.Values{"content": {"Спасибо"}}) // свои действия не уведомляют автора
+
+	if got := e.texts(t, 1); len(got) != 1 || got[0] != "fan3 и ещё 1 человек прокомментировали ваш пост «Финал»" {
+		t.Errorf("author notifications: %q", got)
+	}
+	if got := e.texts(t, 2); len(got) != 1 || got[0] != "fan3 ответил на ваш комментарий к посту «Финал»" {
+		t.Errorf("reply notifications: %q", got)
+	}
+
+	w := httptest.NewRecorder()
+	e.comments.AddComment(w, postForm("/post/comment", "s2", url.Values{"post_id": {"2"}, "content": {"x"}, "parent_id": {"1"}}))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("reply to a comment of another post must be rejected, got %d", w.Code)
+	}
+}
+
+func TestNotifications_LikesCoalesce(t *testing.T) {
+	e := setupNotifications(t)
+
+	e.like("s2", "post", "1")
+	e.like("s3", "post", "1")
+	e.like("s3", "post", "1") // снятие лайка
+	e.like("s3", "post", "1")
+	e.like("s4", "post", "1")
+
+	got := e.texts(t, 1)
+	if len(got) != 1 || got[0] != "fan4 и ещё 2 человека оценили ваш пост «Финал»" {
+		t.Fatalf("likes must coalesce by distinct people: %q", got)
+	}
+
+	// После прочтения новое событие начинает новое уведомление
+	if err := handlers.MarkNotificationsRead(e.db, 1, 0); err != nil {
+		t.Fatal(err)
+	}
+	e.like("s2", "post", "1") // снятие
+	e.like("s2", "post", "1")
+	got = e.texts(t, 1)
+	if len(got) != 2 || got[0] != "fan2 оценил ваш пост «Финал»" {
+		t.Errorf("expected a fresh notification after read: %q", got)
+	}
+}
+
+func TestNotifications_Follows(t *testing.T) {
+	e := setupNotifications(t)
+
+	follow := func(session, typ, id string) {
+		w := httptest.NewRecorder()
+		e.pages.Follow(w, postForm("/follow", session, url.Values{"type": {typ}, "id": {id}}))
+		if w.Code != http.StatusSeeOther {
+			t.Fatalf("follow %s %s: got %d", typ, id, w.Code)
+		}
+	}
+	follow("s2", "category", "1")
+	follow("s3", "user", "1")
+	follow("s4", "post", "1")
+
+	w := httptest.NewRecorder()
+	e.pages.Follow(w, postForm("/follow", "s2", url.Values{"type": {"user"}, "id": {"2"}}))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("following yourself must be rejected, got %d", w.Code)
+	}
+
+	// Пост в подкатегории доходит до подписчика родительской категории
+	for _, title := range []string{"Дерби", "Трансфер"} {
+		w := httptest.NewRecorder()
+		e.posts.CreatePost(w, postForm("/create", "s1", url.Values{"title": {title}, "content": {"текст"}, "categories": {"2"}}))
+		if w.Code != http.StatusSeeOther {
+			t.Fatalf("create post: got %d", w.Code)
+		}
+	}
+	if got := e.texts(t, 2); len(got) != 1 || got[0] != "2 новых поста в категории «Футбол», последний — «Трансфер»" {
+		t.Errorf("category follower: %q", got)
+	}
+	if got := e.texts(t, 3); len(got) != 1 || got[0] != "author опубликовал 2 поста, последний — «Трансфер»" {
+		t.Errorf("author follower: %q", got)
+	}
+
+	e.comment(t, "s2", url.Values{"content": {"Ну и матч"}})
+	if got := e.texts(t, 4); len(got) != 1 || got[0] != "fan2 прокомментировал пост «Финал»" {
+		t.Errorf("post follower: %q", got)
+	}
+}
+
+func TestNotifications_FollowRedirectBack(t *testing.T) {
+	e := setupNotifications(t)
+	cases := []struct {
+		typ, id, referer, want string
+	}{
+		{"post", "1", "", "/post/1"},
+		{"category", "1", "http://example.com/c/football?sort=new", "/c/football?sort=new"},
+		// Чужой Referer не уводит с форума
+		{"post", "1", "https://evil.example/phish", "/post/1"},
+		{"category", "2", "https://evil.example/phish", "/c/premier-league"},
+		{"user", "1", "https://evil.example/phish", "/u/author"},
+	}
+	for _, c := range cases {
+		req := postForm("/follow", "s2", url.Values{"type": {c.typ}, "id": {c.id}})
+		if c.referer != "" {
+			req.Header.Set("Referer", c.referer)
+		}
+		w := httptest.NewRecorder()
+		e.pages.Follow(w, req)
+		if w.Code != http.StatusSeeOther || w.Header().Get("Location") != c.want {
+			t.Errorf("%s %q: expected redirect to %s, got %d %s", c.typ, c.referer, c.want, w.Code, w.Header().Get("Location"))
+		}
+	}
+}
+
+func TestNotifications_UnreadCounterAndPage(t *testing.T) {
+	e := setupNotifications(t)
+	e.like("s2", "post", "1")
+	e.notifier.Now = func() time.Time { return time.Now().Add(time.Minute) }
+	e.comment(t, "s3", url.Values{"content": {"Отлично"}})
+
+	handler := e.notifier.Middleware(http.HandlerFunc(e.pages.List))
+	req := httptest.NewRequest(http.MethodGet, "/notifications", nil)
+	req.AddCookie(&http.Cookie{Name: "session_id", Value: "s1"})
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	body := w.Body.String()
+	if !strings.Contains(body, `<span class="badge bg-danger unread-count">2</span>`) {
+		t.Error("layout must show the unread counter")
+	}
+	if strings.Index(body, "прокомментировал") > strings.Index(body, "оценил") {
+		t.Error("latest notifications must come first")
+	}
+
+	w = httptest.NewRecorder()
+	e.pages.MarkRead(w, postForm("/notifications/read", "s1", url.Values{}))
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("mark read: got %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if strings.Contains(w.Body.String(), "unread-count") {
+		t.Error("counter must disappear after marking all as read")
+	}
+}
+
+func TestDigest_SettingsAndUnsubscribe(t *testing.T) {
+	e := setupNotifications(t)
+	mode := func() string {
+		var m string
+		e.db.QueryRow(`SELECT digest FROM users WHERE id = 2`).Scan(&m)
+		return m
+	}
+
+	w := httptest.NewRecorder()
+	e.pages.SetDigest(w, postForm("/notifications/digest", "s2", url.Values{"digest": {"hourly"}}))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("unknown period must be rejected, got %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	e.pages.SetDigest(w, postForm("/notifications/digest", "s2", url.Values{"digest": {"weekly"}}))
+	if w.Code != http.StatusSeeOther || mode() != "weekly" {
+		t.Fatalf("set digest: got %d, mode %q", w.Code, mode())
+	}
+
+	token := digest.UnsubscribeToken([]byte("secret"), 2)
+	w = httptest.NewRecorder()
+	e.pages.Unsubscribe(w, httptest.NewRequest(http.MethodGet, "/unsubscribe?u=2&t="+token, nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "b@example.com") || mode() != "weekly" {
+		t.Errorf("GET must only ask for confirmation, got %d, mode %q", w.Code, mode())
+	}
+
+	w = httptest.NewRecorder()
+	e.pages.Unsubscribe(w, postForm("/unsubscribe", "", url.Values{"u": {"3"}, "t": {token}}))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("token of another user must be rejected, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	e.pages.Unsubscribe(w, postForm("/unsubscribe", "", url.Values{"u": {"2"}, "t": {token}}))
+	if w.Code != http.StatusOK || mode() != "off" {
+		t.Errorf("unsubscribe: got %d, mode %q", w.Code, mode())
+	}
+}
@@ -0,0 +1,199 @@
+package handlers_test
+
+import (
+	"database/sql"
+	"forum/internal/handlers"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func setupPolls(t *testing.T) (*sql.DB, *handlers.PostHandler, *handlers.PollHandler, *fakeClock) {
+	db := setupTestDB(t)
+	t.Cleanup(func() { db.Close() })
+	db.Exec(`CREATE TABLE posts (id INTEGER PRIMARY KEY AUTOINCREMENT, user_id INTEGER, title TEXT, content TEXT, content_html TEXT NOT NULL DEFAULT '', created_at TIMESTAMP, likes INTEGER DEFAULT 0, dislikes INTEGER DEFAULT 0, reaction_counts TEXT NOT NULL DEFAULT '{}', comment_count INTEGER NOT NULL DEFAULT 0, last_activity_at DATETIME, locked BOOLEAN NOT NULL DEFAULT FALSE, pinned_at DATETIME, pinned_category_id INTEGER, archived_at DATETIME, unarchived_at DATETIME);`)
+	db.Exec(`CREATE TABLE post_categories (post_id INTEGER, category_id INTEGER);`)
+	db.Exec(`CREATE TABLE categories (id INTEGER PRIMARY KEY, name TEXT, parent_id INTEGER, slug TEXT NOT NULL DEFAULT '', description TEXT NOT NULL DEFAULT '');`)
+	db.Exec(`CREATE TABLE polls (id INTEGER PRIMARY KEY AUTOINCREMENT, post_id INTEGER UNIQUE, question TEXT, multiple BOOLEAN, closes_at DATETIME, results TEXT);`)
+	db.Exec(`CREATE TABLE poll_options (id INTEGER PRIMARY KEY AUTOINCREMENT, poll_id INTEGER, position INTEGER, text TEXT);`)
+	db.Exec(`CREATE TABLE poll_ballots (poll_id INTEGER, user_id INTEGER, created_at DATETIME, PRIMARY KEY (poll_id, user_id));`)
+	db.Exec(`CREATE TABLE poll_votes (poll_id INTEGER, user_id INTEGER, option_id INTEGER, PRIMARY KEY (poll_id, user_id, option_id));`)
+	db.Exec(`INSERT INTO users (id, email, username, password) VALUES (1, 'a@example.com', 'fan1', 'x'), (2, 'b@example.com', 'fan2', 'x')`)
+	db.Exec(`INSERT INTO sessions (id, user_id, expires_at) VALUES ('s1', 1, datetime('now', '+1 hour')), ('s2', 2, datetime('now', '+1 hour'))`)
+
+	tmpl := template.Must(template.New("").Funcs(handlers.TemplateFuncs()).ParseGlob("../../templates/*.html"))
+	errHandler := &handlers.ErrorHandler{Templates: tmpl}
+	clock := &fakeClock{now: time.Now()}
+	return db,
+		&handlers.PostHandler{DB: db, Templates: tmpl, Err: errHandler},
+		&handlers.PollHandler{DB: db, Err: errHandler, Now: clock.Now},
+		clock
+}
+
+func postForm(path, session string, form url.Values) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(&http.Cookie{Name: "session_id", Value: session})
+	return req
+}
+
+func createPollPost(t *testing.T, h *handlers.PostHandler, poll url.Values) *httptest.ResponseRecorder {
+	form := url.Values{"title": {"Кто победит?"}, "content": {"Финал сегодня"}, "categories": {"1"}}
+	for k, v := range poll {
+		form[k] = v
+	}
+	w := httptest.NewRecorder()
+	h.CreatePost(w, postForm("/create", "s1", form))
+	return w
+}
+
+func vote(h *handlers.PollHandler, session string, options ...string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.Vote(w, postForm("/poll/vote", session, url.Values{"poll_id": {"1"}, "option": options}))
+	return w
+}
+
+func TestPoll_CreateAndVote(t *testing.T) {
+	db, posts, polls, _ := setupPolls(t)
+
+	w := createPollPost(t, posts, url.Values{
+		"poll_question": {"Кто победит?"},
+		"poll_options":  {"Спартак\nЦСКА\nНичья"},
+		"poll_results":  {"voted"},
+	})
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("expected redirect, got %d", w.Code)
+	}
+
+	poll, err := handlers.GetPoll(db, 1, 2, time.Now())
+	if err != nil || poll == nil {
+		t.Fatalf("poll not created: %v", err)
+	}
+	if len(poll.Options) != 3 || poll.ShowResults {
+		t.Errorf("expected 3 options with hidden results, got %d options, show=%v", len(poll.Options), poll.ShowResults)
+	}
+
+	if w := vote(polls, "s2", "1", "2"); w.Code != http.StatusSeeOther {
+		t.Fatalf("expected redirect, got %d", w.Code)
+	}
+	if poll, _ := handlers.GetPoll(db, 1, 2, time.Now()); poll.Voted {
+		t.Error("single-choice poll must reject two options")
+	}
+
+	vote(polls, "s2", "2")
+	vote(polls, "s2", "1") // повторный голос не учитывается
+	vote(polls, "s1", "2")
+
+	poll, _ = handlers.GetPoll(db, 1, 2, time.Now())
+	if !poll.Voted || !poll.ShowResults || poll.Voters != 2 {
+		t.Fatalf("unexpected poll state: voted=%v show=%v voters=%d", poll.Voted, poll.ShowResults, poll.Voters)
+	}
+	if poll.Options[0].Votes != 0 || poll.Options[1].Votes != 2 || poll.Options[1].Percent != 100 || !poll.Options[1].Chosen {
+		t.Errorf("unexpected results: %+v", poll.Options)
+	}
+}
+
+func TestPoll_OneBallotPerUserInDB(t *testing.T) {
+	db, _, _, _ := setupPolls(t)
+	db.Exec(`INSERT INTO poll_ballots (poll_id, user_id) VALUES (1, 1)`)
+	if _, err := db.Exec(`INSERT INTO poll_ballots (poll_id, user_id) VALUES (1, 1)`); err == nil {
+		t.Error("second ballot for the same user must violate the primary key")
+	}
+}
+
+func TestPoll_ClosedPoll(t *testing.T) {
+	db, posts, polls, clock := setupPolls(t)
+
+	closesAt := time.Now().Add(time.Hour).Local().Format("2006-01-02T15:04")
+	createPollPost(t, posts, url.Values{
+		"poll_question":  {"Лучший игрок матча"},
+		"poll_options":   {"Иванов\nПетров\nСидоров"},
+		"poll_multiple":  {"1"},
+		"poll_closes_at": {closesAt},
+		"poll_results":   {"closed"},
+	})
+
+	// Повтор варианта в форме не делает бюллетень недействительным
+	if w := vote(polls, "s1", "1", "3", "3"); w.Code != http.StatusSeeOther {
+		t.Fatalf("duplicate option must be accepted once, got %d", w.Code)
+	}
+	poll, _ := handlers.GetPoll(db, 1, 1, clock.Now())
+	if !poll.Voted || poll.ShowResults {
+		t.Errorf("results must stay hidden until close: voted=%v show=%v", poll.Voted, poll.ShowResults)
+	}
+
+	w := httptest.NewRecorder()
+	polls.Results(w, httptest.NewRequest(http.MethodGet, "/poll/results?post=1", nil))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("hidden results must not be served as JSON, got %d", w.Code)
+	}
+
+	clock.Advance(2 * time.Hour)
+	vote(polls, "s2", "2")
+	poll, _ = handlers.GetPoll(db, 1, 2, clock.Now())
+	if !poll.Closed || !poll.ShowResults || poll.Voters != 1 || poll.Voted {
+		t.Errorf("closed poll must show results and reject votes: %+v", poll)
+	}
+	if poll.Options[0].Votes != 1 || poll.Options[2].Votes != 1 {
+		t.Errorf("each chosen option counts once: %+v", poll.Options)
+	}
+
+	w = httptest.NewRecorder()
+	polls.Results(w, httptest.NewRequest(http.MethodGet, "/poll/results?post=1", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"voters":1`) {
+		t.Errorf("unexpected results response %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestPoll_Validation(t *testing.T) {
+	_, posts, _, _ := setupPolls(t)
+
+	tests := []struct {
+		name string
+		poll url.Values
+		want string
+	}{
+		{"one option", url.Values{"poll_question": {"?"}, "poll_options": {"Да"}}, "от 2 до 10"},
+		{"duplicates", url.Values{"poll_question": {"?"}, "poll_options": {"Да\nда"}}, "не должны повторяться"},
+		{"past close", url.Values{"poll_question": {"?"}, "poll_options": {"Да\nНет"}, "poll_closes_at": {"2001-01-01T00:00"}}, "в будущем"},
+		{"hidden without close", url.Values{"poll_question": {"?"}, "poll_options": {"Да\nНет"}, "poll_results": {"closed"}}, "укажите время закрытия"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := createPollPost(t, posts, tt.poll)
+			if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), tt.want) {
+				t.Errorf("expected form error %q, got %d", tt.want, w.Code)
+			}
+		})
+	}
+}
+
+func TestPoll_ClosesAtInFormZone(t *testing.T) {
+	db, posts, _, _ := setupPolls(t)
+
+	// Браузер в UTC+3: getTimezoneOffset даёт -180
+	moscow := time.FixedZone("", 3*60*60)
+	want := time.Now().Add(48 * time.Hour).In(moscow).Truncate(time.Minute)
+	w := createPollPost(t, posts, url.Values{
+		// Лимиты в символах: 150 букв кириллицы — это 300 байт
+		"poll_question":  {strings.Repeat("в", 150)},
+		"poll_options":   {strings.Repeat("д", 80) + "\n" + strings.Repeat("н", 80)},
+		"poll_closes_at": {want.Format("2006-01-02T15:04")},
+		"tz_offset":      {"-180"},
+	})
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("expected redirect, got %d: %s", w.Code, w.Body.String())
+	}
+
+	poll, err := handlers.GetPoll(db, 1, 1, time.Now())
+	if err != nil || poll == nil {
+		t.Fatalf("poll not created: %v", err)
+	}
+	if poll.ClosesAt == nil || !poll.ClosesAt.Equal(want) {
+		t.Errorf("closes_at = %v, want %v", poll.ClosesAt, want)
+	}
+}
@@ -17,23 +17,14 @@ func TestCreatePost_Success(t *testing.T) {
 	defer db.Close()
 
 	// Таблицы и пользователь
-	db.Exec(`CREATE TABLE posts (id INTEGER PRIMARY KEY AUTOINCREMENT, user_id INTEGER, title TEXT, content TEXT, created_at TIMESTAMP);`)
-	db.Exec(`CREATE TABLE categories (id INTEGER PRIMARY KEY, name TEXT);`)
+	db.Exec(`CREATE TABLE posts (id INTEGER PRIMARY KEY AUTOINCREMENT, user_id INTEGER, title TEXT, content TEXT, content_html TEXT NOT NULL DEFAULT '', created_at TIMESTAMP, likes INTEGER DEFAULT 0, dislikes INTEGER DEFAULT 0, reaction_counts TEXT NOT NULL DEFAULT '{}', comment_count INTEGER NOT NULL DEFAULT 0, last_activity_at DATETIME, locked BOOLEAN NOT NULL DEFAULT FALSE, pinned_at DATETIME, pinned_category_id INTEGER, archived_at DATETIME, unarchived_at DATETIME);`)
+	db.Exec(`CREATE TABLE categories (id INTEGER PRIMARY KEY, name TEXT, parent_id INTEGER, slug TEXT NOT NULL DEFAULT '', description TEXT NOT NULL DEFAULT '');`)
 	db.Exec(`CREATE TABLE post_categories (post_id INTEGER, category_id INTEGER);`)
 	db.Exec(`INSERT INTO users (id, email, username, password) VALUES (1, 'user@example.com', 'user1', 'pass')`)
 	db.Exec(`INSERT INTO sessions (id, user_id, expires_at) VALUES ('session123', 1, datetime('now', '+1 hour'))`)
 	db.Exec(`INSERT INTO categories (id, name) VALUES (1, 'Go'), (2, 'Web')`)
 
-	tmpl := template.New("").Funcs(template.FuncMap{
-		"inSlice": func(slice []string, val string) bool {
-			for _, s := range slice {
-				if s == val {
-					return true
-				}
-			}
-			return false
-		},
-	})
+	tmpl := template.New("").Funcs(handlers.TemplateFuncs())
 	tmpl = template.Must(tmpl.ParseGlob("../../templates/*.html"))
 
 	handler := handlers.PostHandler{DB: db, Templates: tmpl, Err: &handlers.ErrorHandler{Templates: tmpl}}
@@ -54,3 +45,116 @@ func TestCreatePost_Success(t *testing.T) {
 		t.Errorf("expected redirect, got %d", w.Code)
 	}
 }
+
+func TestCreatePost_StoresRenderedMarkdown(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	db.Exec(`CREATE TABLE posts (id INTEGER PRIMARY KEY AUTOINCREMENT, user_id INTEGER, title TEXT, content TEXT, content_html TEXT NOT NULL DEFAULT '', created_at TIMESTAMP, likes INTEGER DEFAULT 0, dislikes INTEGER DEFAULT 0, reaction_counts TEXT NOT NULL DEFAULT '{}', comment_count INTEGER NOT NULL DEFAULT 0, last_activity_at DATETIME, locked BOOLEAN NOT NULL DEFAULT FALSE, pinned_at DATETIME, pinned_category_id INTEGER, archived_at DATETIME, unarchived_at DATETIME);`)
+	db.Exec(`CREATE TABLE post_categories (post_id INTEGER, category_id INTEGER);`)
+	db.Exec(`INSERT INTO users (id, email, username, password) VALUES (1, 'user@example.com', 'user1', 'pass')`)
+	db.Exec(`INSERT INTO sessions (id, user_id, expires_at) VALUES ('session123', 1, datetime('now', '+1 hour'))`)
+
+	tmpl := template.New("").Funcs(handlers.TemplateFuncs())
+	tmpl = template.Must(tmpl.ParseGlob("../../templates/*.html"))
+	handler := handlers.PostHandler{DB: db, Templates: tmpl, Err: &handlers.ErrorHandler{Templates: tmpl}}
+
+	form := url.Values{}
+	form.Set("title", "Отчёт")
+	form.Set("content", "**Счёт** 2:1\n\n<script>alert(1)</script>")
+	form.Add("categories", "1")
+
+	req := httptest.NewRequest(http.MethodPost, "/create", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(&http.Cookie{Name: "session_id", Value: "session123"})
+	handler.CreatePost(httptest.NewRecorder(), req)
+
+	var html string
+	if err := db.QueryRow("SELECT content_html FROM posts WHERE id = 1").Scan(&html); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(html, "<strong>Счёт</strong>") || strings.Contains(html, "<script>") {
+		t.Errorf("unexpected content_html: %q", html)
+	}
+}
+
+func TestCreatePost_CyrillicLength(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	db.Exec(`CREATE TABLE posts (id INTEGER PRIMARY KEY AUTOINCREMENT, user_id INTEGER, title TEXT, content TEXT, content_html TEXT NOT NULL DEFAULT '', created_at TIMESTAMP, likes INTEGER DEFAULT 0, dislikes INTEGER DEFAULT 0, reaction_counts TEXT NOT NULL DEFAULT '{}', comment_count INTEGER NOT NULL DEFAULT 0, last_activity_at DATETIME, locked BOOLEAN NOT NULL DEFAULT FALSE, pinned_at DATETIME, pinned_category_id INTEGER, archived_at DATETIME, unarchived_at DATETIME);`)
+	db.Exec(`CREATE TABLE post_categories (post_id INTEGER, category_id INTEGER);`)
+	db.Exec(`INSERT INTO users (id, email, username, password) VALUES (1, 'user@example.com', 'user1', 'pass')`)
+	db.Exec(`INSERT INTO sessions (id, user_id, expires_at) VALUES ('session123', 1, datetime('now', '+1 hour'))`)
+
+	tmpl := template.New("").Funcs(handlers.TemplateFuncs())
+	tmpl = template.Must(tmpl.ParseGlob("../../templates/*.html"))
+	handler := handlers.PostHandler{DB: db, Templates: tmpl, Err: &handlers.ErrorHandler{Templates: tmpl}}
+
+	create := func(title, content string) int {
+		form := url.Values{"title": {title}, "content": {content}, "categories": {"1"}}
+		req := httptest.NewRequest(http.MethodPost, "/create", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.AddCookie(&http.Cookie{Name: "session_id", Value: "session123"})
+		w := httptest.NewRecorder()
+		handler.CreatePost(w, req)
+		return w.Code
+	}
+
+	// 3000 букв — это 6000 байт, но лимит считается в символах, как и в превью
+	if code := create(strings.Repeat("ж", 150), strings.Repeat("я", 3000)); code != http.StatusSeeOther {
+		t.Fatalf("3000 Cyrillic characters: expected redirect, got %d", code)
+	}
+	if n := countRows(db, "posts"); n != 1 {
+		t.Fatalf("expected 1 post, got %d", n)
+	}
+	if code := create("Заголовок", strings.Repeat("я", 5001)); code == http.StatusSeeOther {
+		t.Error("5001 characters must be rejected")
+	}
+}
+
+func TestPreview(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	db.Exec(`INSERT INTO users (id, email, username, password) VALUES (1, 'user@example.com', 'user1', 'pass')`)
+	db.Exec(`INSERT INTO sessions (id, user_id, expires_at) VALUES ('session123', 1, datetime('now', '+1 hour'))`)
+
+	tmpl := template.New("").Funcs(handlers.TemplateFuncs())
+	tmpl = template.Must(tmpl.ParseGlob("../../templates/*.html"))
+	handler := handlers.PostHandler{DB: db, Templates: tmpl, Err: &handlers.ErrorHandler{Templates: tmpl}}
+
+	preview := func(withSession bool, content string) *httptest.ResponseRecorder {
+		form := url.Values{"content": {content}}
+		req := httptest.NewRequest(http.MethodPost, "/preview", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if withSession {
+			req.AddCookie(&http.Cookie{Name: "session_id", Value: "session123"})
+		}
+		w := httptest.NewRecorder()
+		handler.Preview(w, req)
+		return w
+	}
+
+	list := "- один\n- [два](javascript:alert(1))"
+	if w := preview(false, list); w.Code != http.StatusUnauthorized {
+		t.Errorf("anonymous preview: expected 401, got %d", w.Code)
+	}
+
+	w := preview(true, list)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	want := "<ul>\n<li>один</li>\n<li>два</li>\n</ul>\n"
+	if w.Body.String() != want {
+		t.Errorf("preview = %q, want %q", w.Body.String(), want)
+	}
+
+	// Лимит считается в символах, а не в байтах
+	if w := preview(true, strings.Repeat("я", 5000)); w.Code != http.StatusOK {
+		t.Errorf("5000 Cyrillic characters: expected 200, got %d", w.Code)
+	}
+	if w := preview(true, strings.Repeat("я", 5001)); w.Code != http.StatusRequestEntityTooLarge || !strings.Contains(w.Body.String(), "слишком длинный") {
+		t.Errorf("too long preview: expected 413, got %d", w.Code)
+	}
+}
@@ -0,0 +1,101 @@
+package handlers_test
+
+import (
+	"forum/internal/config"
+	"forum/internal/handlers"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func setupLimiter(t *testing.T) (http.Handler, *fakeClock) {
+	db := setupTestDB(t)
+	t.Cleanup(func() { db.Close() })
+	db.Exec(`INSERT INTO users (id, email, username, password) VALUES (1, 'user@example.com', 'user1', 'pass')`)
+	db.Exec(`INSERT INTO sessions (id, user_id, expires_at) VALUES ('session123', 1, datetime('now', '+1 hour'))`)
+
+	tmpl := template.New("").Funcs(handlers.TemplateFuncs())
+	tmpl = template.Must(tmpl.ParseGlob("../../templates/*.html"))
+
+	clock := &fakeClock{now: time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)}
+	limiter := handlers.NewRateLimiter(db, map[string]config.RateLimit{
+		"/post/comment": {PerMinute: 6, Burst: 2},
+	}, &handlers.ErrorHandler{Templates: tmpl})
+	limiter.Now = clock.Now
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	return limiter.Middleware(next), clock
+}
+
+func comment(handler http.Handler, session, ip string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/post/comment", nil)
+	req.RemoteAddr = ip + ":1234"
+	if session != "" {
+		req.AddCookie(&http.Cookie{Name: "session_id", Value: session})
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w
+}
+
+func TestRateLimit_BurstThenReject(t *testing.T) {
+	handler, clock := setupLimiter(t)
+
+	for i := 0; i < 2; i++ {
+		if w := comment(handler, "session123", "10.0.0.1"); w.Code != http.StatusOK {
+			t.Fatalf("request %d: expected 200, got %d", i+1, w.Code)
+		}
+	}
+
+	w := comment(handler, "session123", "10.0.0.1")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "10" {
+		t.Errorf("expected Retry-After 10, got %q", got)
+	}
+
+	// Через 10 секунд в корзине появляется один токен
+	clock.Advance(10 * time.Second)
+	if w := comment(handler, "session123", "10.0.0.1"); w.Code != http.StatusOK {
+		t.Errorf("expected 200 after refill, got %d", w.Code)
+	}
+	if w := comment(handler, "session123", "10.0.0.1"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("expected 429 again, got %d", w.Code)
+	}
+}
+
+func TestRateLimit_KeysAreIndependent(t *testing.T) {
+	handler, _ := setupLimiter(t)
+
+	for i := 0; i < 3; i++ {
+		comment(handler, "session123", "10.0.0.1")
+	}
+
+	// Аноним с другого адреса не страдает от чужого лимита
+	if w := comment(handler, "", "10.0.0.2"); w.Code != http.StatusOK {
+		t.Errorf("expected anonymous client to pass, got %d", w.Code)
+	}
+
+	// Пользователь ограничивается по ID, а не по адресу
+	if w := comment(handler, "session123", "10.0.0.3"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("expected user limit to follow the session, got %d", w.Code)
+	}
+}
+
+func TestRateLimit_GetNotLimited(t *testing.T) {
+	handler, _ := setupLimiter(t)
+
+	for i := 0; i < 5; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/post/comment", nil)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET should not be limited, got %d", w.Code)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"forum/internal/config"
+	"forum/internal/handlers"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestReactions_Kinds(t *testing.T) {
+	h := setupLikes(t)
+
+	resp := likeJSON(t, h, "session123", "fire")
+	counts := resp["counts"].(map[string]interface{})
+	if resp["reaction"] != "fire" || counts["fire"] != float64(1) || counts["like"] != float64(0) {
+		t.Fatalf("fire: %v", resp)
+	}
+	if len(counts) != len(config.Default().Reactions) {
+		t.Errorf("counts must list every configured kind: %v", counts)
+	}
+
+	// Другая реакция заменяет прежнюю: у пользователя одна реакция на пост
+	resp = likeJSON(t, h, "session123", "clap")
+	counts = resp["counts"].(map[string]interface{})
+	if resp["reaction"] != "clap" || counts["fire"] != float64(0) || counts["clap"] != float64(1) {
+		t.Fatalf("clap: %v", resp)
+	}
+	var n int
+	h.DB.QueryRow(`SELECT COUNT(*) FROM reactions WHERE target_type = 'post' AND target_id = 1`).Scan(&n)
+	if n != 1 {
+		t.Errorf("expected one reaction row, got %d", n)
+	}
+
+	if resp = likeJSON(t, h, "session123", "poop"); resp["status"] != float64(http.StatusBadRequest) {
+		t.Errorf("unknown kind must be rejected: %v", resp)
+	}
+}
+
+func TestReactions_WhoReacted(t *testing.T) {
+	h := setupLikes(t)
+	db := h.DB
+	db.Exec(`INSERT INTO users (id, email, username, password) VALUES (2, 'b@example.com', 'fan2', 'x'), (3, 'c@example.com', 'fan3', 'x')`)
+	db.Exec(`INSERT INTO reactions (target_type, target_id, user_id, kind, created_at) VALUES
+		('post', 1, 1, 'fire', '2024-05-01 10:00:00'),
+		('post', 1, 2, 'like', '2024-05-01 11:00:00'),
+		('post', 1, 3, 'fire', '2024-05-01 12:00:00'),
+		('comment', 5, 2, 'laugh', '2024-05-01 12:00:00')`)
+
+	tmpl := template.Must(template.New("").Funcs(handlers.TemplateFuncs()).ParseGlob("../../templates/*.html"))
+	list := &handlers.ReactionsHandler{DB: db, Templates: tmpl, Err: &handlers.ErrorHandler{Templates: tmpl}}
+
+	get := func(query string, asJSON bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/reactions?"+query, nil)
+		if asJSON {
+			req.Header.Set("Accept", "application/json")
+		}
+		w := httptest.NewRecorder()
+		list.List(w, req)
+		return w
+	}
+
+	w := get("type=post&id=1", true)
+	var resp struct {
+		Reactions []struct {
+			Kind  string
+			Count int
+			Users []string
+		}
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err, w.Body.String())
+	}
+	// Порядок видов — из настроек, внутри вида новые первыми
+	if len(resp.Reactions) != 2 || resp.Reactions[0].Kind != "like" || resp.Reactions[1].Kind != "fire" ||
+		strings.Join(resp.Reactions[1].Users, ",") != "fan3,user1" || resp.Reactions[1].Count != 2 {
+		t.Errorf("unexpected groups: %+v", resp.Reactions)
+	}
+
+	w = get("type=comment&id=5", false)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "fan2") || !strings.Contains(w.Body.String(), "/post/1#comment-5") {
+		t.Errorf("comment page: %d", w.Code)
+	}
+
+	for _, query := range []string{"type=post&id=9", "type=user&id=1", "type=post&id=x"} {
+		if w := get(query, true); w.Code != http.StatusNotFound {
+			t.Errorf("%s: expected 404, got %d", query, w.Code)
+		}
+	}
+}
+
+func TestReactions_SortTop(t *testing.T) {
+	db, _, filter := setupTags(t)
+	db.Exec(`INSERT INTO users (id, email, username, password) VALUES (2, 'b@example.com', 'fan2', 'x'), (3, 'c@example.com', 'fan3', 'x')`)
+	db.Exec(`INSERT INTO posts (id, user_id, title, content, created_at, likes, dislikes, reaction_counts) VALUES
+		(1, 1, 'A', 'текст', '2024-05-01 10:00:00', 0, 0, '{"fire":1}'),
+		(2, 1, 'B', 'текст', '2024-05-02 10:00:00', 3, 0, '{"like":3}'),
+		(3, 1, 'C', 'текст', '2024-05-03 10:00:00', 0, 1, '{"dislike":1}')`)
+
+	if got := postTitles(t, db, handlers.PostFilter{}); got != "C,B,A" {
+		t.Errorf("newest first: %q", got)
+	}
+	// fire = 2, три лайка = 3, дизлайк = -1
+	if got := postTitles(t, db, handlers.PostFilter{Sort: handlers.SortTop}); got != "B,A,C" {
+		t.Errorf("top: %q", got)
+	}
+
+	t.Cleanup(func() { handlers.ConfigureReactions(config.Default().Reactions) })
+	kinds := config.Default().Reactions
+	for i := range kinds {
+		if kinds[i].Kind == "fire" {
+			kinds[i].Weight = 5
+		}
+	}
+	if err := handlers.ConfigureReactions(kinds); err != nil {
+		t.Fatal(err)
+	}
+	if got := postTitles(t, db, handlers.PostFilter{Sort: handlers.SortTop}); got != "A,B,C" {
+		t.Errorf("weights from config must apply: %q", got)
+	}
+
+	w := httptest.NewRecorder()
+	filter.FilteredPosts(w, httptest.NewRequest(http.MethodGet, "/?sort=top&q=final", nil))
+	body := w.Body.String()
+	if w.Code != http.StatusOK || !strings.Contains(body, `name="sort" value="top"`) || !strings.Contains(body, `href="/?q=final"`) {
+		t.Errorf("sort switch must keep the query: %d", w.Code)
+	}
+}
+
+func TestConfigureReactions(t *testing.T) {
+	t.Cleanup(func() { handlers.ConfigureReactions(config.Default().Reactions) })
+	bad := [][]config.Reaction{
+		nil,
+		{{Kind: "Fire", Emoji: "🔥"}},
+		{{Kind: "fire", Emoji: "🔥"}, {Kind: "fire", Emoji: "🔥"}},
+		{{Kind: "fire"}},
+	}
+	for _, kinds := range bad {
+		if err := handlers.ConfigureReactions(kinds); err == nil {
+			t.Errorf("%v must be rejected", kinds)
+		}
+	}
+	if err := handlers.ConfigureReactions([]config.Reaction{{Kind: "goal", Emoji: "⚽", Weight: 1}}); err != nil {
+		t.Fatal(err)
+	}
+}
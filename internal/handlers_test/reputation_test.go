@@ -0,0 +1,100 @@
+package handlers_test
+
+import (
+	"forum/internal/config"
+	"forum/internal/handlers"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func configureReputation(t *testing.T, privileges config.Privileges) {
+	t.Cleanup(func() { handlers.ConfigureReputation(config.Default().Reputation) })
+	cfg := config.Default().Reputation
+	cfg.Privileges = privileges
+	handlers.ConfigureReputation(cfg)
+}
+
+func TestReputation_FromReactions(t *testing.T) {
+	e := setupNotifications(t)
+	configureReputation(t, config.Privileges{})
+	react := func(session, typ, id, kind string) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		e.likes.Like(w, postForm("/like", session, url.Values{"type": {typ}, "id": {id}, "action": {kind}}))
+		if w.Code != http.StatusSeeOther {
+			t.Fatalf("%s %s: %d", session, kind, w.Code)
+		}
+	}
+
+	react("s2", "post", "1", "fire")
+	react("s3", "post", "1", "fire")
+	react("s1", "post", "1", "clap")    // своя реакция не в счёт
+	react("s3", "post", "1", "like")    // огонь сменился лайком
+	react("s4", "post", "1", "dislike") // поставили и сняли
+	react("s4", "post", "1", "dislike")
+
+	e.comment(t, "s2", url.Values{"content": {"Судья ошибся"}})
+	react("s1", "comment", "1", "dislike")
+
+	posts, err := handlers.GetFilteredPosts(e.db, handlers.PostFilter{})
+	if err != nil || len(posts) != 1 {
+		t.Fatal(posts, err)
+	}
+	if posts[0].AuthorReputation != 3 {
+		t.Errorf("post author reputation = %d, want 3", posts[0].AuthorReputation)
+	}
+	comments, err := handlers.GetCommentsByPostID(e.db, 1, 0)
+	if err != nil || len(comments) != 1 {
+		t.Fatal(comments, err)
+	}
+	if comments[0].AuthorReputation != -1 {
+		t.Errorf("comment author reputation = %d, want -1", comments[0].AuthorReputation)
+	}
+}
+
+func TestReputation_Privileges(t *testing.T) {
+	e := setupNotifications(t)
+	configureReputation(t, config.Privileges{Downvote: 2, CreatePoll: 3})
+	e.db.Exec(`UPDATE users SET reputation = 5, reputation_at = datetime('now') WHERE id = 2`)
+
+	likes := &handlers.LikeHandler{DB: e.db, Err: e.likes.Err}
+	if resp := likeJSON(t, likes, "s3", "dislike"); resp["status"] != float64(http.StatusForbidden) || !strings.Contains(resp["error"].(string), "от 2") {
+		t.Errorf("low reputation must not downvote: %v", resp)
+	}
+	if resp := likeJSON(t, likes, "s3", "like"); resp["status"] != float64(http.StatusOK) {
+		t.Errorf("positive reactions need no reputation: %v", resp)
+	}
+	if resp := likeJSON(t, likes, "s2", "dislike"); resp["status"] != float64(http.StatusOK) {
+		t.Errorf("enough reputation to downvote: %v", resp)
+	}
+
+	e.db.Exec(`ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'user'`)
+	e.db.Exec(`UPDATE users SET role = 'moderator' WHERE id = 4`)
+	if resp := likeJSON(t, likes, "s4", "dislike"); resp["status"] != float64(http.StatusOK) {
+		t.Errorf("moderators have no thresholds: %v", resp)
+	}
+
+	// Опрос к посту: форма предупреждает заранее, а сервер не даёт создать
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/create", nil)
+	req.AddCookie(&http.Cookie{Name: "session_id", Value: "s3"})
+	e.posts.CreatePost(w, req)
+	if !strings.Contains(w.Body.String(), "Создавать опросы можно с репутацией от 3") {
+		t.Error("create form must explain the poll threshold")
+	}
+	w = httptest.NewRecorder()
+	e.posts.CreatePost(w, postForm("/create", "s3", url.Values{
+		"title": {"Опрос"}, "content": {"текст"}, "categories": {"1"},
+		"poll_question": {"Кто победит?"}, "poll_options": {"Реал\nБавария"},
+	}))
+	var n int
+	e.db.QueryRow(`SELECT COUNT(*) FROM posts`).Scan(&n)
+	if w.Code != http.StatusOK || n != 1 || !strings.Contains(w.Body.String(), "(у вас 0)") {
+		t.Errorf("poll must be rejected: %d, posts %d", w.Code, n)
+	}
+}
@@ -0,0 +1,92 @@
+package handlers_test
+
+import (
+	"crypto/tls"
+	"forum/internal/config"
+	"forum/internal/handlers"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestSecurityHeaders_NonceInPolicyAndTemplate(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	tmpl := template.New("").Funcs(handlers.TemplateFuncs())
+	tmpl = template.Must(tmpl.ParseGlob("../../templates/*.html"))
+
+	authHandler := handlers.AuthHandler{DB: db, Templates: tmpl, Err: &handlers.ErrorHandler{Templates: tmpl}}
+	handler := handlers.NewSecurityHeaders(config.Default().Security).Middleware(http.HandlerFunc(authHandler.Login))
+
+	var nonces []string
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/login", nil))
+
+		csp := w.Header().Get("Content-Security-Policy")
+		start := strings.Index(csp, "'nonce-")
+		if start < 0 {
+			t.Fatalf("CSP without nonce: %q", csp)
+		}
+		nonce := csp[start+len("'nonce-"):]
+		nonce = nonce[:strings.Index(nonce, "'")]
+
+		if !strings.Contains(w.Body.String(), `src="/static/script.js" nonce="`+nonce+`"`) {
+			t.Error("script.js tag does not carry the request nonce")
+		}
+		if !strings.Contains(csp, "frame-ancestors 'none'") {
+			t.Error("expected frame-ancestors directive")
+		}
+		if w.Header().Get("X-Content-Type-Options") != "nosniff" {
+			t.Error("expected X-Content-Type-Options: nosniff")
+		}
+		if w.Header().Get("Referrer-Policy") == "" {
+			t.Error("expected Referrer-Policy")
+		}
+		nonces = append(nonces, nonce)
+	}
+
+	if nonces[0] == nonces[1] {
+		t.Error("nonce must change between requests")
+	}
+}
+
+func TestSecurityHeaders_HSTSOnlyOverTLS(t *testing.T) {
+	handler := handlers.NewSecurityHeaders(config.Default().Security).
+		Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Header().Get("Strict-Transport-Security") != "" {
+		t.Error("HSTS must not be sent over plain HTTP")
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.TLS = &tls.ConnectionState{}
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Header().Get("Strict-Transport-Security") == "" {
+		t.Error("expected HSTS over TLS")
+	}
+}
+
+func TestSecurityHeaders_NonceOnErrorPages(t *testing.T) {
+	tmpl := template.New("").Funcs(handlers.TemplateFuncs())
+	tmpl = template.Must(tmpl.ParseGlob("../../templates/*.html"))
+	errs := &handlers.ErrorHandler{Templates: tmpl}
+	handler := handlers.NewSecurityHeaders(config.Default().Security).Middleware(http.HandlerFunc(errs.NotFound))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/nowhere", nil))
+	csp := w.Header().Get("Content-Security-Policy")
+	nonce := csp[strings.Index(csp, "'nonce-")+len("'nonce-"):]
+	nonce = nonce[:strings.Index(nonce, "'")]
+	if w.Code != http.StatusNotFound || !strings.Contains(w.Body.String(), `src="/static/script.js" nonce="`+nonce+`"`) {
+		t.Errorf("error page must carry the request nonce: %d", w.Code)
+	}
+}
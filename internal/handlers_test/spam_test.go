@@ -0,0 +1,258 @@
+package handlers_test
+
+import (
+	"database/sql"
+	"forum/internal/handlers"
+	"forum/internal/spam"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+type spamEnv struct {
+	db       *sql.DB
+	posts    *handlers.PostHandler
+	comments *handlers.CommentHandler
+	admin    *handlers.AdminHandler
+}
+
+// setupSpam: fan1 и fan2 — обычные пользователи, mod — модератор;
+// фильтры задерживают «казино» и больше одной ссылки от новых аккаунтов
+func setupSpam(t *testing.T) *spamEnv {
+	db, posts, _ := setupDrafts(t)
+	db.Exec(`CREATE TABLE comments (id INTEGER PRIMARY KEY AUTOINCREMENT, post_id INTEGER, user_id INTEGER, content TEXT, content_html TEXT NOT NULL DEFAULT '', parent_id INTEGER, created_at TIMESTAMP, likes INTEGER NOT NULL DEFAULT 0, dislikes INTEGER NOT NULL DEFAULT 0, reaction_counts TEXT NOT NULL DEFAULT '{}');`)
+	db.Exec(`CREATE TABLE moderation_log (id INTEGER PRIMARY KEY AUTOINCREMENT, moderator_id INTEGER NOT NULL, action TEXT NOT NULL, target_type TEXT NOT NULL, target_id INTEGER NOT NULL, details TEXT NOT NULL DEFAULT '', reason TEXT NOT NULL DEFAULT '', created_at DATETIME NOT NULL);`)
+	db.Exec(`CREATE TABLE spam_tokens (token TEXT PRIMARY KEY, spam INTEGER NOT NULL DEFAULT 0, ham INTEGER NOT NULL DEFAULT 0);`)
+	db.Exec(`CREATE TABLE spam_corpus (label TEXT PRIMARY KEY, docs INTEGER NOT NULL DEFAULT 0);`)
+	db.Exec(`ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'user'`)
+	db.Exec(`ALTER TABLE users ADD COLUMN created_at DATETIME`)
+	db.Exec(`INSERT INTO users (id, email, username, password, role) VALUES (3, 'm@example.com', 'mod', 'x', 'moderator')`)
+	db.Exec(`INSERT INTO sessions (id, user_id, expires_at) VALUES ('s3', 3, datetime('now', '+1 hour'))`)
+	db.Exec(`INSERT INTO posts (id, user_id, title, content, created_at) VALUES (1, 1, 'Финал', 'текст', datetime('now'))`)
+
+	blocklist, err := spam.NewBlocklist([]string{"казино"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain := spam.Chain{blocklist, spam.LinkLimit{Age: 72 * time.Hour, Max: 1}}
+	posts.Spam = chain
+	comments := &handlers.CommentHandler{DB: db, Templates: posts.Templates, Err: posts.Err, Spam: chain}
+	return &spamEnv{
+		db:       db,
+		posts:    posts,
+		comments: comments,
+		admin:    &handlers.AdminHandler{DB: db, Templates: posts.Templates, Err: posts.Err, Posts: posts, Comments: comments},
+	}
+}
+
+func (e *spamEnv) comment(session, content string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	e.comments.AddComment(w, postForm("/post/comment", session, url.Values{"post_id": {"1"}, "content": {content}}))
+	return w
+}
+
+func (e *spamEnv) decide(session string, id int, action string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	e.admin.SpamQueue(w, postForm("/admin/spam", session, url.Values{"id": {strconv.Itoa(id)}, "action": {action}}))
+	return w
+}
+
+func held(t *testing.T, db *sql.DB) []string {
+	t.Helper()
+	items, err := handlers.LoadHeld(db, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reasons []string
+	for _, item := range items {
+		reasons = append(reasons, item.TargetType+": "+item.Reason)
+	}
+	return reasons
+}
+
+func corpusDocs(db *sql.DB, label string) int {
+	var n int
+	db.QueryRow(`SELECT docs FROM spam_corpus WHERE label = ?`, label).Scan(&n)
+	return n
+}
+
+func TestSpam_HeldComments(t *testing.T) {
+	e := setupSpam(t)
+
+	w := e.comment("s2", "Лучшее КАЗИНО тут")
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/post/1?held=1" {
+		t.Fatalf("held comment: %d %s", w.Code, w.Header().Get("Location"))
+	}
+	req := httptest.NewRequest(http.MethodGet, w.Header().Get("Location"), nil)
+	req.AddCookie(&http.Cookie{Name: "session_id", Value: "s2"})
+	page := httptest.NewRecorder()
+	e.posts.GetPost(page, req)
+	if !strings.Contains(page.Body.String(), "Комментарий отправлен на проверку") {
+		t.Error("post page must explain where the held comment went")
+	}
+	if n := countRows(e.db, "comments"); n != 0 {
+		t.Fatalf("held comment must not be published, comments = %d", n)
+	}
+	if got := held(t, e.db); len(got) != 1 || got[0] != "comment: Запрещённое слово «казино»" {
+		t.Fatalf("queue = %v", got)
+	}
+	if w := e.comment("s3", "Про казино здесь не пишем"); w.Code != http.StatusSeeOther || countRows(e.db, "comments") != 1 {
+		t.Error("moderators are not filtered")
+	}
+
+	// Новому аккаунту нельзя больше одной ссылки
+	e.db.Exec(`UPDATE users SET created_at = ? WHERE id = 2`, time.Now().UTC().Add(-time.Hour))
+	e.comment("s2", "Смотрите https://a.example и https://b.example")
+	e.comment("s2", "Смотрите https://a.example")
+	if got := held(t, e.db); len(got) != 2 || !strings.HasPrefix(got[1], "comment: Ссылок: 2") {
+		t.Errorf("queue = %v", got)
+	}
+
+	if w := e.decide("s2", 1, "approve"); w.Code != http.StatusForbidden {
+		t.Errorf("only moderators decide: %d", w.Code)
+	}
+	req = httptest.NewRequest(http.MethodGet, "/admin/spam", nil)
+	req.AddCookie(&http.Cookie{Name: "session_id", Value: "s3"})
+	w = httptest.NewRecorder()
+	e.admin.SpamQueue(w, req)
+	if body := w.Body.String(); !strings.Contains(body, "Лучшее КАЗИНО тут") || !strings.Contains(body, "Запрещённое слово") {
+		t.Error("queue page must show held content with the reason")
+	}
+
+	if w := e.decide("s3", 1, "approve"); w.Code != http.StatusSeeOther {
+		t.Fatalf("approve: %d", w.Code)
+	}
+	var author string
+	e.db.QueryRow(`SELECT u.username FROM comments c JOIN users u ON u.id = c.user_id WHERE c.content = 'Лучшее КАЗИНО тут'`).Scan(&author)
+	if author != "fan2" {
+		t.Error("approved comment must be published under its author")
+	}
+	if w := e.decide("s3", 1, "approve"); w.Code != http.StatusNotFound {
+		t.Errorf("decided item must leave the queue: %d", w.Code)
+	}
+	if w := e.decide("s3", 2, "spam"); w.Code != http.StatusSeeOther {
+		t.Fatalf("reject: %d", w.Code)
+	}
+	if countRows(e.db, "comments") != 3 || len(held(t, e.db)) != 0 {
+		t.Error("rejected comment must be dropped")
+	}
+	if corpusDocs(e.db, "ham") != 1 || corpusDocs(e.db, "spam") != 1 {
+		t.Errorf("decisions must train the classifier: ham %d, spam %d", corpusDocs(e.db, "ham"), corpusDocs(e.db, "spam"))
+	}
+	entries, _ := handlers.LoadModerationLog(e.db, 0, 10)
+	if len(entries) != 2 || entries[0].Text != "отклонил как спам" || !strings.Contains(entries[1].Details, "комментарий от fan2") {
+		t.Errorf("decisions must be logged: %+v", entries)
+	}
+}
+
+// Пока комментарий ждал проверки, обсуждение закрыли или автор поста
+// заблокировал пишущего: одобрение его не публикует
+func TestSpam_HeldCommentRechecksThread(t *testing.T) {
+	e := setupSpam(t)
+	e.comment("s2", "Лучшее КАЗИНО тут")
+	e.comment("s2", "Снова казино")
+
+	e.db.Exec(`UPDATE posts SET locked = TRUE WHERE id = 1`)
+	if w := e.decide("s3", 1, "approve"); w.Code != http.StatusSeeOther {
+		t.Fatalf("approve: %d", w.Code)
+	}
+	if n := countRows(e.db, "comments"); n != 0 {
+		t.Errorf("comment to a locked thread must not be published, comments = %d", n)
+	}
+
+	e.db.Exec(`UPDATE posts SET locked = FALSE WHERE id = 1`)
+	e.db.Exec(`INSERT INTO user_blocks (user_id, target_id, kind, created_at) VALUES (1, 2, 'block', datetime('now'))`)
+	if w := e.decide("s3", 2, "approve"); w.Code != http.StatusSeeOther {
+		t.Fatalf("approve: %d", w.Code)
+	}
+	if n := countRows(e.db, "comments"); n != 0 {
+		t.Errorf("comment from a blocked user must not be published, comments = %d", n)
+	}
+	if got := held(t, e.db); len(got) != 0 {
+		t.Errorf("rejected items must leave the queue: %v", got)
+	}
+}
+
+// Если публикация не удалась, заявка остаётся в очереди, а классификатор
+// не обучается
+func TestSpam_ApproveFailureKeepsItem(t *testing.T) {
+	e := setupSpam(t)
+	e.comment("s2", "Лучшее КАЗИНО тут")
+	e.db.Exec(`CREATE TRIGGER fail_comment BEFORE INSERT ON comments BEGIN SELECT RAISE(ABORT, 'сбой'); END`)
+
+	if w := e.decide("s3", 1, "approve"); w.Code != http.StatusInternalServerError {
+		t.Errorf("failed publish: %d", w.Code)
+	}
+	if got := held(t, e.db); len(got) != 1 {
+		t.Errorf("item must stay in the queue: %v", got)
+	}
+	if corpusDocs(e.db, "ham") != 0 || countRows(e.db, "moderation_log") != 0 {
+		t.Error("failed decision must not train the classifier or be logged")
+	}
+
+	e.db.Exec(`DROP TRIGGER fail_comment`)
+	if w := e.decide("s3", 1, "approve"); w.Code != http.StatusSeeOther || countRows(e.db, "comments") != 1 {
+		t.Errorf("retry must publish the comment: %d", w.Code)
+	}
+}
+
+func TestSpam_HeldPosts(t *testing.T) {
+	e := setupSpam(t)
+	create := func(form url.Values) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		e.posts.CreatePost(w, postForm("/create", "s1", form))
+		return w
+	}
+
+	w := create(url.Values{"title": {"Казино"}, "content": {"бонусы"}, "categories": {"1"}})
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/drafts" {
+		t.Fatalf("held post: %d %s", w.Code, w.Header().Get("Location"))
+	}
+	req := httptest.NewRequest(http.MethodGet, "/drafts", nil)
+	req.AddCookie(&http.Cookie{Name: "session_id", Value: "s1"})
+	for _, c := range w.Result().Cookies() {
+		req.AddCookie(c)
+	}
+	page := httptest.NewRecorder()
+	e.posts.Drafts(page, req)
+	if !strings.Contains(page.Body.String(), "Пост отправлен на проверку") {
+		t.Error("drafts page must show the hold notice")
+	}
+	drafts, _ := handlers.LoadDrafts(e.db, 1)
+	if countRows(e.db, "posts") != 1 || len(drafts) != 1 || !drafts[0].Held {
+		t.Fatalf("held post must wait in drafts: %+v", drafts)
+	}
+
+	// Изменённый черновик снимается с проверки
+	autosave(t, e.posts, "s1", url.Values{"draft_id": {"1"}, "title": {"Казино"}, "content": {"бонусы и фрибеты"}})
+	if got := held(t, e.db); len(got) != 0 {
+		t.Errorf("edited draft must leave the queue: %v", got)
+	}
+	create(url.Values{"draft_id": {"1"}, "title": {"Казино"}, "content": {"бонусы и фрибеты"}, "categories": {"1"}})
+	if e.decide("s3", 2, "approve"); countRows(e.db, "posts") != 2 || countRows(e.db, "drafts") != 0 {
+		t.Error("approved post must be published from the draft")
+	}
+
+	create(url.Values{"title": {"Снова казино"}, "content": {"бонусы"}, "categories": {"1"}})
+	e.decide("s3", 3, "spam")
+	if countRows(e.db, "posts") != 2 || countRows(e.db, "drafts") != 0 {
+		t.Error("rejected post must be deleted with its draft")
+	}
+
+	// Запланированный пост проверяется в момент публикации
+	at := time.Now().Add(time.Hour).Truncate(time.Minute)
+	create(url.Values{"action": {"schedule"}, "title": {"Анонс казино"}, "content": {"скоро"}, "categories": {"1"}, "publish_at": {at.Format("2006-01-02T15:04")}})
+	if published, err := e.posts.PublishDue(at.Add(time.Minute)); err != nil || published != 0 {
+		t.Fatalf("held scheduled post: %d %v", published, err)
+	}
+	drafts, _ = handlers.LoadDrafts(e.db, 1)
+	if len(drafts) != 1 || !drafts[0].Held || drafts[0].PublishAt != nil {
+		t.Errorf("scheduled post must be held and unscheduled: %+v", drafts)
+	}
+}
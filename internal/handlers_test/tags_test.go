@@ -0,0 +1,170 @@
+package handlers_test
+
+import (
+	"database/sql"
+	"errors"
+	"forum/internal/handlers"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func setupTags(t *testing.T) (*sql.DB, *handlers.PostHandler, *handlers.FilterHandler) {
+	db := setupTestDB(t)
+	t.Cleanup(func() { db.Close() })
+	db.Exec(`CREATE TABLE posts (id INTEGER PRIMARY KEY AUTOINCREMENT, user_id INTEGER, title TEXT, content TEXT, content_html TEXT NOT NULL DEFAULT '', created_at TIMESTAMP, likes INTEGER DEFAULT 0, dislikes INTEGER DEFAULT 0, reaction_counts TEXT NOT NULL DEFAULT '{}', comment_count INTEGER NOT NULL DEFAULT 0, last_activity_at DATETIME, locked BOOLEAN NOT NULL DEFAULT FALSE, pinned_at DATETIME, pinned_category_id INTEGER, archived_at DATETIME, unarchived_at DATETIME);`)
+	db.Exec(`CREATE TABLE categories (id INTEGER PRIMARY KEY, name TEXT, parent_id INTEGER, slug TEXT NOT NULL DEFAULT '', description TEXT NOT NULL DEFAULT '');`)
+	db.Exec(`CREATE TABLE post_categories (post_id INTEGER, category_id INTEGER);`)
+	db.Exec(`CREATE TABLE reactions (target_type TEXT, target_id INTEGER, user_id INTEGER, kind TEXT, created_at DATETIME DEFAULT CURRENT_TIMESTAMP);`)
+	db.Exec(`CREATE TABLE tags (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT UNIQUE, banned BOOLEAN NOT NULL DEFAULT FALSE, created_at DATETIME);`)
+	db.Exec(`CREATE TABLE tag_aliases (alias TEXT PRIMARY KEY, tag_id INTEGER);`)
+	db.Exec(`CREATE TABLE post_tags (post_id INTEGER, tag_id INTEGER, PRIMARY KEY (post_id, tag_id));`)
+	db.Exec(`INSERT INTO users (id, email, username, password) VALUES (1, 'a@example.com', 'fan1', 'x')`)
+	db.Exec(`INSERT INTO sessions (id, user_id, expires_at) VALUES ('s1', 1, datetime('now', '+1 hour'))`)
+	db.Exec(`INSERT INTO categories (id, name) VALUES (1, 'Футбол'), (2, 'Бокс')`)
+
+	tmpl := template.Must(template.New("").Funcs(handlers.TemplateFuncs()).ParseGlob("../../templates/*.html"))
+	errHandler := &handlers.ErrorHandler{Templates: tmpl}
+	return db,
+		&handlers.PostHandler{DB: db, Templates: tmpl, Err: errHandler},
+		&handlers.FilterHandler{DB: db, Templates: tmpl, Err: errHandler}
+}
+
+func createTaggedPost(t *testing.T, h *handlers.PostHandler, title, category, tags string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.CreatePost(w, postForm("/create", "s1", url.Values{
+		"title": {title}, "content": {"текст"}, "categories": {category}, "tags": {tags},
+	}))
+	return w
+}
+
+func postTitles(t *testing.T, db *sql.DB, filter handlers.PostFilter) string {
+	posts, err := handlers.GetFilteredPosts(db, filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var titles []string
+	for _, p := range posts {
+		titles = append(titles, p.Title)
+	}
+	return strings.Join(titles, ",")
+}
+
+func TestNormalizeTag(t *testing.T) {
+	tests := map[string]string{
+		"Футбол":              "футбол",
+		"#Лига Чемпионов":     "лига-чемпионов",
+		"  real_madrid  ":     "real-madrid",
+		"Евро--2024!":         "евро-2024",
+		"--":                  "",
+		"<script>":            "script",
+		"ЧМ   2026 (финал)":   "чм-2026-финал",
+		"tag-with-trailing- ": "tag-with-trailing",
+	}
+	for in, want := range tests {
+		if got := handlers.NormalizeTag(in); got != want {
+			t.Errorf("NormalizeTag(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestTags_FilterCombinesWithCategories(t *testing.T) {
+	db, posts, _ := setupTags(t)
+
+	createTaggedPost(t, posts, "A", "1", "Финал, #Лига Чемпионов, финал")
+	createTaggedPost(t, posts, "B", "1", "финал")
+	createTaggedPost(t, posts, "C", "2", "финал, лига-чемпионов")
+
+	var count int
+	db.QueryRow(`SELECT COUNT(*) FROM post_tags WHERE post_id = 1`).Scan(&count)
+	if count != 2 {
+		t.Errorf("tags must be normalized and deduplicated, got %d for post A", count)
+	}
+
+	if got := postTitles(t, db, handlers.PostFilter{Tags: []string{"финал"}}); strings.Count(got, ",") != 2 {
+		t.Errorf("tag filter must return all three posts: %s", got)
+	}
+	if got := postTitles(t, db, handlers.PostFilter{Tags: []string{"финал", "лига-чемпионов"}}); !(strings.Contains(got, "A") && strings.Contains(got, "C") && !strings.Contains(got, "B")) {
+		t.Errorf("all tags must match: %s", got)
+	}
+	if got := postTitles(t, db, handlers.PostFilter{Tags: []string{"лига-чемпионов"}, Categories: []string{"1"}}); got != "A" {
+		t.Errorf("tags must combine with categories: %s", got)
+	}
+}
+
+func TestTags_MergeCreatesAlias(t *testing.T) {
+	db, posts, filter := setupTags(t)
+
+	createTaggedPost(t, posts, "A", "1", "лч")
+	createTaggedPost(t, posts, "B", "1", "лига-чемпионов")
+
+	if err := handlers.MergeTags(db, "лч", "лига-чемпионов"); err != nil {
+		t.Fatal(err)
+	}
+	if got := postTitles(t, db, handlers.PostFilter{Tags: []string{"лига-чемпионов"}}); !strings.Contains(got, "A") || !strings.Contains(got, "B") {
+		t.Errorf("merged tag must include posts of both: %s", got)
+	}
+
+	// Синоним при создании поста заменяется основным тегом
+	createTaggedPost(t, posts, "C", "1", "ЛЧ")
+	var name string
+	db.QueryRow(`SELECT t.name FROM post_tags pt JOIN tags t ON t.id = pt.tag_id WHERE pt.post_id = 3`).Scan(&name)
+	if name != "лига-чемпионов" {
+		t.Errorf("alias must resolve to canonical tag, got %q", name)
+	}
+
+	// Страница синонима перенаправляет на основной тег
+	w := httptest.NewRecorder()
+	filter.TagPage(w, httptest.NewRequest(http.MethodGet, "/tag/"+url.PathEscape("лч")+"?category=1", nil))
+	if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "/tag/"+url.PathEscape("лига-чемпионов")+"?category=1" {
+		t.Errorf("expected redirect to canonical tag, got %d %s", w.Code, w.Header().Get("Location"))
+	}
+
+	w = httptest.NewRecorder()
+	filter.TagPage(w, httptest.NewRequest(http.MethodGet, "/tag/"+url.PathEscape("лига-чемпионов"), nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Посты с тегом #лига-чемпионов") {
+		t.Errorf("tag page: got %d", w.Code)
+	}
+
+	// Запрет синонима не сработал бы: его надо ставить на основной тег
+	var aliasErr *handlers.TagAliasError
+	if err := handlers.SetTagBanned(db, "ЛЧ", true); !errors.As(err, &aliasErr) || aliasErr.Canonical != "лига-чемпионов" {
+		t.Errorf("banning an alias must point to the canonical tag: %v", err)
+	}
+	if n := countRows(db, "tags"); n != 1 {
+		t.Errorf("refused ban must not create a tag, tags = %d", n)
+	}
+
+	suggestions, err := handlers.SuggestTags(db, "лч", 10)
+	if err != nil || len(suggestions) != 1 || suggestions[0] != "лига-чемпионов" {
+		t.Errorf("alias prefix must suggest canonical tag: %v %v", suggestions, err)
+	}
+}
+
+func TestTags_Ban(t *testing.T) {
+	db, posts, filter := setupTags(t)
+
+	createTaggedPost(t, posts, "A", "1", "флуд, финал")
+	if err := handlers.SetTagBanned(db, "флуд", true); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := postTitles(t, db, handlers.PostFilter{Tags: []string{"флуд"}}); got != "" {
+		t.Errorf("banned tag must be removed from posts: %s", got)
+	}
+	if w := createTaggedPost(t, posts, "B", "1", "Флуд"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "запрещён модераторами") {
+		t.Errorf("banned tag must be rejected on create, got %d", w.Code)
+	}
+	if s, _ := handlers.SuggestTags(db, "фл", 10); len(s) != 0 {
+		t.Errorf("banned tag must not be suggested: %v", s)
+	}
+
+	w := httptest.NewRecorder()
+	filter.TagPage(w, httptest.NewRequest(http.MethodGet, "/tag/"+url.PathEscape("флуд"), nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("banned tag page: expected 404, got %d", w.Code)
+	}
+}
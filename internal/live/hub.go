@@ -0,0 +1,181 @@
+// Package live — внутрипроцессный pub/sub для обновлений в реальном времени:
+// новые комментарии, реакции и посты доставляются подписчикам по темам
+// ("feed", "post:42").
+package live
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+)
+
+// Event — опубликованное событие. ID растут монотонно в пределах процесса,
+// поэтому клиент может продолжить с Last-Event-ID по любой теме.
+type Event struct {
+	ID    uint64
+	Topic string
+	Type  string
+	Data  []byte // JSON
+}
+
+// Hub рассылает события подписчикам и хранит последние из них для повтора
+// после переподключения. Медленный подписчик не тормозит остальных: если его
+// буфер переполнен, подписка закрывается, и клиент переподключается
+// с Last-Event-ID, добирая пропущенное из истории.
+type Hub struct {
+	mu      sync.Mutex
+	lastID  uint64
+	history []Event // кольцевой буфер
+	start   int     // индекс самого старого события в history
+	size    int     // сколько событий сейчас в history
+	subs    map[string]map[*Subscription]struct{}
+	buffer  int
+}
+
+// NewHub создаёт хаб, помнящий history последних событий; buffer — сколько
+// событий может ждать отправки одному подписчику.
+func NewHub(history, buffer int) *Hub {
+	return &Hub{
+		history: make([]Event, history),
+		subs:    map[string]map[*Subscription]struct{}{},
+		buffer:  buffer,
+	}
+}
+
+// Subscription — подписка на одну или несколько тем
+type Subscription struct {
+	C      <-chan Event
+	c      chan Event
+	topics []string
+	hub    *Hub
+	closed bool // под hub.mu
+	lagged bool // под hub.mu
+}
+
+// Publish рассылает событие темы. v кодируется в JSON. Безопасен для nil.
+func (h *Hub) Publish(topic, typ string, v interface{}) {
+	if h == nil {
+		return
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		log.Println("Ошибка кодирования события:", err)
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastID++
+	ev := Event{ID: h.lastID, Topic: topic, Type: typ, Data: data}
+	if len(h.history) > 0 {
+		if h.size < len(h.history) {
+			h.history[(h.start+h.size)%len(h.history)] = ev
+			h.size++
+		} else {
+			h.history[h.start] = ev
+			h.start = (h.start + 1) % len(h.history)
+		}
+	}
+
+	for sub := range h.subs[topic] {
+		select {
+		case sub.c <- ev:
+		default:
+			// Буфер полон — отключаем, клиент доберёт события при переподключении
+			sub.lagged = true
+			h.unsubscribe(sub)
+		}
+	}
+}
+
+// LastID возвращает ID последнего события. Страница передаёт его клиенту,
+// чтобы события между рендером и подключением не потерялись.
+func (h *Hub) LastID() uint64 {
+	if h == nil {
+		return 0
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.lastID
+}
+
+// Subscribe подписывает на темы и возвращает события после lastID для
+// повтора. complete == false, если часть из них уже вытеснена из истории —
+// тогда клиенту проще перезагрузить страницу.
+func (h *Hub) Subscribe(lastID uint64, topics ...string) (sub *Subscription, replay []Event, complete bool) {
+	c := make(chan Event, h.buffer)
+	sub = &Subscription{C: c, c: c, topics: topics, hub: h}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	complete = true
+	if lastID > h.lastID {
+		// ID из прошлого запуска сервера: нумерация началась заново
+		complete = false
+	} else if lastID > 0 && lastID < h.lastID {
+		oldest := h.lastID + 1
+		if h.size > 0 {
+			oldest = h.history[h.start].ID
+		}
+		complete = lastID+1 >= oldest
+		for i := 0; i < h.size; i++ {
+			ev := h.history[(h.start+i)%len(h.history)]
+			if ev.ID > lastID && contains(topics, ev.Topic) {
+				replay = append(replay, ev)
+			}
+		}
+	}
+
+	for _, topic := range topics {
+		if h.subs[topic] == nil {
+			h.subs[topic] = map[*Subscription]struct{}{}
+		}
+		h.subs[topic][sub] = struct{}{}
+	}
+	return sub, replay, complete
+}
+
+// Close отписывает и закрывает канал C. Повторный вызов безопасен.
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	s.hub.unsubscribe(s)
+}
+
+// Lagged сообщает, что подписка закрыта из-за переполнения буфера
+func (s *Subscription) Lagged() bool {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	return s.lagged
+}
+
+// Subscribers возвращает число подписчиков темы
+func (h *Hub) Subscribers(topic string) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subs[topic])
+}
+
+// unsubscribe вызывается под h.mu
+func (h *Hub) unsubscribe(s *Subscription) {
+	if s.closed {
+		return
+	}
+	s.closed = true
+	for _, topic := range s.topics {
+		delete(h.subs[topic], s)
+		if len(h.subs[topic]) == 0 {
+			delete(h.subs, topic)
+		}
+	}
+	close(s.c)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
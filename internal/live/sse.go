@@ -0,0 +1,70 @@
+package live
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Stream отдаёт события тем как text/event-stream, пока клиент не отключится.
+// Начальная позиция берётся из заголовка Last-Event-ID (его шлёт браузер при
+// переподключении) или параметра last_event_id (его подставляет страница).
+func (h *Hub) Stream(w http.ResponseWriter, r *http.Request, heartbeat time.Duration, topics ...string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Потоковая передача не поддерживается", http.StatusInternalServerError)
+		return
+	}
+
+	raw := r.Header.Get("Last-Event-ID")
+	if raw == "" {
+		raw = r.URL.Query().Get("last_event_id")
+	}
+	lastID, _ := strconv.ParseUint(raw, 10, 64)
+
+	sub, replay, complete := h.Subscribe(lastID, topics...)
+	defer sub.Close()
+
+	header := w.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("X-Accel-Buffering", "no") // nginx не должен буферизовать поток
+	w.WriteHeader(http.StatusOK)
+
+	// Переподключение через 3 секунды после обрыва
+	fmt.Fprint(w, "retry: 3000\n\n")
+	if !complete {
+		// Пропущенное уже не восстановить — пусть клиент перезагрузит данные
+		fmt.Fprintf(w, "id: %d\nevent: reset\ndata: {}\n\n", h.LastID())
+	}
+	for _, ev := range replay {
+		writeEvent(w, ev)
+	}
+	flusher.Flush()
+
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case ev, ok := <-sub.C:
+			if !ok {
+				// Не успевали читать: закрываем, клиент переподключится
+				// с Last-Event-ID и доберёт пропущенное из истории
+				return
+			}
+			writeEvent(w, ev)
+			flusher.Flush()
+		case <-ticker.C:
+			// Комментарий не даёт прокси закрыть простаивающее соединение
+			fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, ev Event) {
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.ID, ev.Type, ev.Data)
+}
@@ -0,0 +1,184 @@
+package live_test
+
+import (
+	"bufio"
+	"context"
+	"forum/internal/live"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func receive(t *testing.T, sub *live.Subscription) live.Event {
+	t.Helper()
+	select {
+	case ev, ok := <-sub.C:
+		if !ok {
+			t.Fatal("subscription closed")
+		}
+		return ev
+	case <-time.After(time.Second):
+		t.Fatal("no event")
+	}
+	return live.Event{}
+}
+
+func TestHub_DeliversByTopic(t *testing.T) {
+	hub := live.NewHub(16, 4)
+	post, _, _ := hub.Subscribe(0, "post:1")
+	feed, _, _ := hub.Subscribe(0, "feed", "post:1")
+
+	hub.Publish("post:2", "comment", map[string]int{"id": 1})
+	hub.Publish("post:1", "comment", map[string]int{"id": 2})
+
+	if ev := receive(t, post); ev.Type != "comment" || string(ev.Data) != `{"id":2}` || ev.ID != 2 {
+		t.Errorf("unexpected event %+v", ev)
+	}
+	if ev := receive(t, feed); ev.Topic != "post:1" {
+		t.Errorf("unexpected event %+v", ev)
+	}
+
+	post.Close()
+	post.Close() // повторное закрытие безопасно
+	if n := hub.Subscribers("post:1"); n != 1 {
+		t.Errorf("expected 1 subscriber after close, got %d", n)
+	}
+}
+
+func TestHub_Replay(t *testing.T) {
+	hub := live.NewHub(3, 4)
+	for i := 0; i < 3; i++ {
+		hub.Publish("post:1", "comment", i)
+	}
+	hub.Publish("post:2", "comment", 3)
+
+	// История хранит события 2..4; после ID 1 ничего не потеряно
+	sub, replay, complete := hub.Subscribe(1, "post:1")
+	defer sub.Close()
+	if !complete || len(replay) != 2 || replay[0].ID != 2 || replay[1].ID != 3 {
+		t.Errorf("replay after 1: complete=%v %+v", complete, replay)
+	}
+
+	// Без Last-Event-ID повторять нечего
+	if _, replay, complete := hub.Subscribe(0, "post:1"); !complete || replay != nil {
+		t.Errorf("fresh subscription must not replay: %v %+v", complete, replay)
+	}
+	hub.Publish("post:1", "comment", 4)
+	if _, _, complete := hub.Subscribe(1, "post:1"); complete {
+		t.Error("replay must be incomplete once events after Last-Event-ID are evicted")
+	}
+	if _, _, complete := hub.Subscribe(100, "post:1"); complete {
+		t.Error("ID from a previous server run must be reported as incomplete")
+	}
+}
+
+func TestHub_SlowSubscriberIsDropped(t *testing.T) {
+	hub := live.NewHub(16, 2)
+	slow, _, _ := hub.Subscribe(0, "feed")
+	fast, _, _ := hub.Subscribe(0, "feed")
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 5; i++ {
+			hub.Publish("feed", "post", i)
+			receive(t, fast)
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("a slow subscriber must not block publishing")
+	}
+
+	for range slow.C {
+	}
+	if !slow.Lagged() || hub.Subscribers("feed") != 1 {
+		t.Error("slow subscriber must be closed as lagged")
+	}
+	// Переподключение с последним полученным ID добирает пропущенное
+	_, replay, complete := hub.Subscribe(2, "feed")
+	if !complete || len(replay) != 3 {
+		t.Errorf("expected 3 missed events, complete=%v, got %d", complete, len(replay))
+	}
+}
+
+func TestHub_ConcurrentPublish(t *testing.T) {
+	hub := live.NewHub(1000, 1000)
+	sub, _, _ := hub.Subscribe(0, "feed")
+	var wg sync.WaitGroup
+	for g := 0; g < 10; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				hub.Publish("feed", "post", i)
+			}
+		}()
+	}
+	wg.Wait()
+	var last uint64
+	for i := 0; i < 500; i++ {
+		ev := receive(t, sub)
+		if ev.ID <= last {
+			t.Fatalf("IDs must increase: %d after %d", ev.ID, last)
+		}
+		last = ev.ID
+	}
+}
+
+func TestStream(t *testing.T) {
+	hub := live.NewHub(16, 4)
+	hub.Publish("feed", "post", 1)
+	hub.Publish("feed", "post", 2)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hub.Stream(w, r, 20*time.Millisecond, "feed")
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	req.Header.Set("Last-Event-ID", "1")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("content type %q", ct)
+	}
+
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+	read := func(want string) {
+		t.Helper()
+		timeout := time.After(time.Second)
+		for {
+			select {
+			case line := <-lines:
+				if line == want {
+					return
+				}
+			case <-timeout:
+				t.Fatalf("no line %q", want)
+			}
+		}
+	}
+
+	read("id: 2") // повтор пропущенного
+	read("data: 2")
+	hub.Publish("feed", "post", 3)
+	read("id: 3")
+	read("event: post")
+	read(": ping")
+}
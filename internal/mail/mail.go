@@ -0,0 +1,109 @@
+// Package mail собирает письма и отправляет их через сменный транспорт:
+// SMTP в продакшене или каталог с .eml-файлами при разработке и в тестах.
+package mail
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	netmail "net/mail"
+	"net/textproto"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Message — письмо с текстовой и HTML-версией
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+	// Дополнительные заголовки, например List-Unsubscribe
+	Headers map[string]string
+}
+
+// Transport доставляет письма
+type Transport interface {
+	Send(msg Message) error
+}
+
+// Compose собирает письмо в формате RFC 5322: multipart/alternative
+// с текстовой и HTML-частями в quoted-printable.
+func Compose(from string, msg Message, now time.Time) ([]byte, error) {
+	// Перевод строки в заголовке позволил бы дописать свои заголовки
+	values := []string{from, msg.To, msg.Subject}
+	for k, v := range msg.Headers {
+		values = append(values, k, v)
+	}
+	for _, v := range values {
+		if strings.ContainsAny(v, "\r\n") {
+			return nil, fmt.Errorf("перевод строки в заголовке письма: %q", v)
+		}
+	}
+
+	var buf bytes.Buffer
+	header := func(key, value string) {
+		fmt.Fprintf(&buf, "%s: %s\r\n", key, value)
+	}
+	// Имя отправителя кириллицей нужно закодировать
+	if addr, err := netmail.ParseAddress(from); err == nil {
+		from = addr.String()
+	}
+	header("From", from)
+	header("To", msg.To)
+	header("Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+	header("Date", now.Format(time.RFC1123Z))
+	header("Message-ID", "<"+randomID()+"@forum>")
+	header("MIME-Version", "1.0")
+
+	keys := make([]string, 0, len(msg.Headers))
+	for k := range msg.Headers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		header(k, msg.Headers[k])
+	}
+
+	mw := multipart.NewWriter(&buf)
+	header("Content-Type", "multipart/alternative; boundary="+mw.Boundary())
+	buf.WriteString("\r\n")
+
+	for _, part := range []struct{ contentType, body string }{
+		{"text/plain; charset=utf-8", msg.Text},
+		{"text/html; charset=utf-8", msg.HTML},
+	} {
+		if part.body == "" {
+			continue
+		}
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(w)
+		if _, err := qp.Write([]byte(part.body)); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func randomID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
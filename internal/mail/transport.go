@@ -0,0 +1,77 @@
+package mail
+
+import (
+	"fmt"
+	"net"
+	netmail "net/mail"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// FileDrop складывает письма .eml-файлами в каталог вместо отправки.
+// Подходит для разработки и тестов: письмо можно открыть почтовым клиентом.
+type FileDrop struct {
+	Dir  string
+	From string
+}
+
+func NewFileDrop(dir, from string) (*FileDrop, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("ошибка создания каталога писем: %w", err)
+	}
+	return &FileDrop{Dir: dir, From: from}, nil
+}
+
+func (f *FileDrop) Send(msg Message) error {
+	now := time.Now()
+	data, err := Compose(f.From, msg, now)
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.eml", now.UTC().Format("20060102T150405.000000000"), randomID()[:8])
+
+	// Пишем во временный файл и переименовываем, чтобы читатель каталога
+	// не увидел письмо наполовину
+	tmp, err := os.CreateTemp(f.Dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(f.Dir, name))
+}
+
+// SMTP отправляет письма через почтовый сервер. Авторизация PLAIN
+// используется, если задан Username (net/smtp разрешает её только по TLS).
+type SMTP struct {
+	Addr     string
+	Username string
+	Password string
+	From     string
+}
+
+func (s *SMTP) Send(msg Message) error {
+	data, err := Compose(s.From, msg, time.Now())
+	if err != nil {
+		return err
+	}
+	sender, err := netmail.ParseAddress(s.From)
+	if err != nil {
+		return fmt.Errorf("некорректный адрес отправителя %q: %w", s.From, err)
+	}
+	var auth smtp.Auth
+	if s.Username != "" {
+		host, _, _ := net.SplitHostPort(s.Addr)
+		auth = smtp.PlainAuth("", s.Username, s.Password, host)
+	}
+	return smtp.SendMail(s.Addr, auth, sender.Address, []string{msg.To}, data)
+}
@@ -0,0 +1,98 @@
+package mail_test
+
+import (
+	"forum/internal/mail"
+	"io"
+	"mime"
+	"mime/multipart"
+	netmail "net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCompose_MultipartAlternative(t *testing.T) {
+	data, err := mail.Compose("Форум <forum@example.com>", mail.Message{
+		To:      "fan@example.com",
+		Subject: "Дайджест форума",
+		Text:    "Привет, мир",
+		HTML:    "<p>Привет, мир</p>",
+		Headers: map[string]string{"List-Unsubscribe": "<https://forum.example.com/unsubscribe?u=1>"},
+	}, time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := netmail.ReadMessage(strings.NewReader(string(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil || subject != "Дайджест форума" {
+		t.Errorf("subject: %q %v", subject, err)
+	}
+	if from, err := msg.Header.AddressList("From"); err != nil || from[0].Address != "forum@example.com" || from[0].Name != "Форум" {
+		t.Errorf("from: %v %v", from, err)
+	}
+	if msg.Header.Get("List-Unsubscribe") == "" || msg.Header.Get("Message-Id") == "" {
+		t.Error("extra headers and Message-ID must be set")
+	}
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("content type: %q %v", mediaType, err)
+	}
+	parts := multipart.NewReader(msg.Body, params["boundary"])
+	var bodies []string
+	for {
+		part, err := parts.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(part) // quoted-printable декодируется читателем
+		bodies = append(bodies, part.Header.Get("Content-Type")+"|"+string(body))
+	}
+	if len(bodies) != 2 || !strings.HasPrefix(bodies[0], "text/plain") || !strings.HasSuffix(bodies[0], "Привет, мир") ||
+		!strings.HasPrefix(bodies[1], "text/html") || !strings.HasSuffix(bodies[1], "<p>Привет, мир</p>") {
+		t.Errorf("unexpected parts: %q", bodies)
+	}
+}
+
+func TestCompose_RejectsHeaderInjection(t *testing.T) {
+	_, err := mail.Compose("forum@example.com", mail.Message{
+		To:      "fan@example.com\r\nBcc: victim@example.com",
+		Subject: "x",
+		Text:    "x",
+	}, time.Now())
+	if err == nil {
+		t.Error("recipient with a line break must be rejected")
+	}
+}
+
+func TestFileDrop(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mail")
+	drop, err := mail.NewFileDrop(dir, "forum@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := drop.Send(mail.Message{To: "fan@example.com", Subject: "Тест", Text: "текст"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 messages, got %d", len(entries))
+	}
+	for _, e := range entries {
+		if !strings.HasSuffix(e.Name(), ".eml") {
+			t.Errorf("unexpected file %s", e.Name())
+		}
+	}
+}
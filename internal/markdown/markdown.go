@@ -0,0 +1,118 @@
+// Package markdown рендерит посты и комментарии: Markdown разбирает
+// goldmark (CommonMark и расширения GFM), результат чистит bluemonday.
+package markdown
+
+import (
+	"bytes"
+	"html"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// relExternal — rel внешних ссылок
+const relExternal = "nofollow noopener"
+
+// Парсеры goldmark по умолчанию без сырого HTML: теги во входных данных
+// остаются обычным текстом и экранируются
+var md = goldmark.New(
+	goldmark.WithParser(parser.NewParser(
+		parser.WithBlockParsers(
+			util.Prioritized(parser.NewSetextHeadingParser(), 100),
+			util.Prioritized(parser.NewThematicBreakParser(), 200),
+			util.Prioritized(parser.NewListParser(), 300),
+			util.Prioritized(parser.NewListItemParser(), 400),
+			util.Prioritized(parser.NewCodeBlockParser(), 500),
+			util.Prioritized(parser.NewATXHeadingParser(), 600),
+			util.Prioritized(parser.NewFencedCodeBlockParser(), 700),
+			util.Prioritized(parser.NewBlockquoteParser(), 800),
+			util.Prioritized(parser.NewParagraphParser(), 1000),
+		),
+		parser.WithInlineParsers(
+			util.Prioritized(parser.NewCodeSpanParser(), 100),
+			util.Prioritized(parser.NewLinkParser(), 200),
+			util.Prioritized(parser.NewAutoLinkParser(), 300),
+			util.Prioritized(parser.NewEmphasisParser(), 500),
+		),
+		parser.WithParagraphTransformers(parser.DefaultParagraphTransformers()...),
+		parser.WithASTTransformers(util.Prioritized(linkTransformer{}, 1000)),
+	)),
+	goldmark.WithExtensions(
+		extension.NewTable(extension.WithTableCellAlignMethod(extension.TableCellAlignStyle)),
+		extension.Strikethrough,
+		extension.Linkify,
+	),
+)
+
+// Render преобразует Markdown (CommonMark + таблицы, зачёркивание и
+// автоссылки GFM) в безопасный HTML. Сырой HTML во входных данных
+// экранируется, результат дополнительно проходит через Sanitize.
+func Render(src string) string {
+	var b bytes.Buffer
+	// Запись в bytes.Buffer не бывает неудачной, других ошибок Convert нет
+	md.Convert([]byte(src), &b)
+	return Sanitize(b.String())
+}
+
+// linkTransformer убирает ссылки и картинки с опасными адресами, оставляя
+// их текст, а внешним ссылкам ставит rel="nofollow noopener"
+type linkTransformer struct{}
+
+func (linkTransformer) Transform(doc *ast.Document, reader text.Reader, _ parser.Context) {
+	source := reader.Source()
+	var unsafe []ast.Node
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n := n.(type) {
+		case *ast.Link:
+			if !safeURL(destination(n.Destination)) {
+				unsafe = append(unsafe, n)
+				return ast.WalkSkipChildren, nil
+			}
+			n.SetAttributeString("rel", []byte(relExternal))
+		case *ast.Image:
+			if !safeURL(destination(n.Destination)) {
+				unsafe = append(unsafe, n)
+				return ast.WalkSkipChildren, nil
+			}
+		case *ast.AutoLink:
+			if n.AutoLinkType == ast.AutoLinkEmail {
+				break
+			}
+			if !safeURL(string(n.URL(source))) {
+				unsafe = append(unsafe, n)
+				break
+			}
+			n.SetAttributeString("rel", []byte(relExternal))
+		}
+		return ast.WalkContinue, nil
+	})
+
+	for _, n := range unsafe {
+		parent := n.Parent()
+		if autolink, ok := n.(*ast.AutoLink); ok {
+			// <javascript:...> остаётся текстом вместе со скобками
+			s := ast.NewString([]byte("<" + string(autolink.Label(source)) + ">"))
+			parent.ReplaceChild(parent, n, s)
+			continue
+		}
+		for c := n.FirstChild(); c != nil; {
+			next := c.NextSibling()
+			parent.InsertBefore(parent, n, c)
+			c = next
+		}
+		parent.RemoveChild(parent, n)
+	}
+}
+
+// destination — адрес ссылки, каким его увидит браузер: goldmark хранит
+// его с неразобранными сущностями (java&#x73;cript:)
+func destination(raw []byte) string {
+	return html.UnescapeString(string(raw))
+}
@@ -0,0 +1,136 @@
+package markdown
+
+import (
+	"html"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var reTag = regexp.MustCompile(`^<(/?)([a-zA-Z][a-zA-Z0-9]*)((?:\s+[a-zA-Z\-]+(?:="[^"<>]*")?)*)\s*/?>`)
+
+// Имя пользователя: латиница, цифры и подчёркивание, 3–20 символов
+const (
+	mentionMinLen = 3
+	mentionMaxLen = 20
+)
+
+func isMentionChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_'
+}
+
+// mentionAt возвращает имя из упоминания @name, начинающегося с позиции i.
+// Перед @ не должно быть буквы, цифры или точки, иначе это адрес почты.
+func mentionAt(s string, i int) (string, bool) {
+	if s[i] != '@' || wordCharBefore(s, i) || i > 0 && strings.IndexByte("@./_", s[i-1]) >= 0 {
+		return "", false
+	}
+	end := i + 1
+	for end < len(s) && isMentionChar(s[end]) {
+		end++
+	}
+	n := end - i - 1
+	if n < mentionMinLen || n > mentionMaxLen || end < len(s) && (s[end] == '@' || isWordChar(s, end)) {
+		return "", false
+	}
+	return s[i+1 : end], true
+}
+
+// Mentions возвращает имена из упоминаний @name в отрендеренном HTML без
+// повторов, в порядке появления. Упоминания в ссылках и коде не считаются.
+func Mentions(rendered string) []string {
+	var names []string
+	seen := map[string]bool{}
+	walkText(rendered, func(text string) string {
+		for i := 0; i < len(text); i++ {
+			if name, ok := mentionAt(text, i); ok {
+				if key := strings.ToLower(name); !seen[key] {
+					seen[key] = true
+					names = append(names, name)
+				}
+				i += len(name)
+			}
+		}
+		return text
+	})
+	return names
+}
+
+// LinkMentions превращает упоминания @name в ссылки. link возвращает адрес
+// для имени или false, если такого пользователя нет — тогда упоминание
+// остаётся текстом. Ссылки и код не затрагиваются.
+func LinkMentions(rendered string, link func(name string) (string, bool)) string {
+	return walkText(rendered, func(text string) string {
+		var b strings.Builder
+		last := 0
+		for i := 0; i < len(text); i++ {
+			name, ok := mentionAt(text, i)
+			if !ok {
+				continue
+			}
+			if href, found := link(name); found {
+				b.WriteString(text[last:i])
+				b.WriteString(`<a href="` + html.EscapeString(href) + `">@` + name + "</a>")
+				last = i + 1 + len(name)
+			}
+			i += len(name)
+		}
+		b.WriteString(text[last:])
+		return b.String()
+	})
+}
+
+// walkText применяет fn к текстовым участкам HTML вне <a>, <code> и <pre>.
+// Рассчитана на вывод Render: теги в нём корректны, текст экранирован.
+func walkText(s string, fn func(text string) string) string {
+	var b strings.Builder
+	depth := 0
+	for i := 0; i < len(s); {
+		if s[i] == '<' {
+			end := strings.IndexByte(s[i:], '>')
+			if end < 0 {
+				b.WriteString(s[i:])
+				break
+			}
+			tag := s[i : i+end+1]
+			if m := reTag.FindStringSubmatch(tag); m != nil {
+				switch strings.ToLower(m[2]) {
+				case "a", "code", "pre":
+					if m[1] == "/" {
+						depth--
+					} else {
+						depth++
+					}
+				}
+			}
+			b.WriteString(tag)
+			i += end + 1
+			continue
+		}
+		next := strings.IndexByte(s[i:], '<')
+		if next < 0 {
+			next = len(s) - i
+		}
+		if depth > 0 {
+			b.WriteString(s[i : i+next])
+		} else {
+			b.WriteString(fn(s[i : i+next]))
+		}
+		i += next
+	}
+	return b.String()
+}
+
+func isWordChar(s string, i int) bool {
+	r, _ := utf8.DecodeRuneInString(s[i:])
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func wordCharBefore(s string, i int) bool {
+	if i == 0 {
+		return false
+	}
+	r, _ := utf8.DecodeLastRuneInString(s[:i])
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
@@ -0,0 +1,63 @@
+package markdown
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/microcosm-cc/bluemonday"
+)
+
+// policy — разрешённые теги и атрибуты. Всё остальное из HTML вырезается.
+var policy = func() *bluemonday.Policy {
+	p := bluemonday.NewPolicy()
+	p.AllowElements("p", "br", "hr", "h1", "h2", "h3", "h4", "h5", "h6",
+		"strong", "em", "del", "blockquote", "pre", "code", "ul", "li",
+		"table", "thead", "tbody", "tr")
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^language-[a-zA-Z0-9_+\-#.]+$`)).OnElements("code")
+	p.AllowAttrs("start").Matching(regexp.MustCompile(`^[0-9]{1,9}$`)).OnElements("ol")
+	p.AllowElements("ol")
+	p.AllowAttrs("href", "title").OnElements("a")
+	p.AllowAttrs("rel").Matching(regexp.MustCompile(`^` + relExternal + `$`)).OnElements("a")
+	p.AllowAttrs("src", "alt", "title").OnElements("img")
+	p.AllowStyles("text-align").MatchingEnum("left", "center", "right").OnElements("th", "td")
+	p.AllowElements("th", "td")
+	p.AllowURLSchemes("http", "https", "mailto")
+	p.AllowRelativeURLs(true)
+	p.RequireParseableURLs(true)
+	return p
+}()
+
+// Sanitize оставляет в HTML только разрешённые теги и атрибуты
+func Sanitize(s string) string {
+	return policy.Sanitize(s)
+}
+
+// safeURL разрешает http(s), mailto и относительные ссылки
+func safeURL(raw string) bool {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return false
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https", "mailto":
+		return true
+	case "":
+		// В относительной ссылке двоеточие допустимо только после / ? или #,
+		// иначе браузер может увидеть в нём схему (java&#x73;cript: и т.п.)
+		if strings.ContainsRune(raw, '\\') {
+			return false
+		}
+		colon := strings.IndexByte(raw, ':')
+		if colon < 0 {
+			return true
+		}
+		sep := strings.IndexAny(raw, "/?#")
+		return sep >= 0 && sep < colon
+	}
+	return false
+}
@@ -0,0 +1,197 @@
+package markdown_test
+
+import (
+	"fmt"
+	"forum/internal/markdown"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{"paragraph", "Привет, мир", "<p>Привет, мир</p>\n"},
+		{"heading", "## Матч", "<h2>Матч</h2>\n"},
+		{"setext heading", "Итоги\n=====", "<h1>Итоги</h1>\n"},
+		{"emphasis", "*a* **b** ***c***", "<p><em>a</em> <strong>b</strong> <em><strong>c</strong></em></p>\n"},
+		{"intraword underscore", "snake_case_name", "<p>snake_case_name</p>\n"},
+		{"strikethrough", "~~ничья~~ победа", "<p><del>ничья</del> победа</p>\n"},
+		{"code span", "`a < b`", "<p><code>a &lt; b</code></p>\n"},
+		{"fenced code", "```go\nx := 1\n```", "<pre><code class=\"language-go\">x := 1\n</code></pre>\n"},
+		{"blockquote", "> цитата\nпродолжение", "<blockquote>\n<p>цитата\nпродолжение</p>\n</blockquote>\n"},
+		{"bullet list", "- один\n- два", "<ul>\n<li>один</li>\n<li>два</li>\n</ul>\n"},
+		{"ordered list", "3. три\n4. четыре", "<ol start=\"3\">\n<li>три</li>\n<li>четыре</li>\n</ol>\n"},
+		{"thematic break", "***", "<hr>\n"},
+		{"hard break", "a  \nb", "<p>a<br>\nb</p>\n"},
+		{"link", `[сайт](https://example.com "Заголовок")`,
+			"<p><a href=\"https://example.com\" title=\"Заголовок\" rel=\"nofollow noopener\">сайт</a></p>\n"},
+		{"link with parens", "[wiki](https://w.org/a_(b))",
+			"<p><a href=\"https://w.org/a_(b)\" rel=\"nofollow noopener\">wiki</a></p>\n"},
+		{"image", "![логотип](/static/logo.png)", "<p><img src=\"/static/logo.png\" alt=\"логотип\"></p>\n"},
+		{"bare url", "см. https://example.com/x.",
+			"<p>см. <a href=\"https://example.com/x\" rel=\"nofollow noopener\">https://example.com/x</a>.</p>\n"},
+		{"table", "| Команда | Очки |\n|:--|--:|\n| А | 3 |",
+			"<table>\n<thead>\n<tr>\n<th style=\"text-align: left\">Команда</th>\n<th style=\"text-align: right\">Очки</th>\n</tr>\n</thead>\n" +
+				"<tbody>\n<tr>\n<td style=\"text-align: left\">А</td>\n<td style=\"text-align: right\">3</td>\n</tr>\n</tbody>\n</table>\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := markdown.Render(tt.in); got != tt.want {
+				t.Errorf("Render(%q)\n got %q\nwant %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRender_Sanitizes(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{"script tag", "<script>alert(1)</script>", "<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>\n"},
+		{"event handler", `<img src=x onerror="alert(1)">`, "<p>&lt;img src=x onerror=&#34;alert(1)&#34;&gt;</p>\n"},
+		{"javascript link", "[клик](javascript:alert(1))", "<p>клик</p>\n"},
+		{"mixed case scheme", "[x](JaVaScRiPt:alert(1))", "<p>x</p>\n"},
+		{"entity in scheme", "[x](java&#x73;cript:alert(1))", "<p>x</p>\n"},
+		{"data uri image", "![x](data:text/html;base64,PHNjcmlwdD4=)", "<p>x</p>\n"},
+		{"javascript autolink", "<javascript:alert(1)>", "<p>&lt;javascript:alert(1)&gt;</p>\n"},
+		{"quote in title", `[x](/a "\" onmouseover=\"alert(1)")`, "<p><a href=\"/a\" title=\"&#34; onmouseover=&#34;alert(1)\" rel=\"nofollow noopener\">x</a></p>\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := markdown.Render(tt.in); got != tt.want {
+				t.Errorf("Render(%q)\n got %q\nwant %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	in := `<p onclick="x()">ok</p><iframe src="https://evil"></iframe><a href="vbscript:x" title="t">a</a><code class="language-go evil">c</code>`
+	want := `<p>ok</p><a title="t">a</a><code>c</code>`
+	if got := markdown.Sanitize(in); got != want {
+		t.Errorf("Sanitize\n got %q\nwant %q", got, want)
+	}
+}
+
+func TestMentions(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{"plain", "привет, @sportfan3 и @Fan_4!", "sportfan3,Fan_4"},
+		{"duplicates ignore case", "@fan1 @FAN1 @fan1", "fan1"},
+		{"email", "пишите на fan@example.com", ""},
+		{"too short and too long", "@ab @abcdefghijklmnopqrstu", ""},
+		{"code", "`@fan1` и\n\n    @fan2\n\n@fan3", "fan3"},
+		{"link text", "[@fan1](https://example.com) @fan2", "fan2"},
+		{"word after", "@fan1ы @fan2.", "fan2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := strings.Join(markdown.Mentions(markdown.Render(tt.in)), ","); got != tt.want {
+				t.Errorf("Mentions(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLinkMentions(t *testing.T) {
+	known := func(name string) (string, bool) {
+		if strings.EqualFold(name, "fan1") {
+			return "/u/fan1", true
+		}
+		return "", false
+	}
+	got := markdown.LinkMentions(markdown.Render("@FAN1, @ghost и `@fan1`"), known)
+	want := "<p><a href=\"/u/fan1\">@FAN1</a>, @ghost и <code>@fan1</code></p>\n"
+	if got != want {
+		t.Errorf("LinkMentions\n got %q\nwant %q", got, want)
+	}
+}
+
+// allowedOutput — теги и атрибуты, которые может содержать вывод
+var allowedOutput = map[string]map[string]bool{
+	"p": {}, "br": {}, "hr": {},
+	"h1": {}, "h2": {}, "h3": {}, "h4": {}, "h5": {}, "h6": {},
+	"strong": {}, "em": {}, "del": {}, "blockquote": {},
+	"pre": {}, "code": {"class": true},
+	"ul": {}, "ol": {"start": true}, "li": {},
+	"a":     {"href": true, "title": true, "rel": true},
+	"img":   {"src": true, "alt": true, "title": true},
+	"table": {}, "thead": {}, "tbody": {}, "tr": {},
+	"th": {"style": true}, "td": {"style": true},
+}
+
+// checkSafe разбирает HTML так же, как браузер, и ищет недопустимые теги,
+// атрибуты и схемы ссылок
+func checkSafe(out string) error {
+	z := html.NewTokenizer(strings.NewReader(out))
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return nil
+		case html.StartTagToken, html.SelfClosingTagToken:
+			tok := z.Token()
+			attrs, ok := allowedOutput[tok.Data]
+			if !ok {
+				return fmt.Errorf("tag <%s>", tok.Data)
+			}
+			for _, a := range tok.Attr {
+				if !attrs[a.Key] {
+					return fmt.Errorf("attribute %s on <%s>", a.Key, tok.Data)
+				}
+				if (a.Key == "href" || a.Key == "src") && !safeScheme(a.Val) {
+					return fmt.Errorf("%s=%q", a.Key, a.Val)
+				}
+			}
+		}
+	}
+}
+
+// safeScheme — у адреса нет схемы или она http(s) либо mailto. Браузер
+// выбрасывает из адреса пробельные символы, поэтому они не в счёт.
+func safeScheme(raw string) bool {
+	value := strings.Map(func(r rune) rune {
+		if r <= ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToLower(raw))
+	colon := strings.IndexByte(value, ':')
+	if colon < 0 || strings.ContainsAny(value[:colon], "/?#") {
+		return true
+	}
+	switch value[:colon] {
+	case "http", "https", "mailto":
+		return true
+	}
+	return false
+}
+
+func FuzzRender(f *testing.F) {
+	for _, seed := range []string{
+		"*a* **b** [x](https://example.com)",
+		"<script>alert(1)</script>",
+		`<img src=x onerror="alert(1)">`,
+		"[x](java&#x73;cript:alert(1))",
+		"![x](data:text/html;base64,PHNjcmlwdD4=)",
+		"<javascript:alert(1)>",
+		`[x](/a "\" onmouseover=\"alert(1)")`,
+		"| a |\n|---|\n| <b onclick=x> |",
+		"```\"><script>\n```",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, src string) {
+		if err := checkSafe(markdown.Render(src)); err != nil {
+			t.Fatalf("Render(%q): %v", src, err)
+		}
+		if err := checkSafe(markdown.Sanitize(src)); err != nil {
+			t.Fatalf("Sanitize(%q): %v", src, err)
+		}
+	})
+}
@@ -0,0 +1,167 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	_ "image/gif" // регистрирует декодер GIF для image.Decode
+	"image/jpeg"
+	"image/png"
+	"net/http"
+)
+
+var (
+	ErrTooLarge    = errors.New("файл слишком большой")
+	ErrUnsupported = errors.New("поддерживаются только изображения JPEG, PNG, GIF и WebP")
+	ErrDimensions  = errors.New("недопустимый размер изображения")
+	ErrCorrupt     = errors.New("файл повреждён или не является изображением")
+)
+
+// Limits — ограничения на загружаемые изображения
+type Limits struct {
+	MaxBytes  int64
+	MaxWidth  int
+	MaxHeight int
+	// Предел ширины × высоты: декодированный пиксель занимает 4 байта,
+	// и 8000×8000 развернулись бы в 256 МБ. 0 — без предела.
+	MaxPixels int
+	// Длинная сторона миниатюры в пикселях
+	ThumbSize int
+}
+
+// Image — проверенное изображение, готовое к сохранению
+type Image struct {
+	Data   []byte // без EXIF и других метаданных
+	MIME   string
+	Width  int
+	Height int
+	// Миниатюра; nil, если изображение и так не больше ThumbSize
+	// или формат не удаётся декодировать (WebP)
+	Thumb     []byte
+	ThumbMIME string
+}
+
+// Process проверяет загруженный файл по содержимому (а не по имени или
+// заголовкам клиента), вырезает метаданные и строит миниатюру.
+func Process(data []byte, lim Limits) (*Image, error) {
+	if int64(len(data)) > lim.MaxBytes {
+		return nil, ErrTooLarge
+	}
+
+	img := &Image{MIME: http.DetectContentType(data)}
+	var err error
+	switch img.MIME {
+	case "image/jpeg", "image/png", "image/gif":
+		var cfg image.Config
+		cfg, _, err = image.DecodeConfig(bytes.NewReader(data))
+		img.Width, img.Height = cfg.Width, cfg.Height
+	case "image/webp":
+		img.Width, img.Height, err = webpSize(data)
+	default:
+		return nil, ErrUnsupported
+	}
+	if err != nil {
+		return nil, ErrCorrupt
+	}
+	// Размеры проверяем до декодирования, чтобы маленький файл
+	// не развернулся в гигабайты пикселей
+	if img.Width <= 0 || img.Height <= 0 || img.Width > lim.MaxWidth || img.Height > lim.MaxHeight {
+		return nil, ErrDimensions
+	}
+	if lim.MaxPixels > 0 && int64(img.Width)*int64(img.Height) > int64(lim.MaxPixels) {
+		return nil, ErrDimensions
+	}
+
+	orientation := 1
+	if img.MIME == "image/jpeg" {
+		orientation = jpegOrientation(data)
+	}
+	if img.Data, err = Strip(img.MIME, data); err != nil {
+		return nil, ErrCorrupt
+	}
+	if img.MIME == "image/webp" {
+		return img, nil
+	}
+
+	decoded, _, err := image.Decode(bytes.NewReader(img.Data))
+	if err != nil {
+		return nil, ErrCorrupt
+	}
+	if orientation > 1 {
+		// Вместе с EXIF пропал бы и поворот, поэтому применяем его к пикселям
+		decoded = orient(decoded, orientation)
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, decoded, &jpeg.Options{Quality: 90}); err != nil {
+			return nil, err
+		}
+		img.Data = buf.Bytes()
+		img.Width, img.Height = decoded.Bounds().Dx(), decoded.Bounds().Dy()
+	}
+
+	if img.Width <= lim.ThumbSize && img.Height <= lim.ThumbSize {
+		return img, nil
+	}
+	thumb := Thumbnail(decoded, lim.ThumbSize)
+	var buf bytes.Buffer
+	if opaque(thumb) {
+		img.ThumbMIME = "image/jpeg"
+		err = jpeg.Encode(&buf, thumb, &jpeg.Options{Quality: 85})
+	} else {
+		// Прозрачность JPEG не поддерживает
+		img.ThumbMIME = "image/png"
+		err = png.Encode(&buf, thumb)
+	}
+	if err != nil {
+		return nil, err
+	}
+	img.Thumb = buf.Bytes()
+	return img, nil
+}
+
+func opaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	return false
+}
+
+// webpSize читает размеры из заголовка WebP: стандартная библиотека
+// не умеет декодировать этот формат.
+func webpSize(data []byte) (int, int, error) {
+	if len(data) < 30 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return 0, 0, ErrCorrupt
+	}
+	// Первый чанк должен целиком помещаться в файл
+	size := int(binary.LittleEndian.Uint32(data[16:20]))
+	if size < 0 || size > len(data)-20 {
+		return 0, 0, ErrCorrupt
+	}
+	chunk := data[20 : 20+size]
+	switch string(data[12:16]) {
+	case "VP8 ":
+		// Кадр с потерями: 3 байта тега кадра, стартовый код 9d 01 2a
+		if size < 10 || chunk[3] != 0x9d || chunk[4] != 0x01 || chunk[5] != 0x2a {
+			return 0, 0, ErrCorrupt
+		}
+		w := int(binary.LittleEndian.Uint16(chunk[6:8]) & 0x3fff)
+		h := int(binary.LittleEndian.Uint16(chunk[8:10]) & 0x3fff)
+		return w, h, nil
+	case "VP8L":
+		// Без потерь: сигнатура 0x2f, затем по 14 бит ширины-1 и высоты-1
+		if size < 5 || chunk[0] != 0x2f {
+			return 0, 0, ErrCorrupt
+		}
+		bits := binary.LittleEndian.Uint32(chunk[1:5])
+		return int(bits&0x3fff) + 1, int(bits>>14&0x3fff) + 1, nil
+	case "VP8X":
+		// Расширенный формат: 24-битные ширина-1 и высота-1
+		if size < 10 {
+			return 0, 0, ErrCorrupt
+		}
+		w := int(chunk[4]) | int(chunk[5])<<8 | int(chunk[6])<<16
+		h := int(chunk[7]) | int(chunk[8])<<8 | int(chunk[9])<<16
+		return w + 1, h + 1, nil
+	}
+	return 0, 0, ErrCorrupt
+}
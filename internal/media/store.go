@@ -0,0 +1,127 @@
+package media
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrNotFound — блоба с таким ключом нет в хранилище
+var ErrNotFound = errors.New("файл не найден")
+
+// Blob — открытое содержимое из хранилища
+type Blob interface {
+	io.ReadSeeker
+	io.Closer
+}
+
+// BlobStore хранит неизменяемые файлы, адресуемые по содержимому:
+// ключ — SHA-256 данных, поэтому одинаковые загрузки хранятся один раз.
+type BlobStore interface {
+	Put(data []byte) (key string, err error)
+	Open(key string) (Blob, time.Time, error)
+	Delete(key string) error
+}
+
+// Key возвращает ключ, под которым данные будут сохранены
+func Key(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// ValidKey проверяет, что строка похожа на ключ блоба (64 hex-символа).
+// Используется до обращения к диску, чтобы не допустить обхода путей.
+func ValidKey(key string) bool {
+	if len(key) != sha256.Size*2 {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// DiskStore раскладывает блобы по каталогам root/ab/cd/abcd...
+type DiskStore struct {
+	Root string
+}
+
+func NewDiskStore(root string) (*DiskStore, error) {
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, fmt.Errorf("ошибка создания каталога загрузок: %w", err)
+	}
+	return &DiskStore{Root: root}, nil
+}
+
+func (s *DiskStore) path(key string) string {
+	return filepath.Join(s.Root, key[:2], key[2:4], key)
+}
+
+func (s *DiskStore) Put(data []byte) (string, error) {
+	key := Key(data)
+	path := s.path(key)
+	if _, err := os.Stat(path); err == nil {
+		return key, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", err
+	}
+
+	// Пишем во временный файл и переименовываем, чтобы читатели
+	// никогда не увидели файл наполовину
+	tmp, err := os.CreateTemp(filepath.Dir(path), key+".*.tmp")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+func (s *DiskStore) Open(key string) (Blob, time.Time, error) {
+	if !ValidKey(key) {
+		return nil, time.Time{}, ErrNotFound
+	}
+	f, err := os.Open(s.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, time.Time{}, ErrNotFound
+	}
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, time.Time{}, err
+	}
+	return f, info.ModTime(), nil
+}
+
+func (s *DiskStore) Delete(key string) error {
+	if !ValidKey(key) {
+		return ErrNotFound
+	}
+	err := os.Remove(s.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrNotFound
+	}
+	return err
+}
@@ -0,0 +1,258 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+var errFormat = errors.New("неожиданная структура файла")
+
+// Strip удаляет из изображения метаданные (EXIF с геолокацией, XMP,
+// комментарии), не перекодируя пиксели.
+func Strip(mime string, data []byte) ([]byte, error) {
+	switch mime {
+	case "image/jpeg":
+		return stripJPEG(data)
+	case "image/png":
+		return stripPNG(data)
+	case "image/gif":
+		return stripGIF(data)
+	case "image/webp":
+		return stripWebP(data)
+	}
+	return nil, ErrUnsupported
+}
+
+// stripJPEG выбрасывает сегменты APP1 (EXIF, XMP), APP13 (IPTC) и COM.
+// APP0 (JFIF), APP2 (цветовой профиль) и APP14 (Adobe) нужны для
+// правильного отображения и остаются.
+func stripJPEG(data []byte) ([]byte, error) {
+	if len(data) < 4 || data[0] != 0xff || data[1] != 0xd8 {
+		return nil, errFormat
+	}
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:2])
+	for i := 2; ; {
+		if i+4 > len(data) || data[i] != 0xff {
+			return nil, errFormat
+		}
+		marker := data[i+1]
+		if marker == 0xff {
+			// Заполняющие байты между сегментами
+			i++
+			continue
+		}
+		if marker == 0xda {
+			// Начало сжатых данных: дальше метаданных нет
+			out.Write(data[i:])
+			return out.Bytes(), nil
+		}
+		end := i + 2 + int(binary.BigEndian.Uint16(data[i+2:i+4]))
+		if end > len(data) {
+			return nil, errFormat
+		}
+		switch marker {
+		case 0xe1, 0xed, 0xfe:
+		default:
+			out.Write(data[i:end])
+		}
+		i = end
+	}
+}
+
+// jpegOrientation возвращает тег Orientation из EXIF (1, если его нет)
+func jpegOrientation(data []byte) int {
+	for i := 2; i+4 <= len(data) && data[i] == 0xff; {
+		marker := data[i+1]
+		if marker == 0xda {
+			break
+		}
+		end := i + 2 + int(binary.BigEndian.Uint16(data[i+2:i+4]))
+		if end > len(data) {
+			break
+		}
+		if seg := data[i+4 : end]; marker == 0xe1 && bytes.HasPrefix(seg, []byte("Exif\x00\x00")) {
+			return exifOrientation(seg[6:])
+		}
+		i = end
+	}
+	return 1
+}
+
+// exifOrientation ищет тег 0x0112 в первом IFD заголовка TIFF
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	ifd := int(order.Uint32(tiff[4:8]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 1
+	}
+	count := int(order.Uint16(tiff[ifd:]))
+	for n := 0; n < count; n++ {
+		entry := ifd + 2 + n*12
+		if entry+12 > len(tiff) {
+			break
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			if v := int(order.Uint16(tiff[entry+8:])); v >= 1 && v <= 8 {
+				return v
+			}
+			break
+		}
+	}
+	return 1
+}
+
+// stripPNG выбрасывает чанки eXIf, tEXt, zTXt, iTXt и tIME
+func stripPNG(data []byte) ([]byte, error) {
+	const signature = "\x89PNG\r\n\x1a\n"
+	if !bytes.HasPrefix(data, []byte(signature)) {
+		return nil, errFormat
+	}
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.WriteString(signature)
+	for i := len(signature); i < len(data); {
+		if i+12 > len(data) {
+			return nil, errFormat
+		}
+		length := int(binary.BigEndian.Uint32(data[i:]))
+		end := i + 12 + length
+		if length < 0 || end > len(data) {
+			return nil, errFormat
+		}
+		kind := string(data[i+4 : i+8])
+		switch kind {
+		case "eXIf", "tEXt", "zTXt", "iTXt", "tIME":
+		default:
+			out.Write(data[i:end])
+		}
+		if kind == "IEND" {
+			return out.Bytes(), nil
+		}
+		i = end
+	}
+	return nil, errFormat
+}
+
+// stripGIF выбрасывает комментарии и расширения приложений, кроме
+// NETSCAPE2.0 (счётчик повторов анимации). XMP хранится именно там.
+func stripGIF(data []byte) ([]byte, error) {
+	if len(data) < 13 || !bytes.HasPrefix(data, []byte("GIF8")) {
+		return nil, errFormat
+	}
+	i := 13
+	if flags := data[10]; flags&0x80 != 0 {
+		i += 3 << (flags&0x07 + 1)
+	}
+	if i > len(data) {
+		return nil, errFormat
+	}
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:i])
+
+	// skipBlocks возвращает позицию после цепочки подблоков
+	skipBlocks := func(j int) (int, error) {
+		for j < len(data) {
+			size := int(data[j])
+			j += 1 + size
+			if size == 0 {
+				return j, nil
+			}
+		}
+		return 0, errFormat
+	}
+
+	for i < len(data) {
+		switch data[i] {
+		case 0x3b:
+			out.WriteByte(0x3b)
+			return out.Bytes(), nil
+		case 0x21:
+			if i+2 > len(data) {
+				return nil, errFormat
+			}
+			label := data[i+1]
+			end, err := skipBlocks(i + 2)
+			if err != nil {
+				return nil, err
+			}
+			keep := label != 0xfe
+			if label == 0xff {
+				keep = i+14 <= len(data) && data[i+2] == 11 && string(data[i+3:i+14]) == "NETSCAPE2.0"
+			}
+			if keep {
+				out.Write(data[i:end])
+			}
+			i = end
+		case 0x2c:
+			start := i
+			if i+10 > len(data) {
+				return nil, errFormat
+			}
+			flags := data[i+9]
+			i += 10
+			if flags&0x80 != 0 {
+				i += 3 << (flags&0x07 + 1)
+			}
+			// Минимальный размер кода LZW и сами данные кадра
+			end, err := skipBlocks(i + 1)
+			if err != nil {
+				return nil, err
+			}
+			out.Write(data[start:end])
+			i = end
+		default:
+			return nil, errFormat
+		}
+	}
+	// Некоторые программы не пишут завершающий байт
+	out.WriteByte(0x3b)
+	return out.Bytes(), nil
+}
+
+// stripWebP выбрасывает чанки EXIF и XMP и снимает их флаги в VP8X
+func stripWebP(data []byte) ([]byte, error) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, errFormat
+	}
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:12])
+	for i := 12; i < len(data); {
+		if i+8 > len(data) {
+			return nil, errFormat
+		}
+		size := int(binary.LittleEndian.Uint32(data[i+4:]))
+		end := i + 8 + size + size&1 // чанки выравниваются до чётной длины
+		if size < 0 || end > len(data) {
+			return nil, errFormat
+		}
+		switch string(data[i : i+4]) {
+		case "EXIF", "XMP ":
+		case "VP8X":
+			// Флаги лежат в первом байте данных, а весь чанк занимает 10 байт
+			if size < 10 {
+				return nil, ErrCorrupt
+			}
+			chunk := append([]byte(nil), data[i:end]...)
+			chunk[8] &^= 0x08 | 0x04
+			out.Write(chunk)
+		default:
+			out.Write(data[i:end])
+		}
+		i = end
+	}
+	stripped := out.Bytes()
+	binary.LittleEndian.PutUint32(stripped[4:8], uint32(len(stripped)-8))
+	return stripped, nil
+}
@@ -0,0 +1,92 @@
+package media
+
+import (
+	"image"
+	"image/draw"
+)
+
+// Thumbnail уменьшает изображение так, чтобы длинная сторона была не больше
+// size. Каждый пиксель результата — среднее по соответствующему блоку
+// исходника, поэтому мелкие детали (цифры на табло) не пропадают, как
+// при выборке ближайшего соседа.
+func Thumbnail(src image.Image, size int) *image.RGBA {
+	rgba := toRGBA(src)
+	sw, sh := rgba.Rect.Dx(), rgba.Rect.Dy()
+	dw, dh := sw, sh
+	if sw >= sh && sw > size {
+		dw, dh = size, max(1, sh*size/sw)
+	} else if sh > sw && sh > size {
+		dw, dh = max(1, sw*size/sh), size
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		y0, y1 := y*sh/dh, max((y+1)*sh/dh, y*sh/dh+1)
+		for x := 0; x < dw; x++ {
+			x0, x1 := x*sw/dw, max((x+1)*sw/dw, x*sw/dw+1)
+			var r, g, b, a, n int
+			for sy := y0; sy < y1; sy++ {
+				row := rgba.Pix[sy*rgba.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					p := row[sx*4 : sx*4+4]
+					r += int(p[0])
+					g += int(p[1])
+					b += int(p[2])
+					a += int(p[3])
+					n++
+				}
+			}
+			d := dst.Pix[y*dst.Stride+x*4:]
+			d[0], d[1], d[2], d[3] = uint8(r/n), uint8(g/n), uint8(b/n), uint8(a/n)
+		}
+	}
+	return dst
+}
+
+// orient применяет EXIF Orientation (2–8): отражения и повороты на 90°
+func orient(src image.Image, orientation int) image.Image {
+	rgba := toRGBA(src)
+	w, h := rgba.Rect.Dx(), rgba.Rect.Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2:
+				dx, dy = w-1-x, y
+			case 3:
+				dx, dy = w-1-x, h-1-y
+			case 4:
+				dx, dy = x, h-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = h-1-y, x
+			case 7:
+				dx, dy = h-1-y, w-1-x
+			case 8:
+				dx, dy = y, w-1-x
+			default:
+				dx, dy = x, y
+			}
+			copy(dst.Pix[dy*dst.Stride+dx*4:dy*dst.Stride+dx*4+4], rgba.Pix[y*rgba.Stride+x*4:])
+		}
+	}
+	return dst
+}
+
+// toRGBA приводит изображение к RGBA с началом координат в (0, 0)
+func toRGBA(src image.Image) *image.RGBA {
+	if rgba, ok := src.(*image.RGBA); ok && rgba.Rect.Min == (image.Point{}) {
+		return rgba
+	}
+	b := src.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Rect, src, b.Min, draw.Src)
+	return rgba
+}
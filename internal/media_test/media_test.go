@@ -0,0 +1,245 @@
+package media_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"forum/internal/media"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"testing"
+)
+
+var limits = media.Limits{MaxBytes: 1 << 20, MaxWidth: 2000, MaxHeight: 2000, MaxPixels: 1_000_000, ThumbSize: 100}
+
+func testImage(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{uint8(x), uint8(y), 100, 255})
+		}
+	}
+	return img
+}
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// withPNGChunk вставляет чанк сразу после IHDR
+func withPNGChunk(data []byte, kind string, payload []byte) []byte {
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(payload)))
+	chunk = append(chunk, kind...)
+	chunk = append(chunk, payload...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+	const ihdrEnd = 8 + 12 + 13
+	return append(append(append([]byte{}, data[:ihdrEnd]...), chunk...), data[ihdrEnd:]...)
+}
+
+// withEXIF вставляет в JPEG сегмент APP1 с тегом Orientation
+func withEXIF(data []byte, orientation uint16) []byte {
+	tiff := []byte("II*\x00\x08\x00\x00\x00")
+	tiff = binary.LittleEndian.AppendUint16(tiff, 1)
+	tiff = binary.LittleEndian.AppendUint16(tiff, 0x0112)
+	tiff = binary.LittleEndian.AppendUint16(tiff, 3)
+	tiff = binary.LittleEndian.AppendUint32(tiff, 1)
+	tiff = binary.LittleEndian.AppendUint16(tiff, orientation)
+	tiff = append(tiff, 0, 0, 0, 0, 0, 0) // выравнивание значения и следующий IFD
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+
+	seg := []byte{0xff, 0xe1}
+	seg = binary.BigEndian.AppendUint16(seg, uint16(len(payload)+2))
+	seg = append(seg, payload...)
+	return append(append(append([]byte{}, data[:2]...), seg...), data[2:]...)
+}
+
+func TestProcess_PNGStripsTextAndMakesThumbnail(t *testing.T) {
+	data := withPNGChunk(encodePNG(t, testImage(400, 200)), "tEXt", []byte("GPS\x0055.75,37.61"))
+
+	img, err := media.Process(data, limits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.MIME != "image/png" || img.Width != 400 || img.Height != 200 {
+		t.Errorf("unexpected image: %s %dx%d", img.MIME, img.Width, img.Height)
+	}
+	if bytes.Contains(img.Data, []byte("55.75")) {
+		t.Error("tEXt chunk must be stripped")
+	}
+	if _, err := png.Decode(bytes.NewReader(img.Data)); err != nil {
+		t.Errorf("stripped PNG must stay valid: %v", err)
+	}
+
+	thumb, _, err := image.Decode(bytes.NewReader(img.Thumb))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := thumb.Bounds(); b.Dx() != 100 || b.Dy() != 50 {
+		t.Errorf("thumbnail is %dx%d, want 100x50", b.Dx(), b.Dy())
+	}
+	if img.ThumbMIME != "image/jpeg" {
+		t.Errorf("opaque thumbnail must be JPEG, got %s", img.ThumbMIME)
+	}
+}
+
+func TestProcess_JPEGAppliesOrientationAndDropsEXIF(t *testing.T) {
+	var buf bytes.Buffer
+	jpeg.Encode(&buf, testImage(60, 20), nil)
+	data := withEXIF(buf.Bytes(), 6)
+
+	img, err := media.Process(data, limits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(img.Data, []byte("Exif")) {
+		t.Error("EXIF must be stripped")
+	}
+	// Поворот на 90° меняет стороны местами
+	if img.Width != 20 || img.Height != 60 {
+		t.Errorf("got %dx%d, want 20x60", img.Width, img.Height)
+	}
+	if img.Thumb != nil {
+		t.Error("small image must not get a thumbnail")
+	}
+}
+
+func TestProcess_GIFStripsComments(t *testing.T) {
+	var buf bytes.Buffer
+	gif.Encode(&buf, testImage(10, 10), nil)
+	data := buf.Bytes()
+	// Комментарий перед завершающим байтом
+	comment := append([]byte{0x21, 0xfe, 6}, "secret"...)
+	data = append(append(append([]byte{}, data[:len(data)-1]...), append(comment, 0)...), 0x3b)
+
+	img, err := media.Process(data, limits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(img.Data, []byte("secret")) {
+		t.Error("comment extension must be stripped")
+	}
+	if _, err := gif.Decode(bytes.NewReader(img.Data)); err != nil {
+		t.Errorf("stripped GIF must stay valid: %v", err)
+	}
+}
+
+func TestProcess_WebP(t *testing.T) {
+	riffChunk := func(kind string, payload []byte) []byte {
+		c := append([]byte(kind), binary.LittleEndian.AppendUint32(nil, uint32(len(payload)))...)
+		c = append(c, payload...)
+		if len(payload)%2 == 1 {
+			c = append(c, 0)
+		}
+		return c
+	}
+	// VP8X с флагом EXIF, размер 640x480
+	vp8x := []byte{0x08, 0, 0, 0, 0x7f, 0x02, 0, 0xdf, 0x01, 0}
+	// VP8L: сигнатура и 14-битные ширина-1 и высота-1
+	bits := uint32(639) | uint32(479)<<14
+	vp8l := append([]byte{0x2f}, binary.LittleEndian.AppendUint32(nil, bits)...)
+
+	body := append([]byte("WEBP"), riffChunk("VP8X", vp8x)...)
+	body = append(body, riffChunk("VP8L", vp8l)...)
+	body = append(body, riffChunk("EXIF", []byte("GPS 55.75"))...)
+	data := append([]byte("RIFF"), binary.LittleEndian.AppendUint32(nil, uint32(len(body)))...)
+	data = append(data, body...)
+
+	img, err := media.Process(data, limits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.MIME != "image/webp" || img.Width != 640 || img.Height != 480 {
+		t.Errorf("unexpected image: %s %dx%d", img.MIME, img.Width, img.Height)
+	}
+	if bytes.Contains(img.Data, []byte("GPS")) || img.Data[20]&0x08 != 0 {
+		t.Error("EXIF chunk and flag must be stripped")
+	}
+	if size := binary.LittleEndian.Uint32(img.Data[4:8]); int(size) != len(img.Data)-8 {
+		t.Errorf("RIFF size %d does not match %d", size, len(img.Data)-8)
+	}
+}
+
+func TestProcess_MalformedVP8X(t *testing.T) {
+	// Чанк VP8X нулевой длины, за ним нули до 40 байт
+	data := append([]byte("RIFF"), binary.LittleEndian.AppendUint32(nil, 32)...)
+	data = append(data, "WEBPVP8X"...)
+	data = append(data, make([]byte, 40-len(data))...)
+
+	if _, err := media.Process(data, limits); !errors.Is(err, media.ErrCorrupt) {
+		t.Errorf("Process: expected ErrCorrupt, got %v", err)
+	}
+	if _, err := media.Strip("image/webp", data); err == nil {
+		t.Error("Strip must reject a short VP8X chunk")
+	}
+}
+
+func TestProcess_Rejects(t *testing.T) {
+	big := encodePNG(t, image.NewGray(image.Rect(0, 0, 3000, 10)))
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"html disguised as image", []byte("<html><script>alert(1)</script></html>"), media.ErrUnsupported},
+		{"svg", []byte(`<svg xmlns="http://www.w3.org/2000/svg"></svg>`), media.ErrUnsupported},
+		{"too wide", big, media.ErrDimensions},
+		{"too many pixels", encodePNG(t, image.NewGray(image.Rect(0, 0, 1500, 1000))), media.ErrDimensions},
+		{"truncated png", encodePNG(t, testImage(10, 10))[:20], media.ErrCorrupt},
+		{"too many bytes", bytes.Repeat([]byte{0}, int(limits.MaxBytes)+1), media.ErrTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := media.Process(tt.data, limits); !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiskStore(t *testing.T) {
+	store, err := media.NewDiskStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := store.Put([]byte("счёт 2:1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, _ := store.Put([]byte("счёт 2:1"))
+	if key != again || key != media.Key([]byte("счёт 2:1")) {
+		t.Errorf("content-addressed keys differ: %s %s", key, again)
+	}
+
+	blob, _, err := store.Open(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(blob)
+	blob.Close()
+	if string(data) != "счёт 2:1" {
+		t.Errorf("read %q", data)
+	}
+
+	for _, bad := range []string{"../../etc/passwd", key[:10], key + "0"} {
+		if _, _, err := store.Open(bad); !errors.Is(err, media.ErrNotFound) {
+			t.Errorf("Open(%q) = %v, want ErrNotFound", bad, err)
+		}
+	}
+
+	if err := store.Delete(key); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := store.Open(key); !errors.Is(err, media.ErrNotFound) {
+		t.Errorf("deleted blob must be gone, got %v", err)
+	}
+}
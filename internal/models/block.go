@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// Block — пользователь, которого заглушили или заблокировали
+type Block struct {
+	UserID    int
+	Username  string
+	Kind      string // "mute" или "block"
+	CreatedAt time.Time
+}
@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// Bookmark — закладка пользователя на пост или комментарий
+type Bookmark struct {
+	TargetType string // post или comment
+	TargetID   int
+	PostID     int
+	FolderID   int // 0 — без папки
+	Folder     string
+	Note       string
+	CreatedAt  time.Time
+}
+
+// BookmarkFolder — папка закладок
+type BookmarkFolder struct {
+	ID    int
+	Name  string
+	Count int // закладок в папке
+}
+
+// SavedComment — комментарий из закладок со ссылкой на обсуждение
+type SavedComment struct {
+	Comment
+	PostTitle string
+	Bookmark  Bookmark
+}
@@ -1,14 +1,30 @@
 package models
 
-import "time"
+import (
+	"html/template"
+	"time"
+)
 
 type Comment struct {
-	ID        int
-	PostID    int
-	UserID    int
-	Author    string
-	Content   string
-	CreatedAt time.Time
-	Likes     int
-	Dislikes  int
+	ID     int
+	PostID int
+	UserID int
+	Author string
+	// Репутация автора на момент показа
+	AuthorReputation int
+	Content          string
+	// HTML из Markdown, уже очищенный санитайзером
+	ContentHTML template.HTML
+	CreatedAt   time.Time
+	Likes       int
+	Dislikes    int
+	// Счётчики всех видов реакций в порядке из настроек
+	Reactions []ReactionCount
+	// Вид реакции текущего пользователя ("like", "fire"…) или ""
+	Reaction string
+	// Ответ на комментарий ParentID (0 — комментарий к самому посту)
+	ParentID     int
+	ParentAuthor string
+	// Закладка текущего пользователя или nil
+	Bookmark *Bookmark
 }
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// Draft — черновик поста; с PublishAt — запланированный пост
+type Draft struct {
+	ID         int
+	UserID     int
+	Title      string
+	Content    string
+	Categories []string
+	Tags       string
+	Poll       string // JSON полей опроса из формы
+	PublishAt  *time.Time
+	Error      string // почему не удалась публикация по расписанию или после проверки
+	Images     int
+	Held       bool // ждёт проверки модераторами
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// HeldContent — пост или комментарий, задержанный фильтрами спама до
+// решения модератора
+type HeldContent struct {
+	ID         int
+	TargetType string // "post" или "comment"
+	UserID     int
+	Author     string
+	Joined     time.Time // регистрация автора
+	DraftID    int       // пост ждёт в черновиках автора
+	PostID     int       // комментарий: к какому посту
+	PostTitle  string
+	ParentID   int
+	Title      string
+	Content    string
+	Filter     string
+	Reason     string
+	Score      float64 // вероятность спама по классификатору
+	CreatedAt  time.Time
+}
@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// Conversation — личная переписка в списке входящих
+type Conversation struct {
+	ID    int
+	Title string // название группы; у диалога — имя собеседника
+	Group bool
+	// Участники, кроме текущего пользователя
+	Members       []string
+	LastMessage   string
+	LastAuthor    string
+	LastMessageAt time.Time
+	Unread        int
+}
+
+// Message — сообщение в переписке
+type Message struct {
+	ID             int
+	ConversationID int
+	UserID         int
+	Author         string
+	Content        string
+	CreatedAt      time.Time
+	// Для своих сообщений: кто из остальных участников уже прочитал
+	ReadBy []string
+}
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// ModerationEntry — запись журнала действий модераторов
+type ModerationEntry struct {
+	ID          int
+	ModeratorID int
+	Moderator   string
+	Action      string
+	Text        string // действие по-русски: «закрыл обсуждение»
+	TargetType  string
+	TargetID    int
+	TargetTitle string
+	Details     string
+	Reason      string
+	CreatedAt   time.Time
+}
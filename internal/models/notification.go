@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// Виды уведомлений
+const (
+	NotifyComment = "comment" // комментарий к вашему посту или посту из подписок
+	NotifyReply   = "reply"   // ответ на ваш комментарий
+	NotifyLike    = "like"    // лайк вашему посту или комментарию
+	NotifyMention = "mention" // упоминание @username
+	NotifyPost    = "post"    // новый пост в категории или от автора из подписок
+)
+
+// Notification — уведомление в готовом для показа виде
+type Notification struct {
+	ID        int
+	Kind      string
+	Text      string
+	Link      string
+	Read      bool
+	UpdatedAt time.Time
+}
+
+// Follow — подписка на пост, категорию или пользователя
+type Follow struct {
+	TargetType string
+	TargetID   int
+	Name       string
+	Link       string
+}
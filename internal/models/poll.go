@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// Когда участникам видны итоги опроса
+const (
+	PollResultsAlways = "always"
+	PollResultsVoted  = "voted"  // после своего голоса
+	PollResultsClosed = "closed" // только после закрытия
+)
+
+type Poll struct {
+	ID       int
+	PostID   int
+	Question string
+	Multiple bool
+	ClosesAt *time.Time
+	Results  string
+	Options  []PollOption
+	// Сколько пользователей проголосовало
+	Voters int
+
+	// Состояние для текущего пользователя
+	Closed      bool
+	Voted       bool
+	ShowResults bool
+}
+
+type PollOption struct {
+	ID      int
+	Text    string
+	Votes   int
+	Percent int // доля проголосовавших за вариант
+	Chosen  bool
+}
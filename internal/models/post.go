@@ -1,20 +1,78 @@
 package models
 
-import "time"
+import (
+	"html/template"
+	"time"
+)
 
 type Post struct {
-	ID         int
-	UserID     int
-	Title      string
-	Content    string
-	Categories []Category
-	CreatedAt  time.Time
-	Author     string
-	Likes      int
-	Dislikes   int
+	ID      int
+	UserID  int
+	Title   string
+	Content string
+	// HTML из Markdown, уже очищенный санитайзером
+	ContentHTML template.HTML
+	Categories  []Category
+	Tags        []Tag
+	Attachments []Attachment
+	CreatedAt   time.Time
+	Author      string
+	// Репутация автора на момент показа
+	AuthorReputation int
+	Likes            int
+	Dislikes         int
+	// Счётчики всех видов реакций в порядке из настроек
+	Reactions []ReactionCount
+	// Вид реакции текущего пользователя ("like", "fire"…) или ""
+	Reaction string
+	// Комментариев и время последнего из них (или создания поста)
+	CommentCount int
+	LastActivity time.Time
+	// Закладка текущего пользователя или nil
+	Bookmark *Bookmark
+	// Модерация: закрытое обсуждение, закрепление и архив
+	Locked bool
+	Pinned bool
+	// Категория, где закреплён пост; "" — закреплён везде
+	PinnedIn string
+	Archived bool
+}
+
+// ReactionCount — сколько реакций одного вида у поста или комментария
+type ReactionCount struct {
+	Kind  string
+	Emoji string
+	Title string
+	Count int
 }
 
 type Category struct {
-	ID   int
-	Name string
+	ID          int
+	Name        string
+	Slug        string
+	Description string
+	ParentID    int // 0 — корневая категория
+	Depth       int // уровень вложенности, 0 — корневая
+	Posts       int // постов в категории вместе с подкатегориями
+	Active      bool
+	Children    []*Category
+}
+
+type Tag struct {
+	ID     int
+	Name   string
+	Banned bool
+	Posts  int // число постов с тегом (для списков)
+}
+
+// Attachment — изображение, прикреплённое к посту
+type Attachment struct {
+	ID       int
+	PostID   int
+	Key      string // ключ оригинала в хранилище
+	ThumbKey string
+	MIME     string
+	Width    int
+	Height   int
+	Size     int64
 }
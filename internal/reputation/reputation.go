@@ -0,0 +1,203 @@
+// Package reputation считает репутацию пользователей по реакциям на их
+// посты и комментарии. Вклад реакции со временем затухает экспоненциально,
+// поэтому достаточно хранить у пользователя сумму очков и момент, на который
+// она посчитана: к любому другому моменту сумма приводится одним множителем.
+package reputation
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"time"
+
+	"forum/internal/config"
+)
+
+// Rules — очки за виды реакций и скорость затухания
+type Rules struct {
+	Weights  map[string]float64
+	HalfLife time.Duration // 0 — без затухания
+}
+
+// NewRules собирает правила из настроек: очки берутся из reputation.weights,
+// а для остальных видов — вес реакции
+func NewRules(cfg config.Reputation, kinds []config.Reaction) Rules {
+	rules := Rules{
+		Weights:  map[string]float64{},
+		HalfLife: time.Duration(cfg.HalfLifeDays * float64(24*time.Hour)),
+	}
+	for _, k := range kinds {
+		rules.Weights[k.Kind] = k.Weight
+	}
+	for kind, w := range cfg.Weights {
+		rules.Weights[kind] = w
+	}
+	return rules
+}
+
+// Points — очки автору за одну реакцию; виды не из настроек ничего не дают
+func (r Rules) Points(kind string) float64 {
+	return r.Weights[kind]
+}
+
+// Decay приводит сумму очков, посчитанную на момент from, к моменту to
+func (r Rules) Decay(score float64, from, to time.Time) float64 {
+	if r.HalfLife <= 0 || !to.After(from) {
+		return score
+	}
+	return score * math.Exp2(-float64(to.Sub(from))/float64(r.HalfLife))
+}
+
+// Current — репутация на момент now по сохранённым users.reputation и
+// users.reputation_at
+func (r Rules) Current(score float64, at sql.NullTime, now time.Time) float64 {
+	if !at.Valid {
+		return score
+	}
+	return r.Decay(score, at.Time, now)
+}
+
+// Display округляет репутацию для показа
+func Display(score float64) int {
+	return int(math.Round(score))
+}
+
+// queryRower — общее у *sql.DB и *sql.Tx
+type queryRower interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// Of возвращает текущую репутацию пользователя
+func Of(db queryRower, rules Rules, userID int, now time.Time) (float64, error) {
+	var score float64
+	var at sql.NullTime
+	err := db.QueryRow("SELECT reputation, reputation_at FROM users WHERE id = ?", userID).Scan(&score, &at)
+	if err != nil {
+		return 0, err
+	}
+	return rules.Current(score, at, now), nil
+}
+
+// Change — смена реакции на объект автора: прежняя реакция (если была,
+// поставлена в OldAt) заменяется новой (если есть, ставится в момент now)
+type Change struct {
+	AuthorID int
+	OldKind  string
+	OldAt    time.Time
+	NewKind  string
+}
+
+// Apply меняет репутацию автора в транзакции реакции. Вклад снимаемой
+// реакции уже затух с момента её появления, поэтому вычитается затухший.
+func Apply(tx *sql.Tx, rules Rules, c Change, now time.Time) error {
+	delta := 0.0
+	if c.OldKind != "" {
+		delta -= rules.Decay(rules.Points(c.OldKind), c.OldAt, now)
+	}
+	if c.NewKind != "" {
+		delta += rules.Points(c.NewKind)
+	}
+	score, err := Of(tx, rules, c.AuthorID, now)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("UPDATE users SET reputation = ?, reputation_at = ? WHERE id = ?", score+delta, now.UTC(), c.AuthorID)
+	return err
+}
+
+// received — реакции, полученные авторами, без реакций на собственные
+// посты и комментарии
+var received = []string{`
+	SELECT p.user_id, r.kind, r.created_at FROM reactions r
+	JOIN posts p ON r.target_type = 'post' AND p.id = r.target_id
+	WHERE r.user_id != p.user_id`, `
+	SELECT c.user_id, r.kind, r.created_at FROM reactions r
+	JOIN comments c ON r.target_type = 'comment' AND c.id = r.target_id
+	WHERE r.user_id != c.user_id`,
+}
+
+// Recalculate пересчитывает репутацию всех пользователей с нуля по таблице
+// реакций — после смены очков или затухания в настройках. Возвращает число
+// пользователей, чья репутация изменилась.
+func Recalculate(db *sql.DB, rules Rules, now time.Time) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	scores := map[int]float64{}
+	for _, query := range received {
+		if err := sumReceived(tx, query, rules, now, scores); err != nil {
+			return 0, err
+		}
+	}
+
+	type stored struct {
+		id    int
+		score float64
+		at    sql.NullTime
+	}
+	rows, err := tx.Query("SELECT id, reputation, reputation_at FROM users")
+	if err != nil {
+		return 0, err
+	}
+	var users []stored
+	for rows.Next() {
+		var u stored
+		if err := rows.Scan(&u.id, &u.score, &u.at); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		users = append(users, u)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	changed := 0
+	for _, u := range users {
+		// Расхождение меньше сотой очка — погрешность округления
+		if math.Abs(rules.Current(u.score, u.at, now)-scores[u.id]) >= 0.01 {
+			changed++
+		}
+		if _, err := tx.Exec("UPDATE users SET reputation = ?, reputation_at = ? WHERE id = ?", scores[u.id], now.UTC(), u.id); err != nil {
+			return changed, err
+		}
+	}
+	return changed, tx.Commit()
+}
+
+func sumReceived(tx *sql.Tx, query string, rules Rules, now time.Time, scores map[int]float64) error {
+	rows, err := tx.Query(query)
+	if err != nil {
+		return fmt.Errorf("ошибка чтения реакций: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var authorID int
+		var kind string
+		var created time.Time
+		if err := rows.Scan(&authorID, &kind, &created); err != nil {
+			return err
+		}
+		scores[authorID] += rules.Decay(rules.Points(kind), created, now)
+	}
+	return rows.Err()
+}
+
+// Stale сообщает, что репутация ещё не считалась: у автора есть полученные
+// реакции, а момент расчёта не записан. Так бывает после обновления форума —
+// Apply записывает момент при каждой реакции.
+func Stale(db *sql.DB) (bool, error) {
+	for _, query := range received {
+		var stale bool
+		err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM (` + query + `) got
+			JOIN users u ON u.id = got.user_id WHERE u.reputation_at IS NULL)`).Scan(&stale)
+		if err != nil || stale {
+			return stale, err
+		}
+	}
+	return false, nil
+}
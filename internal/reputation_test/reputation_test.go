@@ -0,0 +1,133 @@
+package reputation_test
+
+import (
+	"database/sql"
+	"math"
+	"testing"
+	"time"
+
+	"forum/internal/config"
+	"forum/internal/reputation"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func setupDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	db.SetMaxOpenConns(1)
+	_, err = db.Exec(`
+		CREATE TABLE users (id INTEGER PRIMARY KEY, username TEXT, reputation REAL NOT NULL DEFAULT 0, reputation_at DATETIME);
+		CREATE TABLE posts (id INTEGER PRIMARY KEY, user_id INTEGER);
+		CREATE TABLE comments (id INTEGER PRIMARY KEY, post_id INTEGER, user_id INTEGER);
+		CREATE TABLE reactions (target_type TEXT, target_id INTEGER, user_id INTEGER, kind TEXT, created_at DATETIME);
+		INSERT INTO users (id, username) VALUES (1, 'author'), (2, 'fan2'), (3, 'fan3');
+		INSERT INTO posts (id, user_id) VALUES (1, 1);
+		INSERT INTO comments (id, post_id, user_id) VALUES (1, 1, 2);
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestNewRules(t *testing.T) {
+	rules := reputation.NewRules(config.Reputation{
+		Weights:      map[string]float64{"fire": 5, "angry": 0},
+		HalfLifeDays: 30,
+	}, config.Default().Reactions)
+
+	for kind, want := range map[string]float64{"like": 1, "dislike": -1, "fire": 5, "angry": 0, "removed": 0} {
+		if got := rules.Points(kind); got != want {
+			t.Errorf("Points(%s) = %v, want %v", kind, got, want)
+		}
+	}
+
+	from := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	if got := rules.Decay(8, from, from.AddDate(0, 0, 60)); math.Abs(got-2) > 1e-9 {
+		t.Errorf("two half-lives must leave a quarter, got %v", got)
+	}
+	if got := rules.Decay(8, from, from.Add(-time.Hour)); got != 8 {
+		t.Errorf("no decay backwards in time, got %v", got)
+	}
+	if got := (reputation.Rules{}).Decay(8, from, from.AddDate(10, 0, 0)); got != 8 {
+		t.Errorf("zero half-life disables decay, got %v", got)
+	}
+}
+
+func TestRecalculate(t *testing.T) {
+	db := setupDB(t)
+	rules := reputation.NewRules(config.Reputation{HalfLifeDays: 10}, config.Default().Reactions)
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	db.Exec(`INSERT INTO reactions (target_type, target_id, user_id, kind, created_at) VALUES
+		('post', 1, 2, 'fire', ?),
+		('post', 1, 3, 'dislike', ?),
+		('post', 1, 1, 'clap', ?),
+		('comment', 1, 3, 'like', ?)`,
+		now, now.AddDate(0, 0, -10), now, now)
+
+	if stale, err := reputation.Stale(db); err != nil || !stale {
+		t.Fatalf("fresh database must be stale: %v %v", stale, err)
+	}
+	changed, err := reputation.Recalculate(db, rules, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed != 2 {
+		t.Errorf("changed = %d, want 2", changed)
+	}
+
+	// fire = 2, дизлайк десятидневной давности — половина от -1,
+	// реакция на собственный пост не считается
+	if got, _ := reputation.Of(db, rules, 1, now); math.Abs(got-1.5) > 1e-9 {
+		t.Errorf("author reputation = %v, want 1.5", got)
+	}
+	if got, _ := reputation.Of(db, rules, 2, now.AddDate(0, 0, 10)); math.Abs(got-0.5) > 1e-9 {
+		t.Errorf("comment author reputation after a half-life = %v, want 0.5", got)
+	}
+	if stale, _ := reputation.Stale(db); stale {
+		t.Error("recalculated database must not be stale")
+	}
+	if changed, _ := reputation.Recalculate(db, rules, now); changed != 0 {
+		t.Errorf("second run changed %d users", changed)
+	}
+}
+
+func TestApply(t *testing.T) {
+	db := setupDB(t)
+	rules := reputation.NewRules(config.Reputation{HalfLifeDays: 10}, config.Default().Reactions)
+	start := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	apply := func(c reputation.Change, now time.Time) {
+		t.Helper()
+		tx, err := db.Begin()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := reputation.Apply(tx, rules, c, now); err != nil {
+			t.Fatal(err)
+		}
+		tx.Commit()
+	}
+
+	apply(reputation.Change{AuthorID: 1, NewKind: "fire"}, start)
+	apply(reputation.Change{AuthorID: 1, NewKind: "like"}, start)
+	// Через период полураспада огонь меняют на лайк: снимается затухший огонь
+	later := start.AddDate(0, 0, 10)
+	apply(reputation.Change{AuthorID: 1, OldKind: "fire", OldAt: start, NewKind: "like"}, later)
+
+	got, _ := reputation.Of(db, rules, 1, later)
+	if math.Abs(got-1.5) > 1e-9 {
+		t.Errorf("reputation = %v, want 1.5", got)
+	}
+	// Инкрементальный расчёт совпадает с пересчётом с нуля
+	db.Exec(`INSERT INTO reactions (target_type, target_id, user_id, kind, created_at) VALUES
+		('post', 1, 2, 'like', ?), ('post', 1, 3, 'like', ?)`, start, later)
+	if changed, _ := reputation.Recalculate(db, rules, later); changed != 0 {
+		t.Error("incremental reputation must match recalculation")
+	}
+}
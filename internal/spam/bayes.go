@@ -0,0 +1,165 @@
+package spam
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"strings"
+	"unicode/utf8"
+)
+
+// Сколько разных слов текста учитывает классификатор и какой они длины
+const (
+	maxTokens      = 200
+	minTokenLength = 2
+	maxTokenLength = 30
+)
+
+// Classifier — наивный байесовский классификатор. Для каждого слова
+// хранится, в скольких спамных и обычных текстах оно встречалось
+// (spam_tokens), и сколько всего текстов каждого вида (spam_corpus).
+// Учится только на решениях модераторов, см. Train.
+type Classifier struct {
+	DB        *sql.DB
+	Threshold float64
+	// Пока спамных или обычных текстов меньше, классификатор молчит
+	MinTraining int
+}
+
+func (cl Classifier) Check(c Content) (*Flag, error) {
+	p, ok, err := cl.Probability(c.fullText())
+	if err != nil || !ok || p < cl.Threshold {
+		return nil, err
+	}
+	return &Flag{Filter: "bayes", Reason: fmt.Sprintf("Похоже на спам: %.0f%%", p*100), Score: p}, nil
+}
+
+// Probability — вероятность того, что текст спам. ok = false, пока
+// классификатор не обучен.
+//
+// Априорные вероятности не учитываются: на проверку попадает в основном
+// спам, и перекос выборки не должен задерживать обычные тексты.
+func (cl Classifier) Probability(text string) (p float64, ok bool, err error) {
+	spamDocs, hamDocs, err := corpus(cl.DB)
+	if err != nil {
+		return 0, false, err
+	}
+	if spamDocs == 0 || hamDocs == 0 || spamDocs < cl.MinTraining || hamDocs < cl.MinTraining {
+		return 0, false, nil
+	}
+	tokens := Tokens(text)
+	if len(tokens) == 0 {
+		return 0, false, nil
+	}
+
+	args := make([]interface{}, len(tokens))
+	for i, t := range tokens {
+		args[i] = t
+	}
+	rows, err := cl.DB.Query(`SELECT spam, ham FROM spam_tokens WHERE token IN (?`+
+		strings.Repeat(", ?", len(tokens)-1)+`)`, args...)
+	if err != nil {
+		return 0, false, fmt.Errorf("классификатор: %w", err)
+	}
+	defer rows.Close()
+
+	// Логарифм отношения правдоподобий со сглаживанием Лапласа
+	logRatio := 0.0
+	for rows.Next() {
+		var spam, ham int
+		if err := rows.Scan(&spam, &ham); err != nil {
+			return 0, false, fmt.Errorf("классификатор: %w", err)
+		}
+		logRatio += math.Log(float64(spam+1)/float64(spamDocs+2)) - math.Log(float64(ham+1)/float64(hamDocs+2))
+	}
+	if err := rows.Err(); err != nil {
+		return 0, false, fmt.Errorf("классификатор: %w", err)
+	}
+	return 1 / (1 + math.Exp(-logRatio)), true, nil
+}
+
+func corpus(db *sql.DB) (spamDocs, hamDocs int, err error) {
+	rows, err := db.Query(`SELECT label, docs FROM spam_corpus`)
+	if err != nil {
+		return 0, 0, fmt.Errorf("классификатор: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var label string
+		var docs int
+		if err := rows.Scan(&label, &docs); err != nil {
+			return 0, 0, fmt.Errorf("классификатор: %w", err)
+		}
+		if label == "spam" {
+			spamDocs = docs
+		} else {
+			hamDocs = docs
+		}
+	}
+	return spamDocs, hamDocs, rows.Err()
+}
+
+// execer — общее у *sql.DB и *sql.Tx
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// Train учит классификатор на решении модератора: isSpam — текст
+// отклонён как спам, иначе одобрен
+func Train(q execer, text string, isSpam bool) error {
+	label, spam, ham := "ham", 0, 1
+	if isSpam {
+		label, spam, ham = "spam", 1, 0
+	}
+	_, err := q.Exec(`
+		INSERT INTO spam_corpus (label, docs) VALUES (?, 1)
+		ON CONFLICT(label) DO UPDATE SET docs = docs + 1`, label)
+	if err != nil {
+		return err
+	}
+	for _, token := range Tokens(text) {
+		_, err := q.Exec(`
+			INSERT INTO spam_tokens (token, spam, ham) VALUES (?, ?, ?)
+			ON CONFLICT(token) DO UPDATE SET spam = spam + excluded.spam, ham = ham + excluded.ham`,
+			token, spam, ham)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Tokens — разные слова текста для классификатора: в нижнем регистре,
+// без слишком коротких и длинных. Ссылка даёт одно слово link:<домен>,
+// потому что спам выдаёт домен, а не путь.
+func Tokens(text string) []string {
+	seen := map[string]bool{}
+	var tokens []string
+	add := func(token string) {
+		if len(tokens) < maxTokens && !seen[token] {
+			seen[token] = true
+			tokens = append(tokens, token)
+		}
+	}
+	for _, link := range linkPattern.FindAllString(text, -1) {
+		add("link:" + linkHost(link))
+	}
+	for _, word := range words(linkPattern.ReplaceAllString(text, " ")) {
+		if n := utf8.RuneCountInString(word); n >= minTokenLength && n <= maxTokenLength {
+			add(word)
+		}
+	}
+	return tokens
+}
+
+// linkHost — домен ссылки без www.
+func linkHost(link string) string {
+	host := strings.ToLower(link)
+	if i := strings.Index(host, "://"); i >= 0 {
+		host = host[i+3:]
+	}
+	if i := strings.IndexAny(host, "/?#:"); i >= 0 {
+		host = host[:i]
+	}
+	return strings.TrimPrefix(host, "www.")
+}
@@ -0,0 +1,226 @@
+// Package spam проверяет посты и комментарии перед публикацией цепочкой
+// фильтров: запрещённые слова, ссылки от новых аккаунтов, повторы уже
+// опубликованного и байесовский классификатор, который учится на решениях
+// модераторов. Текст, на котором сработал фильтр, задерживается до проверки.
+package spam
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"forum/internal/config"
+)
+
+// Content — проверяемый текст и его автор
+type Content struct {
+	Kind   string // "post" или "comment"
+	UserID int
+	Joined time.Time // регистрация автора; нулевое — неизвестна
+	Title  string
+	Text   string
+	At     time.Time // момент публикации
+}
+
+func (c Content) fullText() string {
+	if c.Title == "" {
+		return c.Text
+	}
+	return c.Title + "\n" + c.Text
+}
+
+// Flag — почему текст задержан
+type Flag struct {
+	Filter string  // сработавший фильтр: blocklist, links, duplicate, bayes
+	Reason string  // пояснение для модератора
+	Score  float64 // вероятность спама по классификатору, если он высказался
+}
+
+// Filter — звено цепочки. nil без ошибки — текст фильтр прошёл.
+type Filter interface {
+	Check(c Content) (*Flag, error)
+}
+
+// Chain проверяет текст фильтрами по порядку до первого сработавшего.
+// Ошибка фильтра не мешает остальным: она возвращается, только если ни
+// один фильтр не сработал. Пустая цепочка пропускает всё.
+type Chain []Filter
+
+func (ch Chain) Check(c Content) (*Flag, error) {
+	var errs []error
+	for _, f := range ch {
+		flag, err := f.Check(c)
+		if flag != nil {
+			return flag, nil
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return nil, errors.Join(errs...)
+}
+
+// NewChain собирает цепочку из настроек: выключенные фильтры в неё не входят
+func NewChain(db *sql.DB, cfg config.Spam) (Chain, error) {
+	var ch Chain
+	if len(cfg.BlockedWords)+len(cfg.BlockedPatterns) > 0 {
+		blocklist, err := NewBlocklist(cfg.BlockedWords, cfg.BlockedPatterns)
+		if err != nil {
+			return nil, err
+		}
+		ch = append(ch, blocklist)
+	}
+	if cfg.NewAccountDays > 0 {
+		ch = append(ch, LinkLimit{
+			Age: time.Duration(cfg.NewAccountDays * float64(24*time.Hour)),
+			Max: cfg.NewAccountLinks,
+		})
+	}
+	if cfg.DuplicateWindowHours > 0 {
+		ch = append(ch, Duplicates{
+			DB:        db,
+			Window:    time.Duration(cfg.DuplicateWindowHours * float64(time.Hour)),
+			MinLength: cfg.DuplicateMinLength,
+		})
+	}
+	if cfg.Threshold > 0 {
+		ch = append(ch, Classifier{DB: db, Threshold: cfg.Threshold, MinTraining: cfg.MinTraining})
+	}
+	return ch, nil
+}
+
+// Blocklist задерживает тексты с запрещёнными словами и шаблонами
+type Blocklist struct {
+	rules []blockRule
+}
+
+type blockRule struct {
+	re     *regexp.Regexp
+	reason string
+}
+
+// NewBlocklist собирает список. Слова и фразы ищутся без учёта регистра
+// целыми словами, пробелы во фразе совпадают с любыми пробелами;
+// шаблоны — регулярные выражения как есть.
+func NewBlocklist(words, patterns []string) (*Blocklist, error) {
+	b := &Blocklist{}
+	for _, word := range words {
+		parts := strings.Fields(word)
+		if len(parts) == 0 {
+			continue
+		}
+		for i, part := range parts {
+			parts[i] = regexp.QuoteMeta(part)
+		}
+		re := regexp.MustCompile(`(?i)(?:^|[^\pL\pN_])` + strings.Join(parts, `\s+`) + `(?:$|[^\pL\pN_])`)
+		b.rules = append(b.rules, blockRule{re: re, reason: "Запрещённое слово «" + strings.Join(strings.Fields(word), " ") + "»"})
+	}
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("шаблон спама %q: %w", pattern, err)
+		}
+		b.rules = append(b.rules, blockRule{re: re, reason: "Совпадение с шаблоном " + pattern})
+	}
+	return b, nil
+}
+
+func (b *Blocklist) Check(c Content) (*Flag, error) {
+	text := c.fullText()
+	for _, rule := range b.rules {
+		if rule.re.MatchString(text) {
+			return &Flag{Filter: "blocklist", Reason: rule.reason}, nil
+		}
+	}
+	return nil, nil
+}
+
+// LinkLimit ограничивает число ссылок у аккаунтов моложе Age. Аккаунт
+// с неизвестной датой регистрации считается старым.
+type LinkLimit struct {
+	Age time.Duration
+	Max int
+}
+
+func (l LinkLimit) Check(c Content) (*Flag, error) {
+	if c.Joined.IsZero() || c.At.Sub(c.Joined) >= l.Age {
+		return nil, nil
+	}
+	if n := CountLinks(c.fullText()); n > l.Max {
+		return &Flag{
+			Filter: "links",
+			Reason: fmt.Sprintf("Ссылок: %d, а аккаунтам младше %s можно не больше %d", n, days(l.Age), l.Max),
+		}, nil
+	}
+	return nil, nil
+}
+
+func days(d time.Duration) string {
+	return fmt.Sprintf("%g дн.", d.Hours()/24)
+}
+
+// Duplicates задерживает повтор поста или комментария, опубликованного
+// кем угодно за последние Window. Короткие тексты («+1», «согласен»)
+// повторяются честно и не сравниваются.
+type Duplicates struct {
+	DB        *sql.DB
+	Window    time.Duration
+	MinLength int
+}
+
+func (d Duplicates) Check(c Content) (*Flag, error) {
+	text := Normalize(c.Text)
+	if utf8.RuneCountInString(text) < d.MinLength {
+		return nil, nil
+	}
+	since := c.At.Add(-d.Window).UTC()
+	rows, err := d.DB.Query(`
+		SELECT 'post', id, content FROM posts WHERE created_at >= ?
+		UNION ALL
+		SELECT 'comment', id, content FROM comments WHERE created_at >= ?`, since, since)
+	if err != nil {
+		return nil, fmt.Errorf("поиск повторов: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var kind, content string
+		var id int
+		if err := rows.Scan(&kind, &id, &content); err != nil {
+			return nil, fmt.Errorf("поиск повторов: %w", err)
+		}
+		if Normalize(content) != text {
+			continue
+		}
+		what := "поста"
+		if kind == "comment" {
+			what = "комментария"
+		}
+		return &Flag{Filter: "duplicate", Reason: fmt.Sprintf("Повтор текста %s #%d", what, id)}, nil
+	}
+	return nil, rows.Err()
+}
+
+// linkPattern — ссылка в тексте или Markdown: со схемой или начиная с www.
+var linkPattern = regexp.MustCompile(`(?i)\b(?:https?://|www\.)[^\s<>()\[\]"']*`)
+
+// CountLinks — сколько ссылок в тексте
+func CountLinks(text string) int {
+	return len(linkPattern.FindAllStringIndex(text, -1))
+}
+
+// Normalize сводит текст к словам в нижнем регистре через пробел, чтобы
+// повтор не прятался за регистром, пунктуацией и переносами строк
+func Normalize(text string) string {
+	return strings.Join(words(text), " ")
+}
+
+func words(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
@@ -0,0 +1,201 @@
+package spam_test
+
+import (
+	"database/sql"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"forum/internal/config"
+	"forum/internal/spam"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func setupDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	db.SetMaxOpenConns(1)
+	_, err = db.Exec(`
+		CREATE TABLE posts (id INTEGER PRIMARY KEY, content TEXT, created_at DATETIME);
+		CREATE TABLE comments (id INTEGER PRIMARY KEY, content TEXT, created_at DATETIME);
+		CREATE TABLE spam_tokens (token TEXT PRIMARY KEY, spam INTEGER NOT NULL DEFAULT 0, ham INTEGER NOT NULL DEFAULT 0);
+		CREATE TABLE spam_corpus (label TEXT PRIMARY KEY, docs INTEGER NOT NULL DEFAULT 0);
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestBlocklist(t *testing.T) {
+	b, err := spam.NewBlocklist([]string{"Казино", "  быстрый   заработок "}, []string{`(?i)t\.me/\w+`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for text, want := range map[string]string{
+		"Лучшее КАЗИНО онлайн":            "Запрещённое слово «Казино»",
+		"казино!":                         "Запрещённое слово «Казино»",
+		"Быстрый\nзаработок без вложений": "Запрещённое слово «быстрый заработок»",
+		"пишите в T.me/bonus":             `Совпадение с шаблоном (?i)t\.me/\w+`,
+		"Казиношный сленг не в счёт":      "",
+		"Обычный разговор о футболе":      "",
+	} {
+		flag, err := b.Check(spam.Content{Text: text})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := ""
+		if flag != nil {
+			got = flag.Reason
+		}
+		if got != want {
+			t.Errorf("%q: got %q, want %q", text, got, want)
+		}
+	}
+	if flag, _ := b.Check(spam.Content{Title: "Казино", Text: "текст"}); flag == nil {
+		t.Error("title must be checked too")
+	}
+	if _, err := spam.NewBlocklist(nil, []string{"(("}); err == nil {
+		t.Error("invalid pattern must be an error")
+	}
+}
+
+func TestLinkLimit(t *testing.T) {
+	now := time.Date(2026, 5, 10, 12, 0, 0, 0, time.UTC)
+	l := spam.LinkLimit{Age: 72 * time.Hour, Max: 1}
+	text := "смотри https://a.example/x и www.b.example, а также [тут](http://c.example)"
+	if n := spam.CountLinks(text); n != 3 {
+		t.Fatalf("CountLinks = %d", n)
+	}
+
+	flag, _ := l.Check(spam.Content{Text: text, Joined: now.Add(-time.Hour), At: now})
+	if flag == nil || flag.Filter != "links" {
+		t.Errorf("new account with many links must be held: %+v", flag)
+	}
+	if flag, _ := l.Check(spam.Content{Text: "одна https://a.example", Joined: now.Add(-time.Hour), At: now}); flag != nil {
+		t.Error("one link is allowed")
+	}
+	if flag, _ := l.Check(spam.Content{Text: text, Joined: now.AddDate(0, 0, -4), At: now}); flag != nil {
+		t.Error("old accounts are not limited")
+	}
+	if flag, _ := l.Check(spam.Content{Text: text, At: now}); flag != nil {
+		t.Error("unknown registration date counts as old")
+	}
+}
+
+func TestDuplicates(t *testing.T) {
+	db := setupDB(t)
+	now := time.Now().UTC()
+	text := "Лучшие прогнозы на матчи, подписывайтесь на канал прямо сейчас"
+	db.Exec(`INSERT INTO comments (id, content, created_at) VALUES (7, ?, ?)`, text, now.Add(-time.Hour))
+	db.Exec(`INSERT INTO posts (id, content, created_at) VALUES (3, 'Старый текст, который давно никто не повторял бы', ?)`, now.AddDate(0, 0, -3))
+	d := spam.Duplicates{DB: db, Window: 24 * time.Hour, MinLength: 20}
+
+	flag, err := d.Check(spam.Content{Text: "ЛУЧШИЕ прогнозы на матчи —\nподписывайтесь на канал прямо сейчас!!!", At: now})
+	if err != nil || flag == nil || flag.Reason != "Повтор текста комментария #7" {
+		t.Errorf("repeat with other case and punctuation must be held: %+v %v", flag, err)
+	}
+	if flag, _ := d.Check(spam.Content{Text: "Старый текст, который давно никто не повторял бы", At: now}); flag != nil {
+		t.Error("texts outside the window are not compared")
+	}
+	db.Exec(`INSERT INTO comments (content, created_at) VALUES ('согласен', ?)`, now)
+	if flag, _ := d.Check(spam.Content{Text: "Согласен", At: now}); flag != nil {
+		t.Error("short texts are not compared")
+	}
+}
+
+func TestClassifier(t *testing.T) {
+	db := setupDB(t)
+	cl := spam.Classifier{DB: db, Threshold: 0.9, MinTraining: 3}
+
+	spamTexts := []string{
+		"Ставки на спорт, бонус 500% по ссылке https://bet.example/promo",
+		"Бонус новым игрокам, ставки без проигрыша: www.bet.example",
+		"Выигрывай на ставках! Бонус ждёт https://bet.example/vip",
+	}
+	hamTexts := []string{
+		"Отличный матч, защита сыграла надёжно",
+		"Кто смотрел финал? Судья ошибся с пенальти",
+		"Тренер зря поменял схему во втором тайме",
+	}
+	for i, text := range spamTexts {
+		if err := spam.Train(db, text, true); err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			if _, ok, _ := cl.Probability("бонус на ставки"); ok {
+				t.Error("untrained classifier must stay silent")
+			}
+		}
+	}
+	for _, text := range hamTexts {
+		if err := spam.Train(db, text, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p, ok, err := cl.Probability("Бонус на ставки тут https://www.bet.example/new")
+	if err != nil || !ok || p < 0.9 {
+		t.Errorf("spammy text: p = %v, ok = %v, %v", p, ok, err)
+	}
+	flag, _ := cl.Check(spam.Content{Text: "Бонус на ставки тут https://www.bet.example/new"})
+	if flag == nil || flag.Filter != "bayes" || math.Abs(flag.Score-p) > 1e-9 {
+		t.Errorf("spammy text must be held with its score: %+v", flag)
+	}
+	if p, _, _ := cl.Probability("Судья ошибся, защита сыграла плохо"); p > 0.5 {
+		t.Errorf("ordinary text: p = %v", p)
+	}
+	if p, ok, _ := cl.Probability("совершенно незнакомые слова"); !ok || p != 0.5 {
+		t.Errorf("unknown words must be neutral: p = %v", p)
+	}
+}
+
+func TestTokens(t *testing.T) {
+	got := strings.Join(spam.Tokens("Смотри, СМОТРИ: https://WWW.Bet.example:8080/path?x=1 и я"), " ")
+	if got != "link:bet.example смотри" {
+		t.Errorf("Tokens = %q", got)
+	}
+}
+
+type stubFilter struct {
+	flag *spam.Flag
+	err  error
+}
+
+func (s stubFilter) Check(spam.Content) (*spam.Flag, error) { return s.flag, s.err }
+
+func TestChain(t *testing.T) {
+	broken := stubFilter{err: errors.New("нет таблицы")}
+	first := stubFilter{flag: &spam.Flag{Filter: "first"}}
+	second := stubFilter{flag: &spam.Flag{Filter: "second"}}
+
+	if flag, err := (spam.Chain{broken, first, second}).Check(spam.Content{}); err != nil || flag.Filter != "first" {
+		t.Errorf("first flag wins over errors: %+v %v", flag, err)
+	}
+	if flag, err := (spam.Chain{stubFilter{}, broken}).Check(spam.Content{}); flag != nil || err == nil {
+		t.Errorf("error must surface when nothing flagged: %+v %v", flag, err)
+	}
+	if flag, err := (spam.Chain(nil)).Check(spam.Content{Text: "что угодно"}); flag != nil || err != nil {
+		t.Error("empty chain passes everything")
+	}
+
+	cfg := config.Default().Spam
+	if ch, err := spam.NewChain(nil, cfg); err != nil || len(ch) != 3 {
+		t.Errorf("defaults: links, duplicates and classifier, got %d filters, %v", len(ch), err)
+	}
+	cfg.BlockedWords = []string{"казино"}
+	cfg.NewAccountDays, cfg.DuplicateWindowHours, cfg.Threshold = 0, 0, 0
+	if ch, _ := spam.NewChain(nil, cfg); len(ch) != 1 {
+		t.Errorf("disabled filters must be left out, got %d", len(ch))
+	}
+	cfg.BlockedPatterns = []string{"[a-"}
+	if _, err := spam.NewChain(nil, cfg); err == nil {
+		t.Error("invalid pattern must fail the chain")
+	}
+}
@@ -38,10 +38,691 @@ function initSearch() {
     });
 }
 
+// === Кнопки, отправляющие форму на сервер в обход клиентского поиска ===
+// (вместо inline onclick, который запрещён CSP)
+function initSubmitButtons() {
+    document.querySelectorAll('[data-submit-form]').forEach(btn => {
+        btn.addEventListener('click', () => {
+            const form = document.getElementById(btn.dataset.submitForm);
+            if (form) form.submit();
+        });
+    });
+}
+
+// === Предпросмотр Markdown в форме создания поста ===
+function initPreview() {
+    document.querySelectorAll('[data-preview]').forEach(btn => {
+        btn.addEventListener('click', async () => {
+            const form = btn.closest('form');
+            const target = document.getElementById(btn.dataset.preview);
+            if (!form || !target) return;
+
+            const body = new FormData();
+            body.append('content', form.elements['content'].value);
+            const resp = await fetch('/preview', {
+                method: 'POST',
+                body,
+                headers: { 'X-CSRF-Token': form.elements['csrf_token']?.value || '' },
+            });
+            // Ответ сервера уже очищен санитайзером
+            target.innerHTML = resp.ok ? await resp.text() : '<p class="text-danger">Не удалось построить предпросмотр</p>';
+            target.hidden = false;
+        });
+    });
+}
+
+// === Автосохранение формы поста в черновик ===
+function initAutosave() {
+    const form = document.querySelector('form[data-autosave]');
+    if (!form) return;
+    const status = form.querySelector('.autosave-status');
+    let pending;
+
+    const save = async () => {
+        const body = new FormData(form);
+        // Изображения уходят на сервер только с самой формой
+        body.delete('images');
+        const resp = await fetch('/drafts/autosave', {
+            method: 'POST',
+            body,
+            headers: { 'Accept': 'application/json', 'X-CSRF-Token': form.elements['csrf_token']?.value || '' },
+        }).catch(() => null);
+        const data = await resp?.json().catch(() => null);
+        if (!resp?.ok) {
+            status.textContent = data?.error || 'Не удалось сохранить черновик';
+            return;
+        }
+        if (data.id) {
+            form.elements['draft_id'].value = data.id;
+            status.textContent = 'Черновик сохранён в ' + data.saved_at;
+        }
+    };
+
+    const schedule = () => {
+        clearTimeout(pending);
+        pending = setTimeout(save, 3000);
+    };
+    form.addEventListener('input', schedule);
+    form.addEventListener('change', schedule);
+    form.addEventListener('submit', () => clearTimeout(pending));
+}
+
+// === Обновление итогов открытых опросов без перезагрузки ===
+function initPolls() {
+    document.querySelectorAll('.poll[data-live]').forEach(poll => {
+        const refresh = async () => {
+            const resp = await fetch('/poll/results?post=' + poll.dataset.pollPost);
+            if (!resp.ok) return;
+            const data = await resp.json();
+            poll.querySelector('.poll-voters').textContent = data.voters;
+            data.options.forEach(o => {
+                const row = poll.querySelector('[data-option="' + o.id + '"]');
+                if (!row) return;
+                row.querySelector('.poll-count').textContent = o.votes + ' (' + o.percent + '%)';
+                row.querySelector('.progress-bar').style.width = o.percent + '%';
+            });
+            if (data.closed) clearInterval(timer);
+        };
+        const timer = setInterval(refresh, 15000);
+    });
+}
+
+// === Автодополнение тегов в форме поста ===
+function initTagSuggest() {
+    document.querySelectorAll('[data-tag-input]').forEach(input => {
+        const list = input.closest('.position-relative').querySelector('.tag-suggestions');
+        let pending;
+
+        // Дополняется последний тег в списке через запятую
+        const replaceLast = name => {
+            const parts = input.value.split(',');
+            parts[parts.length - 1] = ' ' + name;
+            input.value = parts.join(',').replace(/^ /, '') + ', ';
+            list.hidden = true;
+            input.focus();
+        };
+
+        input.addEventListener('input', () => {
+            clearTimeout(pending);
+            const last = input.value.split(',').pop().trim();
+            if (!last) {
+                list.hidden = true;
+                return;
+            }
+            pending = setTimeout(async () => {
+                const resp = await fetch('/tags/suggest?q=' + encodeURIComponent(last));
+                if (!resp.ok) return;
+                const names = await resp.json();
+                list.replaceChildren(...names.map(name => {
+                    const item = document.createElement('button');
+                    item.type = 'button';
+                    item.className = 'list-group-item list-group-item-action';
+                    item.textContent = '#' + name;
+                    item.addEventListener('click', () => replaceLast(name));
+                    return item;
+                }));
+                list.hidden = names.length === 0;
+            }, 200);
+        });
+        input.addEventListener('blur', () => setTimeout(() => { list.hidden = true; }, 200));
+    });
+}
+
+// === Автодополнение @упоминаний в текстах ===
+function initMentionSuggest() {
+    document.querySelectorAll('[data-mention-input]').forEach(input => {
+        const list = input.closest('.position-relative').querySelector('.mention-suggestions');
+        let pending;
+
+        // Незаконченное упоминание перед курсором: "@spo"
+        const current = () => {
+            const before = input.value.slice(0, input.selectionStart);
+            const m = before.match(/(^|[^\w@.\/])@(\w{1,20})$/);
+            return m ? { prefix: m[2], start: before.length - m[2].length } : null;
+        };
+
+        const complete = (name, start) => {
+            const end = input.selectionStart;
+            input.value = input.value.slice(0, start) + name + ' ' + input.value.slice(end);
+            input.selectionStart = input.selectionEnd = start + name.length + 1;
+            list.hidden = true;
+            input.focus();
+        };
+
+        input.addEventListener('input', () => {
+            clearTimeout(pending);
+            const mention = current();
+            if (!mention) {
+                list.hidden = true;
+                return;
+            }
+            pending = setTimeout(async () => {
+                const resp = await fetch('/users/suggest?q=' + encodeURIComponent(mention.prefix));
+                if (!resp.ok) return;
+                const names = await resp.json();
+                list.replaceChildren(...names.map(name => {
+                    const item = document.createElement('button');
+                    item.type = 'button';
+                    item.className = 'list-group-item list-group-item-action';
+                    item.textContent = '@' + name;
+                    item.addEventListener('click', () => complete(name, mention.start));
+                    return item;
+                }));
+                list.hidden = names.length === 0;
+            }, 200);
+        });
+        input.addEventListener('blur', () => setTimeout(() => { list.hidden = true; }, 200));
+    });
+}
+
+// === Ответ на комментарий ===
+function initReplies() {
+    const form = document.getElementById('comment-form');
+    if (!form) return;
+    const parent = form.querySelector('[name="parent_id"]');
+    const banner = form.querySelector('.reply-to');
+
+    // Делегирование: комментарии, пришедшие по SSE, тоже получают кнопку
+    document.addEventListener('click', e => {
+        const btn = e.target.closest('[data-reply]');
+        if (!btn) return;
+        parent.value = btn.dataset.reply;
+        banner.querySelector('.reply-author').textContent = btn.dataset.replyAuthor;
+        banner.hidden = false;
+        form.querySelector('textarea').focus();
+    });
+    form.querySelector('[data-reply-cancel]').addEventListener('click', () => {
+        parent.value = '';
+        banner.hidden = true;
+    });
+}
+
+// === Реакции без перезагрузки страницы ===
+// Без JavaScript форма отправляется обычным POST, и сервер возвращает на страницу
+function setReaction(type, id, reaction) {
+    document.querySelectorAll('[data-reactions="' + type + '-' + id + '"] [data-reaction]').forEach(btn => {
+        const active = btn.dataset.reaction === reaction;
+        const color = btn.dataset.reaction === 'dislike' ? 'danger' : 'primary';
+        btn.classList.toggle('btn-' + color, active);
+        btn.classList.toggle('btn-outline-' + color, !active);
+        btn.setAttribute('aria-pressed', active);
+    });
+}
+
+function initLikes() {
+    // Делегирование: формы комментариев, пришедших по SSE, тоже перехватываются
+    document.addEventListener('submit', async e => {
+        const form = e.target;
+        if (form.getAttribute('action') !== '/like') return;
+        e.preventDefault();
+        const button = form.querySelector('button');
+        button.disabled = true;
+        try {
+            const resp = await fetch('/like', {
+                method: 'POST',
+                body: new URLSearchParams(new FormData(form)),
+                headers: {
+                    'Accept': 'application/json',
+                    'X-CSRF-Token': form.elements['csrf_token']?.value || '',
+                },
+            });
+            const data = await resp.json();
+            if (!resp.ok) {
+                alert(data.error);
+                return;
+            }
+            updateReactions(data);
+            setReaction(data.type, data.id, data.reaction);
+        } catch {
+            // Ответ не JSON (например, страница ошибки) — отправляем форму как обычно
+            form.submit();
+        } finally {
+            button.disabled = false;
+        }
+    });
+
+    // «Кто отреагировал»: список раскрывается под кнопками, без JavaScript
+    // ссылка ведёт на отдельную страницу
+    document.addEventListener('click', async e => {
+        const link = e.target.closest('[data-who-reacted]');
+        if (!link) return;
+        e.preventDefault();
+        const box = link.parentElement.querySelector('.who-reacted');
+        if (!box.hidden) {
+            box.hidden = true;
+            return;
+        }
+        try {
+            const resp = await fetch(link.href, { headers: { 'Accept': 'application/json' } });
+            const data = await resp.json();
+            if (!resp.ok) throw new Error(data.error);
+            box.replaceChildren(...data.reactions.map(g => {
+                const row = document.createElement('div');
+                row.append(g.emoji + ' ');
+                g.users.forEach((name, i) => {
+                    if (i) row.append(', ');
+                    const a = document.createElement('a');
+                    a.href = '/u/' + encodeURIComponent(name);
+                    a.textContent = name;
+                    row.append(a);
+                });
+                if (g.more) row.append(' и ещё ' + g.more);
+                return row;
+            }));
+            if (!data.reactions.length) box.textContent = 'Реакций пока нет.';
+            box.hidden = false;
+        } catch {
+            location.href = link.href;
+        }
+    });
+}
+
+// === Закладки ===
+// Кнопка-переключатель меняет вид на месте; без JavaScript форма
+// отправляется обычным POST с возвратом на страницу
+function setBookmark(button, saved) {
+    button.classList.toggle('btn-warning', saved);
+    button.classList.toggle('btn-outline-secondary', !saved);
+    button.setAttribute('aria-pressed', saved);
+    button.title = saved ? 'Убрать из закладок' : 'Сохранить в закладки';
+    button.querySelector('.bookmark-label').textContent = saved ? 'Сохранено' : 'Сохранить';
+}
+
+function initBookmarks() {
+    document.addEventListener('submit', async e => {
+        const form = e.target;
+        if (!form.matches('form[data-bookmark]')) return;
+        e.preventDefault();
+        const button = form.querySelector('button');
+        button.disabled = true;
+        try {
+            const resp = await fetch('/bookmark', {
+                method: 'POST',
+                body: new URLSearchParams(new FormData(form)),
+                headers: {
+                    'Accept': 'application/json',
+                    'X-CSRF-Token': form.elements['csrf_token']?.value || '',
+                },
+            });
+            const data = await resp.json();
+            if (!resp.ok) {
+                alert(data.error);
+                return;
+            }
+            setBookmark(button, data.saved);
+        } catch {
+            form.submit();
+        } finally {
+            button.disabled = false;
+        }
+    });
+}
+
+// === Обновления в реальном времени (Server-Sent Events) ===
+// Браузер сам переподключается после обрыва и присылает Last-Event-ID,
+// а сервер досылает пропущенные события.
+function subscribe(url, lastEventId, handlers) {
+    if (!window.EventSource) return;
+    const source = new EventSource(url + '?last_event_id=' + encodeURIComponent(lastEventId || ''));
+    Object.entries(handlers).forEach(([type, handle]) => {
+        source.addEventListener(type, e => handle(JSON.parse(e.data)));
+    });
+    // Пропущенное уже не восстановить — проще перезагрузить страницу
+    source.addEventListener('reset', () => {
+        source.close();
+        location.reload();
+    });
+}
+
+function updateReactions(data) {
+    document.querySelectorAll('[data-reactions="' + data.type + '-' + data.id + '"]').forEach(el => {
+        el.querySelectorAll('[data-count]').forEach(span => {
+            const n = data.counts[span.dataset.count] || 0;
+            span.textContent = n;
+            // В ленте показываются только реакции, которые кто-то поставил
+            const badge = span.closest('[data-hide-empty]');
+            if (badge) badge.hidden = n === 0;
+        });
+        const box = el.querySelector('.who-reacted');
+        if (box) box.hidden = true;
+    });
+}
+
+function initLivePost() {
+    const list = document.getElementById('comments');
+    const tmpl = document.getElementById('comment-template');
+    if (!list || !tmpl) return;
+
+    const muted = JSON.parse(list.dataset.muted || '[]');
+
+    subscribe('/events/post/' + list.dataset.livePost, list.dataset.lastEventId, {
+        reaction: updateReactions,
+        comment: c => {
+            if (document.getElementById('comment-' + c.id)) return;
+            // Комментарии заглушённых не показываются и вживую
+            if (muted.includes(c.author)) return;
+            const el = tmpl.content.firstElementChild.cloneNode(true);
+            el.id = 'comment-' + c.id;
+            const author = el.querySelector('.comment-author');
+            author.textContent = c.author;
+            author.href = '/u/' + encodeURIComponent(c.author);
+            el.querySelector('.comment-reputation').textContent = '★ ' + c.reputation;
+            el.querySelector('.comment-date').textContent = c.created_at;
+            if (c.parent_id) {
+                const parent = el.querySelector('.comment-parent');
+                parent.href = '#comment-' + c.parent_id;
+                parent.querySelector('.comment-parent-author').textContent = c.parent_author;
+                parent.hidden = false;
+            }
+            // HTML уже очищен санитайзером на сервере
+            el.querySelector('.markdown-body').innerHTML = c.html;
+            el.querySelector('[data-reactions]').dataset.reactions = 'comment-' + c.id;
+            el.querySelectorAll('input[name="id"]').forEach(input => { input.value = c.id; });
+            el.querySelector('[data-who-reacted]').href = '/reactions?type=comment&id=' + c.id;
+            const reply = el.querySelector('[data-reply]');
+            if (reply) {
+                reply.dataset.reply = c.id;
+                reply.dataset.replyAuthor = c.author;
+            }
+            list.querySelector('.no-comments')?.remove();
+            list.appendChild(el);
+        },
+    });
+}
+
+function initLiveFeed() {
+    const feed = document.getElementById('feed');
+    if (!feed) return;
+    const tmpl = document.getElementById('post-card-template');
+    const banner = document.querySelector('.live-banner');
+    const muted = JSON.parse(feed.dataset.muted || '[]');
+    let missed = 0;
+
+    subscribe('/events/feed', feed.dataset.lastEventId, {
+        reaction: updateReactions,
+        post: p => {
+            if (muted.includes(p.author)) return;
+            if (!('liveInsert' in feed.dataset)) {
+                // Лента отфильтрована — новый пост может в неё не входить
+                missed++;
+                banner.querySelector('.live-count').textContent = missed;
+                banner.hidden = false;
+                return;
+            }
+            const card = tmpl.content.firstElementChild.cloneNode(true);
+            card.dataset.title = p.title;
+            card.dataset.content = p.content;
+            card.querySelectorAll('.post-link, .post-link-more').forEach(a => { a.href = '/post/' + p.id; });
+            card.querySelector('.post-link').textContent = p.title;
+            card.querySelector('.post-categories').replaceChildren(...p.categories.map(c => {
+                const badge = document.createElement('a');
+                badge.className = 'badge bg-secondary category-badge text-decoration-none me-1';
+                badge.href = '/c/' + c.slug;
+                badge.textContent = c.name;
+                return badge;
+            }));
+            card.querySelector('.post-date').textContent = p.created_at;
+            const author = card.querySelector('.post-author');
+            author.textContent = p.author;
+            author.href = '/u/' + encodeURIComponent(p.author);
+            card.querySelector('.post-reputation').textContent = '★ ' + p.reputation;
+            card.querySelector('.post-content').textContent = p.content;
+            card.querySelector('[data-reactions]').dataset.reactions = 'post-' + p.id;
+            card.querySelectorAll('input[name="id"]').forEach(input => { input.value = p.id; });
+            document.querySelector('.no-posts')?.remove();
+            feed.prepend(card);
+        },
+    });
+}
+
+// === Личные сообщения (SSE) ===
+function initMessages() {
+    const box = document.querySelector('[data-messages]');
+    if (!box) return;
+    const conversation = Number(box.dataset.conversation || 0);
+    const tmpl = document.getElementById('message-template');
+    const csrf = document.querySelector('input[name="csrf_token"]')?.value || '';
+
+    // Отметка о прочтении у своих сообщений
+    const receipt = el => {
+        const readBy = el.dataset.readBy ? el.dataset.readBy.split(',') : [];
+        if (!readBy.length) return '✓ отправлено';
+        return box.dataset.group === 'true' ? '✓✓ прочитали: ' + readBy.join(', ') : '✓✓ прочитано';
+    };
+
+    subscribe('/events/messages', box.dataset.lastEventId, {
+        message: m => {
+            if (m.conversation_id !== conversation) {
+                // Во входящих обновляем строку переписки, на других страницах — счётчик
+                const row = document.querySelector('[data-conversation-row="' + m.conversation_id + '"]');
+                if (!row) {
+                    if (!conversation) location.reload();
+                    return;
+                }
+                row.querySelector('.conversation-preview').textContent = m.author + ': ' + m.content;
+                row.querySelector('.conversation-date').textContent = m.created_at;
+                const unread = row.querySelector('.unread');
+                unread.textContent = Number(unread.textContent || 0) + 1;
+                unread.hidden = false;
+                row.classList.add('fw-semibold');
+                row.parentElement.prepend(row);
+                return;
+            }
+            if (!tmpl || document.getElementById('message-' + m.id)) return;
+            const el = tmpl.content.firstElementChild.cloneNode(true);
+            el.id = 'message-' + m.id;
+            el.dataset.messageId = m.id;
+            el.querySelector('.message-author').textContent = m.author;
+            el.querySelector('.message-date').textContent = m.created_at;
+            // Текст обычный: textContent не даёт вставить разметку
+            el.querySelector('.message-content').textContent = m.content;
+            box.querySelector('.no-messages')?.remove();
+            box.appendChild(el);
+            el.scrollIntoView({ block: 'nearest' });
+            // Сообщение видно — сообщаем собеседникам, что оно прочитано
+            fetch('/messages/read', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/x-www-form-urlencoded', 'X-CSRF-Token': csrf },
+                body: new URLSearchParams({ conversation_id: conversation, csrf_token: csrf }),
+            });
+        },
+        read: r => {
+            if (r.conversation_id !== conversation) return;
+            box.querySelectorAll('.read-receipt').forEach(el => {
+                const id = Number(el.closest('[data-message-id]').dataset.messageId);
+                const readBy = el.dataset.readBy ? el.dataset.readBy.split(',') : [];
+                if (id > r.last_read_id || readBy.includes(r.user)) return;
+                readBy.push(r.user);
+                el.dataset.readBy = readBy.join(',');
+                el.textContent = receipt(el);
+            });
+        },
+    });
+}
+
+// === Живой чат категории (WebSocket) ===
+function initChat() {
+    const room = document.querySelector('[data-chat]');
+    if (!room || !window.WebSocket) return;
+    const log = room.querySelector('.chat-log');
+    const list = room.querySelector('.chat-messages');
+    const more = room.querySelector('.chat-more');
+    const status = room.querySelector('.chat-status');
+    const form = room.querySelector('.chat-form');
+    const presence = room.querySelector('.chat-presence');
+    const messageTmpl = document.getElementById('chat-message-template');
+    const memberTmpl = document.getElementById('chat-member-template');
+    const userId = Number(room.dataset.userId);
+    let socket;
+    let delay = 1000;
+    let oldest = 0;
+    let stopped = false;
+
+    const time = iso => new Date(iso).toLocaleTimeString([], { hour: '2-digit', minute: '2-digit' });
+
+    const render = m => {
+        const el = messageTmpl.content.firstElementChild.cloneNode(true);
+        el.dataset.id = m.id;
+        el.querySelector('.chat-time').textContent = time(m.created_at);
+        const author = el.querySelector('.chat-author');
+        author.textContent = m.author;
+        author.href = '/u/' + encodeURIComponent(m.author);
+        el.querySelector('.chat-text').textContent = m.text;
+        return el;
+    };
+
+    const system = text => {
+        const el = document.createElement('div');
+        el.className = 'chat-message chat-system';
+        el.textContent = text;
+        list.appendChild(el);
+        log.scrollTop = log.scrollHeight;
+    };
+
+    const handlers = {
+        history: ev => {
+            const messages = (ev.messages || []).filter(m => !list.querySelector('[data-id="' + m.id + '"]'));
+            if (oldest === 0) {
+                // Первая порция после (пере)подключения — заменяет показанное
+                list.replaceChildren(...messages.map(render));
+                log.scrollTop = log.scrollHeight;
+            } else {
+                const height = log.scrollHeight;
+                list.prepend(...messages.map(render));
+                log.scrollTop += log.scrollHeight - height;
+            }
+            if (messages.length) oldest = messages[0].id;
+            more.hidden = !ev.more;
+        },
+        message: ev => {
+            // Одновременные сообщения сервер может разослать не по порядку,
+            // а только что вошедшему — прислать и в истории, и отдельно
+            if (list.querySelector('[data-id="' + ev.message.id + '"]')) return;
+            const stick = log.scrollTop + log.clientHeight >= log.scrollHeight - 20;
+            const later = [...list.querySelectorAll('[data-id]')].find(el => Number(el.dataset.id) > ev.message.id);
+            list.insertBefore(render(ev.message), later || null);
+            if (stick || ev.message.user_id === userId) log.scrollTop = log.scrollHeight;
+        },
+        presence: ev => {
+            presence.replaceChildren(...(ev.users || []).map(u => {
+                const el = memberTmpl.content.firstElementChild.cloneNode(true);
+                const name = el.querySelector('.chat-member-name');
+                name.textContent = u.name + (u.moderator ? ' 🛡️' : '');
+                name.href = '/u/' + encodeURIComponent(u.name);
+                el.querySelectorAll('[data-chat-action]').forEach(btn => {
+                    btn.dataset.userId = u.id;
+                    btn.hidden = u.id === userId || u.moderator;
+                });
+                return el;
+            }));
+        },
+        system: ev => system(ev.text),
+        error: ev => system('⚠️ ' + ev.text),
+        muted: ev => {
+            form.elements['text'].disabled = !!ev.until;
+            if (ev.until) system('Модератор запретил вам писать до ' + time(ev.until));
+        },
+        kicked: ev => {
+            stopped = true;
+            system('Модератор удалил вас из комнаты до ' + time(ev.until));
+        },
+    };
+
+    const connect = () => {
+        const scheme = location.protocol === 'https:' ? 'wss://' : 'ws://';
+        socket = new WebSocket(scheme + location.host + '/ws/chat/' + encodeURIComponent(room.dataset.chat));
+        socket.addEventListener('open', () => {
+            delay = 1000;
+            oldest = 0;
+            status.textContent = 'В сети';
+        });
+        socket.addEventListener('message', e => {
+            const ev = JSON.parse(e.data);
+            handlers[ev.type]?.(ev);
+        });
+        socket.addEventListener('close', e => {
+            // 4001 — удалён модератором, переподключаться бессмысленно
+            if (stopped || e.code === 4001) {
+                status.textContent = 'Отключено';
+                form.elements['text'].disabled = true;
+                return;
+            }
+            status.textContent = 'Нет связи, переподключение…';
+            setTimeout(connect, delay);
+            delay = Math.min(delay * 2, 30000);
+        });
+    };
+
+    const send = cmd => {
+        if (socket?.readyState === WebSocket.OPEN) socket.send(JSON.stringify(cmd));
+    };
+
+    form.addEventListener('submit', e => {
+        e.preventDefault();
+        const input = form.elements['text'];
+        if (!input.value.trim()) return;
+        send({ type: 'message', text: input.value });
+        input.value = '';
+    });
+    more.addEventListener('click', () => send({ type: 'history', before: oldest }));
+    presence.addEventListener('click', e => {
+        const btn = e.target.closest('[data-chat-action]');
+        if (btn) send({ type: btn.dataset.chatAction, user_id: Number(btn.dataset.userId), minutes: 10 });
+    });
+
+    connect();
+}
+
+// === Время публикации в часовом поясе браузера ===
+// Сервер читает publish_at со смещением из tz_offset, а запланированное
+// время показывает по своим часам — здесь оно переводится в местное.
+function initLocalTimes() {
+    const pad = n => String(n).padStart(2, '0');
+    document.querySelectorAll('time[data-local-time]').forEach(el => {
+        const d = new Date(el.dateTime);
+        el.textContent = pad(d.getDate()) + '.' + pad(d.getMonth() + 1) + '.' + d.getFullYear() +
+            ' ' + pad(d.getHours()) + ':' + pad(d.getMinutes());
+    });
+
+    const input = document.querySelector('input[name="publish_at"]');
+    const offset = input?.form.elements['tz_offset'];
+    if (!offset) return;
+    // Время из черновика заполнено в поясе сервера: переводим в местное
+    if (input.value && offset.value !== '') {
+        const [date, clock] = input.value.split('T');
+        const [y, m, d] = date.split('-').map(Number);
+        const [hh, mm] = clock.split(':').map(Number);
+        const at = new Date(Date.UTC(y, m - 1, d, hh, mm) + Number(offset.value) * 60000);
+        input.value = at.getFullYear() + '-' + pad(at.getMonth() + 1) + '-' + pad(at.getDate()) +
+            'T' + pad(at.getHours()) + ':' + pad(at.getMinutes());
+    }
+    // Смещение берётся на выбранную дату: летнее время может отличаться
+    const update = () => {
+        offset.value = input.value ? new Date(input.value).getTimezoneOffset() : new Date().getTimezoneOffset();
+    };
+    update();
+    input.addEventListener('change', update);
+    input.form.addEventListener('submit', update);
+}
+
 // === Инициализация после загрузки ===
 function init() {
     initTheme();
     initSearch();
+    initSubmitButtons();
+    initPreview();
+    initAutosave();
+    initLocalTimes();
+    initPolls();
+    initTagSuggest();
+    initMentionSuggest();
+    initReplies();
+    initLikes();
+    initBookmarks();
+    initLivePost();
+    initLiveFeed();
+    initMessages();
+    initChat();
 }
 
 if (document.readyState !== 'loading') {
@@ -50,11 +731,9 @@ if (document.readyState !== 'loading') {
     document.addEventListener('DOMContentLoaded', init);
 }
 
-document.addEventListener('DOMContentLoaded', () => {
-    document.querySelectorAll('.show-login-popup').forEach(btn => {
-      btn.addEventListener('click', () => {
-        const modal = new bootstrap.Modal(document.getElementById('loginModal'));
-        modal.show();
-      });
-    });
-  });
+// Делегирование, чтобы кнопки в карточках и комментариях, добавленных по SSE, тоже работали
+document.addEventListener('click', e => {
+    if (!e.target.closest('.show-login-popup')) return;
+    const modal = new bootstrap.Modal(document.getElementById('loginModal'));
+    modal.show();
+});